@@ -16,10 +16,21 @@ import (
 	*  ENCRYPTION SUPPORT:
 	*		Include what you want to use here, then perform the registration below
 	 */
+	"github.com/cgentry/gus/library/encryption/drivers/argon2id"
 	"github.com/cgentry/gus/library/encryption/drivers/bcrypt"
+	"github.com/cgentry/gus/library/encryption/drivers/pbkdf2"
+	"github.com/cgentry/gus/library/encryption/drivers/scrypt"
 	"github.com/cgentry/gus/library/encryption/drivers/sha512"
 	/* REMOVE WHEN IN PRODUCTION */
 	"github.com/cgentry/gus/library/encryption/drivers/plaintext"
+
+	/*
+	*  NOTIFY SUPPORT:
+	*		Include what you want to use here, then perform the registration below
+	 */
+	"github.com/cgentry/gus/library/notify/drivers/file"
+	"github.com/cgentry/gus/library/notify/drivers/smtp"
+	"github.com/cgentry/gus/library/notify/drivers/webhook"
 )
 
 // DefaultConfigFilename is where you will find the configuration file for GUS
@@ -37,6 +48,14 @@ func init() {
 
 	/* ENCRYPTION SUPPORT */
 	bcrypt.Register()
+	argon2id.Register()
+	scrypt.Register()
+	pbkdf2.Register()
 	sha512.Register()
 	plaintext.Register()
+
+	/* NOTIFY SUPPORT */
+	file.Register()
+	smtp.Register()
+	webhook.Register()
 }
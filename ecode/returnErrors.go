@@ -48,6 +48,36 @@ func (s *GeneralError) Error() string { return s.Message }
 // return the error integer.
 func (s *GeneralError) Code() int { return s.ReturnCode }
 
+/* ------------------------------------------------------------------------------------ */
+
+// The RetryErrorCoder is an ErrorCoder that can also tell the caller how long, in seconds,
+// they should wait before trying the request again.
+type RetryErrorCoder interface {
+	ErrorCoder
+	RetryAfter() int
+}
+
+// RetryError holds a general error and the number of seconds before a retry may succeed.
+// A value of zero means no estimate can be given.
+type RetryError struct {
+	GeneralError
+	Retry int
+}
+
+// Create a new RetryError from an existing error code and the seconds to wait
+func NewRetryError(e ErrorCoder, seconds int) RetryErrorCoder {
+	if seconds < 0 {
+		seconds = 0
+	}
+	return &RetryError{
+		GeneralError: GeneralError{Message: e.Error(), ReturnCode: e.Code()},
+		Retry:        seconds,
+	}
+}
+
+// Return the number of seconds the caller should wait before retrying
+func (s *RetryError) RetryAfter() int { return s.Retry }
+
 var ErrBadPackage = NewGeneralError("Package: Bad format", http.StatusBadRequest)
 var ErrBadBody = NewGeneralError("Package: Cannot unarshal body", http.StatusBadRequest)
 
@@ -64,19 +94,78 @@ var ErrMissingLogin = NewGeneralError("Request: Missing login", http.StatusBadRe
 var ErrMissingName = NewGeneralError("Request: Missing Name", http.StatusBadRequest)
 var ErrMissingPassword = NewGeneralError("Request: Missing Password", http.StatusBadRequest)
 var ErrMissingToken = NewGeneralError("Request: Missing token", http.StatusBadRequest)
+var ErrMissingCode = NewGeneralError("Request: Missing code", http.StatusBadRequest)
 var ErrMissingEmail = NewGeneralError("Request: Missing Email", http.StatusBadRequest)
 var ErrMissingPasswordNew = NewGeneralError("Request: Missing New Password", http.StatusBadRequest)
+var ErrMissingPermission = NewGeneralError("Request: Missing permission", http.StatusBadRequest)
+var ErrMissingUser = NewGeneralError("Request: Missing user", http.StatusBadRequest)
+var ErrMissingDomain = NewGeneralError("Request: Missing domain", http.StatusBadRequest)
 var ErrMatchingPassword = NewGeneralError("Request: Old and new passwords match", http.StatusBadRequest)
 var ErrPasswordTooShort = NewGeneralError("Request: Password is too short", http.StatusBadRequest)
 
 var ErrSessionExpired = NewGeneralError("User session expired", http.StatusUnauthorized)
-var ErrPasswordTooSimple = NewGeneralError("Password is too simple", http.StatusBadRequest)
+var ErrRefreshInvalid = NewGeneralError("Invalid or expired refresh token", http.StatusUnauthorized)
+var ErrRefreshReused = NewGeneralError("Refresh token already used: the login has been ended", http.StatusUnauthorized)
+var ErrPasswordTooSimple = NewGeneralError("Password is too simple: it is a common password", http.StatusBadRequest)
+var ErrPasswordTooLong = NewGeneralError("Password is too long", http.StatusBadRequest)
+var ErrPasswordClasses = NewGeneralError("Password needs more types of characters (lower case, upper case, digits, symbols)", http.StatusBadRequest)
+var ErrPasswordUserInfo = NewGeneralError("Password must not contain the login name or email address", http.StatusBadRequest)
+var ErrPasswordTooWeak = NewGeneralError("Password is too easy to guess", http.StatusBadRequest)
+
+var ErrTicketInvalid = NewGeneralError("Invalid ticket", http.StatusUnauthorized)
+var ErrTicketExpired = NewGeneralError("Ticket expired", http.StatusUnauthorized)
+var ErrTicketAlgorithm = NewGeneralError("Unknown ticket signing algorithm", http.StatusInternalServerError)
+var ErrTicketKey = NewGeneralError("Invalid ticket signing key", http.StatusInternalServerError)
+var ErrTicketsOff = NewGeneralError("Tickets are not enabled", http.StatusNotImplemented)
+
+var ErrKeyPassphrase = NewGeneralError("Key store passphrase is missing or wrong", http.StatusInternalServerError)
+var ErrKeyAlgorithm = NewGeneralError("Unknown signing key algorithm", http.StatusBadRequest)
+var ErrKeyNotFound = NewGeneralError("Signing key not found", http.StatusNotFound)
+var ErrKeyCurrent = NewGeneralError("The current signing key can't be retired. Rotate the keys first", http.StatusBadRequest)
+var ErrNoCurrentKey = NewGeneralError("There is no current signing key. Use 'gus keys rotate' to create one", http.StatusInternalServerError)
+
+var ErrSecondFactorRequired = NewGeneralError("Second factor required", http.StatusUnauthorized)
+var ErrSecondFactorInvalid = NewGeneralError("Invalid or expired second factor code", http.StatusUnauthorized)
+var ErrTwoFactorOff = NewGeneralError("Two-factor authentication is not enabled", http.StatusNotImplemented)
+var ErrTwoFactorEnabled = NewGeneralError("Two-factor authentication is already turned on", http.StatusConflict)
+var ErrTwoFactorNotEnrolled = NewGeneralError("Two-factor enrollment has not been started", http.StatusBadRequest)
+
+var ErrPasskeysOff = NewGeneralError("Passkeys are not enabled", http.StatusNotImplemented)
+var ErrPasskeyChallenge = NewGeneralError("Invalid or expired passkey challenge", http.StatusUnauthorized)
+var ErrPasskeyResponse = NewGeneralError("Invalid passkey response", http.StatusBadRequest)
+var ErrPasskeyOrigin = NewGeneralError("Passkey response is for another site", http.StatusBadRequest)
+var ErrPasskeyKey = NewGeneralError("Invalid passkey public key", http.StatusBadRequest)
+var ErrPasskeyAlgorithm = NewGeneralError("Unsupported passkey algorithm", http.StatusBadRequest)
+var ErrPasskeyFormat = NewGeneralError("Unsupported passkey attestation format", http.StatusBadRequest)
+var ErrPasskeyAttestation = NewGeneralError("Invalid passkey attestation", http.StatusBadRequest)
+var ErrPasskeySignature = NewGeneralError("Invalid passkey signature", http.StatusUnauthorized)
+var ErrPasskeyUser = NewGeneralError("Passkey did not check the user was present or verified", http.StatusUnauthorized)
+var ErrPasskeyCloned = NewGeneralError("Passkey signature counter went backwards: it may have been copied", http.StatusUnauthorized)
+
+var ErrInvalidVerifyToken = NewGeneralError("Invalid or expired verification token", http.StatusBadRequest)
+var ErrUserActive = NewGeneralError("User is already activated", http.StatusConflict)
+var ErrNotifyOff = NewGeneralError("Notifications are not configured", http.StatusNotImplemented)
+var ErrNotifyFailed = NewGeneralError("Notification could not be sent", http.StatusInternalServerError)
+var ErrNotifyDriver = NewGeneralError("Unknown notify driver", http.StatusInternalServerError)
+var ErrNotifyOptions = NewGeneralError("Invalid notify driver options", http.StatusInternalServerError)
+var ErrNotifyEvent = NewGeneralError("Unknown notify event", http.StatusInternalServerError)
+var ErrNotifyTemplate = NewGeneralError("Notify template must start with a 'Subject:' line and a blank line", http.StatusInternalServerError)
+
+var ErrWebhookUnknown = NewGeneralError("Unknown webhook", http.StatusNotFound)
+var ErrWebhookEvent = NewGeneralError("Unknown webhook event", http.StatusInternalServerError)
+var ErrWebhookConfig = NewGeneralError("Webhook needs an http or https address and a secret", http.StatusInternalServerError)
+var ErrWebhookFailed = NewGeneralError("Webhook could not be delivered", http.StatusBadGateway)
+var ErrWebhookSignature = NewGeneralError("Invalid webhook signature", http.StatusUnauthorized)
+var ErrDeliveryNotFound = NewGeneralError("Webhook delivery not found", http.StatusNotFound)
+
+var ErrInvalidAccessName = NewGeneralError("Role and permission names can only use letters, digits, '.', '_', '-' and ':'", http.StatusBadRequest)
 
 // Storage Errors
 var ErrInvalidHeader = NewGeneralError("Invalid header in request", http.StatusBadRequest)
 var ErrInvalidChecksum = NewGeneralError("Invalid Checksum", http.StatusBadRequest)
 var ErrInvalidBody = NewGeneralError("Invalid body (mistmatch request?)", http.StatusBadRequest)
 var ErrEmptyFieldForLookup = NewGeneralError("Lookup field is empty", http.StatusBadRequest)
+var ErrInvalidSearch = NewGeneralError("Invalid search sort, filter or cursor", http.StatusBadRequest)
 var ErrInvalidPasswordOrUser = NewGeneralError("Invalid password or user id", http.StatusBadRequest)
 var ErrMatchAnyNotSupported = NewGeneralError("Storage driver does not support 'MatchAnyDomain' for fetch operation", http.StatusInternalServerError)
 var ErrNoDriverFound = NewGeneralError("No storage driver found", http.StatusInternalServerError)
@@ -86,6 +175,9 @@ var ErrAlreadyRegistered = NewGeneralError("Storage driver already registered",
 var ErrInternalDatabase = NewGeneralError("Internal storage error while executing operation", http.StatusInternalServerError)
 var ErrCannotSetId = NewGeneralError("User id cannot be set", http.StatusBadRequest)
 var ErrUserNotFound = NewGeneralError("User not found", http.StatusNotFound)
+var ErrSessionNotFound = NewGeneralError("Session not found", http.StatusNotFound)
+var ErrRefreshNotFound = NewGeneralError("Refresh token not found", http.StatusNotFound)
+var ErrPasskeyNotFound = NewGeneralError("Passkey not found", http.StatusNotFound)
 var ErrAlreadyOpen  = NewGeneralError("Storage driver already open", http.StatusBadRequest)
 
 var ErrShortGuid = NewGeneralError("GUID must be at least 32 characters long", http.StatusInternalServerError)
@@ -93,13 +185,21 @@ var ErrDuplicateGuid = NewGeneralError("User GUID already in use", http.StatusIn
 var ErrInvalidGuid = NewGeneralError("Invalid Guid for lookup", http.StatusNotFound)
 var ErrInvalidEmail = NewGeneralError("Invalid email for lookup", http.StatusNotFound)
 var ErrInvalidToken = NewGeneralError("Invalid token for lookup", http.StatusNotFound)
+var ErrInvalidResetToken = NewGeneralError("Invalid or expired password reset token", http.StatusBadRequest)
 
 var ErrDuplicateEmail = NewGeneralError("Email address already registered", http.StatusConflict)
 var ErrDuplicateLogin = NewGeneralError("Login name already exists", http.StatusConflict)
+var ErrDuplicatePasskey = NewGeneralError("Passkey already registered", http.StatusConflict)
 
 var ErrUserNotRegistered = NewGeneralError("User not registered", http.StatusBadRequest)
 var ErrUserNotLoggedIn = NewGeneralError("User not logged in", http.StatusBadRequest)
 var ErrUserLoggedIn = NewGeneralError("User already logged in", http.StatusBadRequest)
 var ErrUserNotActive = NewGeneralError("User is not yet activated", http.StatusUnauthorized)
+var ErrUserLocked = NewGeneralError("User account is locked", http.StatusTooManyRequests)
+var ErrNotSystemClient = NewGeneralError("Only system clients may use this service", http.StatusForbidden)
+var ErrServiceNotPermitted = NewGeneralError("Client may not use this service", http.StatusForbidden)
+var ErrNoUpdateCapability = NewGeneralError("Client has no update capabilities", http.StatusForbidden)
+var ErrNotAdminClient = NewGeneralError("Only admin clients may use this service", http.StatusForbidden)
+var ErrUserDeleted = NewGeneralError("User has been deleted", http.StatusConflict)
 
 var ErrStatusOk = NewGeneralError("", http.StatusOK)
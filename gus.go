@@ -38,8 +38,11 @@ var commands = []*cli.Command{
 	cmdUser,
 	cmdUserAdd,
 	cmdService,
+	cmdKeys,
+	cmdWebhook,
 	helpStore,
 	helpEncrypt,
+	helpNotify,
 }
 
 var helpTemplate = `Usage:
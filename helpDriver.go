@@ -8,6 +8,7 @@ import (
 	"github.com/cgentry/gdriver"
 	"github.com/cgentry/gus/cli"
 	"github.com/cgentry/gus/library/encryption"
+	"github.com/cgentry/gus/library/notify"
 	"github.com/cgentry/gus/library/storage"
 )
 
@@ -31,6 +32,19 @@ var helpEncrypt = &cli.Command{
 Display all of the drivers that are compiled into this runtime. If
 you add in the 'driver-name', it will list specific help for that driver.
 
+Each driver may require different paramters. The driver will give you some
+details, but you should refer to the documentation
+`,
+}
+var helpNotify = &cli.Command{
+	Name:      "notify",
+	UsageLine: "gus notify [driver-name]",
+	Short:     "Display a list of what notify drivers are available",
+	Long: `
+Display all of the drivers that can send messages, such as the email
+verification link, to users. If you add in the 'driver-name', it will list
+specific help for that driver.
+
 Each driver may require different paramters. The driver will give you some
 details, but you should refer to the documentation
 `,
@@ -39,6 +53,7 @@ details, but you should refer to the documentation
 func init() {
 	helpStore.Run = runStore
 	helpEncrypt.Run = runEncrypt
+	helpNotify.Run = runNotify
 }
 
 // Output any help that is required
@@ -101,3 +116,45 @@ const templateEncryptionEntry = `
 {{ .Id }}: {{ .ShortHelp }}
 {{ .LongHelp }}
 `
+
+// notifyEntry holds the help text for one notify driver
+type notifyEntry struct {
+	Name      string
+	ShortHelp string
+	LongHelp  string
+}
+
+func runNotify(cmd *cli.Command, args []string) {
+	list := make(map[string]notifyEntry)
+	for name, drv := range gdriver.ListMembers(notify.DriverGroup) {
+		list[name] = notifyEntry{
+			Name:      drv.Identity(gdriver.IdentityName),
+			ShortHelp: drv.Identity(gdriver.IdentityShort),
+			LongHelp:  drv.Identity(gdriver.IdentityLong),
+		}
+	}
+
+	if len(args) == 0 {
+		cli.RenderTemplate(os.Stdout, templateNotifyList, list)
+		return
+	}
+	if len(args) == 1 {
+		if entry, ok := list[args[0]]; ok {
+			cli.RenderTemplate(os.Stdout, templateNotifyEntry, entry)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "'%s' is not a valid notify driver\n", args[0])
+	} else {
+		fmt.Fprintf(os.Stderr, "Only one parameter for notify command\nUse 'gus help notify' for more information\n")
+	}
+}
+
+const templateNotifyList = `
+List of notify drivers available:{{ range . }}
+  {{ .Name }}: {{ .ShortHelp }}{{ end }}
+
+`
+const templateNotifyEntry = `
+{{ .Name }}: {{ .ShortHelp }}
+{{ .LongHelp }}
+`
@@ -0,0 +1,132 @@
+package encryption_test
+
+import (
+	gobcrypt "code.google.com/p/go.crypto/bcrypt"
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/encryption"
+	"github.com/cgentry/gus/library/encryption/drivers/argon2id"
+	"github.com/cgentry/gus/library/encryption/drivers/bcrypt"
+	"github.com/cgentry/gus/library/encryption/drivers/pbkdf2"
+	"github.com/cgentry/gus/library/encryption/drivers/plaintext"
+	"github.com/cgentry/gus/library/encryption/drivers/scrypt"
+	"github.com/cgentry/gus/library/encryption/drivers/sha512"
+	. "github.com/smartystreets/goconvey/convey"
+	"sort"
+	"testing"
+)
+
+// conformanceDrivers are all of the drivers registered before any test is run. The
+// package tests register mock drivers of their own, which are not included.
+var conformanceDrivers []string
+
+func init() {
+	bcrypt.Register()
+	argon2id.Register()
+	scrypt.Register()
+	pbkdf2.Register()
+	sha512.Register()
+	plaintext.Register()
+	for name := range gdriver.ListMembers(encryption.DriverGroup) {
+		conformanceDrivers = append(conformanceDrivers, name)
+	}
+	sort.Strings(conformanceDrivers)
+}
+
+// TestDriverConformance is the set of tests every encryption driver must pass.
+func TestDriverConformance(t *testing.T) {
+	const pwd = "Conformance Passw0rd"
+	const salt = "kjldoeuifnfl203294fkfmakdi3nf"
+
+	for _, name := range conformanceDrivers {
+		Convey("Driver "+name, t, func() {
+			drv := encryption.GetDriver(name)
+			hash := drv.EncryptPassword(pwd, salt)
+			So(hash, ShouldNotBeBlank)
+
+			Convey("Encrypt and compare round trip", func() {
+				So(drv.ComparePasswords(hash, pwd, salt), ShouldBeTrue)
+				So(encryption.GetDriver(name).ComparePasswords(hash, pwd, salt), ShouldBeTrue)
+			})
+			Convey("Wrong password fails", func() {
+				So(drv.ComparePasswords(hash, pwd+"x", salt), ShouldBeFalse)
+				So(drv.ComparePasswords(hash, "", salt), ShouldBeFalse)
+			})
+			Convey("Wrong salt fails", func() {
+				So(drv.ComparePasswords(hash, pwd, salt+"x"), ShouldBeFalse)
+				So(drv.ComparePasswords(hash, pwd, ""), ShouldBeFalse)
+			})
+			Convey("Long passwords and salts are not truncated", func() {
+				long := pwd + pwd + pwd + pwd
+				longHash := drv.EncryptPassword(long, salt+salt+salt)
+				So(drv.ComparePasswords(longHash, long, salt+salt+salt), ShouldBeTrue)
+				So(drv.ComparePasswords(longHash, long+"x", salt+salt+salt), ShouldBeFalse)
+				So(drv.ComparePasswords(longHash, long, salt+salt+salt+"x"), ShouldBeFalse)
+			})
+			Convey("Changing the driver salt fails", func() {
+				other := encryption.GetDriver(name).Setup(`{"Salt": "A different driver salt"}`)
+				So(other.ComparePasswords(hash, pwd, salt), ShouldBeFalse)
+			})
+			Convey("Changing the cost still compares a versioned hash", func() {
+				encryption.SetOptions(name, `{"Cost": 5}`)
+				stored := encryption.EncodeHash(encryption.GetDriver(name), pwd, salt)
+				encryption.SetOptions(name, `{"Cost": 6}`)
+				defer encryption.SetOptions(name, "")
+				So(encryption.ComparePassword(stored, pwd, salt), ShouldBeTrue)
+				So(encryption.ComparePassword(stored, pwd+"x", salt), ShouldBeFalse)
+			})
+		})
+	}
+}
+
+// TestBaselineBcrypt checks bcrypt passwords saved before the driver was recorded with the hash,
+// when the salts were appended to the password, and before they were keyed with the salts.
+func TestBaselineBcrypt(t *testing.T) {
+	const pwd = "Baseline Passw0rd"
+	const salt = "kjldoeuifnfl203294fkfmakdi3nf"
+	const siteSalt = "The site salt for bcrypt"
+	encryption.SetOptions("bcrypt", `{"Salt": "`+siteSalt+`"}`)
+	encryption.SetDefault("bcrypt")
+	encryption.SetLegacy("")
+	defer encryption.SetOptions("bcrypt", "")
+
+	raw, err := gobcrypt.GenerateFromPassword([]byte(pwd+siteSalt+salt+encryption.GetStaticSalt(0)), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stored := range []string{string(raw), "$bcrypt$7$" + string(raw)} {
+		Convey("Baseline hash "+stored[:10], t, func() {
+			So(encryption.ComparePassword(stored, pwd, salt), ShouldBeTrue)
+			So(encryption.ComparePassword(stored, pwd+"x", salt), ShouldBeFalse)
+			So(encryption.ComparePassword(stored, pwd, salt+"x"), ShouldBeFalse)
+			So(encryption.NeedsRehash(stored), ShouldBeTrue)
+
+			rehashed := encryption.HashPassword(pwd, salt)
+			So(rehashed, ShouldStartWith, "$bcrypt$7h$")
+			So(encryption.ComparePassword(rehashed, pwd, salt), ShouldBeTrue)
+			So(encryption.NeedsRehash(rehashed), ShouldBeFalse)
+		})
+	}
+}
+
+// TestHashParamLimits checks that saved hashes with parameters past the driver's limits are
+// refused rather than tying up the CPU, or memory, on every login.
+func TestHashParamLimits(t *testing.T) {
+	Convey("Parameters over the limits are refused", t, func() {
+		for _, stored := range []string{
+			"$bcrypt$99h$$2a$07$abcdefghijklmnopqrstuv",
+			"$pbkdf2$2000000000$abcdefgh",
+			"$argon2id$m=4194304,t=2,p=1$abcdefgh",
+			"$argon2id$m=19456,t=1000,p=1$abcdefgh",
+			"$scrypt$ln=30,r=8,p=1$abcdefgh",
+			"$scrypt$ln=15,r=1000,p=1$abcdefgh",
+			"$sha512$2000000000$abcdefgh",
+		} {
+			_, _, err := encryption.DriverForHash(stored)
+			So(err, ShouldEqual, encryption.ErrHashParams)
+			So(encryption.ComparePassword(stored, "password", "salt"), ShouldBeFalse)
+		}
+	})
+	Convey("Bcrypt refuses a cost over the limit inside the hash", t, func() {
+		So(encryption.ComparePassword("$bcrypt$7h$$2a$31$abcdefghijklmnopqrstuv", "password", "salt"), ShouldBeFalse)
+	})
+}
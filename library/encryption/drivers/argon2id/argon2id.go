@@ -0,0 +1,136 @@
+// Package argon2id will encrypt passwords using argon2id, the winner of the Password Hashing
+// Competition. It is memory hard, which makes it expensive to attack with GPUs. The setup
+// option passed in can be:
+// { Memory: n, Time: n, Parallelism: n, Salt: "string"}
+// Memory is in KiB, Time is the number of passes over the memory and Parallelism is the
+// number of threads used.
+
+// Copyright 2014 Charles Gentry. All rights reserved.
+// Please see the license included with this package
+
+package argon2id
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/encryption"
+	"golang.org/x/crypto/argon2"
+)
+
+// KeyLength is the number of bytes generated for each password
+const KeyLength = 32
+
+// Highest parameters accepted. Memory is in KiB.
+const (
+	MaxMemory      = 256 * 1024
+	MaxTime        = 16
+	MaxParallelism = 16
+)
+
+type PwdArgon2id struct {
+	Salt        string
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+}
+
+// Id returns the string identifier for this driver
+func (t *PwdArgon2id) Id() string {
+	return gdriver.Help(encryption.DriverGroup, DriverName, gdriver.IdentityName)
+}
+
+// ShortHelp returns a short string identifier for the identity.
+func (t *PwdArgon2id) ShortHelp() string {
+	return gdriver.Help(encryption.DriverGroup, DriverName, gdriver.IdentityShort)
+}
+
+// LongHelp returns a longer descriptive text for the help
+func (t *PwdArgon2id) LongHelp() string {
+	return gdriver.Help(encryption.DriverGroup, DriverName, gdriver.IdentityLong)
+}
+
+// New will create an ARGON2ID structure. The salt is given a static string but
+// can be set up on selection from the driver. This must be the same with every
+// load or you won't be able to login anymore.
+func New() *PwdArgon2id {
+	c := &PwdArgon2id{
+		Memory:      19 * 1024,
+		Time:        2,
+		Parallelism: 1,
+		Salt:        "Bq7#nW2vL!x9dZ@pQ4sT^eR8mK1yH5uJ&cF3gA6oN0iV$bX.jYkU7wE2rD9tS4lP",
+	}
+	return c
+}
+
+// EncryptPassword will encrypt the password using the user's salt and the driver's salt.
+func (t *PwdArgon2id) EncryptPassword(clearPassword, userSalt string) string {
+	salt := []byte(userSalt + t.Salt + encryption.GetStaticSalt(0))
+	key := argon2.IDKey([]byte(clearPassword), salt, t.Time, t.Memory, t.Parallelism, KeyLength)
+	return base64.RawStdEncoding.EncodeToString(key)
+}
+
+// Setup should be called only when the driver has been selected for use.
+func (t *PwdArgon2id) Setup(jsonOptions string) encryption.EncryptDriver {
+	if jsonOptions != "" {
+		opt, err := encryption.UnmarshalOptions(jsonOptions)
+		if err != nil {
+			log.Printf("Argon2id: Could not unmarshal '%s' options: ignored.", jsonOptions)
+			return t
+		}
+		t.setCost(opt.Memory, opt.Time, opt.Parallelism)
+		t.setSalt(opt.Salt)
+	}
+	return t
+}
+
+// Params returns the memory, time and parallelism, which are saved along with the password hash
+func (t *PwdArgon2id) Params() string {
+	return fmt.Sprintf("m=%d,t=%d,p=%d", t.Memory, t.Time, t.Parallelism)
+}
+
+// SetParams sets the memory, time and parallelism from a saved password hash
+func (t *PwdArgon2id) SetParams(params string) error {
+	var memory, time, parallelism int
+	if _, err := fmt.Sscanf(params, "m=%d,t=%d,p=%d", &memory, &time, &parallelism); err != nil {
+		return err
+	}
+	if !inRange(memory, MaxMemory) || !inRange(time, MaxTime) || !inRange(parallelism, MaxParallelism) {
+		return encryption.ErrHashParams
+	}
+	t.setCost(memory, time, parallelism)
+	return nil
+}
+
+// setCost sets each value that is within the limits. The others are left alone.
+func (t *PwdArgon2id) setCost(memory, time, parallelism int) {
+	if inRange(memory, MaxMemory) {
+		t.Memory = uint32(memory)
+	}
+	if inRange(time, MaxTime) {
+		t.Time = uint32(time)
+	}
+	if inRange(parallelism, MaxParallelism) {
+		t.Parallelism = uint8(parallelism)
+	}
+}
+
+func inRange(value, max int) bool {
+	return value > 0 && value <= max
+}
+
+func (t *PwdArgon2id) setSalt(newEncryptionSalt string) {
+	if len(newEncryptionSalt) > 0 {
+		t.Salt = newEncryptionSalt
+	}
+}
+
+// ComparePasswords will encrypt the clear password and compare it to the hash.
+// The comparison takes the same time no matter where the strings differ.
+func (t *PwdArgon2id) ComparePasswords(hashedPassword, clearPassword, userSalt string) bool {
+	pwd := t.EncryptPassword(clearPassword, userSalt)
+	return subtle.ConstantTimeCompare([]byte(hashedPassword), []byte(pwd)) == 1
+}
@@ -0,0 +1,45 @@
+package argon2id
+
+import (
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/encryption"
+	"testing"
+)
+
+// The encrypt and compare tests for every driver are in the encryption package
+// (conformance_test.go). Only the options that belong to this driver are tested here.
+
+func TestSetup(t *testing.T) {
+	Register()
+	SetDefault()
+	if !gdriver.IsRegistered(encryption.DriverGroup, DriverName) {
+		t.Errorf("%s is not registered", DriverName)
+	}
+	if drv := encryption.GetDefaultDriver(); drv.Id() != DriverName {
+		t.Errorf("Driver identity is wrong: %s != %s", DriverName, drv.Id())
+	}
+}
+
+func TestParams(t *testing.T) {
+	drv := New()
+	drv.Setup(`{ "Memory": 8192, "Time": 3, "Parallelism": 2 }`)
+	if drv.Params() != "m=8192,t=3,p=2" {
+		t.Errorf("Params are wrong: '%s'", drv.Params())
+	}
+	drv2 := New()
+	if err := drv2.SetParams(drv.Params()); err != nil {
+		t.Errorf("SetParams returned error: %s", err.Error())
+	}
+	if drv2.Params() != drv.Params() {
+		t.Errorf("Params did not match: '%s' and '%s'", drv.Params(), drv2.Params())
+	}
+	if err := drv2.SetParams("bad"); err == nil {
+		t.Errorf("SetParams should fail with bad parameters")
+	}
+	if err := drv2.SetParams("m=19456,t=2,p=100"); err != encryption.ErrHashParams {
+		t.Errorf("SetParams should refuse parameters over the limit")
+	}
+	if drv2.Params() != drv.Params() {
+		t.Errorf("Params changed after being refused: '%s'", drv2.Params())
+	}
+}
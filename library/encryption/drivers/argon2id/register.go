@@ -0,0 +1,61 @@
+package argon2id
+
+import (
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/encryption"
+)
+
+const (
+	// DriverName Specifies the specific identity of this driver within a group
+	DriverName   = "argon2id"
+	HelpShort    = "Memory hard encryption using ARGON2ID (recommended)"
+	HelpTemplate = `
+  Argon2id won the Password Hashing Competition in 2015 and is the recommended way to store
+  passwords. It is memory hard: every password check needs a block of memory as well as time,
+  which makes guessing passwords on GPUs or custom hardware very expensive.
+
+  Options: The options should be passed by JSON strings. They are:
+      "Memory", "Time", "Parallelism" and "Salt". Memory is the number of KiB used for each
+      password, Time is the number of passes made over the memory and Parallelism is the
+      number of threads used. Raising any of these makes it more costly to encrypt (which
+      is a good thing). Salt is an additional bit of encryption you want added when it is
+      encrypting the password. The salt should be a long, random string of any characters.
+      Do not include quotes.
+
+      The defaults are 19456 KiB of memory, a time of 2 and a parallelism of 1. The cost
+      values are saved with each password, so they can be raised and users will be moved
+      to the new values when they next login. The highest values accepted are 262144 KiB of
+      memory, a time of 16 and a parallelism of 16. The salt has a long, random string built
+      in. You must not change the salt after you have set it or passwords will never match again.
+
+  Option format: {"Memory" : 65536, "Time" : 1, "Parallelism" : 4, "Salt": "abcd...........xyz" }
+
+`
+)
+
+type registerDriver struct{}
+
+// Register is a simple wrapper to make sure registration occurs properly
+func Register() {
+	gdriver.Register(encryption.DriverGroup, &registerDriver{})
+}
+
+// SetDefault will set THIS driver as the default encryption driver.
+func SetDefault() {
+	gdriver.Default(encryption.DriverGroup, DriverName)
+}
+
+func (r *registerDriver) New() interface{} {
+	return New()
+}
+
+func (r *registerDriver) Identity(id int) string {
+	switch id {
+
+	case gdriver.IdentityShort:
+		return HelpShort
+	case gdriver.IdentityLong:
+		return HelpTemplate
+	}
+	return DriverName
+}
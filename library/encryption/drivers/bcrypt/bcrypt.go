@@ -12,16 +12,29 @@
 package bcrypt
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"log"
+	"strconv"
+	"strings"
 
 	"code.google.com/p/go.crypto/bcrypt"
 	"github.com/cgentry/gdriver"
 	"github.com/cgentry/gus/library/encryption"
 )
 
+// keyedMarker is added to the cost saved with a password when the password was keyed with the
+// salts (e.g. $bcrypt$7h$...). Passwords without it had the salts appended.
+const keyedMarker = "h"
+
+// MaxCost is the highest cost accepted. Each step doubles the time taken.
+const MaxCost = 16
+
 type PwdBcrypt struct {
-	Salt string
-	Cost int
+	Salt  string
+	Cost  int
+	Keyed bool // The password is keyed with the salts rather than having them appended
 }
 
 // Id returns the string identifier for this driver
@@ -44,8 +57,9 @@ func (t *PwdBcrypt) LongHelp() string {
 // load or you won't be able to login anymore.
 func New() *PwdBcrypt {
 	c := &PwdBcrypt{
-		Cost: 7,
-		Salt: "vniiO5UD0w5GpJkPijwQCT63MuMjyWnyi5TtUWBGInCq84zaFFsSwGm9DK8UyUeQp{2h&gV,KoQi9ysC",
+		Cost:  7,
+		Salt:  "vniiO5UD0w5GpJkPijwQCT63MuMjyWnyi5TtUWBGInCq84zaFFsSwGm9DK8UyUeQp{2h&gV,KoQi9ysC",
+		Keyed: true,
 	}
 	return c
 }
@@ -54,11 +68,23 @@ func New() *PwdBcrypt {
 // This should be sufficient to protect it but still allow us to re-create later on.
 // (The magic number will never alter for the life of the record
 func (t *PwdBcrypt) EncryptPassword(clearPassword, userSalt string) string {
-	saltyPassword := []byte(clearPassword + t.Salt + userSalt + encryption.GetStaticSalt(0))
-	pass1, _ := bcrypt.GenerateFromPassword(saltyPassword, t.Cost)
+	pass1, _ := bcrypt.GenerateFromPassword(t.saltyPassword(clearPassword, userSalt), t.Cost)
 	return string(pass1)
 }
 
+// saltyPassword combines the password with the salts. Bcrypt will only use the first 72 bytes
+// it is given, so the password is keyed with the salts (HMAC-SHA256) rather than having them
+// appended. Otherwise a long password or salt would push the user's salt out of the hash.
+// Passwords saved before keying was added still have the salts appended.
+func (t *PwdBcrypt) saltyPassword(clearPassword, userSalt string) []byte {
+	if !t.Keyed {
+		return []byte(clearPassword + t.Salt + userSalt + encryption.GetStaticSalt(0))
+	}
+	mac := hmac.New(sha256.New, []byte(t.Salt+userSalt+encryption.GetStaticSalt(0)))
+	mac.Write([]byte(clearPassword))
+	return []byte(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
 // Setup should be called only when the driver has been selected for use.
 func (t *PwdBcrypt) Setup(jsonOptions string) encryption.EncryptDriver {
 	if jsonOptions != "" {
@@ -73,10 +99,41 @@ func (t *PwdBcrypt) Setup(jsonOptions string) encryption.EncryptDriver {
 	return t
 }
 
-func (t *PwdBcrypt) setCost(newCostValue int) {
-	if newCostValue > 0 {
+func (t *PwdBcrypt) setCost(newCostValue int) bool {
+	if newCostValue > 0 && newCostValue <= MaxCost {
 		t.Cost = newCostValue
+		return true
+	}
+	return false
+}
+
+// Params returns the cost, which is saved along with the password hash, followed by the
+// keyed marker
+func (t *PwdBcrypt) Params() string {
+	if t.Keyed {
+		return strconv.Itoa(t.Cost) + keyedMarker
 	}
+	return strconv.Itoa(t.Cost)
+}
+
+// SetParams sets the cost, and how the salts are combined, from a saved password hash
+func (t *PwdBcrypt) SetParams(params string) error {
+	keyed := strings.HasSuffix(params, keyedMarker)
+	cost, err := strconv.Atoi(strings.TrimSuffix(params, keyedMarker))
+	if err != nil {
+		return err
+	}
+	if !t.setCost(cost) {
+		return encryption.ErrHashParams
+	}
+	t.Keyed = keyed
+	return nil
+}
+
+// SetLegacyHash is called for passwords saved before the driver was recorded with the hash.
+// These always had the salts appended.
+func (t *PwdBcrypt) SetLegacyHash() {
+	t.Keyed = false
 }
 
 func (t *PwdBcrypt) setSalt(newEncryptionSalt string) {
@@ -85,9 +142,12 @@ func (t *PwdBcrypt) setSalt(newEncryptionSalt string) {
 	}
 }
 
-// ComparePasswords must be called with a bcrypt password.
+// ComparePasswords must be called with a bcrypt password. Bcrypt takes the cost from the hash
+// itself, so a hash with a cost over MaxCost never matches.
 func (t *PwdBcrypt) ComparePasswords(hashedPassword, clearPassword, userSalt string) bool {
-	saltyPassword := []byte(clearPassword + t.Salt + userSalt + encryption.GetStaticSalt(0))
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), saltyPassword)
+	if cost, err := bcrypt.Cost([]byte(hashedPassword)); err != nil || cost > MaxCost {
+		return false
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), t.saltyPassword(clearPassword, userSalt))
 	return err == nil
 }
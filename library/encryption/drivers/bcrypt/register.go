@@ -22,8 +22,14 @@ const (
       encryption you want added when it is encrypting the password. The salt should
       be a long, random string of any characters. Do not include quotes.
 
-      The cost defaults to '7' and the salt has a long, random string built in. You must
-      not change the salt after you have set it or passwords will never match again.
+      The cost defaults to '7' and the salt has a long, random string built in. The cost is
+      saved with each password, so it can be raised and users will be moved to the new cost
+      when they next login. The highest cost accepted is 16. You must not change the salt after you have set it or passwords
+      will never match again.
+
+      Passwords are keyed with the salts so that long passwords are not cut short. Passwords
+      saved by older versions had the salts appended; they are still accepted and are moved
+      over when the user next logs in.
 
   Option format: {"Cost" : 7, "Salt": "abcd...........xyz" }
 
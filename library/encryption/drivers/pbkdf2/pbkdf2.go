@@ -0,0 +1,117 @@
+// Package pbkdf2 will encrypt passwords using PBKDF2 with HMAC-SHA512. This is the standards
+// based replacement for the sha512 driver. The setup option passed in can be:
+// { Cost: n, Salt: "string"}
+// Where cost is the number of iterations. The default is 210000.
+
+// Copyright 2014 Charles Gentry. All rights reserved.
+// Please see the license included with this package
+
+package pbkdf2
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"strconv"
+
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/encryption"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// KeyLength is the number of bytes generated for each password
+const KeyLength = sha512.Size
+
+// MaxCost is the highest iteration count accepted
+const MaxCost = 5000000
+
+type PwdPbkdf2 struct {
+	Salt string
+	Cost int
+}
+
+// Id returns the string identifier for this driver
+func (t *PwdPbkdf2) Id() string {
+	return gdriver.Help(encryption.DriverGroup, DriverName, gdriver.IdentityName)
+}
+
+// ShortHelp returns a short string identifier for the identity.
+func (t *PwdPbkdf2) ShortHelp() string {
+	return gdriver.Help(encryption.DriverGroup, DriverName, gdriver.IdentityShort)
+}
+
+// LongHelp returns a longer descriptive text for the help
+func (t *PwdPbkdf2) LongHelp() string {
+	return gdriver.Help(encryption.DriverGroup, DriverName, gdriver.IdentityLong)
+}
+
+// New will create a PBKDF2 structure. The salt is given a static string but
+// can be set up on selection from the driver. This must be the same with every
+// load or you won't be able to login anymore.
+func New() *PwdPbkdf2 {
+	c := &PwdPbkdf2{
+		Cost: 210000,
+		Salt: "tZ4!qW8e#Lr2Vx@9Np^Kd6Hs&1Jf3Gb.5Mc7Ya0Ue$Ro8Ti2Pl4Sk6Dj9Fh1Qn3Xw",
+	}
+	return c
+}
+
+// EncryptPassword will encrypt the password using the user's salt and the driver's salt.
+func (t *PwdPbkdf2) EncryptPassword(clearPassword, userSalt string) string {
+	salt := []byte(userSalt + t.Salt + encryption.GetStaticSalt(0))
+	key := pbkdf2.Key([]byte(clearPassword), salt, t.Cost, KeyLength, sha512.New)
+	return base64.RawStdEncoding.EncodeToString(key)
+}
+
+// Setup should be called only when the driver has been selected for use.
+func (t *PwdPbkdf2) Setup(jsonOptions string) encryption.EncryptDriver {
+	if jsonOptions != "" {
+		opt, err := encryption.UnmarshalOptions(jsonOptions)
+		if err != nil {
+			log.Printf("Pbkdf2: Could not unmarshal '%s' options: ignored.", jsonOptions)
+			return t
+		}
+		t.setCost(opt.Cost)
+		t.setSalt(opt.Salt)
+	}
+	return t
+}
+
+// Params returns the iteration count, which is saved along with the password hash
+func (t *PwdPbkdf2) Params() string {
+	return strconv.Itoa(t.Cost)
+}
+
+// SetParams sets the iteration count from a saved password hash
+func (t *PwdPbkdf2) SetParams(params string) error {
+	cost, err := strconv.Atoi(params)
+	if err != nil {
+		return err
+	}
+	if !t.setCost(cost) {
+		return encryption.ErrHashParams
+	}
+	return nil
+}
+
+func (t *PwdPbkdf2) setCost(newCostValue int) bool {
+	if newCostValue > 0 && newCostValue <= MaxCost {
+		t.Cost = newCostValue
+		return true
+	}
+	return false
+}
+
+func (t *PwdPbkdf2) setSalt(newEncryptionSalt string) {
+	if len(newEncryptionSalt) > 0 {
+		t.Salt = newEncryptionSalt
+	}
+}
+
+// ComparePasswords will encrypt the clear password and compare it to the hash.
+// The comparison takes the same time no matter where the strings differ.
+func (t *PwdPbkdf2) ComparePasswords(hashedPassword, clearPassword, userSalt string) bool {
+	pwd := t.EncryptPassword(clearPassword, userSalt)
+	return subtle.ConstantTimeCompare([]byte(hashedPassword), []byte(pwd)) == 1
+}
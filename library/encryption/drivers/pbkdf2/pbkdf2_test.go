@@ -0,0 +1,45 @@
+package pbkdf2
+
+import (
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/encryption"
+	"testing"
+)
+
+// The encrypt and compare tests for every driver are in the encryption package
+// (conformance_test.go). Only the options that belong to this driver are tested here.
+
+func TestSetup(t *testing.T) {
+	Register()
+	SetDefault()
+	if !gdriver.IsRegistered(encryption.DriverGroup, DriverName) {
+		t.Errorf("%s is not registered", DriverName)
+	}
+	if drv := encryption.GetDefaultDriver(); drv.Id() != DriverName {
+		t.Errorf("Driver identity is wrong: %s != %s", DriverName, drv.Id())
+	}
+}
+
+func TestParams(t *testing.T) {
+	drv := New()
+	drv.Setup(`{ "Cost": 1000 }`)
+	if drv.Params() != "1000" {
+		t.Errorf("Params are wrong: '%s'", drv.Params())
+	}
+	drv2 := New()
+	if err := drv2.SetParams(drv.Params()); err != nil {
+		t.Errorf("SetParams returned error: %s", err.Error())
+	}
+	if drv2.Params() != drv.Params() {
+		t.Errorf("Params did not match: '%s' and '%s'", drv.Params(), drv2.Params())
+	}
+	if err := drv2.SetParams("bad"); err == nil {
+		t.Errorf("SetParams should fail with bad parameters")
+	}
+	if err := drv2.SetParams("2000000000"); err != encryption.ErrHashParams {
+		t.Errorf("SetParams should refuse parameters over the limit")
+	}
+	if drv2.Params() != drv.Params() {
+		t.Errorf("Params changed after being refused: '%s'", drv2.Params())
+	}
+}
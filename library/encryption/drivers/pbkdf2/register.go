@@ -0,0 +1,60 @@
+package pbkdf2
+
+import (
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/encryption"
+)
+
+const (
+	// DriverName Specifies the specific identity of this driver within a group
+	DriverName   = "pbkdf2"
+	HelpShort    = "Standards based encryption using PBKDF2 with SHA512"
+	HelpTemplate = `
+  PBKDF2 (RFC 8018) is a standard key derivation function. This driver uses HMAC-SHA512
+  and replaces the sha512 driver, which uses its own, much weaker, iteration scheme.
+
+  Options: There are two options that should be passed by JSON strings. They are:
+      "Cost" and "Salt". Cost is the number of iterations you want for the function, making
+      it more costly to encrypt (which is a good thing). Salt is an additional bit of
+      encryption you want added when it is encrypting the password. The salt should
+      be a long, random string of any characters. Do not include quotes.
+
+      The cost defaults to '210000' and the salt has a long, random string built in. The cost
+      is saved with each password, so it can be raised and users will be moved to the new cost
+      when they next login. The highest cost accepted is 5000000. You must not change the salt after you have set it or passwords
+      will never match again.
+
+  Option format: {"Cost" : 210000, "Salt": "abcd...........xyz" }
+
+  Moving from sha512: set the encryption "Name" to "pbkdf2" and "Legacy" to "sha512". Users
+  are moved to pbkdf2 the next time they login.
+
+`
+)
+
+type registerDriver struct{}
+
+// Register is a simple wrapper to make sure registration occurs properly
+func Register() {
+	gdriver.Register(encryption.DriverGroup, &registerDriver{})
+}
+
+// SetDefault will set THIS driver as the default encryption driver.
+func SetDefault() {
+	gdriver.Default(encryption.DriverGroup, DriverName)
+}
+
+func (r *registerDriver) New() interface{} {
+	return New()
+}
+
+func (r *registerDriver) Identity(id int) string {
+	switch id {
+
+	case gdriver.IdentityShort:
+		return HelpShort
+	case gdriver.IdentityLong:
+		return HelpTemplate
+	}
+	return DriverName
+}
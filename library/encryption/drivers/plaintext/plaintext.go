@@ -1,6 +1,7 @@
 package plaintext
 
 import (
+	"crypto/subtle"
 	"github.com/cgentry/gdriver"
 	"github.com/cgentry/gus/library/encryption"
 )
@@ -59,9 +60,11 @@ func (t *PwdPlaintext) setSalt(newEncryptionSalt string) {
 	}
 }
 
-// ComparePasswords must check to see if the passed password is equal to the stored password
+// ComparePasswords must check to see if the passed password is equal to the stored password.
+// The comparison takes the same time no matter where the strings differ.
 func (t *PwdPlaintext) ComparePasswords(hashedPassword, password, salt string) bool {
-	return hashedPassword == t.EncryptPassword(password, salt)
+	pwd := t.EncryptPassword(password, salt)
+	return subtle.ConstantTimeCompare([]byte(hashedPassword), []byte(pwd)) == 1
 }
 
 const constPlainTextHelpTempate = `
@@ -0,0 +1,61 @@
+package scrypt
+
+import (
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/encryption"
+)
+
+const (
+	// DriverName Specifies the specific identity of this driver within a group
+	DriverName   = "scrypt"
+	HelpShort    = "Memory hard encryption using SCRYPT"
+	HelpTemplate = `
+  Scrypt is a key derivation function designed to be costly in both time and memory. This
+  makes guessing passwords on GPUs or custom hardware very expensive.
+
+  Options: The options should be passed by JSON strings. They are:
+      "Cost", "BlockSize", "Parallelism" and "Salt". Cost is the power of 2 used for the
+      CPU/memory cost (15 means 32768 iterations), BlockSize is the block size used and
+      Parallelism is the number of times the work is repeated. Raising any of these makes it
+      more costly to encrypt (which is a good thing). Memory used is about
+      128 * BlockSize * 2^Cost bytes. Salt is an additional bit of encryption you want added
+      when it is encrypting the password. The salt should be a long, random string of any
+      characters. Do not include quotes.
+
+      The defaults are a cost of 15, a block size of 8 and a parallelism of 1. The cost
+      values are saved with each password, so they can be raised and users will be moved
+      to the new values when they next login. The highest values accepted are a cost of 18,
+      a block size of 16 and a parallelism of 4. The salt has a long, random string built
+      in. You must not change the salt after you have set it or passwords will never match again.
+
+  Option format: {"Cost" : 15, "BlockSize" : 8, "Parallelism" : 1, "Salt": "abcd...........xyz" }
+
+`
+)
+
+type registerDriver struct{}
+
+// Register is a simple wrapper to make sure registration occurs properly
+func Register() {
+	gdriver.Register(encryption.DriverGroup, &registerDriver{})
+}
+
+// SetDefault will set THIS driver as the default encryption driver.
+func SetDefault() {
+	gdriver.Default(encryption.DriverGroup, DriverName)
+}
+
+func (r *registerDriver) New() interface{} {
+	return New()
+}
+
+func (r *registerDriver) Identity(id int) string {
+	switch id {
+
+	case gdriver.IdentityShort:
+		return HelpShort
+	case gdriver.IdentityLong:
+		return HelpTemplate
+	}
+	return DriverName
+}
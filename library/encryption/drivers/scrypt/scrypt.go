@@ -0,0 +1,142 @@
+// Package scrypt will encrypt passwords using scrypt, a memory hard key derivation function.
+// The setup option passed in can be:
+// { Cost: n, BlockSize: n, Parallelism: n, Salt: "string"}
+// Cost is the log2 of the CPU/memory cost (N), BlockSize is r and Parallelism is p.
+
+// Copyright 2014 Charles Gentry. All rights reserved.
+// Please see the license included with this package
+
+package scrypt
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/encryption"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeyLength is the number of bytes generated for each password
+const KeyLength = 32
+
+// Highest parameters accepted. The memory used is 128 * r * 2^Cost bytes, so the limits
+// keep it to 512MiB.
+const (
+	MaxCost        = 18
+	MaxBlockSize   = 16
+	MaxParallelism = 4
+)
+
+type PwdScrypt struct {
+	Salt        string
+	Cost        int // log2(N)
+	BlockSize   int // r
+	Parallelism int // p
+}
+
+// Id returns the string identifier for this driver
+func (t *PwdScrypt) Id() string {
+	return gdriver.Help(encryption.DriverGroup, DriverName, gdriver.IdentityName)
+}
+
+// ShortHelp returns a short string identifier for the identity.
+func (t *PwdScrypt) ShortHelp() string {
+	return gdriver.Help(encryption.DriverGroup, DriverName, gdriver.IdentityShort)
+}
+
+// LongHelp returns a longer descriptive text for the help
+func (t *PwdScrypt) LongHelp() string {
+	return gdriver.Help(encryption.DriverGroup, DriverName, gdriver.IdentityLong)
+}
+
+// New will create an SCRYPT structure. The salt is given a static string but
+// can be set up on selection from the driver. This must be the same with every
+// load or you won't be able to login anymore.
+func New() *PwdScrypt {
+	c := &PwdScrypt{
+		Cost:        15,
+		BlockSize:   8,
+		Parallelism: 1,
+		Salt:        "h3Xq!7vLr@2Zp9Wd#kT5mNc&8sYf^1bGj4Ea.Uo6Ri0Hx$wKyV3tP7nQ2lD9gS5",
+	}
+	return c
+}
+
+// EncryptPassword will encrypt the password using the user's salt and the driver's salt.
+func (t *PwdScrypt) EncryptPassword(clearPassword, userSalt string) string {
+	salt := []byte(userSalt + t.Salt + encryption.GetStaticSalt(0))
+	key, err := scrypt.Key([]byte(clearPassword), salt, 1<<uint(t.Cost), t.BlockSize, t.Parallelism, KeyLength)
+	if err != nil {
+		log.Printf("Scrypt: Could not encrypt password: %s", err.Error())
+		return ""
+	}
+	return base64.RawStdEncoding.EncodeToString(key)
+}
+
+// Setup should be called only when the driver has been selected for use.
+func (t *PwdScrypt) Setup(jsonOptions string) encryption.EncryptDriver {
+	if jsonOptions != "" {
+		opt, err := encryption.UnmarshalOptions(jsonOptions)
+		if err != nil {
+			log.Printf("Scrypt: Could not unmarshal '%s' options: ignored.", jsonOptions)
+			return t
+		}
+		t.setCost(opt.Cost, opt.BlockSize, opt.Parallelism)
+		t.setSalt(opt.Salt)
+	}
+	return t
+}
+
+// Params returns the cost, block size and parallelism, which are saved along with the password hash
+func (t *PwdScrypt) Params() string {
+	return fmt.Sprintf("ln=%d,r=%d,p=%d", t.Cost, t.BlockSize, t.Parallelism)
+}
+
+// SetParams sets the cost, block size and parallelism from a saved password hash
+func (t *PwdScrypt) SetParams(params string) error {
+	var cost, blockSize, parallelism int
+	if _, err := fmt.Sscanf(params, "ln=%d,r=%d,p=%d", &cost, &blockSize, &parallelism); err != nil {
+		return err
+	}
+	if cost <= 1 || cost > MaxCost || !inRange(blockSize, MaxBlockSize) || !inRange(parallelism, MaxParallelism) {
+		return encryption.ErrHashParams
+	}
+	t.setCost(cost, blockSize, parallelism)
+	return nil
+}
+
+// setCost sets each value that is within the limits. The others are left alone.
+func (t *PwdScrypt) setCost(cost, blockSize, parallelism int) {
+	if cost > 1 && cost <= MaxCost {
+		t.Cost = cost
+	}
+	if inRange(blockSize, MaxBlockSize) {
+		t.BlockSize = blockSize
+	}
+	if inRange(parallelism, MaxParallelism) {
+		t.Parallelism = parallelism
+	}
+}
+
+func inRange(value, max int) bool {
+	return value > 0 && value <= max
+}
+
+func (t *PwdScrypt) setSalt(newEncryptionSalt string) {
+	if len(newEncryptionSalt) > 0 {
+		t.Salt = newEncryptionSalt
+	}
+}
+
+// ComparePasswords will encrypt the clear password and compare it to the hash.
+// The comparison takes the same time no matter where the strings differ.
+func (t *PwdScrypt) ComparePasswords(hashedPassword, clearPassword, userSalt string) bool {
+	pwd := t.EncryptPassword(clearPassword, userSalt)
+	if pwd == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashedPassword), []byte(pwd)) == 1
+}
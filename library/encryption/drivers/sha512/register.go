@@ -31,7 +31,7 @@ func (r *registerDriver) Identity(id int) string {
 	switch id {
 
 	case gdriver.IdentityShort:
-		return "Standard quality encryption using SHA512 methods"
+		return "Legacy encryption using iterated SHA512 (use pbkdf2 instead)"
 	case gdriver.IdentityLong:
 		return constSha512HelpTemplate
 	}
@@ -2,9 +2,11 @@ package sha512
 
 import (
 	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/base64"
 	"github.com/cgentry/gus/library/encryption"
 	"github.com/cgentry/gdriver"
+	"strconv"
 
 	//"time"
 )
@@ -76,10 +78,32 @@ func (t *PwdSha512) Setup(jsonOption string) encryption.EncryptDriver {
 	return t
 }
 
-func ( t *PwdSha512 )setCost( newCostValue int ){
-	if newCostValue > 0 {
+// MaxCost is the highest number of iterations accepted
+const MaxCost = 100000
+
+func ( t *PwdSha512 )setCost( newCostValue int ) bool {
+	if newCostValue > 0 && newCostValue <= MaxCost {
 		t.Cost = newCostValue
+		return true
 	}
+	return false
+}
+
+// Params returns the cost, which is saved along with the password hash
+func (t *PwdSha512) Params() string {
+	return strconv.Itoa(t.Cost)
+}
+
+// SetParams sets the cost from a saved password hash
+func (t *PwdSha512) SetParams(params string) error {
+	cost, err := strconv.Atoi(params)
+	if err != nil {
+		return err
+	}
+	if !t.setCost(cost) {
+		return encryption.ErrHashParams
+	}
+	return nil
 }
 
 func ( t *PwdSha512 ) setSalt( newEncryptionSalt string ){
@@ -88,15 +112,19 @@ func ( t *PwdSha512 ) setSalt( newEncryptionSalt string ){
 	}
 }
 
-// ComparePasswords must check to see if the passed password is equal to the stored password
+// ComparePasswords must check to see if the passed password is equal to the stored password.
+// The comparison takes the same time no matter where the strings differ.
 func (t *PwdSha512) ComparePasswords(hashedPassword, clearPassword, salt string) bool {
-	return hashedPassword == t.EncryptPassword(clearPassword, salt)
+	pwd := t.EncryptPassword(clearPassword, salt)
+	return subtle.ConstantTimeCompare([]byte(hashedPassword), []byte(pwd)) == 1
 }
 
 const constSha512HelpTemplate = `
-  The SHA512 encryption driver is a reasonable hash method that attempts to balance cost
-  and speed. It will take a password, the users salt, a system salt and hash them into
-  a string.
+  The SHA512 encryption driver is kept so that older passwords can still be checked. It
+  uses its own iteration scheme and should not be selected for new systems: use pbkdf2
+  instead, with "Legacy" set to "sha512" so users are moved over when they next login.
+
+  It will take a password, the users salt, a system salt and hash them into a string.
 
   If you have a cost value > 0, then this is iterated with the previous results making it
   slightly more difficult to crack should the database be comprimised. The system salt should
@@ -111,9 +139,11 @@ const constSha512HelpTemplate = `
       encryption you want added when it is encrypting the password. The salt should
       be a long, random string of any characters. Do not include quotes.
 
-      The cost defaults to '4' and the salt is a very long, random string coded in. You must
-      not change these values after you have selected them or passwords will never match
-      again. You should include a salt in your configuration to increase the security.
+      The cost defaults to '4' and the salt is a very long, random string coded in. The cost
+      is saved with each password, so it can be raised and users will be moved to the new
+      cost when they next login. The highest cost accepted is 100000. You must not change the
+      salt after you have selected it or passwords will never match again. You should include
+      a salt in your configuration to increase the security.
 
   Option format: {"Cost" : 7, "Salt": "abcd...........xyz" }
                  { "Salt": "abc...........xyz" }
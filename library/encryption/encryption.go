@@ -14,7 +14,9 @@ package encryption
 import (
 	"encoding/json"
 	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/record/configure"
 	"strings"
+	"sync"
 )
 
 const DriverGroup = "encryption"
@@ -37,6 +39,12 @@ type CryptOptions struct {
 	StaticSaltIndex int			`json:"StaticSaltIndex"`
 	Cost       int			`json:"Cost"`
 	Salt       string		`json:"Salt"`
+
+	// Memory hard functions (argon2id, scrypt)
+	Memory      int			`json:"Memory"`
+	Time        int			`json:"Time"`
+	Parallelism int			`json:"Parallelism"`
+	BlockSize   int			`json:"BlockSize"`
 }
 
 // Unmarshal a json string containing the common options defined in CryptOptions and return
@@ -60,11 +68,53 @@ func SetDefault(name string) EncryptDriver {
 
 // This will panic if no drivers have been registered
 func GetDefaultDriver() EncryptDriver {
-	return gdriver.MustNewDefault(DriverGroup).(EncryptDriver)
+	return setupDriver(gdriver.MustNewDefault(DriverGroup).(EncryptDriver))
 }
 
 func GetDriver( name string ) EncryptDriver {
-	return gdriver.MustNew( DriverGroup, name ).(EncryptDriver)
+	return setupDriver(gdriver.MustNew( DriverGroup, name ).(EncryptDriver))
+}
+
+// driverOptions holds the configuration options for each driver. A new driver is created
+// for every call, so the options must be kept here to be passed to Setup each time.
+var driverOptions = struct {
+	sync.RWMutex
+	opt map[string]string
+}{opt: make(map[string]string)}
+
+// SetOptions saves the options for a driver (normally from the configuration file). They will
+// be passed to the driver's Setup whenever the driver is created by GetDriver or GetDefaultDriver
+func SetOptions(name, jsonOptions string) {
+	driverOptions.Lock()
+	driverOptions.opt[strings.ToLower(name)] = jsonOptions
+	driverOptions.Unlock()
+}
+
+// Set saves the options for every driver in the configuration, then selects the default and
+// legacy drivers. Passwords are checked by the driver that hashed them, so each driver must keep
+// its own options (e.g. bcrypt's Salt) after the default has been changed.
+func Set(c configure.Encrypt) {
+	for name, jsonOptions := range c.Drivers {
+		SetOptions(name, jsonOptions)
+	}
+	if c.Legacy != "" && c.LegacyOptions != "" {
+		SetOptions(c.Legacy, c.LegacyOptions)
+	}
+	if c.Options != "" {
+		SetOptions(c.Name, c.Options)
+	}
+	SetDefault(c.Name)
+	SetLegacy(c.Legacy)
+}
+
+func setupDriver(drv EncryptDriver) EncryptDriver {
+	driverOptions.RLock()
+	jsonOptions, ok := driverOptions.opt[strings.ToLower(drv.Id())]
+	driverOptions.RUnlock()
+	if ok {
+		return drv.Setup(jsonOptions)
+	}
+	return drv
 }
 
 func GetStaticSalt(offset int) string {
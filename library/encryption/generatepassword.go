@@ -1,10 +1,116 @@
 package encryption
 
-//Generate a simple, dictionary-based password that will make it easy for the user to access
-// The password will consist of a number of words strung together with a separater
+import (
+	"crypto/rand"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// Generate a simple, dictionary-based password that will make it easy for the user to access
+// The password will consist of a number of words strung together with a separater. All of the
+// random choices are made with crypto/rand.
 
 var separator = []string{"&", "-", ".", "_"}
 
-func GeneratePassword() string {
-	return "generated Password"
+var ErrPasswordWords = errors.New("Password generator needs at least one word")
+
+// PasswordGenerator holds the options used to generate a password.
+type PasswordGenerator struct {
+	Words      int    // Number of words in the password
+	Separator  string // Placed between words. If empty, a random separator is picked for each gap
+	Digits     int    // Number of random digits added to the end of the password
+	Capitalize bool   // Capitalize one random word
+}
+
+// NewPasswordGenerator returns a generator with the default options: five words with random
+// separators, two digits and one capitalised word. This gives about 67 bits of entropy.
+func NewPasswordGenerator() *PasswordGenerator {
+	return &PasswordGenerator{
+		Words:      5,
+		Digits:     2,
+		Capitalize: true,
+	}
+}
+
+// GeneratePassword will return a password using the default options.
+func GeneratePassword() (string, error) {
+	return NewPasswordGenerator().Generate()
+}
+
+// Generate will create a new password from the word list.
+func (g *PasswordGenerator) Generate() (string, error) {
+	if g.Words < 1 {
+		return "", ErrPasswordWords
+	}
+	capWord := -1
+	if g.Capitalize {
+		n, err := randomInt(g.Words)
+		if err != nil {
+			return "", err
+		}
+		capWord = n
+	}
+
+	var pwd []string
+	for i := 0; i < g.Words; i++ {
+		if i > 0 {
+			sep := g.Separator
+			if sep == "" {
+				n, err := randomInt(len(separator))
+				if err != nil {
+					return "", err
+				}
+				sep = separator[n]
+			}
+			pwd = append(pwd, sep)
+		}
+		n, err := randomInt(len(passwordWords))
+		if err != nil {
+			return "", err
+		}
+		word := passwordWords[n]
+		if i == capWord {
+			r := []rune(word)
+			r[0] = unicode.ToUpper(r[0])
+			word = string(r)
+		}
+		pwd = append(pwd, word)
+	}
+	for i := 0; i < g.Digits; i++ {
+		n, err := randomInt(10)
+		if err != nil {
+			return "", err
+		}
+		pwd = append(pwd, string(rune('0'+n)))
+	}
+	return strings.Join(pwd, ""), nil
+}
+
+// Entropy returns the number of bits of entropy in a password created with these options. This
+// assumes the attacker knows the word list and the options used.
+func (g *PasswordGenerator) Entropy() float64 {
+	if g.Words < 1 {
+		return 0
+	}
+	bits := float64(g.Words) * math.Log2(float64(len(passwordWords)))
+	if g.Separator == "" {
+		bits += float64(g.Words-1) * math.Log2(float64(len(separator)))
+	}
+	bits += float64(g.Digits) * math.Log2(10)
+	if g.Capitalize {
+		bits += math.Log2(float64(g.Words))
+	}
+	return bits
+}
+
+// randomInt returns a random number from 0 to max-1
+func randomInt(max int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0, err
+	}
+	return int(n.Int64()), nil
 }
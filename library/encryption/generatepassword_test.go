@@ -0,0 +1,72 @@
+package encryption
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestWordList(t *testing.T) {
+	if len(passwordWords) != 1024 {
+		t.Errorf("Word list should have 1024 words, not %d", len(passwordWords))
+	}
+	seen := make(map[string]bool)
+	for _, word := range passwordWords {
+		if seen[word] {
+			t.Errorf("Duplicate word '%s'", word)
+		}
+		seen[word] = true
+		if word != strings.ToLower(word) || strings.ContainsAny(word, strings.Join(separator, "")) {
+			t.Errorf("Word '%s' should be lower case with no separators", word)
+		}
+	}
+}
+
+func TestGeneratePassword(t *testing.T) {
+	pwd, err := GeneratePassword()
+	if err != nil {
+		t.Fatalf("GeneratePassword returned error: %s", err.Error())
+	}
+	if len(pwd) < 20 {
+		t.Errorf("Password is too short: '%s'", pwd)
+	}
+	if !unicode.IsDigit(rune(pwd[len(pwd)-1])) || !unicode.IsDigit(rune(pwd[len(pwd)-2])) {
+		t.Errorf("Password should end with two digits: '%s'", pwd)
+	}
+	if pwd == strings.ToLower(pwd) {
+		t.Errorf("Password should have a capital letter: '%s'", pwd)
+	}
+	pwd2, _ := GeneratePassword()
+	if pwd == pwd2 {
+		t.Errorf("Passwords should not repeat: '%s'", pwd)
+	}
+}
+
+func TestGenerateOptions(t *testing.T) {
+	g := &PasswordGenerator{Words: 3, Separator: " "}
+	pwd, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate returned error: %s", err.Error())
+	}
+	words := strings.Split(pwd, " ")
+	if len(words) != 3 {
+		t.Errorf("Password should have 3 words: '%s'", pwd)
+	}
+	if pwd != strings.ToLower(pwd) {
+		t.Errorf("Password should not have a capital letter: '%s'", pwd)
+	}
+	if g.Entropy() != 30 {
+		t.Errorf("Entropy should be 30 bits, not %f", g.Entropy())
+	}
+
+	g.Words = 0
+	if _, err = g.Generate(); err != ErrPasswordWords {
+		t.Errorf("Expected an error for no words")
+	}
+	if g.Entropy() != 0 {
+		t.Errorf("Entropy should be 0 for no words")
+	}
+	if e := NewPasswordGenerator().Entropy(); e < 66 || e > 68 {
+		t.Errorf("Default entropy should be about 67 bits, not %f", e)
+	}
+}
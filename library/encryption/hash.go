@@ -0,0 +1,136 @@
+package encryption
+
+import (
+	"errors"
+	"github.com/cgentry/gdriver"
+	"strings"
+	"sync"
+)
+
+// HashSeparator is used to separate the parts of a stored password. A stored password has
+// the format:
+//
+//	$driver$parameters$hash
+//
+// which allows the password to be checked even if the default driver, or the driver's
+// parameters (such as cost), have been changed since the password was set.
+const HashSeparator = "$"
+
+// Parameterizer is implemented by drivers whose hash depends upon parameters that can be
+// changed in the configuration, such as cost. The parameters are saved with the hash.
+type Parameterizer interface {
+	Params() string
+	SetParams(params string) error
+}
+
+// LegacyHasher is implemented by drivers that hashed passwords differently before the driver and
+// parameters were saved with the hash. SetLegacyHash is called before an unversioned password
+// is checked.
+type LegacyHasher interface {
+	SetLegacyHash()
+}
+
+// legacyDriver is used to check passwords that were saved without the driver prefix.
+var legacyDriver = struct {
+	sync.RWMutex
+	name string
+}{}
+
+// SetLegacy selects the driver used for passwords that were saved before the driver was recorded
+// with the hash. When it isn't set (""), the default driver is used. This allows the default to be
+// changed (e.g. from sha512 to pbkdf2) and old passwords to be re-encrypted on the next login.
+func SetLegacy(name string) {
+	legacyDriver.Lock()
+	legacyDriver.name = name
+	legacyDriver.Unlock()
+}
+
+var ErrUnknownHash = errors.New("Password hash was not created by a registered driver")
+
+// ErrHashParams is returned by SetParams when a saved parameter is outside of the driver's
+// limits. A bad record could otherwise tie up the CPU, or memory, on every login.
+var ErrHashParams = errors.New("Password hash parameters are out of range")
+
+// HashPassword will encrypt the password with the default driver and return the hash
+// prefixed with the driver id and parameters.
+func HashPassword(clearPassword, salt string) string {
+	return EncodeHash(GetDefaultDriver(), clearPassword, salt)
+}
+
+// EncodeHash will encrypt the password with the driver passed and return the hash prefixed
+// with the driver id and parameters.
+func EncodeHash(drv EncryptDriver, clearPassword, salt string) string {
+	return HashSeparator + drv.Id() +
+		HashSeparator + driverParams(drv) +
+		HashSeparator + drv.EncryptPassword(clearPassword, salt)
+}
+
+// ParseHash splits a stored password into the driver name, parameters and hash. Passwords that
+// were saved before versioning was added have no prefix and ok will be false.
+func ParseHash(stored string) (name, params, hash string, ok bool) {
+	if !strings.HasPrefix(stored, HashSeparator) {
+		return "", "", stored, false
+	}
+	parts := strings.SplitN(stored, HashSeparator, 4)
+	if len(parts) != 4 || parts[1] == "" || !gdriver.IsRegistered(DriverGroup, parts[1]) {
+		return "", "", stored, false // e.g. a raw bcrypt hash: $2a$07$...
+	}
+	return parts[1], parts[2], parts[3], true
+}
+
+// DriverForHash returns the driver that created the stored password, set up with the parameters
+// it was created with, along with the bare hash. Unversioned passwords use the legacy driver,
+// if one is set, otherwise the default driver.
+func DriverForHash(stored string) (EncryptDriver, string, error) {
+	name, params, hash, ok := ParseHash(stored)
+	if !ok {
+		legacyDriver.RLock()
+		legacy := legacyDriver.name
+		legacyDriver.RUnlock()
+		drv := GetDefaultDriver()
+		if legacy != "" {
+			drv = GetDriver(legacy)
+		}
+		if l, isLegacy := drv.(LegacyHasher); isLegacy {
+			l.SetLegacyHash()
+		}
+		return drv, hash, nil
+	}
+	drv := GetDriver(name)
+	if p, isParam := drv.(Parameterizer); isParam {
+		if err := p.SetParams(params); err != nil {
+			return nil, hash, err
+		}
+	} else if params != "" {
+		return nil, hash, ErrUnknownHash
+	}
+	return drv, hash, nil
+}
+
+// ComparePassword checks the clear password against the stored password, using whichever driver
+// created the stored password.
+func ComparePassword(stored, clearPassword, salt string) bool {
+	drv, hash, err := DriverForHash(stored)
+	if err != nil {
+		return false
+	}
+	return drv.ComparePasswords(hash, clearPassword, salt)
+}
+
+// NeedsRehash returns true if the stored password wasn't created by the default driver using
+// the current parameters. The password should be re-encrypted when the user next logs in.
+func NeedsRehash(stored string) bool {
+	name, params, _, ok := ParseHash(stored)
+	if !ok {
+		return true
+	}
+	drv := GetDefaultDriver()
+	return !strings.EqualFold(name, drv.Id()) || params != driverParams(drv)
+}
+
+func driverParams(drv EncryptDriver) string {
+	if p, ok := drv.(Parameterizer); ok {
+		return p.Params()
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package encryption
+
+import (
+	"encoding/json"
+	"github.com/cgentry/gdriver"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// costCrypt is a driver that has a cost parameter and understands Setup options
+type costCrypt struct {
+	Cost int
+	Salt string
+}
+type tCostDriver struct{}
+
+func (t *tCostDriver) New() interface{} { return &costCrypt{Cost: 1} }
+func (t *tCostDriver) Identity(id int) string {
+	switch id {
+	case gdriver.IdentityShort:
+		return "short"
+	case gdriver.IdentityLong:
+		return "long"
+	}
+	return "costcrypt"
+}
+
+func (m *costCrypt) EncryptPassword(password string, salt string) string {
+	return strconv.Itoa(m.Cost) + "/" + password + "/" + salt + "/" + m.Salt
+}
+func (m *costCrypt) ComparePasswords(hash, password, salt string) bool {
+	return hash == m.EncryptPassword(password, salt)
+}
+func (m *costCrypt) Setup(options string) EncryptDriver {
+	json.Unmarshal([]byte(options), m)
+	return m
+}
+func (m *costCrypt) Params() string { return strconv.Itoa(m.Cost) }
+func (m *costCrypt) SetParams(params string) (err error) {
+	m.Cost, err = strconv.Atoi(params)
+	return
+}
+func (m *costCrypt) Id() string        { return "costcrypt" }
+func (m *costCrypt) ShortHelp() string { return "short" }
+func (m *costCrypt) LongHelp() string  { return "long" }
+
+func registerCostDriver() {
+	if !gdriver.IsRegistered(DriverGroup, "costcrypt") {
+		gdriver.Register(DriverGroup, &tCostDriver{})
+	}
+}
+
+func TestHashVersioning(t *testing.T) {
+	registerCostDriver()
+	SetDefault("costcrypt")
+	SetOptions("costcrypt", `{"Cost": 3, "Salt": "pepper"}`)
+
+	stored := HashPassword("password", "salt")
+	if stored != "$costcrypt$3$3/password/salt/pepper" {
+		t.Fatalf("Hash was not prefixed correctly: '%s'", stored)
+	}
+	name, params, hash, ok := ParseHash(stored)
+	if !ok || name != "costcrypt" || params != "3" || hash != "3/password/salt/pepper" {
+		t.Errorf("ParseHash returned '%s', '%s', '%s', %t", name, params, hash, ok)
+	}
+	if !ComparePassword(stored, "password", "salt") {
+		t.Error("Password did not compare")
+	}
+	if ComparePassword(stored, "wrong", "salt") {
+		t.Error("Wrong password compared")
+	}
+	if NeedsRehash(stored) {
+		t.Error("Current hash should not need rehash")
+	}
+
+	// Raise the cost: the old password must still work but should be rehashed
+	SetOptions("costcrypt", `{"Cost": 5, "Salt": "pepper"}`)
+	if !ComparePassword(stored, "password", "salt") {
+		t.Error("Password did not compare after cost changed")
+	}
+	if !NeedsRehash(stored) {
+		t.Error("Old cost should need rehash")
+	}
+	if !strings.HasPrefix(HashPassword("password", "salt"), "$costcrypt$5$") {
+		t.Error("New hash should use new cost")
+	}
+}
+
+func TestHashUnversioned(t *testing.T) {
+	registerCostDriver()
+	SetDefault("costcrypt")
+	SetOptions("costcrypt", `{"Cost": 2, "Salt": ""}`)
+
+	for _, legacy := range []string{"2/password/salt/", "$2a$07$abcdefg"} {
+		if _, _, hash, ok := ParseHash(legacy); ok || hash != legacy {
+			t.Errorf("'%s' should not be versioned", legacy)
+		}
+		if !NeedsRehash(legacy) {
+			t.Errorf("'%s' should need rehash", legacy)
+		}
+	}
+	if !ComparePassword("2/password/salt/", "password", "salt") {
+		t.Error("Unversioned password should use the default driver")
+	}
+	if ComparePassword("$costcrypt$bad$2/password/salt/", "password", "salt") {
+		t.Error("Bad parameters should not compare")
+	}
+}
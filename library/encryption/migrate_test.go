@@ -0,0 +1,73 @@
+package encryption_test
+
+import (
+	"github.com/cgentry/gus/library/encryption"
+	"github.com/cgentry/gus/record/configure"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// TestSwitchDefaultDriver changes the encryption driver, as an operator would in the
+// configuration, and checks that passwords saved by the old driver still work.
+func TestSwitchDefaultDriver(t *testing.T) {
+	const pwd = "Migrate Passw0rd"
+	const salt = "user salt"
+	drivers := map[string]string{
+		"bcrypt": `{"Salt": "A site salt that is not the default"}`,
+	}
+	defer encryption.SetOptions("bcrypt", "")
+
+	Convey("Old passwords are checked with their own driver's options", t, func() {
+		encryption.Set(configure.Encrypt{Name: "bcrypt", Drivers: drivers})
+		stored := encryption.HashPassword(pwd, salt)
+
+		encryption.Set(configure.Encrypt{Name: "pbkdf2", Drivers: drivers})
+		So(encryption.GetDefaultDriver().Id(), ShouldEqual, "pbkdf2")
+		So(encryption.ComparePassword(stored, pwd, salt), ShouldBeTrue)
+		So(encryption.ComparePassword(stored, pwd+"x", salt), ShouldBeFalse)
+		So(encryption.NeedsRehash(stored), ShouldBeTrue)
+
+		Convey("and fail without them", func() {
+			encryption.SetOptions("bcrypt", "")
+			So(encryption.ComparePassword(stored, pwd, salt), ShouldBeFalse)
+		})
+	})
+
+	Convey("Options replace the encryption driver's entry in Drivers", t, func() {
+		encryption.Set(configure.Encrypt{Name: "bcrypt", Options: `{"Salt": "Another salt"}`, Drivers: drivers})
+		stored := encryption.HashPassword(pwd, salt)
+
+		encryption.Set(configure.Encrypt{Name: "pbkdf2", Drivers: drivers})
+		So(encryption.ComparePassword(stored, pwd, salt), ShouldBeFalse)
+	})
+}
+
+// TestLegacyMigration moves from sha512, saved before the driver was recorded with the hash
+// and using its own salt, to pbkdf2.
+func TestLegacyMigration(t *testing.T) {
+	const pwd = "Legacy Passw0rd"
+	const salt = "user salt"
+	const legacyOptions = `{"Salt": "The salt the old site was set up with"}`
+	defer encryption.SetOptions("sha512", "")
+
+	Convey("Legacy passwords are checked with the legacy driver's options", t, func() {
+		encryption.SetOptions("sha512", legacyOptions)
+		stored := encryption.GetDriver("sha512").EncryptPassword(pwd, salt)
+		encryption.SetOptions("sha512", "")
+
+		encryption.Set(configure.Encrypt{Name: "pbkdf2", Legacy: "sha512", LegacyOptions: legacyOptions})
+		So(encryption.ComparePassword(stored, pwd, salt), ShouldBeTrue)
+		So(encryption.ComparePassword(stored, pwd+"x", salt), ShouldBeFalse)
+		So(encryption.NeedsRehash(stored), ShouldBeTrue)
+
+		rehashed := encryption.HashPassword(pwd, salt)
+		So(rehashed, ShouldStartWith, "$pbkdf2$")
+		So(encryption.ComparePassword(rehashed, pwd, salt), ShouldBeTrue)
+		So(encryption.NeedsRehash(rehashed), ShouldBeFalse)
+
+		Convey("and fail without them", func() {
+			encryption.SetOptions("sha512", "")
+			So(encryption.ComparePassword(stored, pwd, salt), ShouldBeFalse)
+		})
+	})
+}
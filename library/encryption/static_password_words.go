@@ -0,0 +1,101 @@
+// This is the compiled in word list used to generate passwords. There are exactly 1024
+// words, so every word that is picked adds 10 bits of entropy to the password. The words
+// are short, common and easy to type. If you change the list, keep the length a power of
+// two and make sure there are no duplicates.
+
+package encryption
+
+var passwordWords = []string{
+	"able", "about", "above", "abuse", "acid", "acorn", "actor", "acute", "admit", "adopt", "adult",
+	"after", "again", "aged", "agent", "agile", "agree", "ahead", "alarm", "album", "alert", "alike",
+	"alive", "allow", "alone", "along", "also", "alter", "amber", "among", "anger", "angle", "angry",
+	"ankle", "apart", "apple", "apply", "apron", "arch", "area", "arena", "argue", "arise", "army",
+	"array", "aside", "asset", "attic", "audio", "audit", "avoid", "award", "aware", "away", "baby",
+	"back", "bacon", "badge", "badly", "bagel", "baker", "ball", "balmy", "band", "banjo", "bank",
+	"barn", "base", "bases", "basic", "basil", "basis", "bath", "beach", "bean", "bear", "beard",
+	"beat", "been", "beer", "began", "begin", "begun", "being", "bell", "below", "belt", "bench",
+	"berry", "best", "bike", "bill", "bird", "birth", "black", "blame", "blaze", "blend", "blind",
+	"blink", "block", "blood", "bloom", "blow", "blue", "bluff", "blunt", "blush", "board", "boat",
+	"body", "bond", "bone", "bonus", "book", "boom", "boost", "boot", "booth", "born", "boss", "both",
+	"bound", "bowl", "brain", "brand", "brave", "bread", "break", "breed", "brick", "brief", "bring",
+	"brisk", "broad", "broke", "broom", "brown", "brush", "buddy", "bugle", "build", "built", "bulk",
+	"bunny", "burn", "bush", "busy", "buyer", "cabin", "cable", "cake", "call", "calm", "came",
+	"camel", "camp", "candy", "canoe", "card", "care", "cargo", "carry", "case", "cash", "cast",
+	"catch", "cause", "cedar", "cell", "chain", "chair", "chalk", "chart", "chase", "chat", "cheap",
+	"check", "chess", "chest", "chief", "child", "chip", "chose", "cider", "city", "civil", "claim",
+	"class", "clay", "clean", "clear", "click", "cliff", "cloak", "clock", "close", "cloud", "club",
+	"coach", "coal", "coast", "coat", "cocoa", "code", "cold", "come", "comet", "cook", "cool",
+	"cope", "copy", "coral", "cord", "core", "corn", "cost", "could", "count", "court", "cover",
+	"craft", "crane", "crash", "cream", "creek", "crew", "crime", "crisp", "crop", "cross", "crowd",
+	"crown", "crumb", "curve", "cycle", "daily", "dairy", "daisy", "dance", "dark", "data", "date",
+	"dated", "dawn", "days", "dead", "deal", "dealt", "dean", "dear", "death", "debt", "debut",
+	"deep", "delay", "delta", "denim", "deny", "depth", "desk", "dial", "diet", "disc", "disk",
+	"dock", "does", "doing", "done", "door", "dose", "doubt", "down", "dozen", "draft", "drama",
+	"draw", "drawn", "dream", "dress", "drew", "drift", "drill", "drink", "drive", "drop", "drove",
+	"drug", "drum", "dual", "duck", "duke", "dune", "dust", "duty", "each", "eager", "eagle", "early",
+	"earn", "earth", "ease", "easel", "east", "easy", "echo", "edge", "eight", "elbow", "elite",
+	"else", "ember", "empty", "enemy", "enjoy", "enter", "entry", "equal", "equip", "error", "even",
+	"event", "ever", "every", "exact", "exist", "exit", "extra", "fable", "face", "fact", "fail",
+	"fair", "faith", "fall", "false", "fancy", "farm", "fast", "fate", "fault", "fear", "feed",
+	"feel", "feet", "fell", "felt", "fern", "ferry", "fiber", "field", "fifth", "fifty", "fight",
+	"file", "fill", "film", "final", "find", "fine", "fire", "firm", "first", "fish", "five", "fixed",
+	"flame", "flash", "flat", "fleet", "flint", "flock", "floor", "flow", "fluid", "flute", "foam",
+	"focus", "food", "foot", "force", "form", "fort", "forth", "forty", "forum", "found", "four",
+	"fox", "frame", "frank", "fraud", "free", "fresh", "from", "front", "frost", "fruit", "fudge",
+	"fuel", "full", "fully", "fund", "funny", "gain", "game", "gate", "gave", "gear", "gene", "giant",
+	"gift", "girl", "give", "given", "glad", "glass", "glide", "globe", "glove", "goal", "goes",
+	"going", "gold", "golf", "gone", "good", "goose", "grace", "grade", "grand", "grant", "grass",
+	"gravy", "gray", "great", "green", "grew", "grey", "grid", "grin", "gross", "group", "grove",
+	"grow", "grown", "guard", "guess", "guest", "guide", "gulf", "habit", "hair", "half", "hall",
+	"hand", "hang", "happy", "hard", "harm", "hate", "have", "hazel", "head", "hear", "heart", "heat",
+	"heavy", "hedge", "held", "help", "hence", "here", "hero", "high", "hill", "hire", "hobby",
+	"hold", "hole", "holy", "home", "honey", "hope", "horse", "host", "hotel", "hour", "house",
+	"huge", "human", "hung", "hunt", "hurt", "husky", "idea", "ideal", "igloo", "image", "inch",
+	"index", "inlet", "inner", "input", "into", "iron", "issue", "item", "ivory", "jack", "jelly",
+	"jewel", "join", "joint", "jolly", "judge", "jump", "jury", "just", "kayak", "keen", "keep",
+	"kept", "kick", "kind", "king", "knee", "knew", "know", "known", "koala", "label", "lack", "lady",
+	"laid", "lake", "land", "lane", "large", "laser", "last", "latch", "late", "later", "laugh",
+	"lava", "layer", "lead", "learn", "lease", "least", "leave", "left", "legal", "lemon", "less",
+	"level", "life", "lift", "light", "like", "lilac", "lily", "limit", "line", "linen", "link",
+	"links", "list", "live", "lives", "llama", "load", "loan", "lobby", "local", "lock", "logic",
+	"logo", "long", "look", "loose", "lord", "lose", "loss", "lost", "lotus", "love", "lower", "luck",
+	"lucky", "lunar", "lunch", "lying", "made", "magic", "mail", "main", "major", "make", "maker",
+	"male", "mango", "many", "maple", "march", "mark", "mass", "match", "maybe", "mayor", "meal",
+	"mean", "meant", "meat", "media", "meet", "melon", "menu", "mere", "metal", "might", "mile",
+	"milk", "mill", "mind", "mine", "minor", "mint", "minus", "miss", "mixed", "mode", "model",
+	"money", "month", "mood", "moon", "moral", "more", "moss", "most", "motor", "mount", "mouse",
+	"mouth", "move", "movie", "much", "mural", "music", "must", "name", "navy", "near", "neck",
+	"need", "needs", "nest", "never", "newly", "news", "next", "nice", "night", "nine", "noble",
+	"noise", "none", "north", "nose", "note", "noted", "novel", "nurse", "oasis", "occur", "ocean",
+	"offer", "often", "okay", "olive", "once", "onion", "only", "opal", "open", "oral", "orbit",
+	"order", "other", "otter", "ought", "over", "pace", "pack", "page", "paid", "pain", "paint",
+	"pair", "palm", "panda", "panel", "paper", "park", "part", "party", "pass", "past", "path",
+	"peace", "peach", "peak", "pecan", "phase", "phone", "photo", "piano", "pick", "piece", "pilot",
+	"pine", "pink", "pipe", "pitch", "place", "plain", "plan", "plane", "plant", "plate", "play",
+	"plot", "plug", "plum", "plus", "poem", "point", "polar", "poll", "pony", "pool", "poor", "poppy",
+	"port", "post", "pound", "power", "press", "price", "pride", "prime", "print", "prior", "prism",
+	"prize", "proof", "proud", "prove", "pull", "puppy", "pure", "push", "quail", "queen", "quick",
+	"quiet", "quill", "quite", "race", "radar", "radio", "rail", "rain", "raise", "range", "rank",
+	"rapid", "rare", "rate", "ratio", "raven", "reach", "read", "ready", "real", "rear", "reef",
+	"refer", "rely", "rent", "rest", "rice", "rich", "ride", "ridge", "right", "ring", "rise", "risk",
+	"rival", "river", "road", "rock", "rodeo", "role", "roll", "roman", "roof", "room", "root",
+	"rose", "rough", "round", "route", "rover", "royal", "ruby", "rule", "rural", "rush", "safe",
+	"said", "sake", "sale", "salt", "same", "sand", "satin", "save", "scale", "scarf", "scene",
+	"scope", "score", "scout", "seat", "seed", "seek", "seem", "seen", "self", "sell", "send",
+	"sense", "sent", "serve", "seven", "shall", "shape", "share", "sharp", "sheet", "shelf", "shell",
+	"shift", "ship", "shirt", "shock", "shoot", "shop", "short", "shot", "show", "shown", "shut",
+	"sick", "side", "sight", "sign", "silk", "since", "site", "sixth", "sixty", "size", "sized",
+	"skill", "skin", "sled", "sleep", "slide", "slip", "slope", "slow", "small", "smart", "smile",
+	"smoke", "snow", "sock", "sofa", "soft", "soil", "sold", "sole", "solid", "solve", "some", "song",
+	"sonic", "soon", "sorry", "sort", "soul", "sound", "south", "space", "spare", "spark", "speak",
+	"speed", "spend", "spent", "spice", "split", "spoke", "sport", "spot", "squid", "staff", "stage",
+	"stake", "stamp", "stand", "star", "start", "stay", "step", "stop", "such", "suit", "sure",
+	"swan", "take", "tale", "talk", "tall", "tank", "tape", "task", "team", "tech", "tell", "tend",
+	"term", "test", "text", "than", "that", "them", "then", "they", "thin", "this", "thus", "till",
+	"time", "tiny", "told", "toll", "tone", "tour", "town", "tree", "trip", "true", "tune", "turn",
+	"twin", "type", "unit", "upon", "used", "user", "vary", "vast", "very", "vice", "view", "vote",
+	"wage", "wait", "wake", "walk", "wall", "want", "ward", "warm", "wash", "wave", "ways", "weak",
+	"wear", "week", "well", "went", "were", "west", "what", "when", "whom", "wide", "wife", "wild",
+	"will", "wind", "wine", "wing", "wire", "wise", "wish", "with", "wood", "word", "wore", "work",
+	"yard", "yeah", "year", "your", "zero", "zone",
+}
@@ -0,0 +1,64 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/base64"
+)
+
+// JWK is the JSON Web Key form of a public key (RFC 7517, with RFC 8037 for Ed25519)
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document published at /keys/
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK converts a public key to a JWK. Only Ed25519 and P-256 keys are supported;
+// any other key returns false.
+func NewJWK(kid string, public crypto.PublicKey) (JWK, bool) {
+	switch public := public.(type) {
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", Kid: kid, Alg: ALG_EDDSA, Use: "sig",
+			X: base64.RawURLEncoding.EncodeToString(public)}, true
+	case *ecdsa.PublicKey:
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		public.X.FillBytes(x)
+		public.Y.FillBytes(y)
+		return JWK{Kty: "EC", Crv: "P-256", Kid: kid, Alg: ALG_ES256, Use: "sig",
+			X: base64.RawURLEncoding.EncodeToString(x),
+			Y: base64.RawURLEncoding.EncodeToString(y)}, true
+	}
+	return JWK{}, false
+}
+
+// JWKS returns the published keys (current and previous) as a JWK set.
+func (k *KeyStore) JWKS() *JWKSet {
+	set := &JWKSet{Keys: []JWK{}}
+	for _, key := range k.Published() {
+		if jwk, ok := NewJWK(key.Id, key.PublicKey()); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// Add puts a key into the set unless one with the same id is already there.
+func (set *JWKSet) Add(jwk JWK) {
+	for _, have := range set.Keys {
+		if have.Kid == jwk.Kid {
+			return
+		}
+	}
+	set.Keys = append(set.Keys, jwk)
+}
@@ -0,0 +1,389 @@
+// Package keystore holds the asymmetric keys gus signs with. The keys are kept in a single file
+// with the private keys encrypted (AES-256-GCM, with the key derived from a passphrase by scrypt).
+//
+// There is one 'current' key, used for all new signatures, and any number of 'previous' keys.
+// Previous keys are still published (see JWKS) so signatures made before a rotation can be
+// checked. Once nothing signed by a previous key is in use, it can be retired. Retired keys
+// stay in the file but are no longer published.
+//
+// The running service uses the keys set with:
+//
+//	keystore.Set(keys)
+package keystore
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	. "github.com/cgentry/gus/ecode"
+	"golang.org/x/crypto/scrypt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signing algorithms. These are the JWA names.
+const (
+	ALG_EDDSA = "EdDSA"
+	ALG_ES256 = "ES256"
+)
+
+// Key status
+const (
+	STATUS_CURRENT  = "current"
+	STATUS_PREVIOUS = "previous"
+	STATUS_RETIRED  = "retired"
+)
+
+// PASSPHRASE_ENV is the environment variable read when the configuration has no passphrase.
+const PASSPHRASE_ENV = "GUS_KEYS_PASSPHRASE"
+
+// scrypt parameters used to turn the passphrase into the file's encryption key
+const (
+	kdfCost      = 1 << 15
+	kdfBlockSize = 8
+	kdfParallel  = 1
+	kdfKeyLength = 32
+)
+
+// Key is a single signing key. The private key is only held in memory; the file holds
+// the encrypted copy.
+type Key struct {
+	Id        string
+	Algorithm string
+	Status    string
+	CreatedAt time.Time
+	RotatedAt time.Time // When it stopped being the current key
+	RetiredAt time.Time
+
+	Public  []byte // PKIX encoded public key
+	Private []byte // Encrypted PKCS8 private key (nonce + sealed key)
+
+	private crypto.Signer
+}
+
+// KeyStore is the set of keys and the file they are kept in.
+type KeyStore struct {
+	mu       sync.RWMutex
+	filename string
+	aead     cipher.AEAD
+
+	Salt []byte
+	Keys []*Key
+}
+
+// Passphrase returns the passphrase to use. If none is given, the environment is checked.
+func Passphrase(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	return os.Getenv(PASSPHRASE_ENV)
+}
+
+// Open will load the key store from the file. If the file doesn't exist, an empty store is
+// returned and the file is created on the first Save. A wrong passphrase returns ErrKeyPassphrase.
+func Open(filename, passphrase string) (*KeyStore, error) {
+	if passphrase == "" {
+		return nil, ErrKeyPassphrase
+	}
+	k := &KeyStore{filename: filename}
+	buff, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(buff) > 0 {
+		if err = json.Unmarshal(buff, k); err != nil {
+			return nil, err
+		}
+	} else {
+		k.Salt = make([]byte, 32)
+		if _, err = rand.Read(k.Salt); err != nil {
+			return nil, err
+		}
+	}
+	if err = k.setPassphrase(passphrase); err != nil {
+		return nil, err
+	}
+	for _, key := range k.Keys {
+		if err = k.unseal(key); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func (k *KeyStore) setPassphrase(passphrase string) error {
+	secret, err := scrypt.Key([]byte(passphrase), k.Salt, kdfCost, kdfBlockSize, kdfParallel, kdfKeyLength)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return err
+	}
+	k.aead, err = cipher.NewGCM(block)
+	return err
+}
+
+// unseal decrypts the private key. The key id is used as additional data so a key
+// can't be swapped for another in the file.
+func (k *KeyStore) unseal(key *Key) error {
+	size := k.aead.NonceSize()
+	if len(key.Private) < size {
+		return ErrKeyPassphrase
+	}
+	der, err := k.aead.Open(nil, key.Private[:size], key.Private[size:], []byte(key.Id))
+	if err != nil {
+		return ErrKeyPassphrase
+	}
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return ErrKeyAlgorithm
+	}
+	key.private = signer
+	return nil
+}
+
+func (k *KeyStore) seal(key *Key) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+	key.Private = k.aead.Seal(nonce, nonce, der, []byte(key.Id))
+	return nil
+}
+
+// Save writes the key store out to its file. The file is replaced in one step so a
+// failure can't leave half a key store behind.
+func (k *KeyStore) Save() error {
+	k.mu.RLock()
+	buff, err := json.MarshalIndent(k, "", "  ")
+	k.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp := k.filename + ".tmp"
+	if err = ioutil.WriteFile(tmp, buff, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.filename)
+}
+
+// Filename returns the file the keys are kept in
+func (k *KeyStore) Filename() string {
+	return k.filename
+}
+
+// NewKey generates a new key for the algorithm. It is not part of any store.
+func NewKey(algorithm string) (*Key, error) {
+	var private crypto.Signer
+	var err error
+
+	switch strings.ToLower(algorithm) {
+	case strings.ToLower(ALG_EDDSA):
+		algorithm = ALG_EDDSA
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case strings.ToLower(ALG_ES256):
+		algorithm = ALG_ES256
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, ErrKeyAlgorithm
+	}
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(public)
+	return &Key{
+		Id:        base64.RawURLEncoding.EncodeToString(sum[:8]),
+		Algorithm: algorithm,
+		CreatedAt: time.Now(),
+		Public:    public,
+		private:   private,
+	}, nil
+}
+
+// Rotate creates a new current key. The old current key becomes a previous key.
+func (k *KeyStore) Rotate(algorithm string) (*Key, error) {
+	key, err := NewKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	key.Status = STATUS_CURRENT
+	if err = k.seal(key); err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := time.Now()
+	for _, old := range k.Keys {
+		if old.Status == STATUS_CURRENT {
+			old.Status = STATUS_PREVIOUS
+			old.RotatedAt = now
+		}
+	}
+	k.Keys = append(k.Keys, key)
+	return key, nil
+}
+
+// Retire stops a previous key from being published. The current key can't be retired.
+func (k *KeyStore) Retire(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range k.Keys {
+		if key.Id == id {
+			if key.Status == STATUS_CURRENT {
+				return ErrKeyCurrent
+			}
+			if key.Status != STATUS_RETIRED {
+				key.Status = STATUS_RETIRED
+				key.RetiredAt = time.Now()
+			}
+			return nil
+		}
+	}
+	return ErrKeyNotFound
+}
+
+// Current returns the key used for new signatures, or nil if there isn't one.
+func (k *KeyStore) Current() *Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.Keys {
+		if key.Status == STATUS_CURRENT {
+			return key
+		}
+	}
+	return nil
+}
+
+// Find returns the key with the id
+func (k *KeyStore) Find(id string) (*Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.Keys {
+		if key.Id == id {
+			return key, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+// List returns all of the keys, newest first.
+func (k *KeyStore) List() []*Key {
+	k.mu.RLock()
+	list := make([]*Key, len(k.Keys))
+	copy(list, k.Keys)
+	k.mu.RUnlock()
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Published returns the keys that signatures can be checked with: the current and previous keys.
+func (k *KeyStore) Published() []*Key {
+	var list []*Key
+	for _, key := range k.List() {
+		if key.Status != STATUS_RETIRED {
+			list = append(list, key)
+		}
+	}
+	return list
+}
+
+// KeyId returns the key's identifier. This is the 'kid' in the JWKS.
+func (key *Key) KeyId() string {
+	return key.Id
+}
+
+// PrivateKey returns the decrypted private key
+func (key *Key) PrivateKey() crypto.Signer {
+	return key.private
+}
+
+// PublicKey returns the public key
+func (key *Key) PublicKey() crypto.PublicKey {
+	if key.private != nil {
+		return key.private.Public()
+	}
+	public, _ := x509.ParsePKIXPublicKey(key.Public)
+	return public
+}
+
+// Sign the message with the key. ES256 signatures are the 64 byte r||s form used by JWS.
+func (key *Key) Sign(message []byte) ([]byte, error) {
+	switch private := key.private.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(private, message), nil
+	case *ecdsa.PrivateKey:
+		sum := sha256.Sum256(message)
+		r, s, err := ecdsa.Sign(rand.Reader, private, sum[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	}
+	return nil, ErrKeyAlgorithm
+}
+
+// Verify checks a signature made by Sign against the public key.
+func Verify(public crypto.PublicKey, message, sig []byte) bool {
+	switch public := public.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(public, message, sig)
+	case *ecdsa.PublicKey:
+		if len(sig) != 64 {
+			return false
+		}
+		sum := sha256.Sum256(message)
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(public, sum[:], r, s)
+	}
+	return false
+}
+
+var current struct {
+	sync.RWMutex
+	keys *KeyStore
+}
+
+// Set the key store used by the service
+func Set(k *KeyStore) {
+	current.Lock()
+	current.keys = k
+	current.Unlock()
+}
+
+// Get the key store used by the service. If none is set, nil is returned.
+func Get() *KeyStore {
+	current.RLock()
+	defer current.RUnlock()
+	return current.keys
+}
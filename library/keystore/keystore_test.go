@@ -0,0 +1,92 @@
+package keystore
+
+import (
+	. "github.com/cgentry/gus/ecode"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyStore(t *testing.T) {
+	Convey("A new key store is empty until a key is rotated in", t, func() {
+		file := filepath.Join(t.TempDir(), "keys.json")
+		_, err := Open(file, "")
+		So(err, ShouldEqual, ErrKeyPassphrase)
+
+		k, err := Open(file, "secret")
+		So(err, ShouldBeNil)
+		So(k.Current(), ShouldBeNil)
+		So(len(k.JWKS().Keys), ShouldEqual, 0)
+
+		_, err = k.Rotate("rsa")
+		So(err, ShouldEqual, ErrKeyAlgorithm)
+
+		first, err := k.Rotate("eddsa")
+		So(err, ShouldBeNil)
+		So(first.Algorithm, ShouldEqual, ALG_EDDSA)
+		So(k.Current(), ShouldEqual, first)
+
+		second, err := k.Rotate(ALG_ES256)
+		So(err, ShouldBeNil)
+		So(k.Current(), ShouldEqual, second)
+		So(first.Status, ShouldEqual, STATUS_PREVIOUS)
+		So(first.RotatedAt.IsZero(), ShouldBeFalse)
+		So(len(k.Published()), ShouldEqual, 2)
+
+		So(k.Retire(second.Id), ShouldEqual, ErrKeyCurrent)
+		So(k.Retire("nokey"), ShouldEqual, ErrKeyNotFound)
+		So(k.Retire(first.Id), ShouldBeNil)
+		So(len(k.List()), ShouldEqual, 2)
+		So(len(k.Published()), ShouldEqual, 1)
+		So(k.JWKS().Keys[0].Kid, ShouldEqual, second.Id)
+		So(k.Save(), ShouldBeNil)
+
+		Convey("The file is private and holds no clear private keys", func() {
+			info, err := os.Stat(file)
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+			buff, _ := os.ReadFile(file)
+			So(strings.Contains(string(buff), "RWMutex"), ShouldBeFalse)
+		})
+		Convey("It can be opened again with the same passphrase only", func() {
+			_, err := Open(file, "wrong")
+			So(err, ShouldEqual, ErrKeyPassphrase)
+
+			again, err := Open(file, "secret")
+			So(err, ShouldBeNil)
+			So(again.Current().Id, ShouldEqual, second.Id)
+			found, err := again.Find(first.Id)
+			So(err, ShouldBeNil)
+			So(found.Status, ShouldEqual, STATUS_RETIRED)
+
+			msg := []byte("message")
+			sig, err := again.Current().Sign(msg)
+			So(err, ShouldBeNil)
+			So(Verify(second.PublicKey(), msg, sig), ShouldBeTrue)
+		})
+	})
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, alg := range []string{ALG_EDDSA, ALG_ES256} {
+		Convey("Signatures check out for "+alg, t, func() {
+			key, err := NewKey(alg)
+			So(err, ShouldBeNil)
+			msg := []byte("a response body")
+			sig, err := key.Sign(msg)
+			So(err, ShouldBeNil)
+			So(Verify(key.PublicKey(), msg, sig), ShouldBeTrue)
+			So(Verify(key.PublicKey(), []byte("changed"), sig), ShouldBeFalse)
+
+			other, _ := NewKey(alg)
+			So(Verify(other.PublicKey(), msg, sig), ShouldBeFalse)
+
+			jwk, ok := NewJWK(key.Id, key.PublicKey())
+			So(ok, ShouldBeTrue)
+			So(jwk.Alg, ShouldEqual, alg)
+			So(jwk.X, ShouldNotBeBlank)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/notify"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OUTBOX_SUFFIX ends the name of each message written to the outbox directory
+const OUTBOX_SUFFIX = ".msg"
+
+// The file is shared by every driver, so writes must not be mixed together
+var mu sync.Mutex
+
+// FileNotify writes messages to a file, or to an outbox directory with one file per message
+type FileNotify struct {
+	File string
+	Dir  string
+}
+
+// New will return an address pointing to a new FileNotify structure
+func New() *FileNotify {
+	return &FileNotify{}
+}
+
+// Id returns the string identifier for this driver
+func (t *FileNotify) Id() string {
+	return gdriver.Help(notify.DriverGroup, DriverName, gdriver.IdentityName)
+}
+
+// ShortHelp returns a short string identifier for the identity.
+func (t *FileNotify) ShortHelp() string {
+	return gdriver.Help(notify.DriverGroup, DriverName, gdriver.IdentityShort)
+}
+
+// LongHelp returns a longer descriptive text for the help
+func (t *FileNotify) LongHelp() string {
+	return gdriver.Help(notify.DriverGroup, DriverName, gdriver.IdentityLong)
+}
+
+// Setup takes the JSON options from the configuration.
+func (t *FileNotify) Setup(options string) error {
+	options = strings.TrimSpace(options)
+	if options == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(options), t)
+}
+
+// Send adds the message to the end of the file or, when there is an outbox directory, writes
+// it to a new file there.
+func (t *FileNotify) Send(msg *notify.Message) error {
+	if t.Dir != "" {
+		return t.outbox(msg)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	if t.File == "" {
+		return write(os.Stdout, msg)
+	}
+	fp, err := os.OpenFile(t.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err = write(fp, msg); err != nil {
+		fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// outbox writes the message to a temporary file and then renames it, so a program picking
+// up the messages never sees one that is half written. Names sort in the order written.
+func (t *FileNotify) outbox(msg *notify.Message) error {
+	fp, err := ioutil.TempFile(t.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	tmp := fp.Name()
+	if err = write(fp, msg); err == nil {
+		err = fp.Close()
+	} else {
+		fp.Close()
+	}
+	if err == nil {
+		name := fmt.Sprintf("%s-%s-%s%s",
+			time.Now().UTC().Format("20060102T150405.000000000"),
+			msg.Event,
+			strings.TrimPrefix(filepath.Base(tmp), ".tmp-"),
+			OUTBOX_SUFFIX)
+		err = os.Rename(tmp, filepath.Join(t.Dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func write(w io.Writer, msg *notify.Message) error {
+	_, err := fmt.Fprintf(w, "Date: %s\nEvent: %s\nDomain: %s\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n%s\n",
+		time.Now().Format(time.RFC1123Z),
+		msg.Event,
+		msg.Domain,
+		msg.From,
+		msg.To,
+		msg.Subject,
+		msg.Body,
+		strings.Repeat("-", 72))
+	return err
+}
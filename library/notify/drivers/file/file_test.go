@@ -0,0 +1,74 @@
+package file
+
+import (
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/notify"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	Register()
+	if !gdriver.IsRegistered(notify.DriverGroup, DriverName) {
+		t.Errorf("%s is not registered", DriverName)
+	}
+}
+
+func TestSend(t *testing.T) {
+	fname := os.TempDir() + "/gus_file_notify_test.log"
+	os.Remove(fname)
+	defer os.Remove(fname)
+
+	Convey("Messages are added to the end of the file", t, func() {
+		drv := New()
+		So(drv.Setup(`{"File": "`+fname+`"}`), ShouldBeNil)
+		So(drv.File, ShouldEqual, fname)
+
+		msg := &notify.Message{Event: "verify", From: "a@example.com", To: "b@example.com", Subject: "Hello", Body: "Body text"}
+		So(drv.Send(msg), ShouldBeNil)
+		So(drv.Send(msg), ShouldBeNil)
+
+		b, err := ioutil.ReadFile(fname)
+		So(err, ShouldBeNil)
+		So(strings.Count(string(b), "Subject: Hello\n"), ShouldEqual, 2)
+		So(string(b), ShouldContainSubstring, "\nBody text\n")
+
+		So(New().Setup(``), ShouldBeNil)
+		So(New().Setup(`{ bad`), ShouldNotBeNil)
+	})
+}
+
+func TestOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gus_file_outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("Each message is written to its own file in the outbox", t, func() {
+		drv := New()
+		So(drv.Setup(`{"Dir": "`+dir+`"}`), ShouldBeNil)
+
+		So(drv.Send(&notify.Message{Event: "register", To: "b@example.com", Subject: "First"}), ShouldBeNil)
+		So(drv.Send(&notify.Message{Event: "lockout", To: "b@example.com", Subject: "Second"}), ShouldBeNil)
+
+		files, err := ioutil.ReadDir(dir)
+		So(err, ShouldBeNil)
+		So(len(files), ShouldEqual, 2)
+		So(files[0].Name(), ShouldContainSubstring, "-register-")
+		So(files[0].Name(), ShouldEndWith, OUTBOX_SUFFIX)
+		So(files[1].Name(), ShouldContainSubstring, "-lockout-")
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+		So(err, ShouldBeNil)
+		So(string(b), ShouldContainSubstring, "Subject: First\n")
+
+		drv = New()
+		So(drv.Setup(`{"Dir": "`+filepath.Join(dir, "missing")+`"}`), ShouldBeNil)
+		So(drv.Send(&notify.Message{Event: "register"}), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,52 @@
+package file
+
+import (
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/notify"
+)
+
+const (
+	// DriverName Specifies the specific identity of this driver within a group
+	DriverName   = "file"
+	HelpShort    = "Write messages to a file instead of sending them. For testing and small sites"
+	HelpTemplate = `
+  Messages are not sent: they are added to the end of a file, one after the other, so they
+  can be checked by a developer or picked up and sent by another program. Each message starts
+  with its headers (From, To, Subject) and ends with a line of dashes.
+
+  If an outbox directory is given, each message is written to its own file in the directory
+  instead, named with the time and event and ending in '.msg'. The file is only renamed to
+  '.msg' once it has been written, so another program can send each file and then remove it.
+
+  Options: These are passed in JSON format:
+      "File" - The file the messages are written to. When it is blank, the messages are written
+               to standard output.
+      "Dir"  - The outbox directory. This must already exist. When it is given, File is ignored.
+
+  Option format: {"File": "/var/log/gus/messages.log" }
+             or: {"Dir": "/var/spool/gus/outbox" }
+`
+)
+
+type registerDriver struct{}
+
+// Register is a simple wrapper to make sure registration occurs properly
+func Register() {
+	gdriver.Register(notify.DriverGroup, &registerDriver{})
+}
+
+// New() will return a file driver. The caller must cast it to a NotifyDriver
+func (r *registerDriver) New() interface{} {
+	return New()
+}
+
+// Identity will return the defined values for help, depending on whether they want a short or long identifier.
+func (r *registerDriver) Identity(id int) string {
+	switch id {
+	case gdriver.IdentityShort:
+		return HelpShort
+	case gdriver.IdentityLong:
+		return HelpTemplate
+	}
+	return DriverName
+}
@@ -0,0 +1,49 @@
+package smtp
+
+import (
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/notify"
+)
+
+const (
+	// DriverName Specifies the specific identity of this driver within a group
+	DriverName   = "smtp"
+	HelpShort    = "Send messages by email through an SMTP server"
+	HelpTemplate = `
+  Messages are sent as plain text email through an SMTP server. If the server offers STARTTLS,
+  the connection is encrypted before anything is sent. When a user name is given, the driver
+  logs in to the server (PLAIN authentication), which is only allowed over an encrypted
+  connection or to localhost.
+
+  Options: These are passed in JSON format:
+      "Host"     - The SMTP server. This is required.
+      "Port"     - The port on the server. The default is 25 (587 is usual for a mail service).
+      "Username" - The name to login with. Leave it out if the server doesn't need a login.
+      "Password" - The password for the user name.
+
+  Option format: {"Host": "mail.example.com", "Port": 587, "Username": "gus", "Password": "secret" }
+`
+)
+
+type registerDriver struct{}
+
+// Register is a simple wrapper to make sure registration occurs properly
+func Register() {
+	gdriver.Register(notify.DriverGroup, &registerDriver{})
+}
+
+// New() will return an smtp driver. The caller must cast it to a NotifyDriver
+func (r *registerDriver) New() interface{} {
+	return New()
+}
+
+// Identity will return the defined values for help, depending on whether they want a short or long identifier.
+func (r *registerDriver) Identity(id int) string {
+	switch id {
+	case gdriver.IdentityShort:
+		return HelpShort
+	case gdriver.IdentityLong:
+		return HelpTemplate
+	}
+	return DriverName
+}
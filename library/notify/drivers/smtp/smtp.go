@@ -0,0 +1,96 @@
+package smtp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/cgentry/gdriver"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/notify"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sendMail is the call used to deliver the message. Tests replace it so no server is needed.
+var sendMail = smtp.SendMail
+
+// SmtpNotify sends messages through an SMTP server
+type SmtpNotify struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+// New will return an address pointing to a new SmtpNotify structure
+func New() *SmtpNotify {
+	return &SmtpNotify{Port: 25}
+}
+
+// Id returns the string identifier for this driver
+func (t *SmtpNotify) Id() string {
+	return gdriver.Help(notify.DriverGroup, DriverName, gdriver.IdentityName)
+}
+
+// ShortHelp returns a short string identifier for the identity.
+func (t *SmtpNotify) ShortHelp() string {
+	return gdriver.Help(notify.DriverGroup, DriverName, gdriver.IdentityShort)
+}
+
+// LongHelp returns a longer descriptive text for the help
+func (t *SmtpNotify) LongHelp() string {
+	return gdriver.Help(notify.DriverGroup, DriverName, gdriver.IdentityLong)
+}
+
+// Setup takes the JSON options from the configuration. The host must be given.
+func (t *SmtpNotify) Setup(options string) error {
+	options = strings.TrimSpace(options)
+	if options != "" {
+		if err := json.Unmarshal([]byte(options), t); err != nil {
+			return err
+		}
+	}
+	if t.Host == "" || t.Port <= 0 {
+		return ErrNotifyOptions
+	}
+	return nil
+}
+
+// Send delivers the message to the user's address
+func (t *SmtpNotify) Send(msg *notify.Message) error {
+	if msg.From == "" || msg.To == "" {
+		return ErrNotifyFailed
+	}
+	var auth smtp.Auth
+	if t.Username != "" {
+		auth = smtp.PlainAuth("", t.Username, t.Password, t.Host)
+	}
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	return sendMail(addr, auth, msg.From, []string{msg.To}, format(msg))
+}
+
+// format creates the mail message. Line breaks are taken out of the headers so a value can't add
+// headers of its own.
+func format(msg *notify.Message) []byte {
+	var b bytes.Buffer
+	oneLine := strings.NewReplacer("\r", "", "\n", " ")
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, oneLine.Replace(value))
+	}
+	header("From", msg.From)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", oneLine.Replace(msg.Subject)))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	b.WriteString("\r\n")
+	for _, line := range strings.Split(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n") {
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+	return b.Bytes()
+}
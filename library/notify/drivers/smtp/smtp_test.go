@@ -0,0 +1,63 @@
+package smtp
+
+import (
+	"github.com/cgentry/gdriver"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/notify"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/smtp"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	Register()
+	if !gdriver.IsRegistered(notify.DriverGroup, DriverName) {
+		t.Errorf("%s is not registered", DriverName)
+	}
+	Convey("The host must be given", t, func() {
+		So(New().Setup(``), ShouldEqual, ErrNotifyOptions)
+		drv := New()
+		So(drv.Setup(`{"Host": "mail.example.com"}`), ShouldBeNil)
+		So(drv.Port, ShouldEqual, 25)
+		So(New().Setup(`{"Host": "mail.example.com", "Port": 0}`), ShouldEqual, ErrNotifyOptions)
+	})
+}
+
+func TestSend(t *testing.T) {
+	defer func() { sendMail = smtp.SendMail }()
+
+	Convey("Messages are sent to the server", t, func() {
+		var gotAddr, gotFrom string
+		var gotAuth smtp.Auth
+		var gotTo []string
+		var gotMsg []byte
+		sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			gotAddr, gotAuth, gotFrom, gotTo, gotMsg = addr, a, from, to, msg
+			return nil
+		}
+
+		drv := New()
+		So(drv.Setup(`{"Host": "mail.example.com", "Port": 587, "Username": "gus", "Password": "secret"}`), ShouldBeNil)
+		err := drv.Send(&notify.Message{
+			From:    "accounts@example.com",
+			To:      "jane@example.com",
+			Subject: "Hello\r\nBcc: evil@example.net",
+			Body:    "Line one\nLine two",
+		})
+		So(err, ShouldBeNil)
+		So(gotAddr, ShouldEqual, "mail.example.com:587")
+		So(gotAuth, ShouldNotBeNil)
+		So(gotFrom, ShouldEqual, "accounts@example.com")
+		So(gotTo, ShouldResemble, []string{"jane@example.com"})
+		So(string(gotMsg), ShouldContainSubstring, "To: jane@example.com\r\n")
+		So(string(gotMsg), ShouldContainSubstring, "Subject: Hello Bcc: evil@example.net\r\n")
+		So(string(gotMsg), ShouldNotContainSubstring, "\r\nBcc:")
+		So(string(gotMsg), ShouldEndWith, "\r\n\r\nLine one\r\nLine two\r\n")
+
+		drv = New()
+		So(drv.Setup(`{"Host": "localhost"}`), ShouldBeNil)
+		So(drv.Send(&notify.Message{From: "a@example.com", To: "b@example.com"}), ShouldBeNil)
+		So(gotAuth, ShouldBeNil)
+		So(drv.Send(&notify.Message{From: "a@example.com"}), ShouldEqual, ErrNotifyFailed)
+	})
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"github.com/cgentry/gdriver"
+	"github.com/cgentry/gus/library/notify"
+)
+
+const (
+	// DriverName Specifies the specific identity of this driver within a group
+	DriverName   = "webhook"
+	HelpShort    = "POST each message, as JSON, to a web address"
+	HelpTemplate = `
+  Each message is sent to another system with an HTTP POST, so that it can decide what to do
+  with it (send an email or a text message, record it, ...). The body is the message as JSON:
+  the event, domain, addresses, the subject and body from the template and the values the
+  template was filled in from. The event is also given in the 'X-Gus-Event' header. Any reply
+  other than a 2xx status is a failure.
+
+  The values can include tokens for verification and lost passwords: only use an https address
+  you control.
+
+  Options: These are passed in JSON format:
+      "Url"     - The address the messages are posted to. This is required.
+      "Timeout" - Seconds to wait for a reply. The default is 10.
+
+  Option format: {"Url": "https://hooks.example.com/gus", "Timeout": 5 }
+`
+)
+
+type registerDriver struct{}
+
+// Register is a simple wrapper to make sure registration occurs properly
+func Register() {
+	gdriver.Register(notify.DriverGroup, &registerDriver{})
+}
+
+// New() will return a webhook driver. The caller must cast it to a NotifyDriver
+func (r *registerDriver) New() interface{} {
+	return New()
+}
+
+// Identity will return the defined values for help, depending on whether they want a short or long identifier.
+func (r *registerDriver) Identity(id int) string {
+	switch id {
+	case gdriver.IdentityShort:
+		return HelpShort
+	case gdriver.IdentityLong:
+		return HelpTemplate
+	}
+	return DriverName
+}
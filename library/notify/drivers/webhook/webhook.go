@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cgentry/gdriver"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/notify"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WebhookNotify posts messages to a web address
+type WebhookNotify struct {
+	Url     string
+	Timeout int // Seconds
+
+	client *http.Client
+}
+
+// New will return an address pointing to a new WebhookNotify structure
+func New() *WebhookNotify {
+	return &WebhookNotify{Timeout: 10}
+}
+
+// Id returns the string identifier for this driver
+func (t *WebhookNotify) Id() string {
+	return gdriver.Help(notify.DriverGroup, DriverName, gdriver.IdentityName)
+}
+
+// ShortHelp returns a short string identifier for the identity.
+func (t *WebhookNotify) ShortHelp() string {
+	return gdriver.Help(notify.DriverGroup, DriverName, gdriver.IdentityShort)
+}
+
+// LongHelp returns a longer descriptive text for the help
+func (t *WebhookNotify) LongHelp() string {
+	return gdriver.Help(notify.DriverGroup, DriverName, gdriver.IdentityLong)
+}
+
+// Setup takes the JSON options from the configuration. The address must be an http or https URL.
+func (t *WebhookNotify) Setup(options string) error {
+	options = strings.TrimSpace(options)
+	if options != "" {
+		if err := json.Unmarshal([]byte(options), t); err != nil {
+			return err
+		}
+	}
+	u, err := url.Parse(t.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || t.Timeout <= 0 {
+		return ErrNotifyOptions
+	}
+	t.client = &http.Client{Timeout: time.Duration(t.Timeout) * time.Second}
+	return nil
+}
+
+// Send posts the message. Only a 2xx reply means it was received.
+func (t *WebhookNotify) Send(msg *notify.Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gus-Event", msg.Event)
+
+	rsp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	io.Copy(ioutil.Discard, rsp.Body) // Let the connection be used again
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return ErrNotifyFailed
+	}
+	return nil
+}
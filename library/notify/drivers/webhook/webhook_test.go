@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/cgentry/gdriver"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/notify"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	Register()
+	if !gdriver.IsRegistered(notify.DriverGroup, DriverName) {
+		t.Errorf("%s is not registered", DriverName)
+	}
+	Convey("The address must be given", t, func() {
+		So(New().Setup(``), ShouldEqual, ErrNotifyOptions)
+		So(New().Setup(`{"Url": "ftp://example.com/"}`), ShouldEqual, ErrNotifyOptions)
+		So(New().Setup(`{"Url": "https://example.com/", "Timeout": 0}`), ShouldEqual, ErrNotifyOptions)
+		drv := New()
+		So(drv.Setup(`{"Url": "https://example.com/hook"}`), ShouldBeNil)
+		So(drv.Timeout, ShouldEqual, 10)
+	})
+}
+
+func TestSend(t *testing.T) {
+	var event, contentType string
+	var got notify.Message
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event = r.Header.Get("X-Gus-Event")
+		contentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	Convey("Messages are posted as JSON", t, func() {
+		drv := New()
+		So(drv.Setup(`{"Url": "`+server.URL+`"}`), ShouldBeNil)
+		msg := &notify.Message{
+			Event:   notify.EVENT_LOCKOUT,
+			Domain:  "dom",
+			To:      "jane@example.com",
+			Subject: "Locked",
+			Data:    &notify.Data{Guid: "guid", Login: "jane"},
+		}
+		So(drv.Send(msg), ShouldBeNil)
+		So(event, ShouldEqual, notify.EVENT_LOCKOUT)
+		So(contentType, ShouldEqual, "application/json")
+		So(got.To, ShouldEqual, "jane@example.com")
+		So(got.Data.Guid, ShouldEqual, "guid")
+
+		status = http.StatusInternalServerError
+		So(drv.Send(msg), ShouldEqual, ErrNotifyFailed)
+	})
+}
@@ -0,0 +1,174 @@
+// The notify drivers are used to tell users, or other systems, when something happens to an
+// account: registration, email verification, password and email changes, lockouts and lost
+// password requests. Standard drivers are file (writes the messages to a file or an outbox
+// directory), smtp (email) and webhook (an HTTP POST of the message).
+//
+// All drivers need to call Register in order to be usable by the system. The driver in use is
+// selected from the configuration at startup:
+//    err := notify.Set( c.Notify )
+// When no driver is configured, Get returns nil and no messages are sent.
+
+package notify
+
+import (
+	"github.com/cgentry/gdriver"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DriverGroup = "notify"
+
+// The interface gives the set of methods that a notify driver must implement.
+type NotifyDriver interface {
+	Setup(options string) error
+	Send(msg *Message) error
+
+	//  The following are wrappers for the gdriver Id call.
+	Id() string
+	ShortHelp() string
+	LongHelp() string
+}
+
+// Message is a single message to a user, ready to be sent. Drivers that send to other systems,
+// rather than to the user, can use the Data the message was made from.
+type Message struct {
+	Event   string
+	Domain  string
+	From    string
+	To      string
+	Subject string
+	Body    string
+	Data    *Data
+}
+
+// Data holds the values that can be used in the message templates, e.g. {{.Link}}
+type Data struct {
+	Guid      string
+	Name      string // User's full name
+	Login     string
+	Email     string // Address the message is sent to
+	NewEmail  string // For an email change, the address it was changed to
+	Domain    string
+	Token     string
+	Link      string    // Page the user follows, with the token added
+	ExpiresAt time.Time // When the token expires or, for a lockout, when the account unlocks
+	Time      time.Time // When the event happened
+}
+
+// Notifier sends messages with the configured driver.
+type Notifier struct {
+	driver    NotifyDriver
+	from      string
+	events    map[string]bool // Events that are sent. Nil sends them all
+	templates map[string]messageTemplate
+}
+
+// New creates a notifier from the configuration. The driver must have been registered. If the
+// name is blank, nil is returned: messages are turned off.
+func New(c configure.Notify) (*Notifier, error) {
+	name := strings.TrimSpace(c.Name)
+	if name == "" {
+		return nil, nil
+	}
+	if !gdriver.IsRegistered(DriverGroup, name) {
+		return nil, ErrNotifyDriver
+	}
+	n := &Notifier{from: c.From}
+	if events := strings.TrimSpace(c.Events); events != "" {
+		n.events = make(map[string]bool)
+		for _, event := range strings.Split(events, ",") {
+			event = strings.ToLower(strings.TrimSpace(event))
+			if _, ok := templates[event]; !ok {
+				return nil, ErrNotifyEvent
+			}
+			n.events[event] = true
+		}
+	}
+	var err error
+	if n.templates, err = loadTemplates(c.Templates); err != nil {
+		return nil, err
+	}
+	n.driver = gdriver.MustNew(DriverGroup, name).(NotifyDriver)
+	if err = n.driver.Setup(c.Options); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Sends is true when messages are sent for the event. Verification messages are always sent:
+// without them, new users could never login.
+func (n *Notifier) Sends(event string) bool {
+	return n.events == nil || event == EVENT_VERIFY || n.events[event]
+}
+
+// Send creates the message for the event from its template and sends it to the user's email
+// address. Nothing is sent for events that have been turned off.
+func (n *Notifier) Send(event string, data *Data) error {
+	if !n.Sends(event) {
+		return nil
+	}
+	msg, err := n.Message(event, data)
+	if err != nil {
+		return err
+	}
+	return n.driver.Send(msg)
+}
+
+// Message creates the message for an event. The user's domain's own template is used when there
+// is one, then the template for all domains and finally the built-in message.
+func (n *Notifier) Message(event string, data *Data) (*Message, error) {
+	tmpl, ok := n.templates[data.Domain+"/"+event]
+	if !ok {
+		tmpl, ok = n.templates[event]
+	}
+	if !ok {
+		tmpl, ok = templates[event]
+	}
+	if !ok {
+		return nil, ErrNotifyEvent
+	}
+	msg, err := tmpl.message(event, data)
+	if err != nil {
+		return nil, err
+	}
+	msg.From = n.from
+	return msg, nil
+}
+
+// NewMessage creates the message for an event from the built-in templates. The From address is
+// left for the notifier to fill in.
+func NewMessage(event string, data *Data) (*Message, error) {
+	tmpl, ok := templates[event]
+	if !ok {
+		return nil, ErrNotifyEvent
+	}
+	return tmpl.message(event, data)
+}
+
+var current struct {
+	sync.RWMutex
+	notifier *Notifier
+}
+
+// Set will turn messages on (or off, when the name is blank) using the configuration.
+// The current notifier is not changed if there is an error.
+func Set(c configure.Notify) error {
+	n, err := New(c)
+	if err != nil {
+		return err
+	}
+	current.Lock()
+	current.notifier = n
+	current.Unlock()
+	return nil
+}
+
+// Get returns the current notifier. If messages are off, nil is returned.
+func Get() *Notifier {
+	current.RLock()
+	defer current.RUnlock()
+	return current.notifier
+}
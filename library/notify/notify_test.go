@@ -0,0 +1,166 @@
+package notify_test
+
+import (
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/notify"
+	"github.com/cgentry/gus/library/notify/drivers/file"
+	"github.com/cgentry/gus/record/configure"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMessage(t *testing.T) {
+	Convey("The verify message is filled in from the data", t, func() {
+		expires := time.Date(2030, 1, 2, 3, 4, 0, 0, time.UTC)
+		msg, err := notify.NewMessage(notify.EVENT_VERIFY, &notify.Data{
+			Name:      "Jane Doe",
+			Login:     "jane",
+			Email:     "jane@example.com",
+			Domain:    "dom",
+			Link:      "https://example.com/verify?token=abc",
+			ExpiresAt: expires,
+		})
+		So(err, ShouldBeNil)
+		So(msg.Event, ShouldEqual, notify.EVENT_VERIFY)
+		So(msg.To, ShouldEqual, "jane@example.com")
+		So(msg.Domain, ShouldEqual, "dom")
+		So(msg.Subject, ShouldNotBeBlank)
+		So(msg.Body, ShouldContainSubstring, "Hello Jane Doe")
+		So(msg.Body, ShouldContainSubstring, "https://example.com/verify?token=abc")
+		So(msg.Body, ShouldContainSubstring, "2030-01-02 03:04 UTC")
+
+		_, err = notify.NewMessage("unknown", &notify.Data{})
+		So(err, ShouldEqual, ErrNotifyEvent)
+	})
+	Convey("Every event has a built-in message", t, func() {
+		for _, event := range notify.Events() {
+			msg, err := notify.NewMessage(event, &notify.Data{Login: "jane", Email: "jane@example.com"})
+			So(err, ShouldBeNil)
+			So(msg.Subject, ShouldNotBeBlank)
+			So(msg.Body, ShouldContainSubstring, "'jane'")
+		}
+	})
+	Convey("Lockout tells the user when they can try again", t, func() {
+		msg, err := notify.NewMessage(notify.EVENT_LOCKOUT, &notify.Data{})
+		So(err, ShouldBeNil)
+		So(msg.Body, ShouldContainSubstring, "unlocked by an administrator")
+		msg, err = notify.NewMessage(notify.EVENT_LOCKOUT, &notify.Data{ExpiresAt: time.Date(2030, 1, 2, 3, 4, 0, 0, time.UTC)})
+		So(err, ShouldBeNil)
+		So(msg.Body, ShouldContainSubstring, "try again after 2030-01-02 03:04 UTC")
+	})
+	Convey("Reset gives the token when there is no link", t, func() {
+		msg, err := notify.NewMessage(notify.EVENT_RESET, &notify.Data{Token: "tok123"})
+		So(err, ShouldBeNil)
+		So(msg.Body, ShouldContainSubstring, "tok123")
+		msg, err = notify.NewMessage(notify.EVENT_RESET, &notify.Data{Token: "tok123", Link: "https://example.com/reset?token=tok123"})
+		So(err, ShouldBeNil)
+		So(msg.Body, ShouldContainSubstring, "https://example.com/reset?token=tok123")
+	})
+}
+
+func TestEvents(t *testing.T) {
+	file.Register()
+
+	Convey("Only the configured events are sent", t, func() {
+		_, err := notify.New(configure.Notify{Name: file.DriverName, Events: "register, unknown"})
+		So(err, ShouldEqual, ErrNotifyEvent)
+
+		n, err := notify.New(configure.Notify{Name: file.DriverName, Events: "Register, lockout"})
+		So(err, ShouldBeNil)
+		So(n.Sends(notify.EVENT_REGISTER), ShouldBeTrue)
+		So(n.Sends(notify.EVENT_LOCKOUT), ShouldBeTrue)
+		So(n.Sends(notify.EVENT_PASSWORD), ShouldBeFalse)
+		So(n.Sends(notify.EVENT_VERIFY), ShouldBeTrue)
+
+		n, err = notify.New(configure.Notify{Name: file.DriverName})
+		So(err, ShouldBeNil)
+		for _, event := range notify.Events() {
+			So(n.Sends(event), ShouldBeTrue)
+		}
+	})
+}
+
+func TestTemplates(t *testing.T) {
+	file.Register()
+	dir, err := ioutil.TempDir("", "gus_notify_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "shop"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, "register.txt"),
+		[]byte("Subject: Welcome {{.Name}}\n\nAll domains: {{.Login}}\n"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "shop", "register.txt"),
+		[]byte("Subject: Welcome to the shop\r\n\r\nShop: {{.Login}}\r\n"), 0600)
+
+	Convey("Templates replace the built-in messages", t, func() {
+		n, err := notify.New(configure.Notify{Name: file.DriverName, Templates: dir, From: "me@example.com"})
+		So(err, ShouldBeNil)
+
+		msg, err := n.Message(notify.EVENT_REGISTER, &notify.Data{Name: "Jane", Login: "jane", Domain: "dom"})
+		So(err, ShouldBeNil)
+		So(msg.From, ShouldEqual, "me@example.com")
+		So(msg.Subject, ShouldEqual, "Welcome Jane")
+		So(msg.Body, ShouldEqual, "All domains: jane\n")
+
+		msg, err = n.Message(notify.EVENT_REGISTER, &notify.Data{Login: "jane", Domain: "shop"})
+		So(err, ShouldBeNil)
+		So(msg.Subject, ShouldEqual, "Welcome to the shop")
+		So(msg.Body, ShouldEqual, "Shop: jane\n")
+
+		msg, err = n.Message(notify.EVENT_PASSWORD, &notify.Data{Login: "jane", Domain: "shop"})
+		So(err, ShouldBeNil)
+		So(msg.Body, ShouldContainSubstring, "password for your account 'jane'")
+	})
+	Convey("Bad templates are rejected", t, func() {
+		_, err := notify.New(configure.Notify{Name: file.DriverName, Templates: filepath.Join(dir, "missing")})
+		So(err, ShouldNotBeNil)
+
+		ioutil.WriteFile(filepath.Join(dir, "shop", "reset.txt"), []byte("No subject here\n"), 0600)
+		_, err = notify.New(configure.Notify{Name: file.DriverName, Templates: dir})
+		So(err, ShouldEqual, ErrNotifyTemplate)
+
+		ioutil.WriteFile(filepath.Join(dir, "shop", "reset.txt"), []byte("Subject: Reset\n\n{{.Token\n"), 0600)
+		_, err = notify.New(configure.Notify{Name: file.DriverName, Templates: dir})
+		So(err, ShouldNotBeNil)
+		os.Remove(filepath.Join(dir, "shop", "reset.txt"))
+	})
+}
+
+func TestSet(t *testing.T) {
+	file.Register()
+	fname := os.TempDir() + "/gus_notify_test.log"
+	defer os.Remove(fname)
+
+	Convey("Messages are off without a driver", t, func() {
+		So(notify.Set(configure.Notify{}), ShouldBeNil)
+		So(notify.Get(), ShouldBeNil)
+		So(notify.Set(configure.Notify{Name: "nothing"}), ShouldEqual, ErrNotifyDriver)
+		So(notify.Get(), ShouldBeNil)
+	})
+	Convey("The configured driver sends the messages", t, func() {
+		os.Remove(fname)
+		err := notify.Set(configure.Notify{
+			Name:    file.DriverName,
+			Options: `{"File": "` + fname + `"}`,
+			From:    "accounts@example.com",
+		})
+		So(err, ShouldBeNil)
+		n := notify.Get()
+		So(n, ShouldNotBeNil)
+		So(n.Send(notify.EVENT_VERIFY, &notify.Data{Name: "Jane Doe", Email: "jane@example.com", Link: "link"}), ShouldBeNil)
+
+		b, err := ioutil.ReadFile(fname)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldContainSubstring, "From: accounts@example.com\n")
+		So(string(b), ShouldContainSubstring, "To: jane@example.com\n")
+
+		So(notify.Set(configure.Notify{Name: file.DriverName, Options: `{`}), ShouldNotBeNil)
+		So(notify.Get(), ShouldEqual, n)
+		So(notify.Set(configure.Notify{}), ShouldBeNil)
+	})
+}
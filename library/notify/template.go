@@ -0,0 +1,177 @@
+package notify
+
+import (
+	"bytes"
+	. "github.com/cgentry/gus/ecode"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Events that messages are sent for
+const (
+	EVENT_VERIFY   = "verify"   // A new user must verify their email address
+	EVENT_REGISTER = "register" // A new user has registered
+	EVENT_PASSWORD = "password" // The user's password was changed
+	EVENT_EMAIL    = "email"    // The user's email address was changed. Sent to the old address
+	EVENT_LOCKOUT  = "lockout"  // Too many failed logins have locked the account
+	EVENT_RESET    = "reset"    // A lost password token was requested
+)
+
+// TEMPLATE_SUFFIX is added to the event name to give the name of a template file
+const TEMPLATE_SUFFIX = ".txt"
+
+type messageTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// templates are the built-in messages, one for each event.
+var templates = map[string]messageTemplate{
+	EVENT_VERIFY: mustTemplate(EVENT_VERIFY, `Subject: Please verify your email address
+
+Hello {{.Name}},
+
+Before you can login to your account '{{.Login}}', please verify your email
+address by following this link:
+
+    {{.Link}}
+
+The link can be used until {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}. If you
+didn't create the account, you can ignore this message.
+`),
+	EVENT_REGISTER: mustTemplate(EVENT_REGISTER, `Subject: Welcome
+
+Hello {{.Name}},
+
+Your account '{{.Login}}' has been created.
+`),
+	EVENT_PASSWORD: mustTemplate(EVENT_PASSWORD, `Subject: Your password was changed
+
+Hello {{.Name}},
+
+The password for your account '{{.Login}}' was changed at
+{{.Time.Format "2006-01-02 15:04 MST"}}. If you didn't change it, please contact us
+straight away.
+`),
+	EVENT_EMAIL: mustTemplate(EVENT_EMAIL, `Subject: Your email address was changed
+
+Hello {{.Name}},
+
+The email address for your account '{{.Login}}' was changed to {{.NewEmail}}
+at {{.Time.Format "2006-01-02 15:04 MST"}}. Messages will no longer be sent to this
+address. If you didn't change it, please contact us straight away.
+`),
+	EVENT_LOCKOUT: mustTemplate(EVENT_LOCKOUT, `Subject: Your account has been locked
+
+Hello {{.Name}},
+
+There have been too many failed logins to your account '{{.Login}}', so it has
+been locked. {{if .ExpiresAt.IsZero}}It must be unlocked by an administrator.
+{{- else}}You can try again after {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}.{{end}}
+If these weren't you, someone may be trying to guess your password.
+`),
+	EVENT_RESET: mustTemplate(EVENT_RESET, `Subject: Reset your password
+
+Hello {{.Name}},
+
+A new password was requested for your account '{{.Login}}'. To set it, follow
+this link:
+
+    {{if .Link}}{{.Link}}{{else}}{{.Token}}{{end}}
+
+The link can be used until {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}. If you
+didn't ask for a new password, you can ignore this message.
+`),
+}
+
+// Events returns the names of all the events that messages can be sent for
+func Events() []string {
+	return []string{EVENT_VERIFY, EVENT_REGISTER, EVENT_PASSWORD, EVENT_EMAIL, EVENT_LOCKOUT, EVENT_RESET}
+}
+
+// parseTemplate splits the text into the subject and body templates. The text is laid out like
+// an email: a 'Subject:' line, a blank line and then the body.
+func parseTemplate(name, text string) (messageTemplate, error) {
+	var tmpl messageTemplate
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	parts := strings.SplitN(text, "\n\n", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "Subject:") || strings.Contains(parts[0], "\n") {
+		return tmpl, ErrNotifyTemplate
+	}
+	var err error
+	subject := strings.TrimSpace(strings.TrimPrefix(parts[0], "Subject:"))
+	if tmpl.subject, err = template.New(name + ".subject").Parse(subject); err != nil {
+		return tmpl, err
+	}
+	if tmpl.body, err = template.New(name + ".body").Parse(parts[1]); err != nil {
+		return tmpl, err
+	}
+	return tmpl, nil
+}
+
+func mustTemplate(name, text string) messageTemplate {
+	tmpl, err := parseTemplate(name, text)
+	if err != nil {
+		panic(err.Error())
+	}
+	return tmpl
+}
+
+// loadTemplates reads the templates that replace the built-in messages. A template in the
+// directory is used for every domain; one in a sub-directory named for a domain is only used
+// for that domain. Each file is named for its event, e.g. 'reset.txt'. Events without a file
+// keep the built-in message. A blank directory name loads nothing.
+func loadTemplates(dir string) (map[string]messageTemplate, error) {
+	list := make(map[string]messageTemplate)
+	if dir == "" {
+		return list, nil
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	for _, event := range Events() {
+		files, err := filepath.Glob(filepath.Join(dir, "*", event+TEMPLATE_SUFFIX))
+		if err != nil {
+			return nil, err
+		}
+		if _, err = os.Stat(filepath.Join(dir, event+TEMPLATE_SUFFIX)); err == nil {
+			files = append(files, filepath.Join(dir, event+TEMPLATE_SUFFIX))
+		}
+		for _, file := range files {
+			text, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			key := event
+			if parent := filepath.Dir(file); parent != filepath.Clean(dir) {
+				key = filepath.Base(parent) + "/" + event
+			}
+			if list[key], err = parseTemplate(file, string(text)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return list, nil
+}
+
+// message fills in the templates with the data
+func (tmpl messageTemplate) message(event string, data *Data) (*Message, error) {
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return nil, err
+	}
+	return &Message{
+		Event:   event,
+		Domain:  data.Domain,
+		To:      data.Email,
+		Subject: subject.String(),
+		Body:    body.String(),
+		Data:    data,
+	}, nil
+}
@@ -0,0 +1,353 @@
+// Package policy holds the rules that are applied to user data. The password policy is used
+// whenever a new password is set, from the request checks through to User.SetPassword, so
+// that the same rules (and error messages) are used everywhere.
+//
+// The policy starts with the built-in defaults and is normally set from the configuration:
+//
+//	policy.SetPassword(c.Password)
+package policy
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+)
+
+// Score values returned by PasswordScore.
+const (
+	SCORE_TOO_GUESSABLE = iota
+	SCORE_VERY_GUESSABLE
+	SCORE_SOMEWHAT_GUESSABLE
+	SCORE_SAFELY_UNGUESSABLE
+	SCORE_VERY_UNGUESSABLE
+)
+
+// Minimum length of a user's login or email to be checked for inside of a password
+const userInfoMinimumLength = 3
+
+// Shortest banned word that is looked for inside of a password
+const bannedWordMinimumLength = 4
+
+type passwordRules struct {
+	sync.RWMutex
+	policy configure.PasswordPolicy
+	banned map[string]bool
+
+	// Banned words long enough to be looked for inside of a password, keyed by their
+	// length in runes. lengths holds the keys, longest first.
+	words     map[int]map[string]bool
+	lengths   []int
+	wordCount int
+}
+
+var rules = newPasswordRules()
+
+// DefaultPasswordPolicy is used until SetPassword is called. It only checks the length and
+// rejects common passwords.
+func DefaultPasswordPolicy() configure.PasswordPolicy {
+	return configure.PasswordPolicy{
+		MinLength: configure.PASSWORD_MINIMUM_LENGTH,
+		MaxLength: configure.PASSWORD_MAXIMUM_LENGTH,
+		Banned:    true,
+	}
+}
+
+func newPasswordRules() *passwordRules {
+	r := &passwordRules{
+		policy: DefaultPasswordPolicy(),
+		banned: make(map[string]bool),
+		words:  make(map[int]map[string]bool),
+	}
+	for _, pwd := range commonPasswords {
+		r.addBanned(pwd)
+	}
+	return r
+}
+
+// addBanned adds a lower case word to the banned list and, if it is long enough, to the
+// words looked for by passwordBits.
+func (r *passwordRules) addBanned(pwd string) {
+	if r.banned[pwd] {
+		return
+	}
+	r.banned[pwd] = true
+	length := len([]rune(pwd))
+	if length < bannedWordMinimumLength {
+		return
+	}
+	if r.words[length] == nil {
+		r.words[length] = make(map[string]bool)
+		r.lengths = append(r.lengths, length)
+		sort.Sort(sort.Reverse(sort.IntSlice(r.lengths)))
+	}
+	r.words[length][pwd] = true
+	r.wordCount++
+}
+
+// SetPassword will set the password policy. If there is a banned file, it is read here and
+// any error opening or reading it is returned. The policy is not changed if there is an error.
+// An empty policy (e.g. an older configuration file) will use the default policy.
+func SetPassword(p configure.PasswordPolicy) error {
+	if p == (configure.PasswordPolicy{}) {
+		p = DefaultPasswordPolicy()
+	}
+	r := newPasswordRules()
+	r.policy = p
+	if p.BannedFile != "" {
+		fd, err := os.Open(p.BannedFile)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		scan := bufio.NewScanner(fd)
+		for scan.Scan() {
+			if pwd := strings.ToLower(strings.TrimSpace(scan.Text())); pwd != "" {
+				r.addBanned(pwd)
+			}
+		}
+		if err = scan.Err(); err != nil {
+			return err
+		}
+	}
+	rules.Lock()
+	rules.policy = r.policy
+	rules.banned = r.banned
+	rules.words = r.words
+	rules.lengths = r.lengths
+	rules.wordCount = r.wordCount
+	rules.Unlock()
+	return nil
+}
+
+// GetPassword returns the current password policy.
+func GetPassword() configure.PasswordPolicy {
+	rules.RLock()
+	defer rules.RUnlock()
+	return rules.policy
+}
+
+// CheckPassword will check a new password against the policy. The user information
+// (normally login name and email) is used to make sure the password doesn't contain it.
+// Each rule returns its own error so the caller can tell the user what was wrong.
+func CheckPassword(newPassword string, userInfo ...string) error {
+	rules.RLock()
+	defer rules.RUnlock()
+	p := rules.policy
+
+	length := len([]rune(newPassword))
+	if length < p.MinLength || length == 0 {
+		return ErrPasswordTooShort
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return ErrPasswordTooLong
+	}
+	if p.Banned && rules.isBanned(newPassword) {
+		return ErrPasswordTooSimple
+	}
+	if p.NotUserInfo && containsUserInfo(newPassword, userInfo) {
+		return ErrPasswordUserInfo
+	}
+	if characterClasses(newPassword) < p.MinClasses {
+		return ErrPasswordClasses
+	}
+	if p.MinScore > 0 && scoreBits(rules.passwordBits(newPassword, userInfo)) < p.MinScore {
+		return ErrPasswordTooWeak
+	}
+	return nil
+}
+
+// PasswordScore gives a password a strength from 0 (too guessable) to 4 (very unguessable).
+// This is a rough estimate in the style of zxcvbn: common passwords, the user's own information,
+// repeats, sequences and keyboard runs are worth very little.
+func PasswordScore(pwd string, userInfo ...string) int {
+	rules.RLock()
+	defer rules.RUnlock()
+	return scoreBits(rules.passwordBits(pwd, userInfo))
+}
+
+// isBanned checks the password, and the password with any trailing digits or symbols
+// removed ('password1!' is no better than 'password')
+func (r *passwordRules) isBanned(pwd string) bool {
+	lpwd := strings.ToLower(pwd)
+	if r.banned[lpwd] {
+		return true
+	}
+	base := strings.TrimRightFunc(lpwd, func(c rune) bool { return !unicode.IsLetter(c) })
+	return base != "" && r.banned[base]
+}
+
+// passwordBits estimates the entropy of the password. Words found in the banned list or in the
+// user's information are only worth as much as picking a word from the list. Characters that
+// follow on from the previous one (repeats, sequences, keyboard runs) are worth one bit.
+// Everything else is worth the size of the character pool used.
+func (r *passwordRules) passwordBits(pwd string, userInfo []string) float64 {
+	lower := []rune(strings.ToLower(pwd))
+	covered := make([]bool, len(lower))
+	bits := 0.0
+
+	var info [][]rune
+	for _, word := range userInfoWords(userInfo) {
+		info = append(info, []rune(word))
+	}
+	wordBits := math.Log2(float64(r.wordCount + len(info) + 1))
+
+	for i := 0; i < len(lower); {
+		match := r.bannedMatch(lower[i:])
+		for _, w := range info {
+			if len(w) > match && len(w) <= len(lower)-i && string(lower[i:i+len(w)]) == string(w) {
+				match = len(w)
+			}
+		}
+		if match == 0 {
+			i++
+			continue
+		}
+		for j := i; j < i+match; j++ {
+			covered[j] = true
+		}
+		bits += wordBits + 1 // The extra bit is for any capitalisation
+		i += match
+	}
+
+	poolBits := math.Log2(float64(characterPool(pwd)))
+	for i, c := range lower {
+		if covered[i] {
+			continue
+		}
+		if i > 0 && !covered[i-1] && predictable(lower[i-1], c) {
+			bits++
+		} else {
+			bits += poolBits
+		}
+	}
+	return bits
+}
+
+// bannedMatch returns the length of the longest banned word found at the start of pwd,
+// or zero if there isn't one.
+func (r *passwordRules) bannedMatch(pwd []rune) int {
+	for _, length := range r.lengths {
+		if length <= len(pwd) && r.words[length][string(pwd[:length])] {
+			return length
+		}
+	}
+	return 0
+}
+
+// scoreBits turns the estimated entropy into a score
+func scoreBits(bits float64) int {
+	switch {
+	case bits < 28:
+		return SCORE_TOO_GUESSABLE
+	case bits < 36:
+		return SCORE_VERY_GUESSABLE
+	case bits < 45:
+		return SCORE_SOMEWHAT_GUESSABLE
+	case bits < 60:
+		return SCORE_SAFELY_UNGUESSABLE
+	}
+	return SCORE_VERY_UNGUESSABLE
+}
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// predictable returns true if the character repeats, or follows in sequence from, the previous one
+func predictable(prev, c rune) bool {
+	if c == prev || c == prev+1 || c == prev-1 {
+		return true
+	}
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, prev)
+		j := strings.IndexRune(row, c)
+		if i >= 0 && j >= 0 && (i-j == 1 || j-i == 1) {
+			return true
+		}
+	}
+	return false
+}
+
+// characterClasses counts how many of lower case, upper case, digits and symbols are used
+func characterClasses(pwd string) int {
+	var lower, upper, digit, other int
+	for _, c := range pwd {
+		switch {
+		case unicode.IsLower(c):
+			lower = 1
+		case unicode.IsUpper(c):
+			upper = 1
+		case unicode.IsDigit(c):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// characterPool returns the number of characters an attacker would need to try for each position
+func characterPool(pwd string) int {
+	pool := 0
+	var lower, upper, digit, other bool
+	for _, c := range pwd {
+		switch {
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if other {
+		pool += 33
+	}
+	if pool == 0 {
+		pool = 1
+	}
+	return pool
+}
+
+// userInfoWords breaks the user's information into the parts that may be used in a password.
+// An email address is split at the '@' so the mailbox name is checked on its own.
+func userInfoWords(userInfo []string) []string {
+	var words []string
+	for _, info := range userInfo {
+		info = strings.ToLower(strings.TrimSpace(info))
+		if len(info) < userInfoMinimumLength {
+			continue
+		}
+		words = append(words, info)
+		if at := strings.Index(info, "@"); at >= userInfoMinimumLength {
+			words = append(words, info[:at])
+		}
+	}
+	return words
+}
+
+func containsUserInfo(pwd string, userInfo []string) bool {
+	lpwd := strings.ToLower(pwd)
+	for _, word := range userInfoWords(userInfo) {
+		if strings.Contains(lpwd, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package policy
+
+import (
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	SetPassword(configure.PasswordPolicy{})
+	Convey("Empty policy uses the defaults", t, func() {
+		So(GetPassword(), ShouldResemble, DefaultPasswordPolicy())
+		So(CheckPassword(""), ShouldEqual, ErrPasswordTooShort)
+		So(CheckPassword("12345"), ShouldEqual, ErrPasswordTooShort)
+		So(CheckPassword("password"), ShouldEqual, ErrPasswordTooSimple)
+		So(CheckPassword("Password1!"), ShouldEqual, ErrPasswordTooSimple)
+		So(CheckPassword("zebra7"), ShouldBeNil)
+		So(CheckPassword("Th$s1s0k4Apsswd"), ShouldBeNil)
+		So(CheckPassword(strings.Repeat("x", configure.PASSWORD_MAXIMUM_LENGTH+1)), ShouldEqual, ErrPasswordTooLong)
+	})
+}
+
+func TestPolicyRules(t *testing.T) {
+	defer SetPassword(DefaultPasswordPolicy())
+
+	Convey("Length", t, func() {
+		SetPassword(configure.PasswordPolicy{MinLength: 8, MaxLength: 12})
+		So(CheckPassword("1234567"), ShouldEqual, ErrPasswordTooShort)
+		So(CheckPassword("123456789012"), ShouldBeNil)
+		So(CheckPassword("1234567890123"), ShouldEqual, ErrPasswordTooLong)
+		So(CheckPassword("password"), ShouldBeNil) // Banned is off
+	})
+	Convey("Character classes", t, func() {
+		SetPassword(configure.PasswordPolicy{MinLength: 1, MinClasses: 3})
+		So(CheckPassword("abcdefgh"), ShouldEqual, ErrPasswordClasses)
+		So(CheckPassword("abcdEFGH"), ShouldEqual, ErrPasswordClasses)
+		So(CheckPassword("abcdEF12"), ShouldBeNil)
+		So(CheckPassword("abcd!@12"), ShouldBeNil)
+	})
+	Convey("User information", t, func() {
+		SetPassword(configure.PasswordPolicy{MinLength: 1, NotUserInfo: true})
+		So(CheckPassword("xxJohnDoexx", "johndoe", "jd@example.com"), ShouldEqual, ErrPasswordUserInfo)
+		So(CheckPassword("my-mailbox-99", "login", "mailbox@example.com"), ShouldEqual, ErrPasswordUserInfo)
+		So(CheckPassword("my-mailbox-99", "login", ""), ShouldBeNil)
+		So(CheckPassword("abjdxy", "jd", "jd@x.com"), ShouldBeNil) // Too short to check
+	})
+	Convey("Strength", t, func() {
+		SetPassword(configure.PasswordPolicy{MinLength: 1, MinScore: SCORE_SOMEWHAT_GUESSABLE})
+		So(CheckPassword("aaaaaaaaaaaa"), ShouldEqual, ErrPasswordTooWeak)
+		So(CheckPassword("abcdefghijkl"), ShouldEqual, ErrPasswordTooWeak)
+		So(CheckPassword("qwertyuiop12"), ShouldEqual, ErrPasswordTooWeak)
+		So(CheckPassword("Mypassword2024"), ShouldEqual, ErrPasswordTooWeak)
+		So(CheckPassword("xK9#mQ2$vL"), ShouldBeNil)
+		So(CheckPassword("correct horse battery staple"), ShouldBeNil)
+	})
+	Convey("Banned file", t, func() {
+		fd, err := ioutil.TempFile("", "banned")
+		So(err, ShouldBeNil)
+		defer os.Remove(fd.Name())
+		fd.WriteString("Company2024\n\n  gusgusgus  \n")
+		fd.Close()
+
+		So(SetPassword(configure.PasswordPolicy{MinLength: 1, Banned: true, BannedFile: fd.Name()}), ShouldBeNil)
+		So(CheckPassword("company2024"), ShouldEqual, ErrPasswordTooSimple)
+		So(CheckPassword("GusGusGus!!"), ShouldEqual, ErrPasswordTooSimple)
+		So(CheckPassword("letmein"), ShouldEqual, ErrPasswordTooSimple)
+		So(PasswordScore("xCompany2024x"), ShouldBeLessThan, PasswordScore("xCqmpbny2024x"))
+
+		So(SetPassword(configure.PasswordPolicy{MinLength: 1, BannedFile: "/no/such/file"}), ShouldNotBeNil)
+		So(CheckPassword("company2024"), ShouldEqual, ErrPasswordTooSimple) // Policy unchanged
+	})
+}
+
+func TestPasswordScore(t *testing.T) {
+	SetPassword(DefaultPasswordPolicy())
+	Convey("Scores", t, func() {
+		So(PasswordScore("password"), ShouldEqual, SCORE_TOO_GUESSABLE)
+		So(PasswordScore("123456789"), ShouldEqual, SCORE_TOO_GUESSABLE)
+		So(PasswordScore("johnsmith1", "johnsmith"), ShouldEqual, SCORE_TOO_GUESSABLE)
+		So(PasswordScore("Tr0ub4dor&3"), ShouldBeGreaterThanOrEqualTo, SCORE_SAFELY_UNGUESSABLE)
+		So(PasswordScore("correcthorsebatterystaple"), ShouldEqual, SCORE_VERY_UNGUESSABLE)
+	})
+	Convey("Long passwords are scored quickly", t, func() {
+		start := time.Now()
+		So(PasswordScore(strings.Repeat("x!Q7", 25000)), ShouldEqual, SCORE_VERY_UNGUESSABLE)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+	})
+}
@@ -0,0 +1,30 @@
+// This is the compiled in list of common passwords. These are the passwords that are tried
+// first by anyone guessing, so they are rejected when the policy has 'Banned' set. The list
+// is also used to find common words inside a password when it is scored. Entries must be
+// lower case. Extra entries can be added with the policy's 'BannedFile'.
+
+package policy
+
+var commonPasswords = []string{
+	"000000", "1111", "111111", "11111111", "112233", "121212", "123123", "123321", "1234", "12345",
+	"123456", "1234567", "12345678", "123456789", "1234567890", "123qwe", "131313", "159753",
+	"1q2w3e4r", "1q2w3e4r5t", "1qaz2wsx", "1qazxsw2", "2000", "555555", "654321", "666666", "696969",
+	"777777", "7777777", "987654321", "a1b2c3", "aa123456", "aaaaaa", "abc123", "abc12345",
+	"abcd1234", "abcdef", "abcdefg", "abcdefgh", "access", "admin", "administrator", "amanda",
+	"andrew", "angel", "apple", "arsenal", "asdf", "asdf1234", "asdfgh", "asdfghjkl", "ashley",
+	"austin", "babygirl", "banana", "barcelona", "baseball", "baseball1", "batman", "batman1",
+	"biteme", "blessed", "buster", "butterfly", "changeme", "charlie", "cheese", "chelsea",
+	"chelsea1", "chocolate", "computer", "cookie", "dallas", "daniel", "default", "dragon", "dragon1",
+	"flower", "football", "football1", "freedom", "george", "ginger", "guest", "harley", "hello",
+	"hello123", "hockey", "hunter", "iloveyou", "iloveyou1", "jennifer", "jessica", "jesus", "jordan",
+	"joshua", "killer", "klaster", "letmein", "letmein1", "letmein123", "liverpool", "login", "love",
+	"lovely", "maggie", "master", "matrix", "matthew", "messi", "michael", "michelle", "minecraft",
+	"mobilemail", "monkey", "monkey1", "mustang", "mypassword", "naruto", "nicole", "nopassword",
+	"orange", "p@ssw0rd", "p@ssword", "pa$$word", "pa55word", "pass", "passpass", "passw0rd",
+	"password", "password1", "password123", "pepper", "pokemon", "princess", "princess1", "purple",
+	"q1w2e3r4", "qazwsx", "qwe123", "qwerty", "qwerty123", "qwertyu", "qwertyuiop", "ranger",
+	"robert", "ronaldo", "root", "samsung", "secret", "shadow", "shadow1", "soccer", "starwars",
+	"summer", "sunshine", "sunshine1", "superman", "superman1", "taylor", "test", "test123", "thomas",
+	"thunder", "tigger", "toor", "trustno1", "welcome", "welcome1", "whatever", "yankees",
+	"yourpassword", "zaq12wsx", "zxcv", "zxcvbn", "zxcvbnm",
+}
@@ -29,11 +29,23 @@ type JsonFileConn struct {
 	isdirty   bool
 	isMonitor bool
 
-	userlist map[string]*tenant.User
+	userlist    map[string]*tenant.User
+	sessionlist map[string]*tenant.Session    // Kept in a second file: filename + SessionFileSuffix
+	refreshlist map[string]*tenant.Refresh    // Kept in a third file: filename + RefreshFileSuffix
+	credlist    map[string]*tenant.Credential // Kept in a fourth file: filename + CredentialFileSuffix
 
 	messages chan *jsonMessage
 }
 
+// SessionFileSuffix is added to the user's filename to get the file sessions are stored in.
+const SessionFileSuffix = ".session"
+
+// RefreshFileSuffix is added to the user's filename to get the file refresh tokens are stored in.
+const RefreshFileSuffix = ".refresh"
+
+// CredentialFileSuffix is added to the user's filename to get the file passkeys are stored in.
+const CredentialFileSuffix = ".credential"
+
 func NewJsonFileConn(name string) *JsonFileConn {
 	store := &JsonFileConn{
 		filename:  name,
@@ -41,6 +53,9 @@ func NewJsonFileConn(name string) *JsonFileConn {
 		isMonitor: true}
 	store.messages = make(chan *jsonMessage, 10)
 	store.userlist = make(map[string]*tenant.User)
+	store.sessionlist = make(map[string]*tenant.Session)
+	store.refreshlist = make(map[string]*tenant.Refresh)
+	store.credlist = make(map[string]*tenant.Credential)
 	return store
 }
 
@@ -64,7 +79,7 @@ type jsonMessage struct {
 // it then 'routes' calls through this connection.
 func (t *JsonFileDriver) Open(jsonfile string, extraDriverOptions string) (storage.Conn, error) {
 	store := NewJsonFileConn(jsonfile)
-	store.messages <- &jsonMessage{Command: CmdLoad}
+	store.load()       // Load now so the first fetch finds the users
 	go store.Monitor() // Start the MONITOR in the background
 	return store, nil
 }
@@ -78,27 +93,9 @@ func (t *JsonFileConn) Monitor() {
 		t.busy.Lock()
 
 		if msg.Command == CmdNew {
-			if len(t.userlist) < 1 {
-				continue
-			}
-			if buff, err := json.MarshalIndent(t.userlist, "", "  "); err == nil {
-				err := ioutil.WriteFile(t.filename, buff, 0600)
-				if err != nil {
-					fmt.Println("ERROR! JsonFileConn: ", err.Error())
-				}
-				t.isdirty = false
-			} else {
-				fmt.Println("ERROR! JsonFileConn: ", err.Error())
-			}
+			t.save()
 		} else if msg.Command == CmdLoad {
-			if buff, err := ioutil.ReadFile(t.filename); err == nil {
-				if len(buff) > 0 {
-					err := json.Unmarshal(buff, &t.userlist)
-					if err != nil {
-						fmt.Println("ERROR! JsonFileConn: ", err.Error())
-					}
-				}
-			}
+			t.load()
 		} else if msg.Command == CmdTimer {
 			finfo, err := os.Stat(t.filename)
 			if err == nil {
@@ -114,8 +111,55 @@ func (t *JsonFileConn) Monitor() {
 	}
 }
 
-// Close the connection to the database (if it is open)
+// load reads all of the files. The caller must hold the lock once the monitor is running.
+func (t *JsonFileConn) load() {
+	readJsonFile(t.filename, &t.userlist)
+	readJsonFile(t.filename+SessionFileSuffix, &t.sessionlist)
+	readJsonFile(t.filename+RefreshFileSuffix, &t.refreshlist)
+	readJsonFile(t.filename+CredentialFileSuffix, &t.credlist)
+}
+
+// save writes all of the files if anything has changed. The caller must hold the lock.
+func (t *JsonFileConn) save() {
+	if t.isdirty {
+		writeJsonFile(t.filename, t.userlist)
+		writeJsonFile(t.filename+SessionFileSuffix, t.sessionlist)
+		writeJsonFile(t.filename+RefreshFileSuffix, t.refreshlist)
+		writeJsonFile(t.filename+CredentialFileSuffix, t.credlist)
+		t.isdirty = false
+	}
+}
+
+// writeJsonFile encodes the records and writes them out to the file
+func writeJsonFile(filename string, records interface{}) {
+	if buff, err := json.MarshalIndent(records, "", "  "); err == nil {
+		err := ioutil.WriteFile(filename, buff, 0600)
+		if err != nil {
+			fmt.Println("ERROR! JsonFileConn: ", err.Error())
+		}
+	} else {
+		fmt.Println("ERROR! JsonFileConn: ", err.Error())
+	}
+}
+
+// readJsonFile will load the records from the file, if it exists
+func readJsonFile(filename string, records interface{}) {
+	if buff, err := ioutil.ReadFile(filename); err == nil {
+		if len(buff) > 0 {
+			err := json.Unmarshal(buff, records)
+			if err != nil {
+				fmt.Println("ERROR! JsonFileConn: ", err.Error())
+			}
+		}
+	}
+}
+
+// Close writes out any changes the monitor hasn't saved yet, so short-lived programs, such as
+// the command line, don't lose them.
 func (t *JsonFileConn) Close() error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	t.save()
 	return nil
 }
 
@@ -139,12 +183,24 @@ func (t *JsonFileConn) UserInsert(userRecord *tenant.User) error {
 }
 
 func (t *JsonFileConn) UserFetch(domain, key, value string) (*tenant.User, error) {
+	return t.userFetch(domain, key, value, false)
+}
+
+func (t *JsonFileConn) UserFetchDeleted(domain, key, value string) (*tenant.User, error) {
+	return t.userFetch(domain, key, value, true)
+}
+
+// userFetch finds a user that is either deleted or not deleted
+func (t *JsonFileConn) userFetch(domain, key, value string, deleted bool) (*tenant.User, error) {
 	found := false
 	t.busy.Lock()
 	defer t.busy.Unlock()
 
 	for _, userRecord := range t.userlist {
 
+		if userRecord.IsDeleted() != deleted {
+			continue
+		}
 		if domain == storage.MatchAnyDomain || domain == userRecord.Domain {
 			switch key {
 			case storage.FieldGUID:
@@ -155,6 +211,10 @@ func (t *JsonFileConn) UserFetch(domain, key, value string) (*tenant.User, error
 				found = (value == userRecord.LoginName)
 			case storage.FieldToken:
 				found = (value == userRecord.Token)
+			case storage.FieldResetToken:
+				found = (value != "" && value == userRecord.ResetToken)
+			case storage.FieldVerifyToken:
+				found = (value != "" && value == userRecord.VerifyToken)
 			}
 			if found {
 				return userRecord, nil
@@ -163,3 +223,223 @@ func (t *JsonFileConn) UserFetch(domain, key, value string) (*tenant.User, error
 	}
 	return nil, ErrUserNotFound
 }
+
+func (t *JsonFileConn) UserSearch(search *storage.Search) ([]*tenant.User, error) {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	users := []*tenant.User{}
+	for _, userRecord := range t.userlist {
+		users = append(users, userRecord)
+	}
+	return search.Page(users), nil
+}
+
+func (t *JsonFileConn) UserPurge(deletedBefore time.Time) (int, error) {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	count := 0
+	for guid, userRecord := range t.userlist {
+		if userRecord.IsDeleted() && userRecord.DeletedAt.Before(deletedBefore) {
+			delete(t.userlist, guid)
+			for key, session := range t.sessionlist {
+				if session.Guid == guid {
+					delete(t.sessionlist, key)
+				}
+			}
+			for key, refresh := range t.refreshlist {
+				if refresh.Guid == guid {
+					delete(t.refreshlist, key)
+				}
+			}
+			for key, cred := range t.credlist {
+				if cred.Guid == guid {
+					delete(t.credlist, key)
+				}
+			}
+			count++
+		}
+	}
+	if count > 0 {
+		t.isdirty = true
+		t.messages <- &jsonMessage{Command: CmdNew}
+	}
+	return count, nil
+}
+
+func (t *JsonFileConn) SessionInsert(session *tenant.Session) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	t.sessionlist[session.Token] = session
+	t.isdirty = true
+	t.messages <- &jsonMessage{Command: CmdNew}
+	return nil
+}
+
+func (t *JsonFileConn) SessionUpdate(session *tenant.Session) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	if _, ok := t.sessionlist[session.Token]; !ok {
+		return ErrSessionNotFound
+	}
+	t.sessionlist[session.Token] = session
+	t.isdirty = true
+	t.messages <- &jsonMessage{Command: CmdNew}
+	return nil
+}
+
+func (t *JsonFileConn) SessionFetch(tokenHash string) (*tenant.Session, error) {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	if session, ok := t.sessionlist[tokenHash]; ok {
+		return session, nil
+	}
+	return nil, ErrSessionNotFound
+}
+
+func (t *JsonFileConn) SessionList(guid string) ([]*tenant.Session, error) {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	list := []*tenant.Session{}
+	for _, session := range t.sessionlist {
+		if session.Guid == guid {
+			list = append(list, session)
+		}
+	}
+	return list, nil
+}
+
+func (t *JsonFileConn) SessionDelete(tokenHash string) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	delete(t.sessionlist, tokenHash)
+	t.isdirty = true
+	t.messages <- &jsonMessage{Command: CmdNew}
+	return nil
+}
+
+func (t *JsonFileConn) SessionDeleteAll(guid string) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	for key, session := range t.sessionlist {
+		if session.Guid == guid {
+			delete(t.sessionlist, key)
+		}
+	}
+	t.isdirty = true
+	t.messages <- &jsonMessage{Command: CmdNew}
+	return nil
+}
+
+func (t *JsonFileConn) RefreshInsert(refresh *tenant.Refresh) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	saved := *refresh
+	t.refreshlist[refresh.Token] = &saved
+	t.isdirty = true
+	t.messages <- &jsonMessage{Command: CmdNew}
+	return nil
+}
+
+// RefreshUpdate only saves a token that hasn't been used: ErrRefreshReused is returned if another
+// request has used it first.
+func (t *JsonFileConn) RefreshUpdate(refresh *tenant.Refresh) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	stored, ok := t.refreshlist[refresh.Token]
+	if !ok {
+		return ErrRefreshNotFound
+	}
+	if stored.IsUsed() {
+		return ErrRefreshReused
+	}
+	saved := *refresh
+	t.refreshlist[refresh.Token] = &saved
+	t.isdirty = true
+	t.messages <- &jsonMessage{Command: CmdNew}
+	return nil
+}
+
+func (t *JsonFileConn) RefreshFetch(tokenHash string) (*tenant.Refresh, error) {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	if refresh, ok := t.refreshlist[tokenHash]; ok {
+		found := *refresh
+		return &found, nil
+	}
+	return nil, ErrRefreshNotFound
+}
+
+func (t *JsonFileConn) RefreshDeleteFamily(family string) error {
+	return t.refreshDelete(func(refresh *tenant.Refresh) bool { return refresh.Family == family })
+}
+
+func (t *JsonFileConn) RefreshDeleteAll(guid string) error {
+	return t.refreshDelete(func(refresh *tenant.Refresh) bool { return refresh.Guid == guid })
+}
+
+func (t *JsonFileConn) refreshDelete(match func(*tenant.Refresh) bool) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	for key, refresh := range t.refreshlist {
+		if match(refresh) {
+			delete(t.refreshlist, key)
+		}
+	}
+	t.isdirty = true
+	t.messages <- &jsonMessage{Command: CmdNew}
+	return nil
+}
+
+func (t *JsonFileConn) CredentialInsert(cred *tenant.Credential) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	if _, ok := t.credlist[cred.Id]; ok {
+		return ErrDuplicatePasskey
+	}
+	t.credlist[cred.Id] = cred
+	t.isdirty = true
+	t.messages <- &jsonMessage{Command: CmdNew}
+	return nil
+}
+
+func (t *JsonFileConn) CredentialUpdate(cred *tenant.Credential) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	if _, ok := t.credlist[cred.Id]; !ok {
+		return ErrPasskeyNotFound
+	}
+	t.credlist[cred.Id] = cred
+	t.isdirty = true
+	t.messages <- &jsonMessage{Command: CmdNew}
+	return nil
+}
+
+func (t *JsonFileConn) CredentialFetch(id string) (*tenant.Credential, error) {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	if cred, ok := t.credlist[id]; ok {
+		return cred, nil
+	}
+	return nil, ErrPasskeyNotFound
+}
+
+func (t *JsonFileConn) CredentialList(guid string) ([]*tenant.Credential, error) {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	list := []*tenant.Credential{}
+	for _, cred := range t.credlist {
+		if cred.Guid == guid {
+			list = append(list, cred)
+		}
+	}
+	return list, nil
+}
+
+func (t *JsonFileConn) CredentialDelete(id string) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	delete(t.credlist, id)
+	t.isdirty = true
+	t.messages <- &jsonMessage{Command: CmdNew}
+	return nil
+}
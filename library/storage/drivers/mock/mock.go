@@ -7,13 +7,19 @@ import (
 	. "github.com/cgentry/gus/ecode"
 	"github.com/cgentry/gus/library/storage"
 	"github.com/cgentry/gus/record/tenant"
+	"sync"
+	"time"
 )
 
 type MockDriver struct{}
 
 type MockConn struct {
-	db      map[string]*tenant.User
-	errList map[string]error
+	db       map[string]*tenant.User
+	sessions map[string]*tenant.Session
+	refresh  map[string]*tenant.Refresh
+	creds    map[string]*tenant.Credential
+	errList  map[string]error
+	busy     sync.Mutex // Refresh tokens are raced for by concurrent requests
 }
 
 // Fetch a raw database Mock driver
@@ -26,6 +32,9 @@ func NewMockDriver() *MockDriver {
 func (t *MockDriver) Open(option1 string, extraDriverOptions string) (storage.Conn, error) {
 	store := &MockConn{}
 	store.db = make(map[string]*tenant.User)
+	store.sessions = make(map[string]*tenant.Session)
+	store.refresh = make(map[string]*tenant.Refresh)
+	store.creds = make(map[string]*tenant.Credential)
 	store.errList = make(map[string]error)
 	return store, nil
 }
@@ -56,9 +65,21 @@ func (t *MockConn) UserInsert(user *tenant.User) error {
 }
 
 func (t *MockConn) UserFetch(domain, key, value string) (*tenant.User, error) {
+	return t.userFetch(domain, key, value, false)
+}
+
+func (t *MockConn) UserFetchDeleted(domain, key, value string) (*tenant.User, error) {
+	return t.userFetch(domain, key, value, true)
+}
+
+// userFetch finds a user that is either deleted or not deleted
+func (t *MockConn) userFetch(domain, key, value string, deleted bool) (*tenant.User, error) {
 	found := false
 	for _, user := range t.db {
 
+		if user.IsDeleted() != deleted {
+			continue
+		}
 		if domain == storage.MatchAnyDomain || domain == user.Domain {
 			switch key {
 			case storage.FieldGUID:
@@ -69,6 +90,10 @@ func (t *MockConn) UserFetch(domain, key, value string) (*tenant.User, error) {
 				found = (value == user.LoginName)
 			case storage.FieldToken:
 				found = (value == user.Token)
+			case storage.FieldResetToken:
+				found = (value != "" && value == user.ResetToken)
+			case storage.FieldVerifyToken:
+				found = (value != "" && value == user.VerifyToken)
 			}
 			if found {
 				if err, ok := t.errList[user.Guid]; ok {
@@ -80,3 +105,168 @@ func (t *MockConn) UserFetch(domain, key, value string) (*tenant.User, error) {
 	}
 	return nil, ErrUserNotFound
 }
+
+func (t *MockConn) UserSearch(search *storage.Search) ([]*tenant.User, error) {
+	users := []*tenant.User{}
+	for _, user := range t.db {
+		users = append(users, user)
+	}
+	return search.Page(users), nil
+}
+
+func (t *MockConn) UserPurge(deletedBefore time.Time) (int, error) {
+	count := 0
+	for guid, user := range t.db {
+		if user.IsDeleted() && user.DeletedAt.Before(deletedBefore) {
+			delete(t.db, guid)
+			t.SessionDeleteAll(guid)
+			t.RefreshDeleteAll(guid)
+			for id, cred := range t.creds {
+				if cred.Guid == guid {
+					delete(t.creds, id)
+				}
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (t *MockConn) SessionInsert(session *tenant.Session) error {
+	t.sessions[session.Token] = session
+	return nil
+}
+
+func (t *MockConn) SessionUpdate(session *tenant.Session) error {
+	if _, ok := t.sessions[session.Token]; !ok {
+		return ErrSessionNotFound
+	}
+	t.sessions[session.Token] = session
+	return nil
+}
+
+func (t *MockConn) SessionFetch(tokenHash string) (*tenant.Session, error) {
+	if session, ok := t.sessions[tokenHash]; ok {
+		return session, nil
+	}
+	return nil, ErrSessionNotFound
+}
+
+func (t *MockConn) SessionList(guid string) ([]*tenant.Session, error) {
+	list := []*tenant.Session{}
+	for _, session := range t.sessions {
+		if session.Guid == guid {
+			list = append(list, session)
+		}
+	}
+	return list, nil
+}
+
+func (t *MockConn) SessionDelete(tokenHash string) error {
+	delete(t.sessions, tokenHash)
+	return nil
+}
+
+func (t *MockConn) SessionDeleteAll(guid string) error {
+	for key, session := range t.sessions {
+		if session.Guid == guid {
+			delete(t.sessions, key)
+		}
+	}
+	return nil
+}
+
+func (t *MockConn) RefreshInsert(refresh *tenant.Refresh) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	saved := *refresh
+	t.refresh[refresh.Token] = &saved
+	return nil
+}
+
+// RefreshUpdate only saves a token that hasn't been used: ErrRefreshReused is returned if another
+// request has used it first.
+func (t *MockConn) RefreshUpdate(refresh *tenant.Refresh) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	stored, ok := t.refresh[refresh.Token]
+	if !ok {
+		return ErrRefreshNotFound
+	}
+	if stored.IsUsed() {
+		return ErrRefreshReused
+	}
+	saved := *refresh
+	t.refresh[refresh.Token] = &saved
+	return nil
+}
+
+func (t *MockConn) RefreshFetch(tokenHash string) (*tenant.Refresh, error) {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	if refresh, ok := t.refresh[tokenHash]; ok {
+		found := *refresh
+		return &found, nil
+	}
+	return nil, ErrRefreshNotFound
+}
+
+func (t *MockConn) RefreshDeleteFamily(family string) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	for key, refresh := range t.refresh {
+		if refresh.Family == family {
+			delete(t.refresh, key)
+		}
+	}
+	return nil
+}
+
+func (t *MockConn) RefreshDeleteAll(guid string) error {
+	t.busy.Lock()
+	defer t.busy.Unlock()
+	for key, refresh := range t.refresh {
+		if refresh.Guid == guid {
+			delete(t.refresh, key)
+		}
+	}
+	return nil
+}
+
+func (t *MockConn) CredentialInsert(cred *tenant.Credential) error {
+	if _, ok := t.creds[cred.Id]; ok {
+		return ErrDuplicatePasskey
+	}
+	t.creds[cred.Id] = cred
+	return nil
+}
+
+func (t *MockConn) CredentialUpdate(cred *tenant.Credential) error {
+	if _, ok := t.creds[cred.Id]; !ok {
+		return ErrPasskeyNotFound
+	}
+	t.creds[cred.Id] = cred
+	return nil
+}
+
+func (t *MockConn) CredentialFetch(id string) (*tenant.Credential, error) {
+	if cred, ok := t.creds[id]; ok {
+		return cred, nil
+	}
+	return nil, ErrPasskeyNotFound
+}
+
+func (t *MockConn) CredentialList(guid string) ([]*tenant.Credential, error) {
+	list := []*tenant.Credential{}
+	for _, cred := range t.creds {
+		if cred.Guid == guid {
+			list = append(list, cred)
+		}
+	}
+	return list, nil
+}
+
+func (t *MockConn) CredentialDelete(id string) error {
+	delete(t.creds, id)
+	return nil
+}
@@ -6,18 +6,61 @@ package sqlite
 import (
 	. "github.com/cgentry/gus/ecode"
 	"net/http"
+	"strings"
 )
 
+// sqlColumn is a column that is added to a table created by an older version
+type sqlColumn struct {
+	name string
+	kind string
+}
+
+// userColumns are the columns added to the User table after it was first released. A store
+// created by an older version has its User table brought up to date by CreateStore.
+var userColumns = []sqlColumn{
+	{FIELD_RESET_TOKEN, `text`},
+	{FIELD_RESET_DT, `text`},
+	{FIELD_TOTP_SECRET, `text`},
+	{FIELD_TOTP_ENABLED, `integer`},
+	{FIELD_TOTP_STEP, `text`},
+	{FIELD_RECOVERY_CODES, `text`},
+	{FIELD_FACTOR_TOKEN, `text`},
+	{FIELD_FACTOR_DT, `text`},
+	{FIELD_CHALLENGE, `text`},
+	{FIELD_CHALLENGE_DT, `text`},
+	{FIELD_VERIFY_TOKEN, `text`},
+	{FIELD_VERIFY_DT, `text`},
+	{FIELD_ROLES, `text`},
+	{FIELD_PERMISSIONS, `text`},
+	{FIELD_CAPABILITIES, `text`},
+	{FIELD_DELETED_DT, `text`}, // The live login and email indexes depend upon it
+}
+
 // CreateStore is a non-destructive storage creation mechanism. It can be called on the cli line
 // with the option -C
 func (t *SqliteConn) CreateStore() error {
 
-	sql := []string{
-		`CREATE TABLE IF NOT EXISTS User (
+	userTable := `CREATE TABLE IF NOT EXISTS User (
 			Guid         text primary key,
 			LoginName    text ,
 			Email        text ,
 			Token        text UNIQUE,
+			ResetToken   text,
+			ResetExpiresAt text,
+
+			TotpSecret     text,
+			TotpEnabled    integer,
+			TotpStep       text,
+			RecoveryCodes  text,
+			FactorToken    text,
+			FactorExpiresAt text,
+			Challenge      text,
+			ChallengeExpiresAt text,
+			VerifyToken    text,
+			VerifyExpiresAt text,
+			Roles          text,
+			Permissions    text,
+			Capabilities   text,
 
 			Salt         text,
 
@@ -43,12 +86,70 @@ func (t *SqliteConn) CreateStore() error {
 
 			CreatedAt    text,
 			UpdatedAt    text,
-			DeletedAt    text);`,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idxlogin      ON User(LoginName,Domain)`,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idxEmail      ON User(Email,Domain)`,
+			DeletedAt    text);`
+	if _, err := t.db.Exec(userTable); err != nil {
+		return NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	// The indexes below may use the new columns, so they must be added first.
+	if err := t.addMissingColumns(`User`, userColumns); err != nil {
+		return NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+
+	sql := []string{
+		// Deleted users don't hold on to their login name or email. Stores created before
+		// users could be deleted have indexes over every user, so they are replaced.
+		`DROP INDEX IF EXISTS idxlogin`,
+		`DROP INDEX IF EXISTS idxEmail`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idxLoginLive  ON User(LoginName,Domain) WHERE ` + SQL_NOT_DELETED,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idxEmailLive  ON User(Email,Domain) WHERE ` + SQL_NOT_DELETED,
+		`CREATE        INDEX IF NOT EXISTS idxDeletedAt  ON User(DeletedAt);`,
 		`CREATE        INDEX IF NOT EXISTS idxfullname   ON User(FullName);`,
 		`CREATE        INDEX IF NOT EXISTS idxMaxSession ON User(MaxSessionAt);`,
 		`CREATE        INDEX IF NOT EXISTS idxTimeoutAt  ON User(TimeoutAt);`,
+		`CREATE        INDEX IF NOT EXISTS idxResetToken ON User(ResetToken);`,
+		`CREATE        INDEX IF NOT EXISTS idxVerifyToken ON User(VerifyToken);`,
+		`CREATE TABLE IF NOT EXISTS Session (
+			Token        text primary key,
+			Id           text,
+			Guid         text,
+			Domain       text,
+			ClientId     text,
+			Device       text,
+			Family       text,
+
+			CreatedAt    text,
+			LastAuthAt   text,
+			TimeoutAt    text,
+			MaxSessionAt text);`,
+		`CREATE        INDEX IF NOT EXISTS idxSessionGuid ON Session(Guid);`,
+		`CREATE TABLE IF NOT EXISTS Refresh (
+			Token        text primary key,
+			Family       text,
+			Guid         text,
+			Domain       text,
+			ClientId     text,
+			Device       text,
+
+			CreatedAt    text,
+			ExpiresAt    text,
+			UsedAt       text);`,
+		`CREATE        INDEX IF NOT EXISTS idxRefreshFamily ON Refresh(Family);`,
+		`CREATE        INDEX IF NOT EXISTS idxRefreshGuid   ON Refresh(Guid);`,
+		`CREATE TABLE IF NOT EXISTS Credential (
+			Id           text primary key,
+			Guid         text,
+			Domain       text,
+			Name         text,
+
+			PublicKey    text,
+			Algorithm    text,
+			SignCount    text,
+			Aaguid       text,
+			Format       text,
+
+			CreatedAt    text,
+			LastUsedAt   text);`,
+		`CREATE        INDEX IF NOT EXISTS idxCredentialGuid ON Credential(Guid);`,
 	}
 
 	for _, cmd := range sql {
@@ -59,3 +160,36 @@ func (t *SqliteConn) CreateStore() error {
 
 	return nil
 }
+
+// addMissingColumns adds any of the columns that the table doesn't have yet.
+func (t *SqliteConn) addMissingColumns(table string, columns []sqlColumn) error {
+	rows, err := t.db.Query(`PRAGMA table_info(` + table + `)`)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, kind string
+		var dflt interface{}
+		if err = rows.Scan(&cid, &name, &kind, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		have[strings.ToLower(name)] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, column := range columns {
+		if have[strings.ToLower(column.name)] {
+			continue
+		}
+		if _, err = t.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column.name + ` ` + column.kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
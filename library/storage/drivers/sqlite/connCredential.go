@@ -0,0 +1,120 @@
+// Copyright 2014 Charles Gentry. All rights reserved.
+// Please see the license included with this package
+package sqlite
+
+import (
+	"encoding/base64"
+	"fmt"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/tenant"
+	"net/http"
+	"strconv"
+)
+
+// Passkeys are kept in their own table, keyed by the credential id. The public key is stored
+// as base64 and the numbers as text so they map back like every other field.
+
+// CredentialInsert adds a newly registered passkey
+func (t *SqliteConn) CredentialInsert(cred *tenant.Credential) error {
+	if t.db == nil {
+		return ErrNotOpen
+	}
+	if _, err := t.CredentialFetch(cred.Id); err == nil {
+		return ErrDuplicatePasskey
+	}
+	cmd := fmt.Sprintf(`INSERT INTO %s
+			(Id, Guid, Domain, Name, PublicKey, Algorithm, SignCount, Aaguid, Format, CreatedAt, LastUsedAt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		tenant.CREDENTIAL_STORE_NAME)
+	_, err := t.db.Exec(cmd,
+		cred.Id,
+		cred.Guid,
+		cred.Domain,
+		cred.Name,
+		base64.StdEncoding.EncodeToString(cred.PublicKey),
+		strconv.Itoa(cred.Algorithm),
+		strconv.FormatUint(uint64(cred.SignCount), 10),
+		cred.Aaguid,
+		cred.Format,
+		cred.CreatedAt.Format(configure.USER_TIME_STR),
+		cred.LastUsedAt.Format(configure.USER_TIME_STR))
+	if err != nil {
+		return NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// CredentialUpdate saves the name, signature count and last use. The key can't change.
+func (t *SqliteConn) CredentialUpdate(cred *tenant.Credential) error {
+	if t.db == nil {
+		return ErrNotOpen
+	}
+	cmd := fmt.Sprintf(`UPDATE %s
+			 SET Name = ?,
+			     SignCount = ?,
+			     LastUsedAt = ?
+		   WHERE Id = ?`,
+		tenant.CREDENTIAL_STORE_NAME)
+	result, err := t.db.Exec(cmd,
+		cred.Name,
+		strconv.FormatUint(uint64(cred.SignCount), 10),
+		cred.LastUsedAt.Format(configure.USER_TIME_STR),
+		cred.Id)
+	if err != nil {
+		return NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	if count, err := result.RowsAffected(); err == nil && count == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// CredentialFetch finds a passkey by its credential id
+func (t *SqliteConn) CredentialFetch(id string) (*tenant.Credential, error) {
+	list, err := t.credentialSelect(`Id`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrPasskeyNotFound
+	}
+	return list[0], nil
+}
+
+// CredentialList returns all of the passkeys for a user
+func (t *SqliteConn) CredentialList(guid string) ([]*tenant.Credential, error) {
+	list, err := t.credentialSelect(`Guid`, guid)
+	if list == nil && err == nil {
+		list = []*tenant.Credential{}
+	}
+	return list, err
+}
+
+func (t *SqliteConn) credentialSelect(field, value string) ([]*tenant.Credential, error) {
+	if t.db == nil {
+		return nil, ErrNotOpen
+	}
+	cmd := fmt.Sprintf(`SELECT *
+			 FROM %s
+			WHERE %s = ?`,
+		tenant.CREDENTIAL_STORE_NAME, field)
+	rows, err := t.db.Query(cmd, value)
+	if err != nil {
+		return nil, NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	defer rows.Close()
+	return mapColumnsToCredential(rows), nil
+}
+
+// CredentialDelete removes a passkey
+func (t *SqliteConn) CredentialDelete(id string) error {
+	if t.db == nil {
+		return ErrNotOpen
+	}
+	cmd := fmt.Sprintf(`DELETE FROM %s WHERE Id = ?`, tenant.CREDENTIAL_STORE_NAME)
+	if _, err := t.db.Exec(cmd, id); err != nil {
+		return NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2014 Charles Gentry. All rights reserved.
+// Please see the license included with this package
+package sqlite
+
+import (
+	"fmt"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/tenant"
+	"net/http"
+	"time"
+)
+
+// Refresh tokens are kept in their own table, keyed by the hash of the token.
+
+// RefreshInsert adds a new refresh token
+func (t *SqliteConn) RefreshInsert(refresh *tenant.Refresh) error {
+	if t.db == nil {
+		return ErrNotOpen
+	}
+	cmd := fmt.Sprintf(`INSERT INTO %s
+			(Token, Family, Guid, Domain, ClientId, Device, CreatedAt, ExpiresAt, UsedAt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		tenant.REFRESH_STORE_NAME)
+	_, err := t.db.Exec(cmd,
+		refresh.Token,
+		refresh.Family,
+		refresh.Guid,
+		refresh.Domain,
+		refresh.ClientId,
+		refresh.Device,
+		refresh.CreatedAt.Format(configure.USER_TIME_STR),
+		refresh.ExpiresAt.Format(configure.USER_TIME_STR),
+		refresh.UsedAt.Format(configure.USER_TIME_STR))
+	if err != nil {
+		return NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// RefreshUpdate saves when the token was used. Nothing else in a refresh token can change. Only
+// a token that hasn't been used is updated, so when two requests race to use the same token only
+// one wins: the other gets ErrRefreshReused.
+func (t *SqliteConn) RefreshUpdate(refresh *tenant.Refresh) error {
+	if t.db == nil {
+		return ErrNotOpen
+	}
+	cmd := fmt.Sprintf(`UPDATE %s
+			 SET UsedAt = ?
+		   WHERE Token = ?
+			 AND UsedAt = ?`,
+		tenant.REFRESH_STORE_NAME)
+	result, err := t.db.Exec(cmd,
+		refresh.UsedAt.Format(configure.USER_TIME_STR),
+		refresh.Token,
+		time.Time{}.Format(configure.USER_TIME_STR))
+	if err != nil {
+		return NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	if count, err := result.RowsAffected(); err == nil && count == 0 {
+		if _, err = t.RefreshFetch(refresh.Token); err != nil {
+			return err
+		}
+		return ErrRefreshReused
+	}
+	return nil
+}
+
+// RefreshFetch finds the refresh token using the hash of the token
+func (t *SqliteConn) RefreshFetch(tokenHash string) (*tenant.Refresh, error) {
+	if t.db == nil {
+		return nil, ErrNotOpen
+	}
+	cmd := fmt.Sprintf(`SELECT *
+			 FROM %s
+			WHERE Token = ?`,
+		tenant.REFRESH_STORE_NAME)
+	rows, err := t.db.Query(cmd, tokenHash)
+	if err != nil {
+		return nil, NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	list := mapColumnsToRefresh(rows)
+	if len(list) == 0 {
+		return nil, ErrRefreshNotFound
+	}
+	return list[0], nil
+}
+
+// RefreshDeleteFamily removes every token that came from the same login
+func (t *SqliteConn) RefreshDeleteFamily(family string) error {
+	return t.refreshDelete(`Family`, family)
+}
+
+// RefreshDeleteAll removes all of the refresh tokens for a user
+func (t *SqliteConn) RefreshDeleteAll(guid string) error {
+	return t.refreshDelete(`Guid`, guid)
+}
+
+func (t *SqliteConn) refreshDelete(field, value string) error {
+	if t.db == nil {
+		return ErrNotOpen
+	}
+	cmd := fmt.Sprintf(`DELETE FROM %s WHERE %s = ?`, tenant.REFRESH_STORE_NAME, field)
+	if _, err := t.db.Exec(cmd, value); err != nil {
+		return NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2014 Charles Gentry. All rights reserved.
+// Please see the license included with this package
+package sqlite
+
+import (
+	"fmt"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/tenant"
+	"net/http"
+)
+
+// Sessions are kept in their own table, keyed by the hash of the session token.
+
+// SessionInsert adds a new session for a user
+func (t *SqliteConn) SessionInsert(session *tenant.Session) error {
+	if t.db == nil {
+		return ErrNotOpen
+	}
+	cmd := fmt.Sprintf(`INSERT INTO %s
+			(Token, Id, Guid, Domain, ClientId, Device, Family, CreatedAt, LastAuthAt, TimeoutAt, MaxSessionAt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		tenant.SESSION_STORE_NAME)
+	_, err := t.db.Exec(cmd,
+		session.Token,
+		session.Id,
+		session.Guid,
+		session.Domain,
+		session.ClientId,
+		session.Device,
+		session.Family,
+		session.CreatedAt.Format(configure.USER_TIME_STR),
+		session.LastAuthAt.Format(configure.USER_TIME_STR),
+		session.TimeoutAt.Format(configure.USER_TIME_STR),
+		session.MaxSessionAt.Format(configure.USER_TIME_STR))
+	if err != nil {
+		return NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// SessionUpdate saves the times for the session. Nothing else in a session can change.
+func (t *SqliteConn) SessionUpdate(session *tenant.Session) error {
+	if t.db == nil {
+		return ErrNotOpen
+	}
+	cmd := fmt.Sprintf(`UPDATE %s
+			 SET LastAuthAt = ?,
+			     TimeoutAt = ?,
+			     MaxSessionAt = ?
+		   WHERE Token = ?`,
+		tenant.SESSION_STORE_NAME)
+	result, err := t.db.Exec(cmd,
+		session.LastAuthAt.Format(configure.USER_TIME_STR),
+		session.TimeoutAt.Format(configure.USER_TIME_STR),
+		session.MaxSessionAt.Format(configure.USER_TIME_STR),
+		session.Token)
+	if err != nil {
+		return NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	if count, err := result.RowsAffected(); err == nil && count == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// SessionFetch finds the session using the hash of the token
+func (t *SqliteConn) SessionFetch(tokenHash string) (*tenant.Session, error) {
+	sessions, err := t.sessionQuery(`Token`, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	return sessions[0], nil
+}
+
+// SessionList returns all of the sessions for the user's GUID
+func (t *SqliteConn) SessionList(guid string) ([]*tenant.Session, error) {
+	sessions, err := t.sessionQuery(`Guid`, guid)
+	if err == nil && sessions == nil {
+		sessions = []*tenant.Session{}
+	}
+	return sessions, err
+}
+
+// SessionDelete removes a single session
+func (t *SqliteConn) SessionDelete(tokenHash string) error {
+	return t.sessionDelete(`Token`, tokenHash)
+}
+
+// SessionDeleteAll removes all of the sessions for a user
+func (t *SqliteConn) SessionDeleteAll(guid string) error {
+	return t.sessionDelete(`Guid`, guid)
+}
+
+func (t *SqliteConn) sessionQuery(field, value string) ([]*tenant.Session, error) {
+	if t.db == nil {
+		return nil, ErrNotOpen
+	}
+	cmd := fmt.Sprintf(`SELECT *
+			 FROM %s
+			WHERE %s = ?`,
+		tenant.SESSION_STORE_NAME,
+		field)
+	rows, err := t.db.Query(cmd, value)
+	if err != nil {
+		return nil, NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	return mapColumnsToSession(rows), nil
+}
+
+func (t *SqliteConn) sessionDelete(field, value string) error {
+	if t.db == nil {
+		return ErrNotOpen
+	}
+	cmd := fmt.Sprintf(`DELETE FROM %s WHERE %s = ?`, tenant.SESSION_STORE_NAME, field)
+	if _, err := t.db.Exec(cmd, value); err != nil {
+		return NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	return nil
+}
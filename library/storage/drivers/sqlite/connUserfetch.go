@@ -7,18 +7,38 @@ import (
 	"fmt"
 	. "github.com/cgentry/gus/ecode"
 	"github.com/cgentry/gus/library/storage"
+	"github.com/cgentry/gus/record/configure"
 	"github.com/cgentry/gus/record/tenant"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// SQL_NOT_DELETED is true for users that haven't been deleted. DeletedAt is saved as text, so
+// a user that was never deleted (or was restored) holds the zero time.
+var SQL_NOT_DELETED = fmt.Sprintf(`(%s IS NULL OR %s = '' OR %s = '%s')`,
+	FIELD_DELETED_DT, FIELD_DELETED_DT, FIELD_DELETED_DT,
+	time.Time{}.Format(configure.USER_TIME_STR))
+
+// SQL_DELETED is true for users that have been deleted
+var SQL_DELETED = `NOT ` + SQL_NOT_DELETED
+
 func (t *SqliteConn) UserFetch(domain, field, val string) (*tenant.User, error) {
 	if domain == storage.MatchAnyDomain {
-		return t.fetchUserByFieldAny(field, val)
+		return t.fetchUserByFieldAny(field, val, SQL_NOT_DELETED)
 	}
-	return t.fetchUserByField(domain, field, val)
+	return t.fetchUserByField(domain, field, val, SQL_NOT_DELETED)
 }
-func (t *SqliteConn) fetchUserByField(domain, field, val string) (*tenant.User, error) {
+
+// UserFetchDeleted works like UserFetch but only finds deleted users
+func (t *SqliteConn) UserFetchDeleted(domain, field, val string) (*tenant.User, error) {
+	if domain == storage.MatchAnyDomain {
+		return t.fetchUserByFieldAny(field, val, SQL_DELETED)
+	}
+	return t.fetchUserByField(domain, field, val, SQL_DELETED)
+}
+
+func (t *SqliteConn) fetchUserByField(domain, field, val, deleted string) (*tenant.User, error) {
 	field = strings.TrimSpace(field)
 	if field == `` {
 		return nil, ErrEmptyFieldForLookup
@@ -29,10 +49,12 @@ func (t *SqliteConn) fetchUserByField(domain, field, val string) (*tenant.User,
 	cmd := fmt.Sprintf(`SELECT *
 			 FROM %s
 			WHERE %s = ?
-			  AND %s = ?`,
+			  AND %s = ?
+			  AND %s`,
 		tenant.USER_STORE_NAME,
 		FIELD_DOMAIN,
-		field)
+		field,
+		deleted)
 	rows, err := t.db.Query(cmd, domain, val)
 	if err != nil {
 		return nil, NewGeneralFromError(err, http.StatusInternalServerError)
@@ -47,7 +69,7 @@ func (t *SqliteConn) fetchUserByField(domain, field, val string) (*tenant.User,
 	return users[0], nil
 
 }
-func (t *SqliteConn) fetchUserByFieldAny(field, val string) (*tenant.User, error) {
+func (t *SqliteConn) fetchUserByFieldAny(field, val, deleted string) (*tenant.User, error) {
 	field = strings.TrimSpace(field)
 	if field == `` {
 		return nil, ErrEmptyFieldForLookup
@@ -57,9 +79,11 @@ func (t *SqliteConn) fetchUserByFieldAny(field, val string) (*tenant.User, error
 	}
 	cmd := fmt.Sprintf(`SELECT *
 			 FROM %s
-			WHERE  %s = ?`,
+			WHERE  %s = ?
+			  AND %s`,
 		tenant.USER_STORE_NAME,
-		field)
+		field,
+		deleted)
 
 	rows, err := t.db.Query(cmd, val)
 	if err != nil {
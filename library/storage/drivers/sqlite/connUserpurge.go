@@ -0,0 +1,59 @@
+// Copyright 2014 Charles Gentry. All rights reserved.
+// Please see the license included with this package
+package sqlite
+
+import (
+	"fmt"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/tenant"
+	"net/http"
+	"time"
+)
+
+// Deleted users stay in the User table, with DeletedAt set, until they are purged. The times are
+// saved as text with the local offset, so they are compared here rather than in the SELECT.
+
+// UserPurge removes the users deleted before the time given, along with their sessions, refresh
+// tokens and passkeys.
+func (t *SqliteConn) UserPurge(deletedBefore time.Time) (int, error) {
+	if t.db == nil {
+		return 0, ErrNotOpen
+	}
+	cmd := fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s`,
+		FieldGUID,
+		FIELD_DELETED_DT,
+		tenant.USER_STORE_NAME,
+		SQL_DELETED)
+	rows, err := t.db.Query(cmd)
+	if err != nil {
+		return 0, NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	purge := []string{}
+	for rows.Next() {
+		var guid, deletedAt string
+		if err = rows.Scan(&guid, &deletedAt); err != nil {
+			rows.Close()
+			return 0, NewGeneralFromError(err, http.StatusInternalServerError)
+		}
+		if when, err := time.Parse(configure.USER_TIME_STR, deletedAt); err == nil && when.Before(deletedBefore) {
+			purge = append(purge, guid)
+		}
+	}
+	rows.Close()
+
+	for count, guid := range purge {
+		for _, table := range []string{
+			tenant.SESSION_STORE_NAME,
+			tenant.REFRESH_STORE_NAME,
+			tenant.CREDENTIAL_STORE_NAME,
+			tenant.USER_STORE_NAME,
+		} {
+			cmd = fmt.Sprintf(`DELETE FROM %s WHERE Guid = ?`, table)
+			if _, err = t.db.Exec(cmd, guid); err != nil {
+				return count, NewGeneralFromError(err, http.StatusInternalServerError)
+			}
+		}
+	}
+	return len(purge), nil
+}
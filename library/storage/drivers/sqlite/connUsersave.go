@@ -45,6 +45,21 @@ func (t *SqliteConn) UserUpdate(user *tenant.User) error {
 			     %s = ?,
 			     %s = ?,
 			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
+			     %s = ?,
 			     %s = ?
            WHERE %s = ? `,
 			tenant.USER_STORE_NAME,
@@ -57,6 +72,21 @@ func (t *SqliteConn) UserUpdate(user *tenant.User) error {
 			FIELD_PASSWORD,
 			FIELD_SALT,
 			FieldToken,
+			FIELD_RESET_TOKEN,
+			FIELD_RESET_DT,
+			FIELD_TOTP_SECRET,
+			FIELD_TOTP_ENABLED,
+			FIELD_TOTP_STEP,
+			FIELD_RECOVERY_CODES,
+			FIELD_FACTOR_TOKEN,
+			FIELD_FACTOR_DT,
+			FIELD_CHALLENGE,
+			FIELD_CHALLENGE_DT,
+			FIELD_VERIFY_TOKEN,
+			FIELD_VERIFY_DT,
+			FIELD_ROLES,
+			FIELD_PERMISSIONS,
+			FIELD_CAPABILITIES,
 
 			FIELD_ISACTIVE,
 			FIELD_ISLOGGEDIN,
@@ -86,6 +116,21 @@ func (t *SqliteConn) UserUpdate(user *tenant.User) error {
 		user.Password,
 		user.Salt,
 		user.Token,
+		user.ResetToken,
+		user.GetResetExpiresAtStr(),
+		user.TotpSecret,
+		strconv.FormatBool(user.TotpEnabled),
+		user.GetTotpStepStr(),
+		user.RecoveryCodes,
+		user.FactorToken,
+		user.GetFactorExpiresAtStr(),
+		user.Challenge,
+		user.GetChallengeExpiresAtStr(),
+		user.VerifyToken,
+		user.GetVerifyExpiresAtStr(),
+		user.Roles,
+		user.Permissions,
+		user.Capabilities,
 
 		strconv.FormatBool(user.IsActive),
 		strconv.FormatBool(user.IsLoggedIn),
@@ -120,7 +165,7 @@ func (t *SqliteConn) UserInsert(user *tenant.User) error {
 	if cmd_user_insert == "" {
 		cmd_user_insert = fmt.Sprintf(
 			`INSERT INTO %s
-			(%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s)
+			(%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s)
 		    VALUES (%s %s)`,
 			tenant.USER_STORE_NAME,
 
@@ -133,6 +178,21 @@ func (t *SqliteConn) UserInsert(user *tenant.User) error {
 			FIELD_PASSWORD,
 			FIELD_SALT,
 			FieldToken,
+			FIELD_RESET_TOKEN,
+			FIELD_RESET_DT,
+			FIELD_TOTP_SECRET,
+			FIELD_TOTP_ENABLED,
+			FIELD_TOTP_STEP,
+			FIELD_RECOVERY_CODES,
+			FIELD_FACTOR_TOKEN,
+			FIELD_FACTOR_DT,
+			FIELD_CHALLENGE,
+			FIELD_CHALLENGE_DT,
+			FIELD_VERIFY_TOKEN,
+			FIELD_VERIFY_DT,
+			FIELD_ROLES,
+			FIELD_PERMISSIONS,
+			FIELD_CAPABILITIES,
 
 			FIELD_ISACTIVE,
 			FIELD_ISLOGGEDIN,
@@ -149,7 +209,7 @@ func (t *SqliteConn) UserInsert(user *tenant.User) error {
 			FIELD_UPDATED_DT,
 			FIELD_DELETED_DT,
 
-			strings.Repeat(`?, `, 20), `?`)
+			strings.Repeat(`?, `, 35), `?`)
 
 	}
 
@@ -169,6 +229,21 @@ func (t *SqliteConn) UserInsert(user *tenant.User) error {
 		user.Password,
 		user.Salt,
 		user.Token,
+		user.ResetToken,
+		user.GetResetExpiresAtStr(),
+		user.TotpSecret,
+		strconv.FormatBool(user.TotpEnabled),
+		user.GetTotpStepStr(),
+		user.RecoveryCodes,
+		user.FactorToken,
+		user.GetFactorExpiresAtStr(),
+		user.Challenge,
+		user.GetChallengeExpiresAtStr(),
+		user.VerifyToken,
+		user.GetVerifyExpiresAtStr(),
+		user.Roles,
+		user.Permissions,
+		user.Capabilities,
 
 		strconv.FormatBool(user.IsActive),
 		strconv.FormatBool(user.IsLoggedIn),
@@ -219,7 +294,7 @@ func (t *SqliteConn) checkUserExists(user *tenant.User) error {
 				%s
 			FROM %s
 			WHERE %s = ?
-			   OR ( %s = ? AND ( %s = ? OR %s = ?))`,
+			   OR ( %s = ? AND ( %s = ? OR %s = ?) AND %s)`,
 		FieldGUID, /* SELECT ... */
 		FIELD_DOMAIN,
 		FieldEmail,
@@ -231,6 +306,7 @@ func (t *SqliteConn) checkUserExists(user *tenant.User) error {
 		FIELD_DOMAIN,
 		FieldEmail,
 		FIELD_LOGINNAME,
+		SQL_NOT_DELETED,
 	)
 
 	stmt, err := t.db.Prepare(s)
@@ -0,0 +1,104 @@
+// Copyright 2014 Charles Gentry. All rights reserved.
+// Please see the license included with this package
+package sqlite
+
+import (
+	"fmt"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/storage"
+	"github.com/cgentry/gus/record/tenant"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SQL_CREATED_KEY turns CreatedAt, saved with the local offset, into the UTC text that creation
+// times are compared and sorted by (storage.SearchTimeFormat).
+const SQL_CREATED_KEY = `strftime('%Y-%m-%dT%H:%M:%SZ', ` + FIELD_CREATED_DT + `)`
+
+// searchSortKeys maps the search's sort key to the SQL that is sorted on
+var searchSortKeys = map[string]string{
+	storage.FieldCreated: SQL_CREATED_KEY,
+	storage.FieldName:    FIELD_FULLNAME,
+	storage.FieldLogin:   FIELD_LOGINNAME,
+	storage.FieldEmail:   FieldEmail,
+}
+
+// UserSearch returns a page of users that match the search. The Store has already checked it.
+func (t *SqliteConn) UserSearch(search *storage.Search) ([]*tenant.User, error) {
+	if t.db == nil {
+		return nil, ErrNotOpen
+	}
+	sortKey, ok := searchSortKeys[search.Sort]
+	if !ok {
+		return nil, ErrInvalidSearch
+	}
+	where := []string{SQL_NOT_DELETED}
+	args := []interface{}{}
+
+	if search.Domain != "" && search.Domain != storage.MatchAnyDomain {
+		where = append(where, FIELD_DOMAIN+` = ?`)
+		args = append(args, search.Domain)
+	}
+	if search.Active != storage.SearchAny {
+		where = append(where, FIELD_ISACTIVE+` = ?`)
+		args = append(args, strconv.FormatBool(search.Active == storage.SearchYes))
+	}
+	if search.LoggedIn != storage.SearchAny {
+		where = append(where, FIELD_ISLOGGEDIN+` = ?`)
+		args = append(args, strconv.FormatBool(search.LoggedIn == storage.SearchYes))
+	}
+	if !search.CreatedFrom.IsZero() {
+		where = append(where, SQL_CREATED_KEY+` >= ?`)
+		args = append(args, search.CreatedFrom.UTC().Format(storage.SearchTimeFormat))
+	}
+	if !search.CreatedTo.IsZero() {
+		where = append(where, SQL_CREATED_KEY+` < ?`)
+		args = append(args, search.CreatedTo.UTC().Format(storage.SearchTimeFormat))
+	}
+	if search.NamePrefix != "" {
+		where = append(where, fmt.Sprintf(`(%s LIKE ? ESCAPE '\' OR %s LIKE ? ESCAPE '\')`, FIELD_FULLNAME, FIELD_LOGINNAME))
+		args = append(args, likePrefix(search.NamePrefix), likePrefix(search.NamePrefix))
+	}
+	if search.EmailPrefix != "" {
+		where = append(where, FieldEmail+` LIKE ? ESCAPE '\'`)
+		args = append(args, likePrefix(search.EmailPrefix))
+	}
+
+	order, compare := `ASC`, `>`
+	if search.Descending {
+		order, compare = `DESC`, `<`
+	}
+	if search.After != nil {
+		where = append(where, fmt.Sprintf(`(%s %s ? OR (%s = ? AND %s %s ?))`, sortKey, compare, sortKey, FieldGUID, compare))
+		args = append(args, search.After.Value, search.After.Value, search.After.Guid)
+	}
+
+	cmd := fmt.Sprintf(`SELECT *
+			 FROM %s
+			WHERE %s
+		 ORDER BY %s %s, %s %s
+			LIMIT ?`,
+		tenant.USER_STORE_NAME,
+		strings.Join(where, ` AND `),
+		sortKey, order,
+		FieldGUID, order)
+	args = append(args, search.Limit)
+
+	rows, err := t.db.Query(cmd, args...)
+	if err != nil {
+		return nil, NewGeneralFromError(err, http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	users := mapColumnsToUser(rows)
+	if users == nil {
+		users = []*tenant.User{}
+	}
+	return users, nil
+}
+
+// likePrefix escapes the LIKE wildcards in the prefix and adds one to the end
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + `%`
+}
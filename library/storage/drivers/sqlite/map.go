@@ -26,14 +26,119 @@ func mapColumnsToUser(rows *sql.Rows) []*tenant.User {
 		rows.Scan(vpoint...)
 
 		for i, col := range columns {
-			val := values[i]
-			if b, ok := val.([]byte); ok {
-				vstr = string(b)
-				mappers.UserField(user, col, vstr)
-			} // End columns
+			switch val := values[i].(type) {
+			case []byte:
+				vstr = string(val)
+			case string:
+				vstr = val
+			default:
+				continue
+			}
+			mappers.UserField(user, col, vstr)
+		} // End columns
 
-			allUsers = append(allUsers, user)
-		}
+		allUsers = append(allUsers, user)
 	}
 	return allUsers
 }
+
+func mapColumnsToSession(rows *sql.Rows) []*tenant.Session {
+
+	var allSessions []*tenant.Session
+	columns, _ := rows.Columns()
+	count := len(columns)
+	values := make([]interface{}, count)
+	vpoint := make([]interface{}, count)
+	var vstr string
+
+	for rows.Next() {
+		for i := range columns {
+			vpoint[i] = &values[i]
+		}
+		session := &tenant.Session{}
+		rows.Scan(vpoint...)
+
+		for i, col := range columns {
+			switch val := values[i].(type) {
+			case []byte:
+				vstr = string(val)
+			case string:
+				vstr = val
+			default:
+				continue
+			}
+			mappers.SessionField(session, col, vstr)
+		} // End columns
+
+		allSessions = append(allSessions, session)
+	}
+	return allSessions
+}
+
+// mapColumnsToRefresh will take the rows from a query and map them into refresh token records
+func mapColumnsToRefresh(rows *sql.Rows) []*tenant.Refresh {
+
+	var allRefresh []*tenant.Refresh
+	columns, _ := rows.Columns()
+	count := len(columns)
+	values := make([]interface{}, count)
+	vpoint := make([]interface{}, count)
+	var vstr string
+
+	for rows.Next() {
+		for i := range columns {
+			vpoint[i] = &values[i]
+		}
+		refresh := &tenant.Refresh{}
+		rows.Scan(vpoint...)
+
+		for i, col := range columns {
+			switch val := values[i].(type) {
+			case []byte:
+				vstr = string(val)
+			case string:
+				vstr = val
+			default:
+				continue
+			}
+			mappers.RefreshField(refresh, col, vstr)
+		} // End columns
+
+		allRefresh = append(allRefresh, refresh)
+	}
+	return allRefresh
+}
+
+// mapColumnsToCredential will take the rows from a query and map them into passkey records
+func mapColumnsToCredential(rows *sql.Rows) []*tenant.Credential {
+
+	var allCreds []*tenant.Credential
+	columns, _ := rows.Columns()
+	count := len(columns)
+	values := make([]interface{}, count)
+	vpoint := make([]interface{}, count)
+	var vstr string
+
+	for rows.Next() {
+		for i := range columns {
+			vpoint[i] = &values[i]
+		}
+		cred := &tenant.Credential{}
+		rows.Scan(vpoint...)
+
+		for i, col := range columns {
+			switch val := values[i].(type) {
+			case []byte:
+				vstr = string(val)
+			case string:
+				vstr = val
+			default:
+				continue
+			}
+			mappers.CredentialField(cred, col, vstr)
+		} // End columns
+
+		allCreds = append(allCreds, cred)
+	}
+	return allCreds
+}
@@ -22,6 +22,21 @@ const (
 	FIELD_LOGINNAME      = storage.FieldLogin
 	FIELD_PASSWORD       = `Password`
 	FieldToken          = storage.FieldToken
+	FIELD_RESET_TOKEN    = storage.FieldResetToken
+	FIELD_RESET_DT       = `ResetExpiresAt`
+	FIELD_TOTP_SECRET    = `TotpSecret`
+	FIELD_TOTP_ENABLED   = `TotpEnabled`
+	FIELD_TOTP_STEP      = `TotpStep`
+	FIELD_RECOVERY_CODES = `RecoveryCodes`
+	FIELD_FACTOR_TOKEN   = `FactorToken`
+	FIELD_FACTOR_DT      = `FactorExpiresAt`
+	FIELD_CHALLENGE      = `Challenge`
+	FIELD_CHALLENGE_DT   = `ChallengeExpiresAt`
+	FIELD_VERIFY_TOKEN   = storage.FieldVerifyToken
+	FIELD_VERIFY_DT      = `VerifyExpiresAt`
+	FIELD_ROLES          = `Roles`
+	FIELD_PERMISSIONS    = `Permissions`
+	FIELD_CAPABILITIES   = `Capabilities`
 	FIELD_SALT           = `Salt`
 	FIELD_ISACTIVE       = `IsActive`
 	FIELD_ISLOGGEDIN     = `IsLoggedIn`
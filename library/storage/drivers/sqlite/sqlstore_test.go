@@ -5,13 +5,14 @@ package sqlite
 
 import (
 	//"database/sql"
-	//. "github.com/cgentry/gus/ecode"
+	. "github.com/cgentry/gus/ecode"
 	"github.com/cgentry/gus/library/storage"
 	"github.com/cgentry/gus/record/tenant"
 	. "github.com/smartystreets/goconvey/convey"
 	"os"
+	"strings"
 	"testing"
-	//"time"
+	"time"
 )
 
 const STORE_LOCAL = "/tmp/test_store.sqlite3"
@@ -48,6 +49,7 @@ func TestSimpleRegisterCycle(t *testing.T) {
 		user.SetName("Just a test name")
 		user.SetEmail("et@home.com")
 		user.SetLoginName("justlogin")
+		user.SetResetToken("ResetToken")
 
 		serr := dbConn.UserInsert(user) // Register new user
 		So(serr, ShouldBeNil)
@@ -79,6 +81,51 @@ func TestSimpleRegisterCycle(t *testing.T) {
 		So(user5.Domain, ShouldEqual, user.Domain)
 		So(user5.Token, ShouldEqual, user.Token)
 		So(user5.FullName, ShouldEqual, user.FullName)
+
+		// FETCH BY Reset token
+		user6, err := dbConn.UserFetch(user.Domain, storage.FieldResetToken, user.ResetToken)
+		So(err, ShouldBeNil)
+		So(user6.Guid, ShouldEqual, user.Guid)
+		So(user6.ResetToken, ShouldEqual, user.ResetToken)
+
+		// Two-factor fields are saved
+		user.EnrollTotp("EncryptedSecret")
+		user.TotpEnabled = true
+		user.TotpStep = 56789012
+		user.NewRecoveryCodes()
+		So(dbConn.UserUpdate(user), ShouldBeNil)
+		user7, err := dbConn.UserFetch(user.Domain, storage.FieldGUID, user.Guid)
+		So(err, ShouldBeNil)
+		So(user7.TotpSecret, ShouldEqual, "EncryptedSecret")
+		So(user7.TotpEnabled, ShouldBeTrue)
+		So(user7.TotpStep, ShouldEqual, user.TotpStep)
+		So(user7.RecoveryCodes, ShouldEqual, user.RecoveryCodes)
+
+		// As is the passkey challenge
+		challenge := user.NewChallenge()
+		So(dbConn.UserUpdate(user), ShouldBeNil)
+		user8, err := dbConn.UserFetch(user.Domain, storage.FieldGUID, user.Guid)
+		So(err, ShouldBeNil)
+		So(user8.Challenge, ShouldEqual, challenge)
+		So(user8.ChallengeExpiresAt.Unix(), ShouldEqual, user.ChallengeExpiresAt.Unix())
+
+		// FETCH BY Verify token
+		user.NewVerifyToken()
+		So(dbConn.UserUpdate(user), ShouldBeNil)
+		user9, err := dbConn.UserFetch(user.Domain, storage.FieldVerifyToken, user.VerifyToken)
+		So(err, ShouldBeNil)
+		So(user9.Guid, ShouldEqual, user.Guid)
+		So(user9.IsActive, ShouldBeFalse)
+		So(user9.VerifyExpiresAt.Unix(), ShouldEqual, user.VerifyExpiresAt.Unix())
+
+		// Roles and permissions are kept
+		user.GrantRole("admin")
+		user.GrantPermission("users.read")
+		So(dbConn.UserUpdate(user), ShouldBeNil)
+		user10, err := dbConn.UserFetch(user.Domain, storage.FieldGUID, user.Guid)
+		So(err, ShouldBeNil)
+		So(user10.Roles, ShouldEqual, "admin")
+		So(user10.Permissions, ShouldEqual, "users.read")
 		/*
 			// By default, a registered user is NOT logged in...
 			compareTime1 = user.LoginAt
@@ -109,3 +156,382 @@ func TestSimpleRegisterCycle(t *testing.T) {
 	})
 
 }
+
+func TestSessionCycle(t *testing.T) {
+	clearSqliteTest()
+	dbGeneralCon, err := NewSqliteDriver().Open(STORE_LOCAL, ``)
+
+	Convey("Sessions", t, func() {
+		So(err, ShouldBeNil)
+		defer clearSqliteTest()
+
+		dbConn, ok := dbGeneralCon.(*SqliteConn)
+		So(ok, ShouldBeTrue)
+		So(dbConn.CreateStore(), ShouldBeNil)
+
+		user := tenant.NewTestUser()
+		user.Token = ""
+		first := tenant.NewSession(user, "client", "phone")
+		second := tenant.NewSession(user, "client", "laptop")
+		other := tenant.NewSession(tenant.NewTestUser(), "client", "")
+
+		So(dbConn.SessionInsert(first), ShouldBeNil)
+		So(dbConn.SessionInsert(second), ShouldBeNil)
+		So(dbConn.SessionInsert(other), ShouldBeNil)
+
+		// FETCH BY TOKEN HASH
+		session, err := dbConn.SessionFetch(first.Token)
+		So(err, ShouldBeNil)
+		So(session.Id, ShouldEqual, first.Id)
+		So(session.Guid, ShouldEqual, user.Guid)
+		So(session.Device, ShouldEqual, "phone")
+		So(session.SessionToken, ShouldBeBlank)
+
+		_, err = dbConn.SessionFetch(first.SessionToken)
+		So(err, ShouldEqual, ErrSessionNotFound)
+
+		// UPDATE
+		first.TimeoutAt = first.TimeoutAt.Add(time.Hour)
+		So(dbConn.SessionUpdate(first), ShouldBeNil)
+		session, err = dbConn.SessionFetch(first.Token)
+		So(err, ShouldBeNil)
+		So(session.TimeoutAt.Unix(), ShouldEqual, first.TimeoutAt.Unix())
+
+		// LIST
+		list, err := dbConn.SessionList(user.Guid)
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 2)
+
+		// DELETE ONE
+		So(dbConn.SessionDelete(first.Token), ShouldBeNil)
+		_, err = dbConn.SessionFetch(first.Token)
+		So(err, ShouldEqual, ErrSessionNotFound)
+		list, err = dbConn.SessionList(user.Guid)
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 1)
+
+		// DELETE ALL
+		So(dbConn.SessionDeleteAll(user.Guid), ShouldBeNil)
+		list, err = dbConn.SessionList(user.Guid)
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 0)
+		_, err = dbConn.SessionFetch(other.Token)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestRefreshCycle(t *testing.T) {
+	clearSqliteTest()
+	dbGeneralCon, err := NewSqliteDriver().Open(STORE_LOCAL, ``)
+
+	Convey("Refresh tokens", t, func() {
+		So(err, ShouldBeNil)
+		defer clearSqliteTest()
+
+		dbConn, ok := dbGeneralCon.(*SqliteConn)
+		So(ok, ShouldBeTrue)
+		So(dbConn.CreateStore(), ShouldBeNil)
+
+		user := tenant.NewTestUser()
+		user.Token = ""
+		session := tenant.NewSession(user, "client", "phone")
+		first := tenant.NewRefresh(session)
+		_, second := first.Rotate()
+		other := tenant.NewRefresh(tenant.NewSession(user, "client", "laptop"))
+		stranger := tenant.NewRefresh(tenant.NewSession(tenant.NewTestUser(), "client", ""))
+		first.UsedAt = time.Time{}
+
+		So(dbConn.RefreshInsert(first), ShouldBeNil)
+		So(dbConn.RefreshInsert(second), ShouldBeNil)
+		So(dbConn.RefreshInsert(other), ShouldBeNil)
+		So(dbConn.RefreshInsert(stranger), ShouldBeNil)
+
+		// FETCH BY TOKEN HASH
+		refresh, err := dbConn.RefreshFetch(first.Token)
+		So(err, ShouldBeNil)
+		So(refresh.Family, ShouldEqual, session.Family)
+		So(refresh.Guid, ShouldEqual, user.Guid)
+		So(refresh.Device, ShouldEqual, "phone")
+		So(refresh.IsUsed(), ShouldBeFalse)
+
+		_, err = dbConn.RefreshFetch(first.RefreshToken)
+		So(err, ShouldEqual, ErrRefreshNotFound)
+
+		// UPDATE
+		first.UsedAt = time.Now()
+		So(dbConn.RefreshUpdate(first), ShouldBeNil)
+		refresh, err = dbConn.RefreshFetch(first.Token)
+		So(err, ShouldBeNil)
+		So(refresh.UsedAt.Unix(), ShouldEqual, first.UsedAt.Unix())
+
+		// A used token can only be used once
+		refresh.UsedAt = time.Now()
+		So(dbConn.RefreshUpdate(refresh), ShouldEqual, ErrRefreshReused)
+		So(dbConn.RefreshUpdate(tenant.NewRefresh(session)), ShouldEqual, ErrRefreshNotFound)
+
+		// DELETE FAMILY
+		So(dbConn.RefreshDeleteFamily(first.Family), ShouldBeNil)
+		_, err = dbConn.RefreshFetch(first.Token)
+		So(err, ShouldEqual, ErrRefreshNotFound)
+		_, err = dbConn.RefreshFetch(second.Token)
+		So(err, ShouldEqual, ErrRefreshNotFound)
+		_, err = dbConn.RefreshFetch(other.Token)
+		So(err, ShouldBeNil)
+
+		// DELETE ALL
+		So(dbConn.RefreshDeleteAll(user.Guid), ShouldBeNil)
+		_, err = dbConn.RefreshFetch(other.Token)
+		So(err, ShouldEqual, ErrRefreshNotFound)
+		_, err = dbConn.RefreshFetch(stranger.Token)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestCredentialCycle(t *testing.T) {
+	clearSqliteTest()
+	dbGeneralCon, err := NewSqliteDriver().Open(STORE_LOCAL, ``)
+
+	Convey("Passkeys", t, func() {
+		So(err, ShouldBeNil)
+		defer clearSqliteTest()
+
+		dbConn, ok := dbGeneralCon.(*SqliteConn)
+		So(ok, ShouldBeTrue)
+		So(dbConn.CreateStore(), ShouldBeNil)
+
+		user := tenant.NewTestUser()
+		phone := &tenant.Credential{Id: "phone-id", Guid: user.Guid, Name: "phone", PublicKey: []byte{1, 2},
+			Algorithm: -7, SignCount: 3, CreatedAt: time.Now()}
+		laptop := &tenant.Credential{Id: "laptop-id", Guid: user.Guid, Name: "laptop"}
+		stranger := &tenant.Credential{Id: "stranger-id", Guid: tenant.NewGuid()}
+
+		So(dbConn.CredentialInsert(phone), ShouldBeNil)
+		So(dbConn.CredentialInsert(laptop), ShouldBeNil)
+		So(dbConn.CredentialInsert(stranger), ShouldBeNil)
+		So(dbConn.CredentialInsert(&tenant.Credential{Id: "phone-id"}), ShouldEqual, ErrDuplicatePasskey)
+
+		// FETCH BY ID
+		cred, err := dbConn.CredentialFetch(phone.Id)
+		So(err, ShouldBeNil)
+		So(cred.Name, ShouldEqual, "phone")
+		So(cred.Guid, ShouldEqual, user.Guid)
+		So(cred.PublicKey, ShouldResemble, []byte{1, 2})
+		So(cred.Algorithm, ShouldEqual, -7)
+		So(cred.SignCount, ShouldEqual, 3)
+		So(cred.CreatedAt.Unix(), ShouldEqual, phone.CreatedAt.Unix())
+		So(cred.LastUsedAt.IsZero(), ShouldBeTrue)
+		_, err = dbConn.CredentialFetch("unknown")
+		So(err, ShouldEqual, ErrPasskeyNotFound)
+
+		list, err := dbConn.CredentialList(user.Guid)
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 2)
+
+		// UPDATE
+		phone.SignCount = 7
+		phone.LastUsedAt = time.Now()
+		So(dbConn.CredentialUpdate(phone), ShouldBeNil)
+		cred, err = dbConn.CredentialFetch(phone.Id)
+		So(err, ShouldBeNil)
+		So(cred.SignCount, ShouldEqual, 7)
+		So(cred.LastUsedAt.Unix(), ShouldEqual, phone.LastUsedAt.Unix())
+		So(dbConn.CredentialUpdate(&tenant.Credential{Id: "unknown"}), ShouldEqual, ErrPasskeyNotFound)
+
+		// DELETE
+		So(dbConn.CredentialDelete(phone.Id), ShouldBeNil)
+		_, err = dbConn.CredentialFetch(phone.Id)
+		So(err, ShouldEqual, ErrPasskeyNotFound)
+		list, err = dbConn.CredentialList(user.Guid)
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 1)
+	})
+}
+
+func TestDeleteCycle(t *testing.T) {
+	clearSqliteTest()
+	dbGeneralCon, err := NewSqliteDriver().Open(STORE_LOCAL, ``)
+
+	Convey("Deleted users", t, func() {
+		So(err, ShouldBeNil)
+		defer clearSqliteTest()
+
+		dbConn, ok := dbGeneralCon.(*SqliteConn)
+		So(ok, ShouldBeTrue)
+		So(dbConn.CreateStore(), ShouldBeNil)
+
+		user := tenant.NewTestUser()
+		user.SetDomain("Delete")
+		user.SetEmail("gone@home.com")
+		user.SetLoginName("gone")
+		So(dbConn.UserInsert(user), ShouldBeNil)
+		session := tenant.NewSession(user, "client", "phone")
+		So(dbConn.SessionInsert(session), ShouldBeNil)
+
+		// DELETE
+		user.Delete()
+		So(dbConn.UserUpdate(user), ShouldBeNil)
+		_, err = dbConn.UserFetch(storage.MatchAnyDomain, storage.FieldGUID, user.Guid)
+		So(err, ShouldEqual, ErrUserNotFound)
+		_, err = dbConn.UserFetch(user.Domain, storage.FieldLogin, user.LoginName)
+		So(err, ShouldEqual, ErrUserNotFound)
+		deleted, err := dbConn.UserFetchDeleted(user.Domain, storage.FieldLogin, user.LoginName)
+		So(err, ShouldBeNil)
+		So(deleted.Guid, ShouldEqual, user.Guid)
+		So(deleted.IsDeleted(), ShouldBeTrue)
+
+		// The login and email can be used again
+		again := tenant.NewTestUser()
+		again.SetDomain("Delete")
+		again.SetEmail("gone@home.com")
+		again.SetLoginName("gone")
+		So(dbConn.UserInsert(again), ShouldBeNil)
+		found, err := dbConn.UserFetch(again.Domain, storage.FieldEmail, again.Email)
+		So(err, ShouldBeNil)
+		So(found.Guid, ShouldEqual, again.Guid)
+		_, err = dbConn.UserFetchDeleted(again.Domain, storage.FieldGUID, again.Guid)
+		So(err, ShouldEqual, ErrUserNotFound)
+
+		// PURGE
+		count, err := dbConn.UserPurge(time.Now().Add(-time.Hour))
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 0)
+		count, err = dbConn.UserPurge(time.Now().Add(time.Second))
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+		_, err = dbConn.UserFetchDeleted(storage.MatchAnyDomain, storage.FieldGUID, user.Guid)
+		So(err, ShouldEqual, ErrUserNotFound)
+		_, err = dbConn.SessionFetch(session.Token)
+		So(err, ShouldEqual, ErrSessionNotFound)
+		_, err = dbConn.UserFetch(again.Domain, storage.FieldGUID, again.Guid)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestSearchCycle(t *testing.T) {
+	clearSqliteTest()
+	dbGeneralCon, err := NewSqliteDriver().Open(STORE_LOCAL, ``)
+
+	Convey("Searching for users", t, func() {
+		So(err, ShouldBeNil)
+		defer clearSqliteTest()
+
+		dbConn, ok := dbGeneralCon.(*SqliteConn)
+		So(ok, ShouldBeTrue)
+		So(dbConn.CreateStore(), ShouldBeNil)
+
+		for _, login := range []string{"cat", "ann", "bob", "abe"} {
+			user := tenant.NewTestUser()
+			user.SetDomain("Search")
+			user.SetLoginName(login)
+			user.SetEmail(login + "@example.com")
+			if login == "abe" {
+				user.Delete()
+			}
+			So(dbConn.UserInsert(user), ShouldBeNil)
+		}
+		amy := tenant.NewTestUser()
+		amy.SetDomain("Elsewhere")
+		amy.SetLoginName("amy")
+		So(dbConn.UserInsert(amy), ShouldBeNil)
+
+		list, err := dbConn.UserSearch(&storage.Search{Domain: "Search", Sort: storage.FieldLogin, Limit: 10})
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 3)
+		So(list[0].LoginName, ShouldEqual, "ann")
+		So(list[2].LoginName, ShouldEqual, "cat")
+
+		// Next page
+		after := &storage.Cursor{Sort: storage.FieldLogin, Value: "ann", Guid: list[0].Guid}
+		list, err = dbConn.UserSearch(&storage.Search{Domain: "Search", Sort: storage.FieldLogin, Limit: 1, After: after})
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 1)
+		So(list[0].LoginName, ShouldEqual, "bob")
+
+		// Filters
+		list, err = dbConn.UserSearch(&storage.Search{Sort: storage.FieldLogin, NamePrefix: "A", Descending: true, Limit: 10})
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 2)
+		So(list[0].LoginName, ShouldEqual, "ann")
+		So(list[1].LoginName, ShouldEqual, "amy")
+		list, err = dbConn.UserSearch(&storage.Search{Sort: storage.FieldCreated, EmailPrefix: "cat@", Active: storage.SearchYes,
+			CreatedFrom: time.Now().Add(-time.Hour), Limit: 10})
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 1)
+		So(list[0].LoginName, ShouldEqual, "cat")
+		list, err = dbConn.UserSearch(&storage.Search{Sort: storage.FieldCreated, LoggedIn: storage.SearchYes, Limit: 10})
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 0)
+	})
+}
+
+// baselineUserTable is the User table as it was first released
+const baselineUserTable = `CREATE TABLE User (
+	Guid text primary key, LoginName text, Email text, Token text UNIQUE, Salt text,
+	FullName text, Domain text, Password text, IsActive integer, IsLoggedIn integer, IsSystem integer,
+	LoginAt text, LogoutAt text, LastAuthAt text, LastFailedAt text, FailCount integer,
+	MaxSessionAt text, TimeoutAt text, MaxSessionAtSec int8, TimeoutAtSec int8,
+	CreatedAt text, UpdatedAt text, DeletedAt text)`
+
+// tableColumns returns the names of the columns in the table
+func tableColumns(dbConn *SqliteConn, table string) map[string]bool {
+	rows, err := dbConn.db.Query(`PRAGMA table_info(` + table + `)`)
+	So(err, ShouldBeNil)
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, kind string
+		var dflt interface{}
+		So(rows.Scan(&cid, &name, &kind, &notNull, &dflt, &pk), ShouldBeNil)
+		columns[name] = true
+	}
+	return columns
+}
+
+func TestUpgradeStore(t *testing.T) {
+	var current map[string]bool
+	Convey("A new store", t, func() {
+		clearSqliteTest()
+		defer clearSqliteTest()
+		dbGeneralCon, err := NewSqliteDriver().Open(STORE_LOCAL, ``)
+		So(err, ShouldBeNil)
+		dbConn := dbGeneralCon.(*SqliteConn)
+		defer dbConn.Close()
+		So(dbConn.CreateStore(), ShouldBeNil)
+		current = tableColumns(dbConn, `User`)
+	})
+
+	schemas := map[string]string{
+		"first release":     baselineUserTable,
+		"without DeletedAt": strings.Replace(baselineUserTable, `, DeletedAt text`, ``, 1),
+	}
+	for name, schema := range schemas {
+		Convey("A store from the "+name+" is brought up to date", t, func() {
+			clearSqliteTest()
+			defer clearSqliteTest()
+			dbGeneralCon, err := NewSqliteDriver().Open(STORE_LOCAL, ``)
+			So(err, ShouldBeNil)
+			dbConn := dbGeneralCon.(*SqliteConn)
+			defer dbConn.Close()
+
+			_, err = dbConn.db.Exec(schema)
+			So(err, ShouldBeNil)
+			_, err = dbConn.db.Exec(`CREATE UNIQUE INDEX idxlogin ON User(LoginName,Domain)`)
+			So(err, ShouldBeNil)
+
+			So(dbConn.CreateStore(), ShouldBeNil)
+			So(tableColumns(dbConn, `User`), ShouldResemble, current)
+			So(dbConn.CreateStore(), ShouldBeNil) // Nothing left to add
+
+			user := tenant.NewTestUser()
+			user.SetDomain("Upgrade")
+			user.SetLoginName("upgrade")
+			user.SetEmail("upgrade@example.com")
+			So(dbConn.UserInsert(user), ShouldBeNil)
+			user2, err := dbConn.UserFetch(user.Domain, storage.FieldGUID, user.Guid)
+			So(err, ShouldBeNil)
+			So(user2.LoginName, ShouldEqual, user.LoginName)
+			So(dbConn.UserUpdate(user2), ShouldBeNil)
+		})
+	}
+}
@@ -2,6 +2,19 @@
 // should be enabled using the driver options
 package storage
 
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"sync"
+)
+
+// FIELD_KEY_ENV is the environment variable read when the configuration has no field key.
+const FIELD_KEY_ENV = "GUS_FIELD_KEY"
+
 // Encrypter provides the interface that storage classes need to support encryption
 type Encrypter interface {
 	Encrypt(string) string
@@ -9,3 +22,79 @@ type Encrypter interface {
 
 	SetKey(key string)
 }
+
+// FieldEncrypter encrypts single field values with AES-256-GCM. The key is the SHA-256 of
+// the key string, so the key string should be long and random. Encrypted values are the
+// nonce and sealed value, base64 encoded so they can be kept in any text field.
+type FieldEncrypter struct {
+	aead cipher.AEAD
+}
+
+// NewFieldEncrypter returns an encrypter that uses the key
+func NewFieldEncrypter(key string) *FieldEncrypter {
+	e := &FieldEncrypter{}
+	e.SetKey(key)
+	return e
+}
+
+// SetKey will set the key used for all values
+func (e *FieldEncrypter) SetKey(key string) {
+	sum := sha256.Sum256([]byte(key))
+	block, _ := aes.NewCipher(sum[:]) // Only fails for a bad key size
+	e.aead, _ = cipher.NewGCM(block)
+}
+
+// Encrypt the value. Blank values stay blank so an empty field doesn't look set.
+func (e *FieldEncrypter) Encrypt(value string) string {
+	if value == "" {
+		return ""
+	}
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err.Error()) // If there is no random source, we can't run the system
+	}
+	return base64.StdEncoding.EncodeToString(e.aead.Seal(nonce, nonce, []byte(value), nil))
+}
+
+// Decrypt the value. If it can't be decrypted (it was changed, or used a different key)
+// a blank string is returned.
+func (e *FieldEncrypter) Decrypt(value string) string {
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	size := e.aead.NonceSize()
+	if err != nil || len(sealed) < size {
+		return ""
+	}
+	clear, err := e.aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return ""
+	}
+	return string(clear)
+}
+
+// FieldKey returns the field encryption key to use. If none is given, the environment is checked.
+func FieldKey(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	return os.Getenv(FIELD_KEY_ENV)
+}
+
+var fieldEncrypter struct {
+	sync.RWMutex
+	e Encrypter
+}
+
+// SetEncrypter sets the encrypter used for fields that must not be stored in the clear.
+// Passing nil turns field encryption off.
+func SetEncrypter(e Encrypter) {
+	fieldEncrypter.Lock()
+	fieldEncrypter.e = e
+	fieldEncrypter.Unlock()
+}
+
+// GetEncrypter returns the field encrypter. If none is set, nil is returned.
+func GetEncrypter() Encrypter {
+	fieldEncrypter.RLock()
+	defer fieldEncrypter.RUnlock()
+	return fieldEncrypter.e
+}
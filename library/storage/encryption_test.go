@@ -0,0 +1,26 @@
+package storage
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestFieldEncrypter(t *testing.T) {
+	Convey("Fields can only be read back with the same key", t, func() {
+		e := NewFieldEncrypter("a long and random key")
+		var _ Encrypter = e
+
+		sealed := e.Encrypt("JBSWY3DPEHPK3PXP")
+		So(sealed, ShouldNotContainSubstring, "JBSWY3DPEHPK3PXP")
+		So(e.Encrypt("JBSWY3DPEHPK3PXP"), ShouldNotEqual, sealed)
+		So(e.Decrypt(sealed), ShouldEqual, "JBSWY3DPEHPK3PXP")
+		So(e.Encrypt(""), ShouldBeBlank)
+
+		So(NewFieldEncrypter("another key").Decrypt(sealed), ShouldBeBlank)
+		So(e.Decrypt("not encrypted"), ShouldBeBlank)
+		So(e.Decrypt(sealed[:10]), ShouldBeBlank)
+
+		e.SetKey("another key")
+		So(e.Decrypt(sealed), ShouldBeBlank)
+	})
+}
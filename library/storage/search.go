@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/tenant"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FieldCreated is the sort key for the time a user was created
+const FieldCreated = `CreatedAt`
+
+// Search flags for the yes/no filters (Active and LoggedIn)
+const (
+	SearchAny = iota // Don't filter
+	SearchYes
+	SearchNo
+)
+
+// Page sizes for UserSearch. A Limit of zero uses DefaultSearchLimit.
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+)
+
+// SearchTimeFormat is how creation times are compared and sorted: in UTC, to the second. Every
+// driver must use it so that a cursor from one page finds its place on the next.
+const SearchTimeFormat = "2006-01-02T15:04:05Z"
+
+// Search gives the filters, sort order and page for UserSearch. Blank or zero filters match every
+// user. Deleted users are never found.
+type Search struct {
+	Domain      string    // Blank, or MatchAnyDomain, searches every domain
+	Active      int       // SearchAny, SearchYes or SearchNo
+	LoggedIn    int       // SearchAny, SearchYes or SearchNo
+	CreatedFrom time.Time // Created at or after this time
+	CreatedTo   time.Time // Created before this time
+	NamePrefix  string    // Start of the full name or login name, ignoring case
+	EmailPrefix string    // Start of the email address, ignoring case
+
+	Sort       string // FieldCreated (the default), FieldName, FieldLogin or FieldEmail
+	Descending bool
+
+	Limit  int    // Most users to return
+	Cursor string // Next from the previous page. Blank starts at the beginning.
+
+	After *Cursor // Set by the Store from Cursor. Drivers return the users that sort after it.
+}
+
+// Cursor marks the last user on a page: the user's sort key and their Guid, which breaks ties.
+type Cursor struct {
+	Sort  string
+	Value string
+	Guid  string
+}
+
+// SearchPage is a page of users. Next is blank when there are no more.
+type SearchPage struct {
+	Users []*tenant.User
+	Next  string
+}
+
+// SearchSort returns the sort key for the names used by clients and the command line: created,
+// name, login or email. Blank sorts by when the user was created.
+func SearchSort(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "created":
+		return FieldCreated, nil
+	case "name":
+		return FieldName, nil
+	case "login":
+		return FieldLogin, nil
+	case "email":
+		return FieldEmail, nil
+	}
+	return "", ErrInvalidSearch
+}
+
+// SearchFlag returns the yes/no filter for "yes", "no" or blank (either)
+func SearchFlag(name string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "":
+		return SearchAny, nil
+	case "yes":
+		return SearchYes, nil
+	case "no":
+		return SearchNo, nil
+	}
+	return SearchAny, ErrInvalidSearch
+}
+
+// normalise fills in the default sort and limit and decodes the cursor. ErrInvalidSearch is
+// returned when the sort, flags or cursor make no sense.
+func (search *Search) normalise() error {
+	if search.Domain == MatchAnyDomain {
+		search.Domain = ""
+	}
+	switch search.Sort {
+	case "":
+		search.Sort = FieldCreated
+	case FieldCreated, FieldName, FieldLogin, FieldEmail:
+	default:
+		return ErrInvalidSearch
+	}
+	if search.Active < SearchAny || search.Active > SearchNo || search.LoggedIn < SearchAny || search.LoggedIn > SearchNo {
+		return ErrInvalidSearch
+	}
+	if search.Limit <= 0 {
+		search.Limit = DefaultSearchLimit
+	}
+	if search.Limit > MaxSearchLimit {
+		search.Limit = MaxSearchLimit
+	}
+	search.After = nil
+	if search.Cursor != "" {
+		after := &Cursor{}
+		buff, err := base64.RawURLEncoding.DecodeString(search.Cursor)
+		if err != nil || json.Unmarshal(buff, after) != nil || after.Sort != search.Sort || after.Guid == "" {
+			return ErrInvalidSearch
+		}
+		search.After = after
+	}
+	return nil
+}
+
+// cursorFor returns the cursor that starts the page after the user
+func (search *Search) cursorFor(user *tenant.User) string {
+	buff, _ := json.Marshal(&Cursor{Sort: search.Sort, Value: SortKey(user, search.Sort), Guid: user.Guid})
+	return base64.RawURLEncoding.EncodeToString(buff)
+}
+
+// SortKey returns the value a user is sorted by
+func SortKey(user *tenant.User, key string) string {
+	switch key {
+	case FieldName:
+		return user.FullName
+	case FieldLogin:
+		return user.LoginName
+	case FieldEmail:
+		return user.Email
+	}
+	return user.CreatedAt.UTC().Format(SearchTimeFormat)
+}
+
+// Match is true when the user passes all of the filters
+func (search *Search) Match(user *tenant.User) bool {
+	if user.IsDeleted() {
+		return false
+	}
+	if search.Domain != "" && search.Domain != MatchAnyDomain && search.Domain != user.Domain {
+		return false
+	}
+	if !matchFlag(search.Active, user.IsActive) || !matchFlag(search.LoggedIn, user.IsLoggedIn) {
+		return false
+	}
+	created := SortKey(user, FieldCreated)
+	if !search.CreatedFrom.IsZero() && created < search.CreatedFrom.UTC().Format(SearchTimeFormat) {
+		return false
+	}
+	if !search.CreatedTo.IsZero() && created >= search.CreatedTo.UTC().Format(SearchTimeFormat) {
+		return false
+	}
+	if search.NamePrefix != "" && !hasPrefix(user.FullName, search.NamePrefix) && !hasPrefix(user.LoginName, search.NamePrefix) {
+		return false
+	}
+	if search.EmailPrefix != "" && !hasPrefix(user.Email, search.EmailPrefix) {
+		return false
+	}
+	return true
+}
+
+// Page is used by drivers that keep their users in memory. It returns the users that match,
+// in order, starting after the cursor and no more than the limit.
+func (search *Search) Page(users []*tenant.User) []*tenant.User {
+	list := []*tenant.User{}
+	for _, user := range users {
+		if search.Match(user) && (search.After == nil || search.isAfter(user)) {
+			list = append(list, user)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return search.less(list[i], list[j])
+	})
+	if search.Limit > 0 && len(list) > search.Limit {
+		list = list[:search.Limit]
+	}
+	return list
+}
+
+// less is true when user 'a' comes before user 'b'
+func (search *Search) less(a, b *tenant.User) bool {
+	keyA, keyB := SortKey(a, search.Sort), SortKey(b, search.Sort)
+	if keyA == keyB {
+		keyA, keyB = a.Guid, b.Guid
+	}
+	if search.Descending {
+		return keyA > keyB
+	}
+	return keyA < keyB
+}
+
+// isAfter is true when the user comes after the cursor
+func (search *Search) isAfter(user *tenant.User) bool {
+	key, guid := SortKey(user, search.Sort), user.Guid
+	if search.Descending {
+		return key < search.After.Value || (key == search.After.Value && guid < search.After.Guid)
+	}
+	return key > search.After.Value || (key == search.After.Value && guid > search.After.Guid)
+}
+
+func matchFlag(flag int, value bool) bool {
+	return flag == SearchAny || (flag == SearchYes) == value
+}
+
+func hasPrefix(value, prefix string) bool {
+	return strings.HasPrefix(strings.ToLower(value), strings.ToLower(prefix))
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/tenant"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func searchUser(domain, name, login, email string, created time.Time) *tenant.User {
+	user := tenant.NewTestUser()
+	user.SetDomain(domain)
+	user.SetName(name)
+	user.SetLoginName(login)
+	user.SetEmail(email)
+	user.CreatedAt = created
+	return user
+}
+
+// searchAll follows the cursors and returns the logins of every user found
+func searchAll(users []*tenant.User, search Search) []string {
+	logins := []string{}
+	for {
+		So(search.normalise(), ShouldBeNil)
+		limit := search.Limit
+		search.Limit++
+		list := search.Page(users)
+		if len(list) <= limit {
+			for _, user := range list {
+				logins = append(logins, user.LoginName)
+			}
+			return logins
+		}
+		for _, user := range list[:limit] {
+			logins = append(logins, user.LoginName)
+		}
+		search.Limit = limit
+		search.Cursor = search.cursorFor(list[limit-1])
+	}
+}
+
+func TestSearch(t *testing.T) {
+	base := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+	ann := searchUser("Test", "Ann Able", "ann", "ann@example.com", base)
+	bob := searchUser("Test", "Bob Baker", "bob", "bob@example.com", base.Add(time.Hour))
+	cat := searchUser("Test", "Cat Cole", "cat", "cat@other.com", base.Add(2*time.Hour))
+	dan := searchUser("Other", "Dan Dole", "dan", "dan@example.com", base.Add(90*time.Minute))
+	eve := searchUser("Test", "Eve Eddy", "eve", "eve@example.com", base.Add(3*time.Hour))
+	ann.Deactivate()
+	dan.Deactivate()
+	eve.Delete()
+	users := []*tenant.User{eve, dan, cat, bob, ann}
+
+	Convey("Searches are checked and filled in", t, func() {
+		search := Search{}
+		So(search.normalise(), ShouldBeNil)
+		So(search.Sort, ShouldEqual, FieldCreated)
+		So(search.Limit, ShouldEqual, DefaultSearchLimit)
+		search = Search{Limit: MaxSearchLimit + 1}
+		So(search.normalise(), ShouldBeNil)
+		So(search.Limit, ShouldEqual, MaxSearchLimit)
+
+		So((&Search{Sort: "Password"}).normalise(), ShouldEqual, ErrInvalidSearch)
+		So((&Search{Active: 9}).normalise(), ShouldEqual, ErrInvalidSearch)
+		So((&Search{Cursor: "not a cursor"}).normalise(), ShouldEqual, ErrInvalidSearch)
+
+		sortKey, err := SearchSort(" Login ")
+		So(err, ShouldBeNil)
+		So(sortKey, ShouldEqual, FieldLogin)
+		_, err = SearchSort("password")
+		So(err, ShouldEqual, ErrInvalidSearch)
+		flag, err := SearchFlag("NO")
+		So(err, ShouldBeNil)
+		So(flag, ShouldEqual, SearchNo)
+		_, err = SearchFlag("maybe")
+		So(err, ShouldEqual, ErrInvalidSearch)
+
+		byName := Search{Sort: FieldName}
+		byName.normalise()
+		So((&Search{Cursor: byName.cursorFor(ann)}).normalise(), ShouldEqual, ErrInvalidSearch)
+	})
+
+	Convey("Users are filtered", t, func() {
+		So(searchAll(users, Search{}), ShouldResemble, []string{"ann", "bob", "dan", "cat"})
+		So(searchAll(users, Search{Domain: "Test"}), ShouldResemble, []string{"ann", "bob", "cat"})
+		So(searchAll(users, Search{Domain: MatchAnyDomain, Active: SearchYes}), ShouldResemble, []string{"bob", "cat"})
+		So(searchAll(users, Search{Active: SearchNo}), ShouldResemble, []string{"ann", "dan"})
+		So(searchAll(users, Search{LoggedIn: SearchYes}), ShouldBeEmpty)
+		So(searchAll(users, Search{CreatedFrom: base.Add(time.Hour), CreatedTo: base.Add(2 * time.Hour)}), ShouldResemble, []string{"bob", "dan"})
+		So(searchAll(users, Search{NamePrefix: "b"}), ShouldResemble, []string{"bob"})
+		So(searchAll(users, Search{NamePrefix: "CAT C"}), ShouldResemble, []string{"cat"})
+		So(searchAll(users, Search{EmailPrefix: "cat@other"}), ShouldResemble, []string{"cat"})
+	})
+
+	Convey("Pages follow on from the cursor", t, func() {
+		So(searchAll(users, Search{Limit: 1}), ShouldResemble, []string{"ann", "bob", "dan", "cat"})
+		So(searchAll(users, Search{Limit: 3, Descending: true}), ShouldResemble, []string{"cat", "dan", "bob", "ann"})
+		So(searchAll(users, Search{Limit: 2, Sort: FieldEmail}), ShouldResemble, []string{"ann", "bob", "cat", "dan"})
+		So(searchAll(users, Search{Limit: 2, Sort: FieldName, Descending: true}), ShouldResemble, []string{"dan", "cat", "bob", "ann"})
+	})
+
+	Convey("Users with the same sort key aren't lost between pages", t, func() {
+		twin := searchUser("Test", "Cat Cole", "twin", "twin@example.com", cat.CreatedAt)
+		list := append([]*tenant.User{twin}, users...)
+		So(len(searchAll(list, Search{Limit: 1, Sort: FieldName})), ShouldEqual, 5)
+		So(len(searchAll(list, Search{Limit: 1, Descending: true})), ShouldEqual, 5)
+	})
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"github.com/cgentry/gdriver"
 	"github.com/cgentry/gus/record/tenant"
+	"time"
 )
 
 // StorageDriver interface defines very general, high level operations for retrieval and storage of
@@ -37,6 +38,39 @@ type Storer interface {
 	FetchUserByGUID(guid string) (*tenant.User, error)
 	FetchUserByLogin(domain, loginName string) (*tenant.User, error)
 	FetchUserByToken(token string) (*tenant.User, error)
+	FetchUserByResetToken(domain, resetToken string) (*tenant.User, error)
+	FetchUserByVerifyToken(domain, token string) (*tenant.User, error)
+
+	// Session functions. These are optional for a driver and return ErrNoSupport if missing
+	SessionInsert(session *tenant.Session) error
+	SessionUpdate(session *tenant.Session) error
+	SessionFetch(token string) (*tenant.Session, error)
+	SessionList(guid string) ([]*tenant.Session, error)
+	SessionDelete(session *tenant.Session) error
+	SessionDeleteAll(guid string) error
+
+	// Refresh token functions. These are optional for a driver and return ErrNoSupport if missing
+	RefreshInsert(refresh *tenant.Refresh) error
+	RefreshUpdate(refresh *tenant.Refresh) error
+	RefreshFetch(token string) (*tenant.Refresh, error)
+	RefreshDeleteFamily(family string) error
+	RefreshDeleteAll(guid string) error
+
+	// Passkey functions. These are optional for a driver and return ErrNoSupport if missing
+	CredentialInsert(cred *tenant.Credential) error
+	CredentialUpdate(cred *tenant.Credential) error
+	CredentialFetch(id string) (*tenant.Credential, error)
+	CredentialList(guid string) ([]*tenant.Credential, error)
+	CredentialDelete(cred *tenant.Credential) error
+
+	// Deleted user functions. These are optional for a driver and return ErrNoSupport if missing
+	UserDelete(user *tenant.User) error
+	UserRestore(user *tenant.User) error
+	FetchDeletedUser(domain, lookupKey, lookupValue string) (*tenant.User, error)
+	UserPurge(deletedBefore time.Time) (int, error)
+
+	// User search. This is optional for a driver and returns ErrNoSupport if missing
+	UserSearch(search Search) (*SearchPage, error)
 
 	//  The following are wrappers for the gdriver routines.
 	Id() string
@@ -79,6 +113,58 @@ type Reseter interface {
 	Reset()
 }
 
+// Sessioner is an optional interface for drivers that store login sessions. A user may
+// have many sessions. Sessions are keyed by the hash of their token; the clear token
+// is never passed to the driver.
+type Sessioner interface {
+	SessionInsert(session *tenant.Session) error
+	SessionUpdate(session *tenant.Session) error
+	SessionFetch(tokenHash string) (*tenant.Session, error)
+	SessionList(guid string) ([]*tenant.Session, error)
+	SessionDelete(tokenHash string) error
+	SessionDeleteAll(guid string) error
+}
+
+// Refresher is an optional interface for drivers that store refresh tokens. Like sessions, they
+// are keyed by the hash of the token. Used tokens are kept until their family is deleted.
+// RefreshUpdate must only save a token that hasn't been used, returning ErrRefreshReused if it
+// has, so that two requests can't both trade in the same token.
+type Refresher interface {
+	RefreshInsert(refresh *tenant.Refresh) error
+	RefreshUpdate(refresh *tenant.Refresh) error
+	RefreshFetch(tokenHash string) (*tenant.Refresh, error)
+	RefreshDeleteFamily(family string) error
+	RefreshDeleteAll(guid string) error
+}
+
+// Credentialer is an optional interface for drivers that store passkeys. They are keyed by the
+// credential id the browser sends. An id can only be registered once.
+type Credentialer interface {
+	CredentialInsert(cred *tenant.Credential) error
+	CredentialUpdate(cred *tenant.Credential) error
+	CredentialFetch(id string) (*tenant.Credential, error)
+	CredentialList(guid string) ([]*tenant.Credential, error)
+	CredentialDelete(id string) error
+}
+
+// Deleter is an optional interface for drivers that soft delete users. A user is deleted by
+// saving them with DeletedAt set. The driver must then leave them out of UserFetch and must not
+// count their login name or email address when checking for duplicates. UserFetchDeleted only
+// finds deleted users. UserPurge removes users deleted before the time, along with their
+// sessions, refresh tokens and passkeys, and returns how many were removed.
+type Deleter interface {
+	UserFetchDeleted(domain, key, value string) (*tenant.User, error)
+	UserPurge(deletedBefore time.Time) (int, error)
+}
+
+// Searcher is an optional interface for drivers that can list users. The Store has already
+// checked the search, filled in the defaults and decoded the cursor into After. The driver returns
+// the users that match, sorted by the search's key and then by Guid, that come after the cursor
+// and no more than the limit. Drivers that keep their users in memory can use Search.Page.
+type Searcher interface {
+	UserSearch(search *Search) ([]*tenant.User, error)
+}
+
 // Pinger is an optional database 'ping' interface. This will check the database connection
 type Pinger interface {
 	Ping() error
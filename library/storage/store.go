@@ -4,6 +4,7 @@ import (
 	"github.com/cgentry/gdriver"
 	. "github.com/cgentry/gus/ecode"
 	"github.com/cgentry/gus/record/tenant"
+	"time"
 )
 
 // These are the names of fields we expect to occur in the database and will
@@ -11,11 +12,13 @@ import (
 // map them in the driver-level routines in order to provide names that are
 // more appropriate to the driver mechanism.
 const (
-	FieldEmail = `Email`
-	FieldName  = `FullName`
-	FieldGUID  = `Guid`
-	FieldLogin = `LoginName`
-	FieldToken = `Token`
+	FieldEmail       = `Email`
+	FieldName        = `FullName`
+	FieldGUID        = `Guid`
+	FieldLogin       = `LoginName`
+	FieldToken       = `Token`
+	FieldResetToken  = `ResetToken`
+	FieldVerifyToken = `VerifyToken`
 )
 
 // MatchAnyDomain is a special character that should be used to search ALL domains.
@@ -98,6 +101,7 @@ func (s *Store) Open(connect string, extraDriverOptions string) error {
 	s.lastError = nil
 	s.connectString = connect
 	s.connection, s.lastError = s.driver.Open(connect, extraDriverOptions)
+	s.isOpen = (s.lastError == nil)
 
 	return s.lastError
 }
@@ -131,10 +135,13 @@ func (s *Store) UserFetch(domain, lookupKey, lookkupValue string) (*tenant.User,
 		return nil, ErrNotOpen
 	}
 	if domain == MatchAnyDomain {
-		if lookupKey != FieldGUID || lookupKey != FieldToken {
+		if lookupKey != FieldGUID && lookupKey != FieldToken {
 			return nil, ErrMatchAnyNotSupported
 		}
 	}
+	if lookupKey == FieldToken { // Only the hash of a token is stored
+		lookkupValue = tenant.HashToken(lookkupValue)
+	}
 	rec, err := s.connection.UserFetch(domain, lookupKey, lookkupValue)
 	s.lastError = err
 	return rec, err
@@ -215,12 +222,47 @@ func (s *Store) FetchUserByGUID(guid string) (*tenant.User, error) {
 }
 
 // FetchUserByToken If the user is not logged in, a 'User not found' error is returned.
+// Pass the token the client holds: it is hashed here to match what is stored.
 func (s *Store) FetchUserByToken(token string) (*tenant.User, error) {
 	if !s.isOpen {
 		s.lastError = ErrNotOpen
 		return nil, ErrNotOpen
 	}
-	rec, err := s.connection.UserFetch(MatchAnyDomain, FieldToken, token)
+	rec, err := s.connection.UserFetch(MatchAnyDomain, FieldToken, tenant.HashToken(token))
+	s.lastError = err
+	return rec, err
+}
+
+// FetchUserByResetToken finds the user that requested a lost password reset. The token must be
+// within the domain of the caller. Only the hash of the token is stored. A blank token never
+// matches, even users that have no token.
+func (s *Store) FetchUserByResetToken(domain, resetToken string) (*tenant.User, error) {
+	if !s.isOpen {
+		s.lastError = ErrNotOpen
+		return nil, ErrNotOpen
+	}
+	if resetToken == "" {
+		s.lastError = ErrUserNotFound
+		return nil, ErrUserNotFound
+	}
+	rec, err := s.connection.UserFetch(domain, FieldResetToken, tenant.HashToken(resetToken))
+	s.lastError = err
+	return rec, err
+}
+
+// FetchUserByVerifyToken finds the user that was sent an email verification token. The token must
+// be within the domain of the caller. Only the hash of the token is stored. A blank token never
+// matches, even users that have no token.
+func (s *Store) FetchUserByVerifyToken(domain, token string) (*tenant.User, error) {
+	if !s.isOpen {
+		s.lastError = ErrNotOpen
+		return nil, ErrNotOpen
+	}
+	if token == "" {
+		s.lastError = ErrUserNotFound
+		return nil, ErrUserNotFound
+	}
+	rec, err := s.connection.UserFetch(domain, FieldVerifyToken, tenant.HashToken(token))
 	s.lastError = err
 	return rec, err
 }
@@ -246,3 +288,331 @@ func (s *Store) FetchUserByLogin(domain, loginName string) (*tenant.User, error)
 	s.lastError = err
 	return rec, err
 }
+
+/* ------------------------ SESSION FUNCTIONS ***********************/
+
+// sessioner returns the session interface for the driver. If the store isn't open or the driver
+// doesn't keep sessions, an error is returned.
+func (s *Store) sessioner() (Sessioner, error) {
+	if !s.isOpen {
+		s.lastError = ErrNotOpen
+		return nil, ErrNotOpen
+	}
+	sessioner, found := s.connection.(Sessioner)
+	if !found {
+		s.lastError = ErrNoSupport
+		return nil, ErrNoSupport
+	}
+	s.lastError = nil
+	return sessioner, nil
+}
+
+// SessionInsert saves a new session for a user
+func (s *Store) SessionInsert(session *tenant.Session) error {
+	sessioner, err := s.sessioner()
+	if err != nil {
+		return err
+	}
+	return s.saveAndReturnError(sessioner.SessionInsert(session))
+}
+
+// SessionUpdate saves the changes to a session (e.g. after an authentication)
+func (s *Store) SessionUpdate(session *tenant.Session) error {
+	sessioner, err := s.sessioner()
+	if err != nil {
+		return err
+	}
+	return s.saveAndReturnError(sessioner.SessionUpdate(session))
+}
+
+// SessionFetch finds the session for a token. Pass the token the client holds: it is hashed
+// here to match what is stored.
+func (s *Store) SessionFetch(token string) (*tenant.Session, error) {
+	sessioner, err := s.sessioner()
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, s.saveAndReturnError(ErrSessionNotFound)
+	}
+	rec, err := sessioner.SessionFetch(tenant.HashToken(token))
+	s.lastError = err
+	return rec, err
+}
+
+// SessionList returns all of the sessions a user has open
+func (s *Store) SessionList(guid string) ([]*tenant.Session, error) {
+	sessioner, err := s.sessioner()
+	if err != nil {
+		return nil, err
+	}
+	rec, err := sessioner.SessionList(guid)
+	s.lastError = err
+	return rec, err
+}
+
+// SessionDelete removes a single session (a logout)
+func (s *Store) SessionDelete(session *tenant.Session) error {
+	sessioner, err := s.sessioner()
+	if err != nil {
+		return err
+	}
+	return s.saveAndReturnError(sessioner.SessionDelete(session.Token))
+}
+
+// SessionDeleteAll removes every session a user has open (logout everywhere)
+func (s *Store) SessionDeleteAll(guid string) error {
+	sessioner, err := s.sessioner()
+	if err != nil {
+		return err
+	}
+	return s.saveAndReturnError(sessioner.SessionDeleteAll(guid))
+}
+
+/* ------------------------ REFRESH TOKEN FUNCTIONS ***********************/
+
+// refresher returns the refresh token interface for the driver. If the store isn't open or
+// the driver doesn't keep refresh tokens, an error is returned.
+func (s *Store) refresher() (Refresher, error) {
+	if !s.isOpen {
+		s.lastError = ErrNotOpen
+		return nil, ErrNotOpen
+	}
+	refresher, found := s.connection.(Refresher)
+	if !found {
+		s.lastError = ErrNoSupport
+		return nil, ErrNoSupport
+	}
+	s.lastError = nil
+	return refresher, nil
+}
+
+// RefreshInsert saves a new refresh token
+func (s *Store) RefreshInsert(refresh *tenant.Refresh) error {
+	refresher, err := s.refresher()
+	if err != nil {
+		return err
+	}
+	return s.saveAndReturnError(refresher.RefreshInsert(refresh))
+}
+
+// RefreshUpdate saves the changes to a refresh token (e.g. when it is used). ErrRefreshReused is
+// returned if the token was used by another request first.
+func (s *Store) RefreshUpdate(refresh *tenant.Refresh) error {
+	refresher, err := s.refresher()
+	if err != nil {
+		return err
+	}
+	return s.saveAndReturnError(refresher.RefreshUpdate(refresh))
+}
+
+// RefreshFetch finds the refresh token. Pass the token the client holds: it is hashed
+// here to match what is stored.
+func (s *Store) RefreshFetch(token string) (*tenant.Refresh, error) {
+	refresher, err := s.refresher()
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, s.saveAndReturnError(ErrRefreshNotFound)
+	}
+	rec, err := refresher.RefreshFetch(tenant.HashToken(token))
+	s.lastError = err
+	return rec, err
+}
+
+// RefreshDeleteFamily removes every refresh token that came from the same login
+func (s *Store) RefreshDeleteFamily(family string) error {
+	refresher, err := s.refresher()
+	if err != nil {
+		return err
+	}
+	return s.saveAndReturnError(refresher.RefreshDeleteFamily(family))
+}
+
+// RefreshDeleteAll removes all of a user's refresh tokens
+func (s *Store) RefreshDeleteAll(guid string) error {
+	refresher, err := s.refresher()
+	if err != nil {
+		return err
+	}
+	return s.saveAndReturnError(refresher.RefreshDeleteAll(guid))
+}
+
+/* ------------------------ PASSKEY FUNCTIONS ***********************/
+
+// credentialer returns the passkey interface for the driver. If the store isn't open or
+// the driver doesn't keep passkeys, an error is returned.
+func (s *Store) credentialer() (Credentialer, error) {
+	if !s.isOpen {
+		s.lastError = ErrNotOpen
+		return nil, ErrNotOpen
+	}
+	credentialer, found := s.connection.(Credentialer)
+	if !found {
+		s.lastError = ErrNoSupport
+		return nil, ErrNoSupport
+	}
+	s.lastError = nil
+	return credentialer, nil
+}
+
+// CredentialInsert saves a newly registered passkey. If the id is already registered,
+// ErrDuplicatePasskey is returned.
+func (s *Store) CredentialInsert(cred *tenant.Credential) error {
+	credentialer, err := s.credentialer()
+	if err != nil {
+		return err
+	}
+	return s.saveAndReturnError(credentialer.CredentialInsert(cred))
+}
+
+// CredentialUpdate saves the changes to a passkey (e.g. the signature count after a login)
+func (s *Store) CredentialUpdate(cred *tenant.Credential) error {
+	credentialer, err := s.credentialer()
+	if err != nil {
+		return err
+	}
+	return s.saveAndReturnError(credentialer.CredentialUpdate(cred))
+}
+
+// CredentialFetch finds a passkey by the credential id the browser sends
+func (s *Store) CredentialFetch(id string) (*tenant.Credential, error) {
+	credentialer, err := s.credentialer()
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, s.saveAndReturnError(ErrPasskeyNotFound)
+	}
+	rec, err := credentialer.CredentialFetch(id)
+	s.lastError = err
+	return rec, err
+}
+
+// CredentialList returns all of the passkeys a user has registered
+func (s *Store) CredentialList(guid string) ([]*tenant.Credential, error) {
+	credentialer, err := s.credentialer()
+	if err != nil {
+		return nil, err
+	}
+	list, err := credentialer.CredentialList(guid)
+	s.lastError = err
+	return list, err
+}
+
+// CredentialDelete removes a passkey
+func (s *Store) CredentialDelete(cred *tenant.Credential) error {
+	credentialer, err := s.credentialer()
+	if err != nil {
+		return err
+	}
+	return s.saveAndReturnError(credentialer.CredentialDelete(cred.Id))
+}
+
+/* ------------------------ DELETED USER FUNCTIONS ***********************/
+
+// deleter returns the soft delete interface for the driver. If the store isn't open or the
+// driver can't soft delete users, an error is returned.
+func (s *Store) deleter() (Deleter, error) {
+	if !s.isOpen {
+		s.lastError = ErrNotOpen
+		return nil, ErrNotOpen
+	}
+	deleter, found := s.connection.(Deleter)
+	if !found {
+		s.lastError = ErrNoSupport
+		return nil, ErrNoSupport
+	}
+	s.lastError = nil
+	return deleter, nil
+}
+
+// UserDelete marks the user as deleted and turns them off. They are no longer found by the
+// FetchUserByXXX calls and their login name and email address can be used by a new user. Sessions
+// and refresh tokens are not removed: the caller should do that.
+func (s *Store) UserDelete(user *tenant.User) error {
+	if _, err := s.deleter(); err != nil {
+		return err
+	}
+	user.Delete()
+	return s.UserUpdate(user)
+}
+
+// UserRestore brings back a deleted user. If another user has taken their login name or email
+// address since they were deleted, ErrDuplicateLogin or ErrDuplicateEmail is returned. The user
+// stays turned off.
+func (s *Store) UserRestore(user *tenant.User) error {
+	if _, err := s.deleter(); err != nil {
+		return err
+	}
+	if user.LoginName != "" {
+		if found, err := s.connection.UserFetch(user.Domain, FieldLogin, user.LoginName); err == nil && found.Guid != user.Guid {
+			return s.saveAndReturnError(ErrDuplicateLogin)
+		}
+	}
+	if user.Email != "" {
+		if found, err := s.connection.UserFetch(user.Domain, FieldEmail, user.Email); err == nil && found.Guid != user.Guid {
+			return s.saveAndReturnError(ErrDuplicateEmail)
+		}
+	}
+	user.Restore()
+	return s.UserUpdate(user)
+}
+
+// FetchDeletedUser works like UserFetch but only finds users that have been deleted.
+func (s *Store) FetchDeletedUser(domain, lookupKey, lookupValue string) (*tenant.User, error) {
+	deleter, err := s.deleter()
+	if err != nil {
+		return nil, err
+	}
+	if domain == MatchAnyDomain && lookupKey != FieldGUID {
+		return nil, s.saveAndReturnError(ErrMatchAnyNotSupported)
+	}
+	rec, err := deleter.UserFetchDeleted(domain, lookupKey, lookupValue)
+	s.lastError = err
+	return rec, err
+}
+
+// UserPurge removes, for good, every user that was deleted before the time given. The number
+// of users removed is returned.
+func (s *Store) UserPurge(deletedBefore time.Time) (int, error) {
+	deleter, err := s.deleter()
+	if err != nil {
+		return 0, err
+	}
+	count, err := deleter.UserPurge(deletedBefore)
+	s.lastError = err
+	return count, err
+}
+
+/* ------------------------ SEARCH FUNCTIONS ***********************/
+
+// UserSearch returns a page of the users that match the search. Pass the page's Next as the
+// Cursor of the search to get the following page; the other fields must stay the same.
+func (s *Store) UserSearch(search Search) (*SearchPage, error) {
+	if !s.isOpen {
+		s.lastError = ErrNotOpen
+		return nil, ErrNotOpen
+	}
+	searcher, found := s.connection.(Searcher)
+	if !found {
+		return nil, s.saveAndReturnError(ErrNoSupport)
+	}
+	if err := search.normalise(); err != nil {
+		return nil, s.saveAndReturnError(err)
+	}
+	limit := search.Limit
+	search.Limit++ // One more tells us if there is another page
+	users, err := searcher.UserSearch(&search)
+	if err != nil {
+		return nil, s.saveAndReturnError(err)
+	}
+	s.lastError = nil
+	page := &SearchPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		page.Next = search.cursorFor(page.Users[limit-1])
+	}
+	return page, nil
+}
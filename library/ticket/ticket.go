@@ -0,0 +1,283 @@
+// Package ticket issues and checks signed session tickets. A ticket is a short-lived JWT that
+// carries the user's GUID, domain, login time and expiry. Services can check a ticket without
+// calling gus: EdDSA tickets only need the public key, HS256 tickets need the shared secret.
+//
+// Tickets can't be revoked, so they should be kept short. The session token returned at login
+// is still the way to get a new ticket (see the /ticket/ service) and is what a logout removes.
+//
+// Tickets are turned on from the configuration:
+//
+//	ticket.Set(c.Ticket)
+package ticket
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signing algorithms. These are the JWT 'alg' names.
+const (
+	ALG_EDDSA = "EdDSA"
+	ALG_HS256 = "HS256"
+)
+
+// DEFAULT_DURATION is used when the configuration doesn't give a lifetime
+const DEFAULT_DURATION = 5 * time.Minute
+
+// Claims are the fields carried inside of a ticket.
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub"`           // User's GUID
+	Domain    string `json:"dom"`           // User's domain
+	SessionId string `json:"sid,omitempty"` // Session the ticket was issued for
+	LoginAt   int64  `json:"lat"`           // When the user logged in (unix seconds)
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Signer holds the key used to sign and check tickets.
+type Signer struct {
+	alg      string
+	keyId    string
+	secret   []byte
+	private  ed25519.PrivateKey
+	public   ed25519.PublicKey
+	duration time.Duration
+	issuer   string
+}
+
+var current struct {
+	sync.RWMutex
+	signer *Signer
+}
+
+// Set will turn tickets on (or off, when the algorithm is blank) using the configuration.
+// The current signer is not changed if there is an error.
+func Set(c configure.Ticket) error {
+	var signer *Signer
+	if c.Algorithm != "" {
+		var err error
+		if signer, err = NewSigner(c); err != nil {
+			return err
+		}
+	}
+	current.Lock()
+	current.signer = signer
+	current.Unlock()
+	return nil
+}
+
+// Get returns the current signer. If tickets are off, nil is returned.
+func Get() *Signer {
+	current.RLock()
+	defer current.RUnlock()
+	return current.signer
+}
+
+// UseKey replaces the key of the current EdDSA signer. It is used when tickets are signed with
+// the current key from the key store, so the ticket's 'kid' matches the one published at /keys/.
+func UseKey(keyId string, private ed25519.PrivateKey) error {
+	current.Lock()
+	defer current.Unlock()
+	if current.signer == nil || current.signer.alg != ALG_EDDSA {
+		return ErrTicketAlgorithm
+	}
+	signer := *current.signer
+	signer.setPrivate(private)
+	signer.keyId = keyId
+	current.signer = &signer
+	return nil
+}
+
+// Enabled is true when tickets are being issued
+func Enabled() bool {
+	return Get() != nil
+}
+
+// NewSigner creates a signer from the configuration. An EdDSA signer without a key
+// will generate a new one; tickets it signs will not be valid after a restart.
+func NewSigner(c configure.Ticket) (*Signer, error) {
+	s := &Signer{
+		alg:      c.Algorithm,
+		duration: time.Duration(c.Duration) * time.Minute,
+		issuer:   c.Issuer,
+	}
+	if s.duration <= 0 {
+		s.duration = DEFAULT_DURATION
+	}
+	switch strings.ToLower(c.Algorithm) {
+	case strings.ToLower(ALG_HS256):
+		if len(c.Key) < 32 {
+			return nil, ErrTicketKey
+		}
+		s.alg = ALG_HS256
+		s.secret = []byte(c.Key)
+	case strings.ToLower(ALG_EDDSA):
+		s.alg = ALG_EDDSA
+		if c.Key == "" {
+			_, private, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, err
+			}
+			s.setPrivate(private)
+		} else {
+			seed, err := decodeKey(c.Key)
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return nil, ErrTicketKey
+			}
+			s.setPrivate(ed25519.NewKeyFromSeed(seed))
+		}
+	default:
+		return nil, ErrTicketAlgorithm
+	}
+	return s, nil
+}
+
+// NewVerifier creates a signer that can only check EdDSA tickets. This is what a service
+// that receives tickets would use with the key published by gus.
+func NewVerifier(public ed25519.PublicKey) (*Signer, error) {
+	if len(public) != ed25519.PublicKeySize {
+		return nil, ErrTicketKey
+	}
+	return &Signer{alg: ALG_EDDSA, public: public, keyId: KeyId(public)}, nil
+}
+
+func (s *Signer) setPrivate(private ed25519.PrivateKey) {
+	s.private = private
+	s.public = private.Public().(ed25519.PublicKey)
+	s.keyId = KeyId(s.public)
+}
+
+// KeyId is the identifier for a public key. It is put in the ticket's header ('kid') so
+// the receiver knows which key to check it with.
+func KeyId(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+// decodeKey accepts either standard or URL-safe base64, with or without padding.
+func decodeKey(key string) ([]byte, error) {
+	key = strings.TrimRight(strings.TrimSpace(key), "=")
+	if b, err := base64.RawStdEncoding.DecodeString(key); err == nil {
+		return b, nil
+	}
+	return base64.RawURLEncoding.DecodeString(key)
+}
+
+// Algorithm returns the JWT name for the signing algorithm
+func (s *Signer) Algorithm() string { return s.alg }
+
+// KeyId returns the identifier for the signing key. HS256 keys have none.
+func (s *Signer) KeyId() string { return s.keyId }
+
+// PublicKey returns the key services use to check EdDSA tickets. HS256 returns nil.
+func (s *Signer) PublicKey() ed25519.PublicKey { return s.public }
+
+// Duration is how long each ticket is valid for
+func (s *Signer) Duration() time.Duration { return s.duration }
+
+// Issue creates a signed ticket for the user's session. The time the ticket expires is
+// returned along with the ticket.
+func (s *Signer) Issue(guid, domain, sessionId string, loginAt time.Time) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(s.duration)
+	claims := &Claims{
+		Issuer:    s.issuer,
+		Subject:   guid,
+		Domain:    domain,
+		SessionId: sessionId,
+		LoginAt:   loginAt.Unix(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	}
+	ticket, err := s.Sign(claims)
+	return ticket, expires, err
+}
+
+// Sign will encode and sign the claims
+func (s *Signer) Sign(claims *Claims) (string, error) {
+	if s.alg == ALG_EDDSA && s.private == nil {
+		return "", ErrTicketKey
+	}
+	head, err := json.Marshal(&header{Alg: s.alg, Typ: "JWT", Kid: s.keyId})
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := encode(head) + "." + encode(body)
+	return signed + "." + encode(s.signature([]byte(signed))), nil
+}
+
+// Verify checks the signature and the expiry of a ticket and returns the claims
+// carried inside. The algorithm in the ticket must match the signer's.
+func (s *Signer) Verify(ticket string) (*Claims, error) {
+	parts := strings.Split(ticket, ".")
+	if len(parts) != 3 {
+		return nil, ErrTicketInvalid
+	}
+	var head header
+	if err := decode(parts[0], &head); err != nil || head.Alg != s.alg {
+		return nil, ErrTicketInvalid
+	}
+	if s.keyId != "" && head.Kid != "" && head.Kid != s.keyId {
+		return nil, ErrTicketInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !s.checkSignature([]byte(parts[0]+"."+parts[1]), sig) {
+		return nil, ErrTicketInvalid
+	}
+	claims := &Claims{}
+	if err := decode(parts[1], claims); err != nil {
+		return nil, ErrTicketInvalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTicketExpired
+	}
+	return claims, nil
+}
+
+func (s *Signer) signature(signed []byte) []byte {
+	if s.alg == ALG_HS256 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+	return ed25519.Sign(s.private, signed)
+}
+
+func (s *Signer) checkSignature(signed, sig []byte) bool {
+	if s.alg == ALG_HS256 {
+		return hmac.Equal(s.signature(signed), sig)
+	}
+	return ed25519.Verify(s.public, signed, sig)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,140 @@
+package ticket
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestNewSigner(t *testing.T) {
+	Convey("Signers are created from the configuration", t, func() {
+		s, err := NewSigner(configure.Ticket{Algorithm: "hs256", Key: testSecret})
+		So(err, ShouldBeNil)
+		So(s.Algorithm(), ShouldEqual, ALG_HS256)
+		So(s.Duration(), ShouldEqual, DEFAULT_DURATION)
+		So(s.PublicKey(), ShouldBeNil)
+
+		s, err = NewSigner(configure.Ticket{Algorithm: "EdDSA", Duration: 2})
+		So(err, ShouldBeNil)
+		So(s.Algorithm(), ShouldEqual, ALG_EDDSA)
+		So(s.Duration(), ShouldEqual, 2*time.Minute)
+		So(len(s.PublicKey()), ShouldEqual, ed25519.PublicKeySize)
+		So(s.KeyId(), ShouldNotBeBlank)
+
+		seed := base64.StdEncoding.EncodeToString(make([]byte, ed25519.SeedSize))
+		s1, err := NewSigner(configure.Ticket{Algorithm: "EdDSA", Key: seed})
+		So(err, ShouldBeNil)
+		s2, _ := NewSigner(configure.Ticket{Algorithm: "EdDSA", Key: seed})
+		So(s1.KeyId(), ShouldEqual, s2.KeyId())
+	})
+	Convey("Bad configurations are rejected", t, func() {
+		_, err := NewSigner(configure.Ticket{Algorithm: "none"})
+		So(err, ShouldEqual, ErrTicketAlgorithm)
+		_, err = NewSigner(configure.Ticket{Algorithm: "HS256", Key: "short"})
+		So(err, ShouldEqual, ErrTicketKey)
+		_, err = NewSigner(configure.Ticket{Algorithm: "EdDSA", Key: "bm90IGEga2V5"})
+		So(err, ShouldEqual, ErrTicketKey)
+	})
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	login := time.Now().Add(-time.Minute)
+	for _, c := range []configure.Ticket{
+		{Algorithm: ALG_HS256, Key: testSecret, Issuer: "gus"},
+		{Algorithm: ALG_EDDSA, Issuer: "gus"},
+	} {
+		s, err := NewSigner(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		Convey("Round trip for "+c.Algorithm, t, func() {
+			ticket, expires, err := s.Issue("guid", "domain", "session", login)
+			So(err, ShouldBeNil)
+			So(strings.Count(ticket, "."), ShouldEqual, 2)
+			So(expires.After(time.Now()), ShouldBeTrue)
+
+			claims, err := s.Verify(ticket)
+			So(err, ShouldBeNil)
+			So(claims.Subject, ShouldEqual, "guid")
+			So(claims.Domain, ShouldEqual, "domain")
+			So(claims.SessionId, ShouldEqual, "session")
+			So(claims.Issuer, ShouldEqual, "gus")
+			So(claims.LoginAt, ShouldEqual, login.Unix())
+			So(claims.ExpiresAt, ShouldEqual, expires.Unix())
+		})
+		Convey("Tampered tickets fail for "+c.Algorithm, t, func() {
+			ticket, _, _ := s.Issue("guid", "domain", "session", login)
+			parts := strings.Split(ticket, ".")
+			other, _, _ := s.Issue("other", "domain", "session", login)
+			otherParts := strings.Split(other, ".")
+
+			_, err := s.Verify(parts[0] + "." + otherParts[1] + "." + parts[2])
+			So(err, ShouldEqual, ErrTicketInvalid)
+			_, err = s.Verify(parts[0] + "." + parts[1])
+			So(err, ShouldEqual, ErrTicketInvalid)
+			_, err = s.Verify(parts[0] + "." + parts[1] + ".")
+			So(err, ShouldEqual, ErrTicketInvalid)
+
+			none := encode([]byte(`{"alg":"none","typ":"JWT"}`))
+			_, err = s.Verify(none + "." + parts[1] + ".")
+			So(err, ShouldEqual, ErrTicketInvalid)
+		})
+		Convey("Expired tickets fail for "+c.Algorithm, t, func() {
+			ticket, err := s.Sign(&Claims{Subject: "guid", ExpiresAt: time.Now().Add(-time.Second).Unix()})
+			So(err, ShouldBeNil)
+			_, err = s.Verify(ticket)
+			So(err, ShouldEqual, ErrTicketExpired)
+		})
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	Convey("A service can check EdDSA tickets with only the public key", t, func() {
+		s, _ := NewSigner(configure.Ticket{Algorithm: ALG_EDDSA})
+		ticket, _, _ := s.Issue("guid", "domain", "", time.Now())
+
+		v, err := NewVerifier(s.PublicKey())
+		So(err, ShouldBeNil)
+		claims, err := v.Verify(ticket)
+		So(err, ShouldBeNil)
+		So(claims.Subject, ShouldEqual, "guid")
+
+		_, err = v.Sign(claims)
+		So(err, ShouldEqual, ErrTicketKey)
+
+		other, _ := NewSigner(configure.Ticket{Algorithm: ALG_EDDSA})
+		v, _ = NewVerifier(other.PublicKey())
+		_, err = v.Verify(ticket)
+		So(err, ShouldEqual, ErrTicketInvalid)
+
+		_, err = NewVerifier(ed25519.PublicKey("short"))
+		So(err, ShouldEqual, ErrTicketKey)
+	})
+	Convey("HS256 tickets are not accepted by an EdDSA verifier", t, func() {
+		hs, _ := NewSigner(configure.Ticket{Algorithm: ALG_HS256, Key: testSecret})
+		ticket, _, _ := hs.Issue("guid", "domain", "", time.Now())
+		ed, _ := NewSigner(configure.Ticket{Algorithm: ALG_EDDSA})
+		_, err := ed.Verify(ticket)
+		So(err, ShouldEqual, ErrTicketInvalid)
+	})
+}
+
+func TestSet(t *testing.T) {
+	Convey("Tickets are off until set", t, func() {
+		So(Set(configure.Ticket{}), ShouldBeNil)
+		So(Enabled(), ShouldBeFalse)
+		So(Set(configure.Ticket{Algorithm: ALG_EDDSA}), ShouldBeNil)
+		So(Enabled(), ShouldBeTrue)
+		So(Set(configure.Ticket{Algorithm: "bad"}), ShouldEqual, ErrTicketAlgorithm)
+		So(Enabled(), ShouldBeTrue)
+		So(Set(configure.Ticket{}), ShouldBeNil)
+		So(Get(), ShouldBeNil)
+	})
+}
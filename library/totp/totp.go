@@ -0,0 +1,120 @@
+// Package totp implements the time-based one-time passwords of RFC 6238, as used by
+// authenticator apps. Codes are 6 digits, change every 30 seconds and use HMAC-SHA1,
+// which are the only settings every app supports.
+//
+// A code is accepted for one time step either side of now, to allow for clock drift.
+// Verify returns the time step that matched so the caller can refuse to accept the
+// same code (or an older one) a second time.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DIGITS      = 6  // Digits in a code
+	PERIOD      = 30 // Seconds each code is good for
+	SKEW        = 1  // Time steps either side of now that are accepted
+	SECRET_SIZE = 20 // Bytes in a new secret (160 bits, as RFC 4226 recommends)
+)
+
+// modulus keeps the last DIGITS digits of a value
+const modulus = 1000000
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a new, random, secret. It is base32 encoded, which is the form the
+// authenticator apps expect.
+func NewSecret() (string, error) {
+	b := make([]byte, SECRET_SIZE)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// URI returns the otpauth:// URI for the secret. Shown as a QR code, it can be scanned
+// straight into an authenticator app. The issuer is the name the app shows; the account
+// is normally the user's login name or email address.
+func URI(issuer, account, secret string) string {
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+	v := url.Values{}
+	v.Set("secret", secret)
+	if issuer != "" {
+		v.Set("issuer", issuer)
+	}
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(DIGITS))
+	v.Set("period", fmt.Sprint(PERIOD))
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// Step returns the time step for the time
+func Step(t time.Time) int64 {
+	return t.Unix() / PERIOD
+}
+
+// Code returns the code for the secret at the time step.
+func Code(secret string, step int64) (string, error) {
+	key, err := decode(secret)
+	if err != nil {
+		return "", err
+	}
+	return code(key, step), nil
+}
+
+// Verify checks the code against the secret. Codes from time steps up to and including
+// lastStep are refused, so a code can only be used once. If the code is good, the time
+// step it matched is returned; save it and pass it as lastStep the next time.
+func Verify(secret, value string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := decode(secret)
+	if err != nil {
+		return 0, false
+	}
+	value = strings.Replace(strings.TrimSpace(value), " ", "", -1)
+	if len(value) != DIGITS {
+		return 0, false
+	}
+	current := Step(now)
+	for step := current - SKEW; step <= current+SKEW; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(code(key, step)), []byte(value)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// decode turns the secret back into bytes. Case, spaces and padding are ignored
+// as people often copy secrets by hand.
+func decode(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	return encoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// code is the HOTP value (RFC 4226) for the counter
+func code(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", DIGITS, value%modulus)
+}
@@ -0,0 +1,64 @@
+package totp
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The RFC 6238 test secret is the ASCII string "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	Convey("Codes match the RFC 6238 SHA1 test values", t, func() {
+		for unix, want := range map[int64]string{
+			59:          "287082",
+			1111111109:  "081804",
+			1111111111:  "050471",
+			1234567890:  "005924",
+			2000000000:  "279037",
+			20000000000: "353130",
+		} {
+			got, err := Code(rfcSecret, Step(time.Unix(unix, 0)))
+			So(err, ShouldBeNil)
+			So(got, ShouldEqual, want)
+		}
+		_, err := Code("not base32!", 1)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	Convey("Codes are accepted once, within one step of now", t, func() {
+		now := time.Unix(1111111109, 0)
+		step, ok := Verify(rfcSecret, "081804", now, 0)
+		So(ok, ShouldBeTrue)
+		So(step, ShouldEqual, Step(now))
+
+		_, ok = Verify(rfcSecret, "081804", now, step)
+		So(ok, ShouldBeFalse)
+
+		_, ok = Verify(strings.ToLower(rfcSecret), "081 804", now.Add(PERIOD*time.Second), 0)
+		So(ok, ShouldBeTrue)
+		_, ok = Verify(rfcSecret, "081804", now.Add(2*PERIOD*time.Second), 0)
+		So(ok, ShouldBeFalse)
+		_, ok = Verify(rfcSecret, "000000", now, 0)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("New secrets work in an otpauth URI", t, func() {
+		secret, err := NewSecret()
+		So(err, ShouldBeNil)
+		So(len(secret), ShouldEqual, 32)
+		now := time.Now()
+		code, _ := Code(secret, Step(now))
+		_, ok := Verify(secret, code, now, 0)
+		So(ok, ShouldBeTrue)
+
+		uri := URI("Gus Co", "jane@example.com", secret)
+		So(uri, ShouldStartWith, "otpauth://totp/Gus%20Co:jane@example.com?")
+		So(uri, ShouldContainSubstring, "secret="+secret)
+		So(uri, ShouldContainSubstring, "issuer=Gus+Co")
+	})
+}
@@ -0,0 +1,131 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// WebAuthn encodes the attestation object and public keys in CBOR (RFC 8949). Only the parts
+// authenticators use are decoded: integers, byte and text strings, arrays, maps, booleans,
+// null and floats. Indefinite lengths and tags are refused.
+//
+// Integers decode to int64, byte strings to []byte, text to string, arrays to []interface{}
+// and maps to map[interface{}]interface{}.
+
+var errCbor = errors.New("cbor: invalid data")
+
+// maximum nesting of arrays and maps
+const cborMaxDepth = 16
+
+// cborDecode decodes the first item in the data and returns it with the bytes that follow it.
+func cborDecode(data []byte) (interface{}, []byte, error) {
+	return cborItem(data, 0)
+}
+
+func cborItem(data []byte, depth int) (interface{}, []byte, error) {
+	if len(data) == 0 || depth > cborMaxDepth {
+		return nil, nil, errCbor
+	}
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	if major == 7 {
+		return cborSimple(info, data)
+	}
+	value, data, err := cborArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0: // Unsigned integer
+		if value > math.MaxInt64 {
+			return nil, nil, errCbor
+		}
+		return int64(value), data, nil
+	case 1: // Negative integer
+		if value > math.MaxInt64 {
+			return nil, nil, errCbor
+		}
+		return -1 - int64(value), data, nil
+	case 2, 3: // Byte and text strings
+		if value > uint64(len(data)) {
+			return nil, nil, errCbor
+		}
+		b := data[:value]
+		if major == 3 {
+			return string(b), data[value:], nil
+		}
+		return append([]byte{}, b...), data[value:], nil
+	case 4: // Array
+		if value > uint64(len(data)) {
+			return nil, nil, errCbor
+		}
+		list := make([]interface{}, 0, value)
+		for i := uint64(0); i < value; i++ {
+			var item interface{}
+			if item, data, err = cborItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			list = append(list, item)
+		}
+		return list, data, nil
+	case 5: // Map
+		if value > uint64(len(data)) {
+			return nil, nil, errCbor
+		}
+		m := make(map[interface{}]interface{}, value)
+		for i := uint64(0); i < value; i++ {
+			var key, item interface{}
+			if key, data, err = cborItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errCbor
+			}
+			if item, data, err = cborItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			m[key] = item
+		}
+		return m, data, nil
+	}
+	return nil, nil, errCbor // Tags
+}
+
+// cborArgument reads the length or value that follows the initial byte
+func cborArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	}
+	return 0, nil, errCbor
+}
+
+func cborSimple(info byte, data []byte) (interface{}, []byte, error) {
+	switch {
+	case info == 20:
+		return false, data, nil
+	case info == 21:
+		return true, data, nil
+	case info == 22 || info == 23:
+		return nil, data, nil
+	case info == 26 && len(data) >= 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[8:], nil
+	}
+	return nil, nil, errCbor
+}
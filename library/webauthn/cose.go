@@ -0,0 +1,113 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	. "github.com/cgentry/gus/ecode"
+	"math/big"
+)
+
+// COSE algorithms (RFC 9053) that can be used by a credential
+const (
+	ALG_ES256 = -7
+	ALG_EDDSA = -8
+	ALG_RS256 = -257
+)
+
+// Algorithms lists the algorithms accepted, most preferred first. It is sent to the browser
+// when a credential is created.
+var Algorithms = []int{ALG_ES256, ALG_EDDSA, ALG_RS256}
+
+// COSE key parameters
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1
+	coseX   = -2 // RSA: the exponent
+	coseY   = -3
+	coseN   = -1 // RSA modulus
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+// ParsePublicKey decodes a COSE public key, as kept with a credential, and returns the key
+// and its algorithm.
+func ParsePublicKey(cose []byte) (crypto.PublicKey, int, error) {
+	item, rest, err := cborDecode(cose)
+	if err != nil || len(rest) != 0 {
+		return nil, 0, ErrPasskeyKey
+	}
+	return publicKey(item)
+}
+
+func publicKey(item interface{}) (crypto.PublicKey, int, error) {
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, ErrPasskeyKey
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == ALG_ES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, ErrPasskeyKey
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, 0, ErrPasskeyKey
+		}
+		return key, ALG_ES256, nil
+
+	case kty == coseKtyOKP && alg == ALG_EDDSA:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, ErrPasskeyKey
+		}
+		return ed25519.PublicKey(x), ALG_EDDSA, nil
+
+	case kty == coseKtyRSA && alg == ALG_RS256:
+		n, _ := m[int64(coseN)].([]byte)
+		e, _ := m[int64(coseX)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, ErrPasskeyKey
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, ALG_RS256, nil
+	}
+	return nil, 0, ErrPasskeyAlgorithm
+}
+
+// verifySignature checks the signature over the message. ES256 signatures are ASN.1 encoded,
+// as the WebAuthn specification requires.
+func verifySignature(public crypto.PublicKey, alg int, message, sig []byte) bool {
+	switch key := public.(type) {
+	case *ecdsa.PublicKey:
+		if alg != ALG_ES256 {
+			return false
+		}
+		sum := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(key, sum[:], sig)
+	case ed25519.PublicKey:
+		return alg == ALG_EDDSA && ed25519.Verify(key, message, sig)
+	case *rsa.PublicKey:
+		if alg != ALG_RS256 {
+			return false
+		}
+		sum := sha256.Sum256(message)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) == nil
+	}
+	return false
+}
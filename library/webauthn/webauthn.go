@@ -0,0 +1,359 @@
+// Package webauthn checks the responses from passkeys (WebAuthn Level 2). It covers the
+// two ceremonies a relying party has to check:
+//
+//	Registration: the browser creates a credential for a challenge and returns the
+//	              client data and an attestation object holding the new public key.
+//	Assertion:    the browser signs a challenge with the credential and returns the
+//	              client data, the authenticator data and the signature.
+//
+// Only the "none" and "packed" attestation formats are accepted. Packed attestation
+// certificates are checked for form but are not chained to a trusted root: gus doesn't
+// restrict which authenticators users may use.
+//
+// The running service uses the relying party set with:
+//
+//	webauthn.Set(config.Passkey)
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"strings"
+	"sync"
+)
+
+// Client data types
+const (
+	TYPE_CREATE = "webauthn.create"
+	TYPE_GET    = "webauthn.get"
+)
+
+// Attestation formats
+const (
+	FORMAT_NONE   = "none"
+	FORMAT_PACKED = "packed"
+)
+
+// Authenticator data flags
+const (
+	FLAG_UP = 0x01 // User present
+	FLAG_UV = 0x04 // User verified
+	FLAG_AT = 0x40 // Attested credential data included
+	FLAG_ED = 0x80 // Extension data included
+)
+
+// The attestation certificate extension holding the authenticator's AAGUID
+var oidAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// RelyingParty is the site the passkeys belong to.
+type RelyingParty struct {
+	Id               string   // The domain, e.g. example.com
+	Name             string   // Shown to the user when a passkey is created
+	Origins          []string // Where responses may come from, e.g. https://login.example.com
+	UserVerification bool     // Require the authenticator to verify the user (PIN, biometric)
+}
+
+// Credential is a newly registered passkey
+type Credential struct {
+	Id           []byte
+	PublicKey    []byte // COSE encoded
+	Algorithm    int
+	SignCount    uint32
+	AAGUID       []byte
+	Format       string // Attestation format
+	UserVerified bool
+}
+
+// clientData is the JSON the browser builds and the authenticator signs (by hash)
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// authData is the decoded authenticator data
+type authData struct {
+	RPIdHash  []byte
+	Flags     byte
+	SignCount uint32
+
+	AAGUID       []byte
+	CredentialId []byte
+	PublicKey    []byte
+}
+
+// NewRelyingParty creates the relying party from the configuration. With no id,
+// nil is returned: passkeys are turned off.
+func NewRelyingParty(c configure.Passkey) *RelyingParty {
+	if c.RPId == "" {
+		return nil
+	}
+	rp := &RelyingParty{Id: c.RPId, Name: c.RPName, UserVerification: c.UserVerification}
+	if rp.Name == "" {
+		rp.Name = rp.Id
+	}
+	for _, origin := range strings.Split(c.Origins, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			rp.Origins = append(rp.Origins, origin)
+		}
+	}
+	if len(rp.Origins) == 0 {
+		rp.Origins = []string{"https://" + rp.Id}
+	}
+	return rp
+}
+
+// VerifyRegistration checks the response to a registration challenge and returns the
+// new credential.
+func (rp *RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.checkClientData(TYPE_CREATE, challenge, clientDataJSON); err != nil {
+		return nil, err
+	}
+	item, rest, err := cborDecode(attestationObject)
+	obj, ok := item.(map[interface{}]interface{})
+	if err != nil || len(rest) != 0 || !ok {
+		return nil, ErrPasskeyResponse
+	}
+	format, _ := obj["fmt"].(string)
+	stmt, _ := obj["attStmt"].(map[interface{}]interface{})
+	raw, _ := obj["authData"].([]byte)
+	if stmt == nil {
+		return nil, ErrPasskeyResponse
+	}
+
+	data, err := parseAuthData(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err = rp.checkAuthData(data); err != nil {
+		return nil, err
+	}
+	if data.CredentialId == nil {
+		return nil, ErrPasskeyResponse
+	}
+	public, alg, err := ParsePublicKey(data.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, raw...), hash[:]...)
+	switch format {
+	case FORMAT_NONE:
+		if len(stmt) != 0 {
+			return nil, ErrPasskeyAttestation
+		}
+	case FORMAT_PACKED:
+		if err = verifyPacked(stmt, signed, data.AAGUID, public, alg); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrPasskeyFormat
+	}
+
+	return &Credential{
+		Id:           data.CredentialId,
+		PublicKey:    data.PublicKey,
+		Algorithm:    alg,
+		SignCount:    data.SignCount,
+		AAGUID:       data.AAGUID,
+		Format:       format,
+		UserVerified: data.Flags&FLAG_UV != 0,
+	}, nil
+}
+
+// VerifyAssertion checks the response to a login challenge against the stored credential.
+// The new signature count is returned and must be saved. If the authenticator keeps a count
+// and it hasn't gone up, the passkey may have been copied and ErrPasskeyCloned is returned.
+func (rp *RelyingParty) VerifyAssertion(challenge string, publicKey []byte, signCount uint32,
+	clientDataJSON, authenticatorData, signature []byte) (uint32, error) {
+
+	if err := rp.checkClientData(TYPE_GET, challenge, clientDataJSON); err != nil {
+		return 0, err
+	}
+	data, err := parseAuthData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err = rp.checkAuthData(data); err != nil {
+		return 0, err
+	}
+	public, alg, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	hash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), hash[:]...)
+	if !verifySignature(public, alg, signed, signature) {
+		return 0, ErrPasskeySignature
+	}
+	if (data.SignCount != 0 || signCount != 0) && data.SignCount <= signCount {
+		return 0, ErrPasskeyCloned
+	}
+	return data.SignCount, nil
+}
+
+// checkClientData makes sure the client data is for this ceremony, challenge and site.
+func (rp *RelyingParty) checkClientData(ceremony, challenge string, raw []byte) error {
+	cd := clientData{}
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return ErrPasskeyResponse
+	}
+	if cd.Type != ceremony {
+		return ErrPasskeyResponse
+	}
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(challenge)) != 1 {
+		return ErrPasskeyChallenge
+	}
+	if cd.CrossOrigin {
+		return ErrPasskeyOrigin
+	}
+	for _, origin := range rp.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return ErrPasskeyOrigin
+}
+
+// checkAuthData makes sure the authenticator was used for this site and the user was there.
+func (rp *RelyingParty) checkAuthData(data *authData) error {
+	want := sha256.Sum256([]byte(rp.Id))
+	if subtle.ConstantTimeCompare(data.RPIdHash, want[:]) != 1 {
+		return ErrPasskeyOrigin
+	}
+	if data.Flags&FLAG_UP == 0 {
+		return ErrPasskeyUser
+	}
+	if rp.UserVerification && data.Flags&FLAG_UV == 0 {
+		return ErrPasskeyUser
+	}
+	return nil
+}
+
+// parseAuthData splits up the authenticator data. The credential is only present when
+// a passkey is registered.
+func parseAuthData(raw []byte) (*authData, error) {
+	if len(raw) < 37 {
+		return nil, ErrPasskeyResponse
+	}
+	data := &authData{
+		RPIdHash:  raw[:32],
+		Flags:     raw[32],
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[37:]
+	if data.Flags&FLAG_AT != 0 {
+		if len(rest) < 18 {
+			return nil, ErrPasskeyResponse
+		}
+		data.AAGUID = rest[:16]
+		size := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if size == 0 || size > 1023 || len(rest) < size {
+			return nil, ErrPasskeyResponse
+		}
+		data.CredentialId = rest[:size]
+		rest = rest[size:]
+
+		_, after, err := cborDecode(rest)
+		if err != nil {
+			return nil, ErrPasskeyResponse
+		}
+		data.PublicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if data.Flags&FLAG_ED != 0 {
+		_, after, err := cborDecode(rest)
+		if err != nil {
+			return nil, ErrPasskeyResponse
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, ErrPasskeyResponse
+	}
+	return data, nil
+}
+
+// verifyPacked checks a "packed" attestation statement. Without a certificate the credential
+// signs for itself; with one, the certificate's key must have made the signature.
+func verifyPacked(stmt map[interface{}]interface{}, signed, aaguid []byte, public crypto.PublicKey, credAlg int) error {
+	alg, ok := stmt["alg"].(int64)
+	sig, _ := stmt["sig"].([]byte)
+	if !ok || sig == nil {
+		return ErrPasskeyAttestation
+	}
+	x5c, hasCert := stmt["x5c"].([]interface{})
+	if !hasCert {
+		if int(alg) != credAlg || !verifySignature(public, credAlg, signed, sig) {
+			return ErrPasskeyAttestation
+		}
+		return nil
+	}
+
+	if len(x5c) == 0 {
+		return ErrPasskeyAttestation
+	}
+	der, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil || cert.Version != 3 || cert.IsCA {
+		return ErrPasskeyAttestation
+	}
+	if !verifySignature(cert.PublicKey, int(alg), signed, sig) {
+		return ErrPasskeyAttestation
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidAAGUID) {
+			var value []byte
+			if _, err = asn1.Unmarshal(ext.Value, &value); err != nil || !bytes.Equal(value, aaguid) {
+				return ErrPasskeyAttestation
+			}
+		}
+	}
+	return nil
+}
+
+// DecodeBase64 decodes a value sent by a browser. Base64url, with or without padding, is
+// normal but standard base64 is also accepted.
+func DecodeBase64(value string) ([]byte, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "=")
+	if strings.ContainsAny(value, "+/") {
+		return base64.RawStdEncoding.DecodeString(value)
+	}
+	return base64.RawURLEncoding.DecodeString(value)
+}
+
+// EncodeBase64 encodes a value for a browser
+func EncodeBase64(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+var current struct {
+	sync.RWMutex
+	rp *RelyingParty
+}
+
+// Set the relying party used by the service from the configuration
+func Set(c configure.Passkey) {
+	current.Lock()
+	current.rp = NewRelyingParty(c)
+	current.Unlock()
+}
+
+// Get the relying party used by the service. If passkeys are turned off, nil is returned.
+func Get() *RelyingParty {
+	current.RLock()
+	defer current.RUnlock()
+	return current.rp
+}
@@ -0,0 +1,212 @@
+package webauthn_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/webauthn"
+	"github.com/cgentry/gus/library/webauthn/webauthntest"
+	"github.com/cgentry/gus/record/configure"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	testRP     = "example.com"
+	testOrigin = "https://login.example.com"
+)
+
+func testParty() *webauthn.RelyingParty {
+	return webauthn.NewRelyingParty(configure.Passkey{RPId: testRP, Origins: testOrigin + "/, https://example.com"})
+}
+
+func TestRelyingParty(t *testing.T) {
+	Convey("Passkeys are off without a site", t, func() {
+		So(webauthn.NewRelyingParty(configure.Passkey{}), ShouldBeNil)
+		rp := webauthn.NewRelyingParty(configure.Passkey{RPId: testRP})
+		So(rp.Name, ShouldEqual, testRP)
+		So(rp.Origins, ShouldResemble, []string{"https://example.com"})
+		So(testParty().Origins, ShouldResemble, []string{testOrigin, "https://example.com"})
+	})
+}
+
+func TestRegistration(t *testing.T) {
+	for _, format := range []string{webauthn.FORMAT_NONE, webauthn.FORMAT_PACKED} {
+		Convey("A '"+format+"' registration gives the credential", t, func() {
+			rp := testParty()
+			key := webauthntest.New(testRP, testOrigin)
+			key.Format = format
+			clientData, attestation := key.Register("challenge")
+
+			cred, err := rp.VerifyRegistration("challenge", clientData, attestation)
+			So(err, ShouldBeNil)
+			So(cred.Id, ShouldResemble, key.Id)
+			So(cred.Algorithm, ShouldEqual, webauthn.ALG_ES256)
+			So(cred.Format, ShouldEqual, format)
+			So(cred.UserVerified, ShouldBeTrue)
+
+			public, alg, err := webauthn.ParsePublicKey(cred.PublicKey)
+			So(err, ShouldBeNil)
+			So(alg, ShouldEqual, webauthn.ALG_ES256)
+			So(public.(*ecdsa.PublicKey).Equal(key.Key.Public()), ShouldBeTrue)
+		})
+	}
+
+	Convey("Registrations are checked", t, func() {
+		rp := testParty()
+		key := webauthntest.New(testRP, testOrigin)
+		clientData, attestation := key.Register("challenge")
+
+		_, err := rp.VerifyRegistration("other", clientData, attestation)
+		So(err, ShouldEqual, ErrPasskeyChallenge)
+		_, err = rp.VerifyRegistration("challenge", clientData, attestation[:len(attestation)-1])
+		So(err, ShouldEqual, ErrPasskeyResponse)
+
+		evil := webauthntest.New(testRP, "https://evil.example.net")
+		clientData, attestation = evil.Register("challenge")
+		_, err = rp.VerifyRegistration("challenge", clientData, attestation)
+		So(err, ShouldEqual, ErrPasskeyOrigin)
+
+		other := webauthntest.New("other.com", testOrigin)
+		clientData, attestation = other.Register("challenge")
+		_, err = rp.VerifyRegistration("challenge", clientData, attestation)
+		So(err, ShouldEqual, ErrPasskeyOrigin)
+
+		key.Flags = webauthn.FLAG_UP
+		clientData, attestation = key.Register("challenge")
+		_, err = rp.VerifyRegistration("challenge", clientData, attestation)
+		So(err, ShouldBeNil)
+		rp.UserVerification = true
+		_, err = rp.VerifyRegistration("challenge", clientData, attestation)
+		So(err, ShouldEqual, ErrPasskeyUser)
+
+		key.Format = "tpm"
+		clientData, attestation = key.Register("challenge")
+		_, err = rp.VerifyRegistration("challenge", key.ClientData(webauthn.TYPE_CREATE, "challenge"), attestation)
+		So(err, ShouldEqual, ErrPasskeyUser)
+		rp.UserVerification = false
+		_, err = rp.VerifyRegistration("challenge", clientData, attestation)
+		So(err, ShouldEqual, ErrPasskeyFormat)
+
+		_, err = rp.VerifyRegistration("challenge", key.ClientData(webauthn.TYPE_GET, "challenge"), attestation)
+		So(err, ShouldEqual, ErrPasskeyResponse)
+	})
+
+	Convey("Packed attestation can be signed by a certificate", t, func() {
+		rp := testParty()
+		key := webauthntest.New(testRP, testOrigin)
+		clientData, attestation := key.Register("challenge")
+		authData := authDataFrom(attestation)
+
+		attKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		hash := sha256.Sum256(clientData)
+		sum := sha256.Sum256(append(append([]byte{}, authData...), hash[:]...))
+		sig, _ := ecdsa.SignASN1(rand.Reader, attKey, sum[:])
+		packed := func(aaguid []byte) []byte {
+			cert := attestationCert(attKey, aaguid)
+			stmt := webauthntest.Map{
+				{Key: "alg", Value: webauthn.ALG_ES256},
+				{Key: "sig", Value: sig},
+				{Key: "x5c", Value: []interface{}{cert}},
+			}
+			return webauthntest.Encode(webauthntest.Map{
+				{Key: "fmt", Value: webauthn.FORMAT_PACKED},
+				{Key: "attStmt", Value: stmt},
+				{Key: "authData", Value: authData},
+			})
+		}
+
+		_, err := rp.VerifyRegistration("challenge", clientData, packed(make([]byte, 16)))
+		So(err, ShouldBeNil)
+		_, err = rp.VerifyRegistration("challenge", clientData, packed([]byte("0123456789abcdef")))
+		So(err, ShouldEqual, ErrPasskeyAttestation)
+	})
+}
+
+func TestAssertion(t *testing.T) {
+	Convey("Logins are signed by the registered key", t, func() {
+		rp := testParty()
+		key := webauthntest.New(testRP, testOrigin)
+		clientData, attestation := key.Register("challenge")
+		cred, _ := rp.VerifyRegistration("challenge", clientData, attestation)
+
+		clientData, authData, sig := key.Assert("login")
+		count, err := rp.VerifyAssertion("login", cred.PublicKey, cred.SignCount, clientData, authData, sig)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+
+		_, err = rp.VerifyAssertion("login", cred.PublicKey, count, clientData, authData, sig)
+		So(err, ShouldEqual, ErrPasskeyCloned)
+		_, err = rp.VerifyAssertion("other", cred.PublicKey, 0, clientData, authData, sig)
+		So(err, ShouldEqual, ErrPasskeyChallenge)
+
+		sig[len(sig)-1] ^= 1
+		_, err = rp.VerifyAssertion("login", cred.PublicKey, 0, clientData, authData, sig)
+		So(err, ShouldEqual, ErrPasskeySignature)
+
+		other := webauthntest.New(testRP, testOrigin)
+		clientData, authData, sig = other.Assert("login")
+		_, err = rp.VerifyAssertion("login", cred.PublicKey, 0, clientData, authData, sig)
+		So(err, ShouldEqual, ErrPasskeySignature)
+
+		key.Count = 0
+		key.Flags = 0
+		clientData, authData, sig = key.Assert("login")
+		_, err = rp.VerifyAssertion("login", cred.PublicKey, 0, clientData, authData, sig)
+		So(err, ShouldEqual, ErrPasskeyUser)
+	})
+}
+
+func TestBase64(t *testing.T) {
+	Convey("Browser values decode with or without padding", t, func() {
+		for _, value := range []string{"-_8", "-_8=", "+/8="} {
+			b, err := webauthn.DecodeBase64(value)
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, []byte{0xfb, 0xff})
+		}
+		So(webauthn.EncodeBase64([]byte{0xfb, 0xff}), ShouldEqual, "-_8")
+	})
+}
+
+// authDataFrom pulls the authenticator data out of a 'none' attestation object. The data is
+// the last entry in the map, so it runs to the end of the object.
+func authDataFrom(attestation []byte) []byte {
+	marker := webauthntest.Encode("authData")
+	for i := len(attestation) - len(marker); i >= 0; i-- {
+		if string(attestation[i:i+len(marker)]) == string(marker) {
+			rest := attestation[i+len(marker):]
+			switch rest[0] & 0x1f {
+			case 24:
+				return rest[2:]
+			case 25:
+				return rest[3:]
+			}
+		}
+	}
+	return nil
+}
+
+func attestationCert(key *ecdsa.PrivateKey, aaguid []byte) []byte {
+	value, _ := asn1.Marshal(aaguid)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{OrganizationalUnit: []string{"Authenticator Attestation"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		ExtraExtensions:       []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}, Value: value}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err.Error())
+	}
+	return der
+}
@@ -0,0 +1,166 @@
+// Package webauthntest provides a software passkey for tests. It answers registration and
+// login challenges the way a browser and authenticator would, using an ES256 key.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/cgentry/gus/library/webauthn"
+)
+
+// Authenticator is a single software passkey
+type Authenticator struct {
+	RPId   string
+	Origin string
+	Format string // webauthn.FORMAT_NONE or webauthn.FORMAT_PACKED (self attestation)
+	Flags  byte   // Authenticator data flags. Defaults to user present and verified
+	Count  uint32 // Signature counter. Each login adds one
+
+	Id  []byte // Credential id
+	Key *ecdsa.PrivateKey
+}
+
+// New creates a passkey for the site
+func New(rpId, origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err.Error())
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &Authenticator{
+		RPId:   rpId,
+		Origin: origin,
+		Format: webauthn.FORMAT_NONE,
+		Flags:  webauthn.FLAG_UP | webauthn.FLAG_UV,
+		Id:     id,
+		Key:    key,
+	}
+}
+
+// CredentialId returns the credential id as the browser sends it
+func (a *Authenticator) CredentialId() string {
+	return webauthn.EncodeBase64(a.Id)
+}
+
+// ClientData returns the client data JSON the browser would build
+func (a *Authenticator) ClientData(ceremony, challenge string) []byte {
+	b, _ := json.Marshal(map[string]interface{}{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    a.Origin,
+	})
+	return b
+}
+
+// Register answers a registration challenge. It returns the client data and attestation object.
+func (a *Authenticator) Register(challenge string) (clientDataJSON, attestationObject []byte) {
+	clientDataJSON = a.ClientData(webauthn.TYPE_CREATE, challenge)
+
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.Key.X.FillBytes(x)
+	a.Key.Y.FillBytes(y)
+	cose := Encode(Map{{1, 2}, {3, webauthn.ALG_ES256}, {-1, 1}, {-2, x}, {-3, y}})
+
+	attested := make([]byte, 18, 18+len(a.Id)+len(cose))
+	binary.BigEndian.PutUint16(attested[16:], uint16(len(a.Id))) // Zero AAGUID
+	attested = append(append(attested, a.Id...), cose...)
+	authData := a.authData(a.Flags|webauthn.FLAG_AT, attested)
+
+	stmt := Map{}
+	if a.Format == webauthn.FORMAT_PACKED {
+		stmt = Map{{"alg", webauthn.ALG_ES256}, {"sig", a.sign(authData, clientDataJSON)}}
+	}
+	attestationObject = Encode(Map{{"fmt", a.Format}, {"attStmt", stmt}, {"authData", authData}})
+	return
+}
+
+// Assert answers a login challenge. It returns the client data, authenticator data and signature.
+func (a *Authenticator) Assert(challenge string) (clientDataJSON, authenticatorData, signature []byte) {
+	a.Count++
+	clientDataJSON = a.ClientData(webauthn.TYPE_GET, challenge)
+	authenticatorData = a.authData(a.Flags, nil)
+	signature = a.sign(authenticatorData, clientDataJSON)
+	return
+}
+
+func (a *Authenticator) authData(flags byte, attested []byte) []byte {
+	hash := sha256.Sum256([]byte(a.RPId))
+	data := append(hash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.Count)
+	return append(data, attested...)
+}
+
+func (a *Authenticator) sign(authData, clientDataJSON []byte) []byte {
+	hash := sha256.Sum256(clientDataJSON)
+	sum := sha256.Sum256(append(append([]byte{}, authData...), hash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.Key, sum[:])
+	if err != nil {
+		panic(err.Error())
+	}
+	return sig
+}
+
+// Map is a CBOR map that keeps its keys in order
+type Map []Pair
+
+// Pair is a single map entry
+type Pair struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// Encode a value as CBOR. Only the types used by authenticators are handled: int, []byte,
+// string, []interface{} and Map.
+func Encode(v interface{}) []byte {
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []interface{}:
+		b := head(4, uint64(len(v)))
+		for _, item := range v {
+			b = append(b, Encode(item)...)
+		}
+		return b
+	case Map:
+		b := head(5, uint64(len(v)))
+		for _, pair := range v {
+			b = append(append(b, Encode(pair.Key)...), Encode(pair.Value)...)
+		}
+		return b
+	}
+	panic("webauthntest: can't encode value")
+}
+
+func head(major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return []byte{major | byte(n)}
+	case n < 1<<8:
+		return []byte{major | 24, byte(n)}
+	case n < 1<<16:
+		b := []byte{major | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		return b
+	case n < 1<<32:
+		b := []byte{major | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		return b
+	}
+	b := []byte{major | 27, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(b[1:], n)
+	return b
+}
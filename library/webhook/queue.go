@@ -0,0 +1,217 @@
+package webhook
+
+import (
+	"encoding/json"
+	. "github.com/cgentry/gus/ecode"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Delivery is one event waiting to be sent to one hook. Once it has been tried too many times it
+// is moved to the dead-letter list, where it stays until it is retried with 'gus webhook retry'.
+type Delivery struct {
+	Id        string
+	Hook      string
+	Event     Event
+	Attempts  int
+	NextAt    time.Time // When it is next sent. Zero once it is dead
+	LastError string    `json:",omitempty"`
+	CreatedAt time.Time
+	DeadAt    time.Time `json:",omitempty"`
+}
+
+// IsDead is true when the delivery is on the dead-letter list
+func (d *Delivery) IsDead() bool {
+	return !d.DeadAt.IsZero()
+}
+
+// Queue holds the deliveries. When it has a file, the file is read before and written after
+// every change, so the running service and 'gus webhook' see each other's changes.
+type Queue struct {
+	mu   sync.Mutex
+	file string
+
+	Pending []*Delivery
+	Dead    []*Delivery
+}
+
+// OpenQueue reads the queue from the file. A missing file is an empty queue. When the file name
+// is blank, the queue is only kept in memory.
+func OpenQueue(file string) (*Queue, error) {
+	q := &Queue{file: file}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *Queue) load() error {
+	if q.file == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(q.file)
+	if os.IsNotExist(err) {
+		q.Pending, q.Dead = nil, nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	q.Pending, q.Dead = nil, nil
+	return json.Unmarshal(b, q)
+}
+
+// save writes the queue to a temporary file and renames it, so the file is never half written.
+func (q *Queue) save() error {
+	if q.file == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	fp, err := ioutil.TempFile(filepath.Dir(q.file), filepath.Base(q.file)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmp := fp.Name()
+	if _, err = fp.Write(b); err == nil {
+		err = fp.Close()
+	} else {
+		fp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp, q.file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// Add puts new deliveries on the end of the queue
+func (q *Queue) Add(list ...*Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.load(); err != nil {
+		return err
+	}
+	q.Pending = append(q.Pending, list...)
+	return q.save()
+}
+
+// Due returns copies of the pending deliveries that should be sent now
+func (q *Queue) Due(now time.Time) ([]Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	var due []Delivery
+	for _, d := range q.Pending {
+		if !now.Before(d.NextAt) {
+			due = append(due, *d)
+		}
+	}
+	return due, nil
+}
+
+// List returns copies of the pending deliveries followed by the dead ones
+func (q *Queue) List() ([]Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	list := make([]Delivery, 0, len(q.Pending)+len(q.Dead))
+	for _, d := range q.Pending {
+		list = append(list, *d)
+	}
+	for _, d := range q.Dead {
+		list = append(list, *d)
+	}
+	return list, nil
+}
+
+// done records the results of sending deliveries. Sent ones are removed; failed ones are tried
+// again after the backoff, which doubles each time, or are moved to the dead-letter list once they
+// have been tried maxTries times.
+func (q *Queue) done(now time.Time, results map[string]error, maxTries int, backoff time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.load(); err != nil {
+		return err
+	}
+	pending := q.Pending[:0]
+	for _, d := range q.Pending {
+		err, ok := results[d.Id]
+		switch {
+		case !ok:
+			pending = append(pending, d)
+		case err == nil:
+			// Sent: drop it
+		default:
+			d.Attempts++
+			d.LastError = err.Error()
+			if d.Attempts >= maxTries {
+				d.NextAt = time.Time{}
+				d.DeadAt = now
+				q.Dead = append(q.Dead, d)
+			} else {
+				d.NextAt = now.Add(retryAfter(backoff, d.Attempts))
+				pending = append(pending, d)
+			}
+		}
+	}
+	q.Pending = pending
+	return q.save()
+}
+
+// Retry moves a dead delivery back to the pending list so it is sent straight away. A blank id
+// retries every dead delivery. A pending delivery is sent straight away rather than waiting.
+func (q *Queue) Retry(id string, now time.Time) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.load(); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, d := range q.Pending {
+		if d.Id == id {
+			d.NextAt = now
+			count++
+		}
+	}
+	dead := q.Dead[:0]
+	for _, d := range q.Dead {
+		if id == "" || d.Id == id {
+			d.Attempts = 0
+			d.NextAt = now
+			d.DeadAt = time.Time{}
+			q.Pending = append(q.Pending, d)
+			count++
+		} else {
+			dead = append(dead, d)
+		}
+	}
+	q.Dead = dead
+	if id != "" && count == 0 {
+		return 0, ErrDeliveryNotFound
+	}
+	return count, q.save()
+}
+
+// retryAfter doubles the backoff for each failed attempt, up to an hour.
+func retryAfter(backoff time.Duration, attempts int) time.Duration {
+	wait := backoff
+	for i := 1; i < attempts && wait < time.Hour; i++ {
+		wait *= 2
+	}
+	if wait > time.Hour {
+		wait = time.Hour
+	}
+	return wait
+}
@@ -0,0 +1,353 @@
+// Package webhook tells other services when something happens to a user: they register, change
+// their email address, are disabled or log out. Each event is POSTed as JSON to the address of
+// every hook that wants it.
+//
+// The event is sent inside a standard gus package, signed in the same way as the service's
+// responses: the head holds a base64 HMAC-SHA256 of the body, made with the hook's secret (and
+// a key signature, if signing keys are in use). A receiver checks it with Open.
+//
+// Events are put on a queue before they are sent, so an event isn't lost when a service is down.
+// Failed deliveries are retried with an exponential backoff; after too many tries they are moved
+// to a dead-letter list. The running service sets the hooks up with:
+//
+//	err := webhook.Set( c.Webhook )
+//	go webhook.Get().Run( stop )
+//
+// When there are no hooks, Get returns nil and no events are sent.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record"
+	"github.com/cgentry/gus/record/configure"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	EVENT_REGISTER = "user.register" // A new user has registered
+	EVENT_EMAIL    = "user.email"    // The user changed their email address
+	EVENT_DISABLE  = "user.disable"  // The user was turned off
+	EVENT_LOGOUT   = "user.logout"   // The user logged out of their last session
+	EVENT_TEST     = "test"          // Sent by 'gus webhook test'. Never queued
+)
+
+// BODY_TYPE is the body type of the package each event is sent in
+const BODY_TYPE = "Event"
+
+// Default settings, used when the configuration value is zero
+const (
+	DEFAULT_RETRIES = 8
+	DEFAULT_BACKOFF = 30 * time.Second
+	DEFAULT_TIMEOUT = 10 * time.Second
+	POLL_INTERVAL   = 5 * time.Second
+)
+
+// Event is the body of each webhook package
+type Event struct {
+	Id       string // Unique for each event. A receiver can use it to ignore an event sent twice
+	Type     string
+	Time     time.Time
+	Domain   string
+	Guid     string
+	Login    string `json:",omitempty"`
+	Email    string `json:",omitempty"`
+	OldEmail string `json:",omitempty"` // For an email change, the address it was changed from
+}
+
+// Events returns the event types that hooks can ask for
+func Events() []string {
+	return []string{EVENT_REGISTER, EVENT_EMAIL, EVENT_DISABLE, EVENT_LOGOUT}
+}
+
+// Hook is a service that is sent events
+type Hook struct {
+	Name   string
+	Url    string
+	secret []byte
+	events map[string]bool // Nil sends every event
+}
+
+// Wants is true when the hook is sent events of this type
+func (h *Hook) Wants(eventType string) bool {
+	return h.events == nil || h.events[eventType]
+}
+
+// Events returns the event types the hook asked for. An empty list means every event.
+func (h *Hook) Events() []string {
+	var list []string
+	for _, event := range Events() {
+		if h.events[event] {
+			list = append(list, event)
+		}
+	}
+	return list
+}
+
+// Webhooks sends the events to the hooks, through the queue
+type Webhooks struct {
+	hooks   map[string]*Hook
+	queue   *Queue
+	retries int
+	backoff time.Duration
+	client  *http.Client
+	kick    chan struct{}
+}
+
+// New creates the webhooks from the configuration and opens the queue. If there are no hooks,
+// nil is returned: events are turned off.
+func New(c configure.Webhook) (*Webhooks, error) {
+	if len(c.Hooks) == 0 {
+		return nil, nil
+	}
+	w := &Webhooks{
+		hooks:   make(map[string]*Hook),
+		retries: DEFAULT_RETRIES,
+		backoff: DEFAULT_BACKOFF,
+		client:  &http.Client{Timeout: DEFAULT_TIMEOUT},
+		kick:    make(chan struct{}, 1),
+	}
+	if c.Retries > 0 {
+		w.retries = c.Retries
+	}
+	if c.Backoff > 0 {
+		w.backoff = time.Duration(c.Backoff) * time.Second
+	}
+	if c.Timeout > 0 {
+		w.client.Timeout = time.Duration(c.Timeout) * time.Second
+	}
+	for name, hc := range c.Hooks {
+		u, err := url.Parse(hc.Url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || hc.Secret == "" {
+			return nil, ErrWebhookConfig
+		}
+		hook := &Hook{Name: name, Url: hc.Url, secret: []byte(hc.Secret)}
+		if events := strings.TrimSpace(hc.Events); events != "" {
+			hook.events = make(map[string]bool)
+			for _, event := range strings.Split(events, ",") {
+				event = strings.ToLower(strings.TrimSpace(event))
+				if !isEvent(event) {
+					return nil, ErrWebhookEvent
+				}
+				hook.events[event] = true
+			}
+		}
+		w.hooks[name] = hook
+	}
+	var err error
+	if w.queue, err = OpenQueue(c.Queue); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func isEvent(eventType string) bool {
+	for _, event := range Events() {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Hooks returns the hooks, sorted by name
+func (w *Webhooks) Hooks() []*Hook {
+	list := make([]*Hook, 0, len(w.hooks))
+	for _, hook := range w.hooks {
+		list = append(list, hook)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Queue returns the queue the deliveries are kept in
+func (w *Webhooks) Queue() *Queue {
+	return w.queue
+}
+
+// Fire queues the event for every hook that wants it. The event's id, type and time are filled
+// in. If Run is going, the event is sent straight away.
+func (w *Webhooks) Fire(eventType string, e Event) error {
+	if !isEvent(eventType) {
+		return ErrWebhookEvent
+	}
+	now := time.Now()
+	e.Id = newId()
+	e.Type = eventType
+	e.Time = now
+
+	var list []*Delivery
+	for _, hook := range w.Hooks() {
+		if hook.Wants(eventType) {
+			list = append(list, &Delivery{Id: newId(), Hook: hook.Name, Event: e, NextAt: now, CreatedAt: now})
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	if err := w.queue.Add(list...); err != nil {
+		return err
+	}
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Deliver sends every delivery that is due and records the results. It returns how many were
+// sent and how many failed.
+func (w *Webhooks) Deliver(now time.Time) (sent, failed int, err error) {
+	due, err := w.queue.Due(now)
+	if err != nil || len(due) == 0 {
+		return 0, 0, err
+	}
+	results := make(map[string]error)
+	for i := range due {
+		hook, ok := w.hooks[due[i].Hook]
+		if !ok {
+			results[due[i].Id] = ErrWebhookUnknown
+		} else {
+			results[due[i].Id] = w.post(hook, &due[i].Event)
+		}
+		if results[due[i].Id] == nil {
+			sent++
+		} else {
+			failed++
+		}
+	}
+	return sent, failed, w.queue.done(now, results, w.retries, w.backoff)
+}
+
+// Run delivers events until stop is closed. New events are sent as soon as they are fired;
+// failed ones are retried when they are due.
+func (w *Webhooks) Run(stop <-chan struct{}) {
+	tick := time.NewTicker(POLL_INTERVAL)
+	defer tick.Stop()
+	for {
+		w.Deliver(time.Now())
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+		case <-w.kick:
+		}
+	}
+}
+
+// Test sends a test event straight to the hook, without using the queue.
+func (w *Webhooks) Test(name string) error {
+	hook, ok := w.hooks[name]
+	if !ok {
+		return ErrWebhookUnknown
+	}
+	return w.post(hook, &Event{Id: newId(), Type: EVENT_TEST, Time: time.Now()})
+}
+
+// post sends one event to the hook. Only a 2xx reply means it was received.
+func (w *Webhooks) post(hook *Hook, e *Event) error {
+	body, err := Pack(hook.Name, hook.secret, e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gus-Event", e.Type)
+	req.Header.Set("X-Gus-Event-Id", e.Id)
+
+	rsp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	io.Copy(ioutil.Discard, rsp.Body) // Let the connection be used again
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return NewGeneralError(ErrWebhookFailed.Error()+": "+rsp.Status, ErrWebhookFailed.Code())
+	}
+	return nil
+}
+
+// Pack puts the event into a package, signed with the secret, and returns the JSON to send.
+// The package head's Id is the hook name and its Domain the user's domain.
+func Pack(name string, secret []byte, e *Event) ([]byte, error) {
+	p := record.NewPackage()
+	if err := p.SetBodyMarshal(e); err != nil {
+		return nil, err
+	}
+	p.SetBodyType(BODY_TYPE)
+	p.GetHead().SetId(name)
+	p.GetHead().SetDomain(e.Domain)
+	p.SetSecret(secret)
+	record.SignPackage(p)
+	return json.Marshal(p)
+}
+
+// Open checks the signature of a package sent to a hook and returns the event inside it.
+// Receivers written in Go can use this rather than checking the signature themselves.
+func Open(body []byte, secret []byte) (*Event, error) {
+	p := record.NewPackage()
+	if err := json.Unmarshal(body, p); err != nil {
+		return nil, ErrBadPackage
+	}
+	sig, err := p.GetHead().GetSignature()
+	if err != nil || len(secret) == 0 {
+		return nil, ErrWebhookSignature
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(p.GetBody()))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrWebhookSignature
+	}
+	e := &Event{}
+	if err = json.Unmarshal([]byte(p.GetBody()), e); err != nil {
+		return nil, ErrBadBody
+	}
+	return e, nil
+}
+
+func newId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var current struct {
+	sync.RWMutex
+	webhooks *Webhooks
+}
+
+// Set will turn webhooks on (or off, when there are no hooks) using the configuration.
+// The current webhooks are not changed if there is an error.
+func Set(c configure.Webhook) error {
+	w, err := New(c)
+	if err != nil {
+		return err
+	}
+	current.Lock()
+	current.webhooks = w
+	current.Unlock()
+	return nil
+}
+
+// Get returns the current webhooks. If there are no hooks, nil is returned.
+func Get() *Webhooks {
+	current.RLock()
+	defer current.RUnlock()
+	return current.webhooks
+}
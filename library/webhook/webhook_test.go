@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a hook that records the events it is sent
+type receiver struct {
+	sync.Mutex
+	secret string
+	status int
+	events []*Event
+	errs   []error
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+	body, _ := ioutil.ReadAll(req.Body)
+	e, err := Open(body, []byte(r.secret))
+	if err != nil {
+		r.errs = append(r.errs, err)
+	} else {
+		r.events = append(r.events, e)
+	}
+	w.WriteHeader(r.status)
+}
+
+func TestNew(t *testing.T) {
+	Convey("Hooks need an address and a secret", t, func() {
+		w, err := New(configure.Webhook{})
+		So(err, ShouldBeNil)
+		So(w, ShouldBeNil)
+
+		_, err = New(configure.Webhook{Hooks: map[string]configure.WebhookHook{"a": {Url: "https://example.com/"}}})
+		So(err, ShouldEqual, ErrWebhookConfig)
+		_, err = New(configure.Webhook{Hooks: map[string]configure.WebhookHook{"a": {Url: "ftp://example.com/", Secret: "s"}}})
+		So(err, ShouldEqual, ErrWebhookConfig)
+		_, err = New(configure.Webhook{Hooks: map[string]configure.WebhookHook{"a": {Url: "https://example.com/", Secret: "s", Events: "user.register,user.nothing"}}})
+		So(err, ShouldEqual, ErrWebhookEvent)
+
+		w, err = New(configure.Webhook{Hooks: map[string]configure.WebhookHook{
+			"b": {Url: "https://b.example.com/", Secret: "s"},
+			"a": {Url: "https://a.example.com/", Secret: "s", Events: "User.Register, user.logout"},
+		}})
+		So(err, ShouldBeNil)
+		hooks := w.Hooks()
+		So(len(hooks), ShouldEqual, 2)
+		So(hooks[0].Name, ShouldEqual, "a")
+		So(hooks[0].Wants(EVENT_REGISTER), ShouldBeTrue)
+		So(hooks[0].Wants(EVENT_EMAIL), ShouldBeFalse)
+		So(hooks[0].Events(), ShouldResemble, []string{EVENT_REGISTER, EVENT_LOGOUT})
+		So(hooks[1].Wants(EVENT_EMAIL), ShouldBeTrue)
+		So(hooks[1].Events(), ShouldBeEmpty)
+		So(w.Fire("user.nothing", Event{}), ShouldEqual, ErrWebhookEvent)
+	})
+}
+
+func TestPack(t *testing.T) {
+	Convey("Packages are signed with the hook's secret", t, func() {
+		body, err := Pack("billing", []byte("secret"), &Event{Id: "1", Type: EVENT_LOGOUT, Domain: "dom", Guid: "guid"})
+		So(err, ShouldBeNil)
+
+		e, err := Open(body, []byte("secret"))
+		So(err, ShouldBeNil)
+		So(e.Type, ShouldEqual, EVENT_LOGOUT)
+		So(e.Guid, ShouldEqual, "guid")
+
+		_, err = Open(body, []byte("wrong"))
+		So(err, ShouldEqual, ErrWebhookSignature)
+		_, err = Open([]byte(`{ bad`), []byte("secret"))
+		So(err, ShouldEqual, ErrBadPackage)
+	})
+}
+
+func TestDeliver(t *testing.T) {
+	good := &receiver{secret: "good secret", status: http.StatusOK}
+	bad := &receiver{secret: "bad secret", status: http.StatusServiceUnavailable}
+	goodServer := httptest.NewServer(good)
+	defer goodServer.Close()
+	badServer := httptest.NewServer(bad)
+	defer badServer.Close()
+
+	dir, err := ioutil.TempDir("", "gus_webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := configure.Webhook{
+		Queue:   filepath.Join(dir, "queue.json"),
+		Retries: 3,
+		Backoff: 10,
+		Hooks: map[string]configure.WebhookHook{
+			"good": {Url: goodServer.URL, Secret: good.secret},
+			"bad":  {Url: badServer.URL, Secret: bad.secret, Events: EVENT_REGISTER},
+		},
+	}
+
+	Convey("Events are queued and sent to the hooks that want them", t, func() {
+		os.Remove(config.Queue)
+		good.events, bad.events = nil, nil
+		bad.status = http.StatusServiceUnavailable
+		w, err := New(config)
+		So(err, ShouldBeNil)
+
+		So(w.Fire(EVENT_LOGOUT, Event{Domain: "dom", Guid: "guid"}), ShouldBeNil)
+		list, err := w.Queue().List()
+		So(err, ShouldBeNil)
+		So(len(list), ShouldEqual, 1)
+		So(list[0].Hook, ShouldEqual, "good")
+
+		sent, failed, err := w.Deliver(time.Now())
+		So(err, ShouldBeNil)
+		So(sent, ShouldEqual, 1)
+		So(failed, ShouldEqual, 0)
+		So(len(good.events), ShouldEqual, 1)
+		So(good.events[0].Type, ShouldEqual, EVENT_LOGOUT)
+		So(good.events[0].Id, ShouldNotBeBlank)
+		list, _ = w.Queue().List()
+		So(len(list), ShouldEqual, 0)
+
+		Convey("Failures back off and then move to the dead-letter list", func() {
+			So(w.Fire(EVENT_REGISTER, Event{Domain: "dom", Guid: "guid"}), ShouldBeNil)
+			now := time.Now()
+			sent, failed, _ = w.Deliver(now)
+			So(sent, ShouldEqual, 1)
+			So(failed, ShouldEqual, 1)
+			So(len(bad.errs), ShouldEqual, 0)
+			So(len(bad.events), ShouldEqual, 1)
+
+			// The queue is kept in the file
+			q, err := OpenQueue(config.Queue)
+			So(err, ShouldBeNil)
+			So(len(q.Pending), ShouldEqual, 1)
+			So(q.Pending[0].Attempts, ShouldEqual, 1)
+			So(q.Pending[0].LastError, ShouldContainSubstring, "503")
+			So(q.Pending[0].NextAt, ShouldHappenWithin, time.Second, now.Add(10*time.Second))
+
+			sent, failed, _ = w.Deliver(now.Add(5 * time.Second))
+			So(sent+failed, ShouldEqual, 0)
+			w.Deliver(now.Add(10 * time.Second))
+			q, _ = OpenQueue(config.Queue)
+			So(q.Pending[0].NextAt, ShouldHappenWithin, time.Second, now.Add(30*time.Second))
+			w.Deliver(now.Add(30 * time.Second))
+
+			q, _ = OpenQueue(config.Queue)
+			So(len(q.Pending), ShouldEqual, 0)
+			So(len(q.Dead), ShouldEqual, 1)
+			So(q.Dead[0].IsDead(), ShouldBeTrue)
+			So(q.Dead[0].Attempts, ShouldEqual, 3)
+
+			Convey("Dead deliveries can be retried", func() {
+				_, err := w.Queue().Retry("nothing", now)
+				So(err, ShouldEqual, ErrDeliveryNotFound)
+
+				bad.Lock()
+				bad.status = http.StatusAccepted
+				bad.Unlock()
+				count, err := w.Queue().Retry(q.Dead[0].Id, now)
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+				sent, failed, _ = w.Deliver(now)
+				So(sent, ShouldEqual, 1)
+				So(failed, ShouldEqual, 0)
+				list, _ = w.Queue().List()
+				So(len(list), ShouldEqual, 0)
+			})
+		})
+	})
+	Convey("Test events go straight to the hook", t, func() {
+		w, err := New(config)
+		So(err, ShouldBeNil)
+		good.Lock()
+		before := len(good.events)
+		good.Unlock()
+		So(w.Test("good"), ShouldBeNil)
+		So(len(good.events), ShouldEqual, before+1)
+		So(good.events[before].Type, ShouldEqual, EVENT_TEST)
+		So(w.Test("nothing"), ShouldEqual, ErrWebhookUnknown)
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	Convey("The wait doubles for each try, up to an hour", t, func() {
+		So(retryAfter(30*time.Second, 1), ShouldEqual, 30*time.Second)
+		So(retryAfter(30*time.Second, 2), ShouldEqual, time.Minute)
+		So(retryAfter(30*time.Second, 4), ShouldEqual, 4*time.Minute)
+		So(retryAfter(30*time.Second, 20), ShouldEqual, time.Hour)
+	})
+}
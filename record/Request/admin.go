@@ -0,0 +1,118 @@
+package request
+
+import (
+	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/stamp"
+	"strings"
+	"time"
+)
+
+// Admin names the user an administrative call works on. The user is found by their Guid or,
+// when that is blank, by their login or email address within Domain.
+type Admin struct {
+	*stamp.Timestamp
+	Guid   string
+	Domain string
+	Login  string
+	Email  string
+}
+
+func NewAdmin() *Admin {
+	r := &Admin{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *Admin) Check() error {
+	r.Guid = strings.TrimSpace(r.Guid)
+	r.Domain = strings.TrimSpace(r.Domain)
+	r.Login = strings.TrimSpace(r.Login)
+	r.Email = strings.TrimSpace(r.Email)
+	if r.Guid == "" && (r.Domain == "" || (r.Login == "" && r.Email == "")) {
+		return ecode.ErrMissingUser
+	}
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	// Note: stale time is always 2 minutes old. You can check for earlier times...
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
+
+// AdminDomain moves a user to another domain.
+type AdminDomain struct {
+	Admin
+	NewDomain string
+}
+
+func NewAdminDomain() *AdminDomain {
+	r := &AdminDomain{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *AdminDomain) Check() error {
+	r.NewDomain = strings.TrimSpace(r.NewDomain)
+	if err := r.Admin.Check(); err != nil {
+		return err
+	}
+	if r.NewDomain == "" {
+		return ecode.ErrMissingDomain
+	}
+	return nil
+}
+
+// AdminList asks for a page of users. Every filter is optional. Active and LoggedIn take "yes",
+// "no" or blank for either. The prefixes match the start of the name (full or login) and the
+// email address, ignoring case. Sort is created (the default), name, login or email. Pass the
+// Next from the last page as Cursor, with the same filters, to get the following page.
+type AdminList struct {
+	*stamp.Timestamp
+	Domain      string
+	Active      string
+	LoggedIn    string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	NamePrefix  string
+	EmailPrefix string
+	Sort        string
+	Descending  bool
+	Limit       int
+	Cursor      string
+}
+
+func NewAdminList() *AdminList {
+	r := &AdminList{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *AdminList) Check() error {
+	r.Domain = strings.TrimSpace(r.Domain)
+	r.NamePrefix = strings.TrimSpace(r.NamePrefix)
+	r.EmailPrefix = strings.TrimSpace(r.EmailPrefix)
+	r.Cursor = strings.TrimSpace(r.Cursor)
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	// Note: stale time is always 2 minutes old. You can check for earlier times...
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package request
+
+import (
+	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/stamp"
+	"strings"
+)
+
+// Authorize asks whether the owner of Token holds Permission. Domain is optional: when it is
+// blank the client's own domain is used.
+type Authorize struct {
+	*stamp.Timestamp
+	Token      string
+	Permission string
+	Domain     string
+}
+
+func NewAuthorize() *Authorize {
+	r := &Authorize{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *Authorize) Check() error {
+	r.Token = strings.TrimSpace(r.Token)
+	r.Permission = strings.ToLower(strings.TrimSpace(r.Permission))
+	r.Domain = strings.TrimSpace(r.Domain)
+	if r.Token == "" {
+		return ecode.ErrMissingToken
+	}
+	if r.Permission == "" {
+		return ecode.ErrMissingPermission
+	}
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	// Note: stale time is always 2 minutes old. You can check for earlier times...
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
@@ -8,12 +8,13 @@ import (
 )
 
 // The login structure is passed for every login request. It is usually encoded into
-// json in the request package. All fields are required and are tested by the
+// json in the request package. All fields, except Device, are required and are tested by the
 // check() routine.
 type Login struct {
 	*stamp.Timestamp
 	Login    string
 	Password string
+	Device   string // Optional: a name for the device, shown when listing sessions
 }
 
 // Create a new login request with the time set to 'now'
@@ -28,6 +29,7 @@ func NewLogin() *Login {
 func (r *Login) Check() error {
 	r.Login = strings.TrimSpace(r.Login)
 	r.Password = strings.TrimSpace(r.Password)
+	r.Device = strings.TrimSpace(r.Device)
 	if r.Login == "" {
 		return ecode.ErrMissingLogin
 	}
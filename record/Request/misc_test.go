@@ -26,6 +26,76 @@ func TestAuthenticate(t *testing.T) {
 	})
 }
 
+func TestAuthorize(t *testing.T) {
+	Convey("Test check and create", t, func() {
+		entity := NewAuthorize()
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingToken)
+
+		entity.Token = " HI "
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingPermission)
+
+		entity.Permission = " Users.Read "
+		So(entity.Check(), ShouldBeNil)
+		So(entity.Token, ShouldEqual, "HI")
+		So(entity.Permission, ShouldEqual, "users.read")
+
+		entity.SetStamp(time.Unix(0, 0))
+		So(entity.Check(), ShouldEqual, ecode.ErrRequestNoTimestamp)
+	})
+}
+
+func TestAdmin(t *testing.T) {
+	Convey("Test check and create", t, func() {
+		entity := NewAdmin()
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingUser)
+
+		entity.Login = " someone "
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingUser)
+		entity.Domain = "Test"
+		So(entity.Check(), ShouldBeNil)
+		So(entity.Login, ShouldEqual, "someone")
+
+		entity = NewAdmin()
+		entity.Guid = "abc"
+		So(entity.Check(), ShouldBeNil)
+
+		entity.SetStamp(time.Unix(0, 0))
+		So(entity.Check(), ShouldEqual, ecode.ErrRequestNoTimestamp)
+
+		move := NewAdminDomain()
+		move.Guid = "abc"
+		So(move.Check(), ShouldEqual, ecode.ErrMissingDomain)
+		move.NewDomain = " Other "
+		So(move.Check(), ShouldBeNil)
+		So(move.NewDomain, ShouldEqual, "Other")
+
+		list := NewAdminList()
+		So(list.Check(), ShouldBeNil)
+		list.NamePrefix = " ann "
+		So(list.Check(), ShouldBeNil)
+		So(list.NamePrefix, ShouldEqual, "ann")
+		list.SetStamp(time.Unix(0, 0))
+		So(list.Check(), ShouldEqual, ecode.ErrRequestNoTimestamp)
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	Convey("Test check and create", t, func() {
+		entity := NewRefresh()
+		err := entity.Check()
+		So(err, ShouldEqual, ecode.ErrMissingToken)
+
+		entity.RefreshToken = " HI "
+		err = entity.Check()
+		So(err, ShouldBeNil)
+		So(entity.RefreshToken, ShouldEqual, "HI")
+
+		entity.SetStamp(time.Unix(0, 0))
+		err = entity.Check()
+		So(err, ShouldEqual, ecode.ErrRequestNoTimestamp)
+	})
+}
+
 func TestLogin(t *testing.T) {
 	Convey("Test check and create", t, func() {
 		entity := NewLogin()
@@ -142,3 +212,156 @@ func TestUpdate(t *testing.T) {
 
 	})
 }
+
+func TestResetRequest(t *testing.T) {
+	Convey("Test check and create", t, func() {
+		entity := NewResetRequest()
+		err := entity.Check()
+		So(err, ShouldNotBeNil)
+		So(err, ShouldEqual, ecode.ErrMissingLogin)
+
+		entity.Email = "e@mail.com"
+		err = entity.Check()
+		So(err, ShouldBeNil)
+
+		entity.Email = ""
+		entity.Login = "login"
+		err = entity.Check()
+		So(err, ShouldBeNil)
+
+		entity.SetStamp(time.Unix(0, 0))
+		err = entity.Check()
+		So(err, ShouldNotBeNil)
+		So(err, ShouldEqual, ecode.ErrRequestNoTimestamp)
+	})
+}
+
+func TestResetConfirm(t *testing.T) {
+	Convey("Test check and create", t, func() {
+		entity := NewResetConfirm()
+		err := entity.Check()
+		So(err, ShouldNotBeNil)
+		So(err, ShouldEqual, ecode.ErrMissingToken)
+
+		entity.Token = "HI"
+		err = entity.Check()
+		So(err, ShouldEqual, ecode.ErrMissingPasswordNew)
+
+		entity.NewPassword = "pwd"
+		err = entity.Check()
+		So(err, ShouldEqual, ecode.ErrPasswordTooShort)
+
+		entity.NewPassword = "password"
+		err = entity.Check()
+		So(err, ShouldEqual, ecode.ErrPasswordTooSimple)
+
+		entity.NewPassword = "a new password"
+		err = entity.Check()
+		So(err, ShouldBeNil)
+
+		entity.SetStamp(time.Unix(0, 0))
+		err = entity.Check()
+		So(err, ShouldNotBeNil)
+		So(err, ShouldEqual, ecode.ErrRequestNoTimestamp)
+	})
+}
+
+func TestSecondFactor(t *testing.T) {
+	Convey("Test check and create", t, func() {
+		entity := NewSecondFactor()
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingLogin)
+		entity.Login = "login"
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingToken)
+		entity.Token = "token"
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingCode)
+		entity.Code = " 123456 "
+		So(entity.Check(), ShouldBeNil)
+		So(entity.Code, ShouldEqual, "123456")
+
+		entity.SetStamp(time.Unix(0, 0))
+		So(entity.Check(), ShouldEqual, ecode.ErrRequestNoTimestamp)
+	})
+}
+
+func TestTotpConfirm(t *testing.T) {
+	Convey("Test check and create", t, func() {
+		entity := NewTotpConfirm()
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingToken)
+		entity.Token = "token"
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingCode)
+		entity.Code = "123456"
+		So(entity.Check(), ShouldBeNil)
+	})
+}
+
+func TestPasskeyAdd(t *testing.T) {
+	Convey("Test check and create", t, func() {
+		entity := NewPasskeyAdd()
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingToken)
+		entity.Token = "token"
+		So(entity.Check(), ShouldEqual, ecode.ErrPasskeyResponse)
+		entity.ClientDataJSON = "e30"
+		entity.AttestationObject = "oA"
+		entity.Name = " phone "
+		So(entity.Check(), ShouldBeNil)
+		So(entity.Name, ShouldEqual, "phone")
+	})
+}
+
+func TestPasskeyStart(t *testing.T) {
+	Convey("Test check and create", t, func() {
+		entity := NewPasskeyStart()
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingLogin)
+		entity.Login = "login"
+		So(entity.Check(), ShouldBeNil)
+	})
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	Convey("Test check and create", t, func() {
+		entity := NewPasskeyLogin()
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingLogin)
+		entity.Login = "login"
+		So(entity.Check(), ShouldEqual, ecode.ErrPasskeyResponse)
+		entity.CredentialId = "id"
+		entity.ClientDataJSON = "e30"
+		entity.AuthenticatorData = "AA"
+		So(entity.Check(), ShouldEqual, ecode.ErrPasskeyResponse)
+		entity.Signature = "AA"
+		So(entity.Check(), ShouldBeNil)
+
+		entity.SetStamp(time.Unix(0, 0))
+		So(entity.Check(), ShouldEqual, ecode.ErrRequestNoTimestamp)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	Convey("Test check and create", t, func() {
+		entity := NewVerify()
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingToken)
+
+		entity.Token = " token "
+		So(entity.Check(), ShouldBeNil)
+		So(entity.Token, ShouldEqual, "token")
+
+		entity.SetStamp(time.Unix(0, 0))
+		So(entity.Check(), ShouldEqual, ecode.ErrRequestNoTimestamp)
+	})
+}
+
+func TestVerifyResend(t *testing.T) {
+	Convey("Test check and create", t, func() {
+		entity := NewVerifyResend()
+		So(entity.Check(), ShouldEqual, ecode.ErrMissingLogin)
+
+		entity.Email = "e@mail.com"
+		So(entity.Check(), ShouldBeNil)
+
+		entity.Email = ""
+		entity.Login = "login"
+		So(entity.Check(), ShouldBeNil)
+
+		entity.SetStamp(time.Unix(0, 0))
+		So(entity.Check(), ShouldEqual, ecode.ErrRequestNoTimestamp)
+	})
+}
@@ -0,0 +1,125 @@
+package request
+
+import (
+	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/stamp"
+	"strings"
+)
+
+// The passkey values come from the browser's PublicKeyCredential and are base64url encoded.
+
+// PasskeyAdd registers a new passkey for a logged in user. The Token is the session token
+// and the browser values answer the challenge from /passkey/new/.
+type PasskeyAdd struct {
+	*stamp.Timestamp
+	Token             string
+	Name              string // Optional: a name for the passkey, e.g. "work laptop"
+	ClientDataJSON    string
+	AttestationObject string
+}
+
+func NewPasskeyAdd() *PasskeyAdd {
+	r := &PasskeyAdd{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *PasskeyAdd) Check() error {
+	r.Token = strings.TrimSpace(r.Token)
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Token == "" {
+		return ecode.ErrMissingToken
+	}
+	if r.ClientDataJSON == "" || r.AttestationObject == "" {
+		return ecode.ErrPasskeyResponse
+	}
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
+
+// PasskeyStart asks for a challenge to login with a passkey
+type PasskeyStart struct {
+	*stamp.Timestamp
+	Login string
+}
+
+func NewPasskeyStart() *PasskeyStart {
+	r := &PasskeyStart{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *PasskeyStart) Check() error {
+	r.Login = strings.TrimSpace(r.Login)
+	if r.Login == "" {
+		return ecode.ErrMissingLogin
+	}
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
+
+// PasskeyLogin logs a user in with a passkey. The browser values answer the challenge
+// from /passkey/start/.
+type PasskeyLogin struct {
+	*stamp.Timestamp
+	Login             string
+	CredentialId      string
+	ClientDataJSON    string
+	AuthenticatorData string
+	Signature         string
+	Device            string // Optional: a name for the device, shown when listing sessions
+}
+
+func NewPasskeyLogin() *PasskeyLogin {
+	r := &PasskeyLogin{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *PasskeyLogin) Check() error {
+	r.Login = strings.TrimSpace(r.Login)
+	r.CredentialId = strings.TrimSpace(r.CredentialId)
+	r.Device = strings.TrimSpace(r.Device)
+	if r.Login == "" {
+		return ecode.ErrMissingLogin
+	}
+	if r.CredentialId == "" || r.ClientDataJSON == "" || r.AuthenticatorData == "" || r.Signature == "" {
+		return ecode.ErrPasskeyResponse
+	}
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
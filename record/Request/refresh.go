@@ -0,0 +1,41 @@
+package request
+
+import (
+	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/stamp"
+	"strings"
+)
+
+// Refresh trades a refresh token for a new session
+type Refresh struct {
+	*stamp.Timestamp
+	RefreshToken string
+}
+
+func NewRefresh() *Refresh {
+	r := &Refresh{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *Refresh) Check() error {
+	r.RefreshToken = strings.TrimSpace(r.RefreshToken)
+	if r.RefreshToken == "" {
+		return ecode.ErrMissingToken
+	}
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	// Note: stale time is always 2 minutes old. You can check for earlier times...
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
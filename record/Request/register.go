@@ -2,6 +2,7 @@ package request
 
 import (
 	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/policy"
 	"github.com/cgentry/gus/record/configure"
 	"github.com/cgentry/gus/record/stamp"
 	"strings"
@@ -39,8 +40,8 @@ func (r *Register) Check() error {
 	if r.Password == "" {
 		return ecode.ErrMissingPassword
 	}
-	if len(r.Password) < 6 {
-		return ecode.ErrPasswordTooShort
+	if err := policy.CheckPassword(r.Password, r.Login, r.Email); err != nil {
+		return err
 	}
 	if !r.IsTimeSet() {
 		return ecode.ErrRequestNoTimestamp
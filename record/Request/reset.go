@@ -0,0 +1,86 @@
+package request
+
+import (
+	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/policy"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/stamp"
+	"strings"
+)
+
+// ResetRequest asks for a lost password token to be generated. The user can be
+// identified either by their login or their email address.
+type ResetRequest struct {
+	*stamp.Timestamp
+	Login string
+	Email string
+}
+
+func NewResetRequest() *ResetRequest {
+	r := &ResetRequest{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *ResetRequest) Check() error {
+	r.Login = strings.TrimSpace(r.Login)
+	r.Email = strings.TrimSpace(r.Email)
+	if r.Login == "" && r.Email == "" {
+		return ecode.ErrMissingLogin
+	}
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	// Note: stale time is always 2 minutes old. You can check for earlier times...
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
+
+// ResetConfirm sends back the lost password token along with the new password.
+type ResetConfirm struct {
+	*stamp.Timestamp
+	Token       string
+	NewPassword string
+}
+
+func NewResetConfirm() *ResetConfirm {
+	r := &ResetConfirm{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *ResetConfirm) Check() error {
+	r.Token = strings.TrimSpace(r.Token)
+	r.NewPassword = strings.TrimSpace(r.NewPassword)
+	if r.Token == "" {
+		return ecode.ErrMissingToken
+	}
+	if r.NewPassword == "" {
+		return ecode.ErrMissingPasswordNew
+	}
+	if err := policy.CheckPassword(r.NewPassword); err != nil {
+		return err
+	}
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	// Note: stale time is always 2 minutes old. You can check for earlier times...
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
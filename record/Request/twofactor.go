@@ -0,0 +1,91 @@
+package request
+
+import (
+	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/stamp"
+	"strings"
+)
+
+// SecondFactor finishes a login for a user with two-factor turned on. The Token is the one
+// returned by the login and the Code is either the authenticator code or a recovery code.
+type SecondFactor struct {
+	*stamp.Timestamp
+	Login  string
+	Token  string
+	Code   string
+	Device string // Optional: a name for the device, shown when listing sessions
+}
+
+func NewSecondFactor() *SecondFactor {
+	r := &SecondFactor{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *SecondFactor) Check() error {
+	r.Login = strings.TrimSpace(r.Login)
+	r.Token = strings.TrimSpace(r.Token)
+	r.Code = strings.TrimSpace(r.Code)
+	r.Device = strings.TrimSpace(r.Device)
+	if r.Login == "" {
+		return ecode.ErrMissingLogin
+	}
+	if r.Token == "" {
+		return ecode.ErrMissingToken
+	}
+	if r.Code == "" {
+		return ecode.ErrMissingCode
+	}
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
+
+// TotpConfirm turns two-factor on. The Token is the session token and the Code is the
+// first code from the user's authenticator.
+type TotpConfirm struct {
+	*stamp.Timestamp
+	Token string
+	Code  string
+}
+
+func NewTotpConfirm() *TotpConfirm {
+	r := &TotpConfirm{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *TotpConfirm) Check() error {
+	r.Token = strings.TrimSpace(r.Token)
+	r.Code = strings.TrimSpace(r.Code)
+	if r.Token == "" {
+		return ecode.ErrMissingToken
+	}
+	if r.Code == "" {
+		return ecode.ErrMissingCode
+	}
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package request
 
 import (
 	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/policy"
 	"github.com/cgentry/gus/record/configure"
 	"github.com/cgentry/gus/record/stamp"
 	"strings"
@@ -34,8 +35,8 @@ func (r *Update) Check() error {
 	if r.NewPassword == "" {
 		return ecode.ErrMissingPasswordNew
 	}
-	if len(r.NewPassword) < 6 {
-		return ecode.ErrPasswordTooShort
+	if err := policy.CheckPassword(r.NewPassword, r.Login, r.Email); err != nil {
+		return err
 	}
 	if r.OldPassword == "" {
 		return ecode.ErrMissingPassword
@@ -0,0 +1,77 @@
+package request
+
+import (
+	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/stamp"
+	"strings"
+)
+
+// Verify sends back the token from the verification message to activate a new user.
+type Verify struct {
+	*stamp.Timestamp
+	Token string
+}
+
+func NewVerify() *Verify {
+	r := &Verify{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *Verify) Check() error {
+	r.Token = strings.TrimSpace(r.Token)
+	if r.Token == "" {
+		return ecode.ErrMissingToken
+	}
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	// Note: stale time is always 2 minutes old. You can check for earlier times...
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
+
+// VerifyResend asks for a new verification message for a user that hasn't been activated.
+// The user can be identified either by their login or their email address.
+type VerifyResend struct {
+	*stamp.Timestamp
+	Login string
+	Email string
+}
+
+func NewVerifyResend() *VerifyResend {
+	r := &VerifyResend{}
+	r.Timestamp = stamp.New()
+	return r
+}
+
+func (r *VerifyResend) Check() error {
+	r.Login = strings.TrimSpace(r.Login)
+	r.Email = strings.TrimSpace(r.Email)
+	if r.Login == "" && r.Email == "" {
+		return ecode.ErrMissingLogin
+	}
+	if !r.IsTimeSet() {
+		return ecode.ErrRequestNoTimestamp
+	}
+	// Note: stale time is always 2 minutes old. You can check for earlier times...
+	window := r.Window(configure.TIMESTAMP_EXPIRATION)
+	if window != 0 {
+		if window > 0 {
+			return ecode.ErrRequestFuture
+		}
+		if window < 0 {
+			return ecode.ErrRequestExpired
+		}
+	}
+	return nil
+}
@@ -14,13 +14,26 @@ var UnixTimeZero = time.Unix(0, 0)
 const TIMESTAMP_EXPIRATION = 120 // seconds
 const USER_TIME_STR = time.RFC3339
 const PASSWORD_MINIMUM_LENGTH = 6
+const PASSWORD_MAXIMUM_LENGTH = 128
 
 // Configure is the main structure holding the parameters, split up for each logical section.
 type Configure struct {
-	Service Service
-	User    Store `help:"The storage for the user data"`
-	Client  Store `help:"The storage for the client can be different than for the user store"`
-	Encrypt Encrypt
+	Service   Service
+	User      Store `help:"The storage for the user data"`
+	Client    Store `help:"The storage for the client can be different than for the user store"`
+	Encrypt   Encrypt
+	Lockout   Lockout
+	Session   Session
+	Password  PasswordPolicy
+	Ticket    Ticket
+	Keys      Keys
+	TwoFactor TwoFactor
+	Passkey   Passkey
+	Notify    Notify
+	Verify    Verify
+	Webhook   Webhook
+	Access    Access
+	Delete    Delete
 }
 
 // Store is the structure that is used to define storage parameters.
@@ -38,10 +51,149 @@ type Service struct {
 	ClientStore bool   `name:"Separate client store" help:"Do you want separate client and user storage?"`
 }
 
-// Encrypt gives the name and options for the password encryption driver
+// Encrypt gives the name and options for the password encryption driver. Drivers holds the
+// options for each driver by name and is only set in the configuration file, e.g.:
+//
+//	"Drivers": { "bcrypt": "{ \"Salt\": \"...\" }", "pbkdf2": "{ \"Cost\": 600000 }" }
+//
+// Passwords are checked with the driver that hashed them, so a driver's options must stay
+// here after the encryption driver is changed. Options, when set, replace the entry in
+// Drivers for the encryption driver.
 type Encrypt struct {
-	Name    string `help:"The encryption driver you want to use." name:"Encryption Name"`
-	Options string `help:"Options passed to the driver. Check the driver for what options are availble." name:"Driver options"`
+	Name          string            `help:"The encryption driver you want to use." name:"Encryption Name"`
+	Options       string            `help:"Options passed to the driver. Check the driver for what options are availble. Blank uses the driver's entry in Drivers." name:"Driver options"`
+	Legacy        string            `help:"The driver used for passwords saved before the driver was recorded. Blank uses the encryption driver." name:"Legacy driver"`
+	LegacyOptions string            `help:"Options for the legacy driver, as they were when those passwords were saved (e.g. its Salt). Blank uses its entry in Drivers." name:"Legacy driver options"`
+	Drivers       map[string]string `json:",omitempty"`
+}
+
+// Lockout controls how failed logins lock an account. All times are in minutes.
+// When MaxFailures is zero, accounts are never locked.
+type Lockout struct {
+	MaxFailures int `name:"Maximum failed logins" help:"Number of failed logins before the account is locked. Zero turns lockout off."`
+	Window      int `name:"Failure window"        help:"Minutes a failed login is remembered. Older failures are forgotten unless the account is already locked."`
+	Backoff     int `name:"Lockout period"        help:"Minutes the account is locked for. Each failure after the lock ends doubles the period. Zero locks until unlocked."`
+	AutoUnlock  int `name:"Automatic unlock"      help:"Minutes after the last failure when the account unlocks itself. Zero means it must be unlocked with 'gus user unlock'."`
+}
+
+// Session sets how long a login lasts. All times are in minutes; zero keeps the built-in
+// value (20 minutes idle, 24 hours in all). Domains can have their own limits, which are
+// only set in the configuration file, e.g.:
+//
+//	"Domains": { "admin": { "Timeout": 15 }, "public": { "Timeout": 120 } }
+//
+// A zero in a domain's limits uses the value above.
+type Session struct {
+	Timeout    int `name:"Idle timeout"    help:"Minutes a session lasts without being used. Each authentication starts it again."`
+	MaxSession int `name:"Maximum session" help:"Minutes a session can last, however often it is used. The user must then login again."`
+
+	Domains map[string]SessionLimit `json:",omitempty"`
+}
+
+// SessionLimit overrides the session times for one domain
+type SessionLimit struct {
+	Timeout    int
+	MaxSession int
+}
+
+// PasswordPolicy sets the rules for new passwords. Zero turns off any of the numeric checks.
+type PasswordPolicy struct {
+	MinLength   int    `name:"Minimum length"        help:"Shortest password allowed."`
+	MaxLength   int    `name:"Maximum length"        help:"Longest password allowed. Zero means no limit."`
+	MinClasses  int    `name:"Character classes"     help:"How many of lower case, upper case, digits and symbols must be used (0-4)."`
+	MinScore    int    `name:"Minimum strength"      help:"Strength score required, from 0 (anything) to 4 (very hard to guess)."`
+	NotUserInfo bool   `name:"Reject user details"   help:"Reject passwords that contain the user's login name or email address."`
+	Banned      bool   `name:"Reject common"         help:"Reject passwords found on the built-in list of common passwords."`
+	BannedFile  string `name:"Banned password file"  help:"A file of extra banned passwords, one per line. Leave empty for none."`
+}
+
+// Ticket controls the signed tickets returned at login. A ticket can be checked by other services
+// without calling gus. When Algorithm is blank, no tickets are issued.
+type Ticket struct {
+	Algorithm string `name:"Signing algorithm" help:"EdDSA (public key), HS256 (shared secret) or blank to turn tickets off."`
+	Key       string `name:"Signing key"       help:"HS256: the shared secret. EdDSA: a base64 ed25519 seed. Blank EdDSA keys are generated at startup."`
+	Duration  int    `name:"Ticket lifetime"   help:"Minutes a ticket is valid for. Keep this short: tickets can't be revoked."`
+	Issuer    string `name:"Issuer"            help:"Name put into each ticket so services know who issued it."`
+}
+
+// Keys gives the file holding the keys used to sign responses and tickets. When File is blank,
+// responses are not signed with a key. The file is managed with 'gus keys'.
+type Keys struct {
+	File       string `name:"Key store file" help:"The file holding the signing keys. Blank turns key signing off."`
+	Passphrase string `name:"Passphrase"     help:"Passphrase the keys are encrypted with. Blank reads it from GUS_KEYS_PASSPHRASE."`
+}
+
+// TwoFactor controls TOTP two-factor logins. The TOTP secrets are stored encrypted with the key.
+// With no key, users can't turn two-factor on.
+type TwoFactor struct {
+	Issuer string `name:"Issuer"           help:"Name shown in the user's authenticator app."`
+	Key    string `name:"Field encryption" help:"Key the TOTP secrets are encrypted with. Blank reads it from GUS_FIELD_KEY."`
+}
+
+// Passkey sets the site (WebAuthn relying party) that passkeys are registered for. When RPId
+// is blank, passkeys are turned off.
+type Passkey struct {
+	RPId             string `name:"Site domain"        help:"Domain the passkeys belong to, e.g. example.com. Blank turns passkeys off."`
+	RPName           string `name:"Site name"          help:"Name shown to users when they create a passkey."`
+	Origins          string `name:"Origins"            help:"Comma separated pages that may use the passkeys, e.g. https://login.example.com. Blank means https:// and the site domain."`
+	UserVerification bool   `name:"Require user check" help:"Require the authenticator to check the user with a PIN or biometric, not just a touch."`
+}
+
+// Notify gives the driver used to send messages, such as verification emails, to users. When
+// Name is blank, no messages are sent.
+type Notify struct {
+	Name      string `name:"Notify driver"      help:"The driver used to send messages to users. Blank turns messages off."`
+	Options   string `name:"Driver options"     help:"Options passed to the driver. Check the driver for what options are availble."`
+	From      string `name:"From address"       help:"Address the messages are sent from, e.g. accounts@example.com."`
+	Events    string `name:"Events"             help:"Comma separated events to send: register, password, email, lockout, reset. Blank sends them all."`
+	Templates string `name:"Template directory" help:"Directory of message templates that replace the built-in ones. Blank uses the built-in messages."`
+	ResetLink string `name:"Reset link"         help:"Page a lost password message sends the user to. The token is added to the end, e.g. https://example.com/reset?token="`
+}
+
+// Verify controls email verification. When Required is set, new users must follow the link
+// they are sent before they can login. A notify driver must be configured to send it.
+type Verify struct {
+	Required bool   `name:"Require verification" help:"New users must verify their email address before they can login."`
+	Link     string `name:"Verification link"    help:"Page the user is sent to. The token is added to the end, e.g. https://example.com/verify?token="`
+	Duration int    `name:"Token lifetime"       help:"Minutes the verification token can be used for. Zero means 24 hours."`
+}
+
+// Webhook sends signed events to other services when users change. The hooks are only set in
+// the configuration file, e.g.:
+//
+//	"Hooks": { "billing": { "Url": "https://billing.example.com/gus", "Secret": "...", "Events": "user.register" } }
+//
+// Events is comma separated; blank sends every event. When there are no hooks, no events are sent.
+type Webhook struct {
+	Queue   string `name:"Queue file"    help:"File holding the events waiting to be delivered and those that failed. Blank keeps them in memory."`
+	Retries int    `name:"Maximum tries" help:"Times an event is sent before it is moved to the dead-letter list. Zero means 8."`
+	Backoff int    `name:"First retry"   help:"Seconds before the first retry. Each retry waits twice as long, up to an hour. Zero means 30."`
+	Timeout int    `name:"Timeout"       help:"Seconds to wait for a service to reply. Zero means 10."`
+
+	Hooks map[string]WebhookHook `json:",omitempty"`
+}
+
+// WebhookHook is one service that is sent events
+type WebhookHook struct {
+	Url    string
+	Secret string
+	Events string
+}
+
+// Access names the permissions each role gives. The roles are only set in the configuration
+// file, e.g.:
+//
+//	"Roles": { "admin": "users.read, users.write", "support": "users.read" }
+//
+// A user holds a permission that was granted to them directly or through one of their roles.
+type Access struct {
+	Roles map[string]string `json:",omitempty"`
+}
+
+// Delete sets how long deleted users are kept. A deleted user can be restored until they are
+// purged with 'gus user purge'.
+type Delete struct {
+	Retention int `name:"Retention period" help:"Days a deleted user is kept before it can be purged. Zero means 30."`
 }
 
 // New will generate a new configuration with no options defined.
@@ -94,6 +246,70 @@ const DEFAULT_CONFIG = `{
   },
   "Encrypt" : {
   	"Name" : "bcrypt",
-  	"Options" : "{ \"Salt\": \"##salt##\" }"
+  	"Options" : "",
+  	"Drivers" : {
+  		"bcrypt" : "{ \"Salt\": \"##salt##\" }"
+  		}
+  	},
+  "Lockout" : {
+  	"MaxFailures" : 5,
+  	"Window" : 15,
+  	"Backoff" : 1,
+  	"AutoUnlock" : 60
+  	},
+  "Session" : {
+  	"Timeout" : 20,
+  	"MaxSession" : 1440
+  	},
+  "Password" : {
+  	"MinLength" : 8,
+  	"MaxLength" : 128,
+  	"MinClasses" : 1,
+  	"MinScore" : 2,
+  	"NotUserInfo" : true,
+  	"Banned" : true,
+  	"BannedFile" : ""
+  	},
+  "Ticket" : {
+  	"Algorithm" : "",
+  	"Key" : "",
+  	"Duration" : 5,
+  	"Issuer" : "gus"
+  	},
+  "Keys" : {
+  	"File" : "",
+  	"Passphrase" : ""
+  	},
+  "TwoFactor" : {
+  	"Issuer" : "gus",
+  	"Key" : ""
+  	},
+  "Passkey" : {
+  	"RPId" : "",
+  	"RPName" : "gus",
+  	"Origins" : "",
+  	"UserVerification" : false
+  	},
+  "Notify" : {
+  	"Name" : "",
+  	"Options" : "",
+  	"From" : "",
+  	"Events" : "",
+  	"Templates" : "",
+  	"ResetLink" : ""
+  	},
+  "Verify" : {
+  	"Required" : false,
+  	"Link" : "",
+  	"Duration" : 1440
+  	},
+  "Webhook" : {
+  	"Queue" : "",
+  	"Retries" : 8,
+  	"Backoff" : 30,
+  	"Timeout" : 10
+  	},
+  "Delete" : {
+  	"Retention" : 30
   	}
 }`
@@ -1,6 +1,7 @@
 package head
 
 import (
+	"encoding/base64"
 	"fmt"
 	"github.com/cgentry/gus/ecode"
 	"github.com/cgentry/gus/record/configure"
@@ -17,6 +18,8 @@ type HeaderInterface interface {
 	SetSignature([]byte)
 	Check() error
 	IsSignatureSet() bool
+	SetKeySignature(string, []byte)
+	GetKeySignature() (string, []byte, error)
 
 	GetDomain() string
 	SetDomain(string)
@@ -32,6 +35,10 @@ type Head struct {
 	Id       string
 	Sequence int
 	BodyType string
+
+	KeyId        string `json:",omitempty"` // Which of the keys published at /keys/ signed the body
+	KeySignature string `json:",omitempty"` // Base64 signature of the body, made with KeyId
+
 	*stamp.Timestamp
 	*signature.Signature
 }
@@ -86,3 +93,15 @@ func (h *Head) SetId(val string) { h.Id = val }
 
 func (h *Head) GetSequence() int    { return h.Sequence }
 func (h *Head) SetSequence(val int) { h.Sequence = val }
+
+// SetKeySignature saves the signature made with one of the gus signing keys.
+func (h *Head) SetKeySignature(keyId string, sig []byte) {
+	h.KeyId = keyId
+	h.KeySignature = base64.StdEncoding.EncodeToString(sig)
+}
+
+// GetKeySignature returns the key id and the signature made with it.
+func (h *Head) GetKeySignature() (string, []byte, error) {
+	sig, err := base64.StdEncoding.DecodeString(h.KeySignature)
+	return h.KeyId, sig, err
+}
@@ -106,6 +106,17 @@ func TestGeneralFields(t *testing.T) {
 		So(found, ShouldBeTrue)
 		So(user.Token, ShouldEqual, `MyToken`)
 
+		found, err = UserField(user, `resettoken`, `MyResetToken`)
+		So(err, ShouldBeNil)
+		So(found, ShouldBeTrue)
+		So(user.ResetToken, ShouldEqual, `MyResetToken`)
+
+		found, err = UserField(user, `ResetExpiresAt`, nowStr)
+		So(err, ShouldBeNil)
+		So(found, ShouldBeTrue)
+		So(user.ResetExpiresAt.Equal(now), ShouldBeTrue)
+		So(user.GetResetExpiresAtStr(), ShouldEqual, nowStr)
+
 		found, err = UserField(user, `salt`, `saltsaltsaltsaltsaltsaltsalt`)
 		So(err, ShouldBeNil)
 		So(found, ShouldBeTrue)
@@ -3,11 +3,13 @@
 package mappers
 
 import (
+	"encoding/base64"
 	"errors"
 	"github.com/cgentry/gus/record/response"
 	"github.com/cgentry/gus/record/tenant"
 	"strconv"
 	"strings"
+	"time"
 )
 
 //ResponseFromUser takes a user record and copies the relevant fields from the
@@ -15,7 +17,7 @@ import (
 func ResponseFromUser(rtn *response.UserReturn, user *tenant.User) *response.UserReturn {
 
 	rtn.Guid = user.Guid
-	rtn.Token = user.Token
+	rtn.Token = user.SessionToken // Never send the stored hash
 
 	rtn.LoginAt = user.LoginAt
 	rtn.LastAuthAt = user.LastAuthAt
@@ -27,6 +29,121 @@ func ResponseFromUser(rtn *response.UserReturn, user *tenant.User) *response.Use
 	rtn.Email = user.Email
 	rtn.LoginName = user.LoginName
 
+	rtn.Roles = user.RoleList()
+	rtn.Permissions = user.AllPermissions()
+
+	return rtn
+}
+
+// ResponseFromSession copies the session's token and times over the user's. Call this after
+// ResponseFromUser so the caller gets back the session they are using.
+func ResponseFromSession(rtn *response.UserReturn, session *tenant.Session) *response.UserReturn {
+
+	rtn.Token = session.SessionToken // Never send the stored hash
+
+	rtn.LoginAt = session.CreatedAt
+	rtn.LastAuthAt = session.LastAuthAt
+	rtn.TimeoutAt = session.TimeoutAt
+	rtn.MaxSessionAt = session.MaxSessionAt
+
+	return rtn
+}
+
+// ResponseFromRefresh adds the refresh token to the response. Only a newly created token has
+// the clear value; it is never sent back again.
+func ResponseFromRefresh(rtn *response.UserReturn, refresh *tenant.Refresh) *response.UserReturn {
+	rtn.RefreshToken = refresh.RefreshToken
+	rtn.RefreshExpiresAt = refresh.ExpiresAt
+	return rtn
+}
+
+// SecondFactorFromUser fills in the response to a password login that still needs the second
+// factor. Nothing else about the user is sent until the login is finished.
+func SecondFactorFromUser(rtn *response.UserReturn, user *tenant.User) *response.UserReturn {
+	rtn.SecondFactorRequired = true
+	rtn.FactorToken = user.PendingToken // Never send the stored hash
+	rtn.FactorExpiresAt = user.FactorExpiresAt
+	rtn.LoginName = user.LoginName
+	return rtn
+}
+
+// RefreshFromSession fills in the response to a refresh: the new session and the refresh
+// token that replaces the one traded in.
+func RefreshFromSession(rtn *response.Refresh, session *tenant.Session, refresh *tenant.Refresh) *response.Refresh {
+	rtn.Token = session.SessionToken
+	rtn.RefreshToken = refresh.RefreshToken
+	rtn.RefreshExpiresAt = refresh.ExpiresAt
+
+	rtn.LoginAt = session.CreatedAt
+	rtn.TimeoutAt = session.TimeoutAt
+	rtn.MaxSessionAt = session.MaxSessionAt
+	return rtn
+}
+
+// SessionListFromSessions copies the public parts of each session into the list. The
+// session the caller is using is flagged as 'Current'
+func SessionListFromSessions(rtn *response.SessionList, sessions []*tenant.Session, current *tenant.Session) *response.SessionList {
+	for _, session := range sessions {
+		rtn.Sessions = append(rtn.Sessions, response.SessionReturn{
+			Id:           session.Id,
+			ClientId:     session.ClientId,
+			Device:       session.Device,
+			CreatedAt:    session.CreatedAt,
+			LastAuthAt:   session.LastAuthAt,
+			TimeoutAt:    session.TimeoutAt,
+			MaxSessionAt: session.MaxSessionAt,
+			Current:      current != nil && session.Token == current.Token,
+		})
+	}
+	return rtn
+}
+
+// IntrospectFromSession fills in the introspection response for an active session. The lifetimes
+// are given in seconds from 'now'.
+func IntrospectFromSession(rtn *response.Introspect, session *tenant.Session, user *tenant.User, now time.Time) *response.Introspect {
+	rtn.Active = true
+	rtn.Guid = session.Guid
+	rtn.Domain = session.Domain
+	rtn.LoginName = user.LoginName
+	rtn.SessionId = session.Id
+	rtn.ClientId = session.ClientId
+
+	rtn.LoginAt = session.CreatedAt
+	rtn.LastAuthAt = session.LastAuthAt
+	rtn.TimeoutAt = session.TimeoutAt
+	rtn.MaxSessionAt = session.MaxSessionAt
+
+	rtn.ExpiresIn = int64(session.TimeoutAt.Sub(now) / time.Second)
+	rtn.MaxExpiresIn = int64(session.MaxSessionAt.Sub(now) / time.Second)
+	return rtn
+}
+
+// AdminFromUser copies the user's record into the view given to admin clients
+func AdminFromUser(rtn *response.AdminUser, user *tenant.User) *response.AdminUser {
+	rtn.Guid = user.Guid
+	rtn.Domain = user.Domain
+	rtn.FullName = user.FullName
+	rtn.LoginName = user.LoginName
+	rtn.Email = user.Email
+
+	rtn.IsActive = user.IsActive
+	rtn.IsLoggedIn = user.IsLoggedIn
+	rtn.IsSystem = user.IsSystem
+	rtn.IsLocked, _ = user.IsLocked(time.Now())
+	rtn.TotpEnabled = user.TotpEnabled
+
+	rtn.Roles = user.RoleList()
+	rtn.Permissions = user.AllPermissions()
+
+	rtn.FailCount = user.FailCount
+	rtn.LoginAt = user.LoginAt
+	rtn.LastAuthAt = user.LastAuthAt
+	rtn.LogoutAt = user.LogoutAt
+	rtn.LastFailedAt = user.LastFailedAt
+
+	rtn.CreatedAt = user.CreatedAt
+	rtn.UpdatedAt = user.UpdatedAt
+	rtn.DeletedAt = user.DeletedAt
 	return rtn
 }
 
@@ -58,6 +175,37 @@ func UserField(user *tenant.User, key, value string) (found bool, rtn error) {
 		rtn = user.SetPasswordStr(value)
 	case "token":
 		rtn = user.SetToken(value)
+	case "resettoken":
+		rtn = user.SetResetToken(value)
+	case "resetexpiresat":
+		rtn = user.SetResetExpiresAt(StrToTime(value))
+	case "totpsecret":
+		rtn = user.SetTotpSecret(value)
+	case "totpenabled":
+		rtn = user.SetTotpEnabled(StrToBool(value, user.TotpEnabled))
+	case "totpstep":
+		step, _ := strconv.ParseInt(value, 10, 64)
+		rtn = user.SetTotpStep(step)
+	case "recoverycodes":
+		rtn = user.SetRecoveryCodes(value)
+	case "factortoken":
+		rtn = user.SetFactorToken(value)
+	case "factorexpiresat":
+		rtn = user.SetFactorExpiresAt(StrToTime(value))
+	case "challenge":
+		rtn = user.SetChallenge(value)
+	case "challengeexpiresat":
+		rtn = user.SetChallengeExpiresAt(StrToTime(value))
+	case "verifytoken":
+		rtn = user.SetVerifyToken(value)
+	case "verifyexpiresat":
+		rtn = user.SetVerifyExpiresAt(StrToTime(value))
+	case "roles":
+		rtn = user.SetRoles(value)
+	case "permissions":
+		rtn = user.SetPermissions(value)
+	case "capabilities":
+		rtn = user.SetCapabilities(value)
 
 	case "salt":
 		rtn = user.SetSalt(value)
@@ -108,6 +256,114 @@ func UserField(user *tenant.User, key, value string) (found bool, rtn error) {
 	return
 }
 
+// SessionField will map a fieldname to a session record and save the field in the record
+func SessionField(session *tenant.Session, key, value string) (found bool) {
+
+	found = true
+	value = strings.TrimSpace(value) // No spaces around field
+
+	switch strings.ToLower(key) {
+	case "id":
+		session.Id = value
+	case "token":
+		session.Token = value
+	case "guid":
+		session.Guid = value
+	case "domain":
+		session.Domain = value
+	case "clientid":
+		session.ClientId = value
+	case "device":
+		session.Device = value
+	case "family":
+		session.Family = value
+
+	case "createdat":
+		session.CreatedAt = StrToTime(value)
+	case "lastauthat":
+		session.LastAuthAt = StrToTime(value)
+	case "timeoutat":
+		session.TimeoutAt = StrToTime(value)
+	case "maxsessionat":
+		session.MaxSessionAt = StrToTime(value)
+
+	default:
+		found = false
+	}
+	return
+}
+
+// RefreshField will map a fieldname to a refresh token record and save the field in the record
+func RefreshField(refresh *tenant.Refresh, key, value string) (found bool) {
+
+	found = true
+	value = strings.TrimSpace(value) // No spaces around field
+
+	switch strings.ToLower(key) {
+	case "token":
+		refresh.Token = value
+	case "family":
+		refresh.Family = value
+	case "guid":
+		refresh.Guid = value
+	case "domain":
+		refresh.Domain = value
+	case "clientid":
+		refresh.ClientId = value
+	case "device":
+		refresh.Device = value
+
+	case "createdat":
+		refresh.CreatedAt = StrToTime(value)
+	case "expiresat":
+		refresh.ExpiresAt = StrToTime(value)
+	case "usedat":
+		refresh.UsedAt = StrToTime(value)
+
+	default:
+		found = false
+	}
+	return
+}
+
+// CredentialField maps a single field, by name, to the passkey record. The public key is
+// kept as base64 when stored as text.
+func CredentialField(cred *tenant.Credential, key, value string) (found bool) {
+
+	found = true
+	value = strings.TrimSpace(value) // No spaces around field
+
+	switch strings.ToLower(key) {
+	case "id":
+		cred.Id = value
+	case "guid":
+		cred.Guid = value
+	case "domain":
+		cred.Domain = value
+	case "name":
+		cred.Name = value
+	case "publickey":
+		cred.PublicKey, _ = base64.StdEncoding.DecodeString(value)
+	case "algorithm":
+		cred.Algorithm, _ = strconv.Atoi(value)
+	case "signcount":
+		count, _ := strconv.ParseUint(value, 10, 32)
+		cred.SignCount = uint32(count)
+	case "aaguid":
+		cred.Aaguid = value
+	case "format":
+		cred.Format = value
+
+	case "createdat":
+		cred.CreatedAt = StrToTime(value)
+	case "lastusedat":
+		cred.LastUsedAt = StrToTime(value)
+
+	default:
+		found = false
+	}
+	return
+}
 
  // UserFromCli copy fields from the user cli record to the rtn record. We return the same record
  // passed, so you can safely ignore the return
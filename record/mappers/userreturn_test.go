@@ -27,7 +27,8 @@ func TestUserReturn(t *testing.T) {
 		rtn := ResponseFromUser(response.NewUserReturn(), user)
 
 		So(rtn.Guid, ShouldEqual, user.Guid)
-		So(rtn.Token, ShouldEqual, user.Token)
+		So(rtn.Token, ShouldEqual, user.SessionToken)
+		So(rtn.Token, ShouldNotEqual, user.Token)
 		So(rtn.FullName, ShouldEqual, user.FullName)
 		So(rtn.LoginName, ShouldEqual, user.LoginName)
 		So(rtn.Email, ShouldEqual, user.Email)
@@ -39,3 +40,19 @@ func TestUserReturn(t *testing.T) {
 
 	})
 }
+
+func TestAdminFromUser(t *testing.T) {
+	user := tenant.NewTestUser()
+	user.GenerateGuid()
+	user.FullName = `FullName`
+	user.GrantRole("support")
+	Convey("Admin view has no secrets", t, func() {
+		rtn := AdminFromUser(response.NewAdminUser(), user)
+		So(rtn.Guid, ShouldEqual, user.Guid)
+		So(rtn.Domain, ShouldEqual, user.Domain)
+		So(rtn.FullName, ShouldEqual, user.FullName)
+		So(rtn.IsActive, ShouldEqual, user.IsActive)
+		So(rtn.Roles, ShouldResemble, []string{"support"})
+		So(rtn.DeletedAt.IsZero(), ShouldBeTrue)
+	})
+}
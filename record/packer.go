@@ -7,6 +7,7 @@ import (
 	"github.com/cgentry/gus/record/head"
 	"reflect"
 	"strings"
+	"sync"
 )
 
 const (
@@ -61,9 +62,37 @@ func GoodSignature(p Packer) bool {
 	return false
 }
 
-// SignPackage with a base64-encoded HMAC of the body contents.
+// KeySigner signs the body of a package with a private key. Anyone can check the signature
+// with the public key, so third parties can tell that a response really came from gus.
+type KeySigner interface {
+	KeyId() string
+	Sign(message []byte) ([]byte, error)
+}
+
+var keySigner struct {
+	sync.RWMutex
+	signer KeySigner
+}
+
+// SetKeySigner sets the key that all packages are signed with. Passing nil stops key signatures.
+func SetKeySigner(k KeySigner) {
+	keySigner.Lock()
+	keySigner.signer = k
+	keySigner.Unlock()
+}
+
+// SignPackage with a base64-encoded HMAC of the body contents. If there is a KeySigner,
+// the body is also signed with the key.
 func SignPackage(p Packer) {
 	p.GetHead().SetSignature(computeSignature(p))
+
+	keySigner.RLock()
+	defer keySigner.RUnlock()
+	if keySigner.signer != nil {
+		if sig, err := keySigner.signer.Sign([]byte(p.GetBody())); err == nil {
+			p.GetHead().SetKeySignature(keySigner.signer.KeyId(), sig)
+		}
+	}
 	return
 }
 
@@ -1,6 +1,8 @@
 package record
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"github.com/cgentry/gus/record/head"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
@@ -70,3 +72,34 @@ func TestPackager(t *testing.T) {
 		})
 	})
 }
+
+type _testKeySigner struct {
+	private ed25519.PrivateKey
+}
+
+func (k *_testKeySigner) KeyId() string { return "testkey" }
+func (k *_testKeySigner) Sign(msg []byte) ([]byte, error) {
+	return ed25519.Sign(k.private, msg), nil
+}
+
+func TestKeySignature(t *testing.T) {
+	Convey("Packages are signed with the key signer", t, func() {
+		public, private, _ := ed25519.GenerateKey(rand.Reader)
+		p := NewPackage()
+		p.SetSecret([]byte(`abcdefSecret`))
+		p.SetBody("Hello there")
+
+		SignPackage(p)
+		kid, _, _ := p.GetHead().GetKeySignature()
+		So(kid, ShouldBeBlank)
+
+		SetKeySigner(&_testKeySigner{private: private})
+		defer SetKeySigner(nil)
+		SignPackage(p)
+		kid, sig, err := p.GetHead().GetKeySignature()
+		So(err, ShouldBeNil)
+		So(kid, ShouldEqual, "testkey")
+		So(ed25519.Verify(public, []byte(p.GetBody()), sig), ShouldBeTrue)
+		So(GoodSignature(p), ShouldBeTrue)
+	})
+}
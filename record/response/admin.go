@@ -0,0 +1,69 @@
+package response
+
+import (
+	"github.com/cgentry/gus/record/stamp"
+	"time"
+)
+
+// AdminUser is the view of a user's record given to admin clients. Secrets, such as the
+// password and tokens, are never included.
+type AdminUser struct {
+	stamp.Timestamp
+	Guid      string
+	Domain    string
+	FullName  string
+	LoginName string
+	Email     string
+
+	IsActive    bool
+	IsLoggedIn  bool
+	IsSystem    bool
+	IsLocked    bool // Too many failed logins
+	TotpEnabled bool
+
+	Roles       []string `json:",omitempty"`
+	Permissions []string `json:",omitempty"` // Every permission, from the roles and given directly
+
+	FailCount    int
+	LoginAt      time.Time
+	LastAuthAt   time.Time
+	LogoutAt     time.Time
+	LastFailedAt time.Time
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt time.Time // Zero unless the user has been deleted
+}
+
+func NewAdminUser() *AdminUser {
+	rtn := &AdminUser{}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
+
+// AdminPassword is returned when an admin client gives a user a new password. The client is
+// responsible for getting the password to the user.
+type AdminPassword struct {
+	stamp.Timestamp
+	Guid     string
+	Password string
+}
+
+func NewAdminPassword() *AdminPassword {
+	rtn := &AdminPassword{}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
+
+// AdminList is a page of users. Next is blank when there are no more.
+type AdminList struct {
+	stamp.Timestamp
+	Users []*AdminUser
+	Next  string `json:",omitempty"`
+}
+
+func NewAdminList() *AdminList {
+	rtn := &AdminList{Users: []*AdminUser{}}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
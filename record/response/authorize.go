@@ -0,0 +1,22 @@
+package response
+
+import (
+	"github.com/cgentry/gus/record/stamp"
+	"time"
+)
+
+// Authorize answers whether a token's owner holds a permission. Granted is false for a token
+// that isn't valid as well as for a user without the permission.
+type Authorize struct {
+	stamp.Timestamp
+	Granted    bool
+	Permission string
+	Domain     string
+	Guid       string `json:",omitempty"` // Owner of the token, when it is valid
+}
+
+func NewAuthorize() *Authorize {
+	rtn := &Authorize{}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
@@ -0,0 +1,33 @@
+package response
+
+import (
+	"github.com/cgentry/gus/record/stamp"
+	"time"
+)
+
+// Introspect tells a system client whether a session token is in use. When Active is false
+// nothing else is filled in, so the caller can't learn anything about a token that isn't valid.
+type Introspect struct {
+	stamp.Timestamp
+	Active bool // True when the token belongs to a session that hasn't expired
+
+	Guid      string `json:",omitempty"` // Owner of the token
+	Domain    string `json:",omitempty"`
+	LoginName string `json:",omitempty"`
+	SessionId string `json:",omitempty"`
+	ClientId  string `json:",omitempty"` // Client the user logged in through
+
+	LoginAt      time.Time // When the session was created
+	LastAuthAt   time.Time // Last time the session was used
+	TimeoutAt    time.Time // Required to authenticate by
+	MaxSessionAt time.Time // When the session will be forced off
+
+	ExpiresIn    int64 // Seconds until the session times out if it isn't used
+	MaxExpiresIn int64 // Seconds until the session must end
+}
+
+func NewIntrospect() *Introspect {
+	rtn := &Introspect{}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
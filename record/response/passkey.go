@@ -0,0 +1,72 @@
+package response
+
+import (
+	"github.com/cgentry/gus/record/stamp"
+	"time"
+)
+
+// The passkey responses carry what the browser needs for navigator.credentials. Binary
+// values (challenge, user and credential ids) are base64url encoded.
+
+// PasskeyCreate holds the options for creating a new passkey.
+type PasskeyCreate struct {
+	stamp.Timestamp
+
+	Challenge        string
+	RPId             string
+	RPName           string
+	UserId           string
+	UserName         string
+	DisplayName      string
+	Algorithms       []int    // COSE algorithms accepted, most preferred first
+	Exclude          []string // Passkeys the user already has
+	UserVerification string   // "required" or "preferred"
+	ExpiresAt        time.Time
+}
+
+func NewPasskeyCreate() *PasskeyCreate {
+	rtn := &PasskeyCreate{}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
+func (u *PasskeyCreate) Check() error {
+	return nil
+}
+
+// PasskeyGet holds the options for logging in with a passkey.
+type PasskeyGet struct {
+	stamp.Timestamp
+
+	Challenge        string
+	RPId             string
+	Allow            []string // The user's passkeys
+	UserVerification string   // "required" or "preferred"
+	ExpiresAt        time.Time
+}
+
+func NewPasskeyGet() *PasskeyGet {
+	rtn := &PasskeyGet{}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
+func (u *PasskeyGet) Check() error {
+	return nil
+}
+
+// Passkey is returned when a passkey has been registered
+type Passkey struct {
+	stamp.Timestamp
+
+	Id        string
+	Name      string
+	CreatedAt time.Time
+}
+
+func NewPasskey() *Passkey {
+	rtn := &Passkey{}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
+func (u *Passkey) Check() error {
+	return nil
+}
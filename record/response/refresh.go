@@ -0,0 +1,32 @@
+package response
+
+import (
+	"github.com/cgentry/gus/record/stamp"
+	"time"
+)
+
+// Refresh is returned when a refresh token is traded in. The old session token and refresh token
+// can no longer be used; the caller must save the new ones.
+type Refresh struct {
+	stamp.Timestamp
+
+	Token            string // New session token
+	RefreshToken     string // Replaces the refresh token that was sent
+	RefreshExpiresAt time.Time
+
+	Ticket          string `json:",omitempty"` // Signed ticket, when tickets are turned on
+	TicketExpiresAt time.Time
+
+	LoginAt      time.Time // When the new session started
+	TimeoutAt    time.Time // Required to authenticate by
+	MaxSessionAt time.Time // When the new session will be forced off
+}
+
+func NewRefresh() *Refresh {
+	rtn := &Refresh{}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
+func (u *Refresh) Check() error {
+	return nil
+}
@@ -0,0 +1,21 @@
+package response
+
+import (
+	"github.com/cgentry/gus/record/stamp"
+	"time"
+)
+
+// Reset is returned to a system client when a lost password token is generated. The
+// client is responsible for getting the token to the user (e.g. by email).
+type Reset struct {
+	stamp.Timestamp
+	Login   string
+	Token   string
+	Expires time.Time
+}
+
+func NewReset() *Reset {
+	rtn := &Reset{}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
@@ -0,0 +1,36 @@
+package response
+
+import (
+	"github.com/cgentry/gus/record/stamp"
+	"time"
+)
+
+// SessionReturn is the public view of one of the user's sessions. Tokens are never returned.
+type SessionReturn struct {
+	Id       string // Identifier for the session
+	ClientId string // Client the user logged in through
+	Device   string // Device name given at login
+
+	CreatedAt    time.Time // When the user logged in
+	LastAuthAt   time.Time // Last time the session was used
+	TimeoutAt    time.Time // Required to authenticate by
+	MaxSessionAt time.Time // When the session will be forced off
+
+	Current bool // True if this is the session making the request
+}
+
+// SessionList is returned when a user asks for all of the sessions they have open.
+type SessionList struct {
+	stamp.Timestamp
+	Sessions []SessionReturn
+}
+
+func NewSessionList() *SessionList {
+	rtn := &SessionList{}
+	rtn.SetStamp(time.Now())
+	rtn.Sessions = []SessionReturn{}
+	return rtn
+}
+func (u *SessionList) Check() error {
+	return nil
+}
@@ -0,0 +1,19 @@
+package response
+
+import (
+	"github.com/cgentry/gus/record/stamp"
+	"time"
+)
+
+// Ticket is returned when a client asks for a new signed ticket for a session.
+type Ticket struct {
+	stamp.Timestamp
+	Ticket    string
+	ExpiresAt time.Time
+}
+
+func NewTicket() *Ticket {
+	rtn := &Ticket{}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
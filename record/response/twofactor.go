@@ -0,0 +1,41 @@
+package response
+
+import (
+	"github.com/cgentry/gus/record/stamp"
+	"time"
+)
+
+// TotpEnroll is returned when a user starts two-factor enrollment. The Uri is normally shown
+// as a QR code; the Secret is for users that have to type it in.
+type TotpEnroll struct {
+	stamp.Timestamp
+
+	Secret string
+	Uri    string // otpauth:// URI
+}
+
+func NewTotpEnroll() *TotpEnroll {
+	rtn := &TotpEnroll{}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
+func (u *TotpEnroll) Check() error {
+	return nil
+}
+
+// RecoveryCodes are returned when two-factor is turned on. Each code can be used once in place
+// of an authenticator code. They are never shown again.
+type RecoveryCodes struct {
+	stamp.Timestamp
+
+	Codes []string
+}
+
+func NewRecoveryCodes() *RecoveryCodes {
+	rtn := &RecoveryCodes{}
+	rtn.SetStamp(time.Now())
+	return rtn
+}
+func (u *RecoveryCodes) Check() error {
+	return nil
+}
@@ -12,10 +12,23 @@ type UserReturn struct {
 	Guid  string // Permanent User ID for external linking (Within systems)
 	Token string // Send THIS to login with
 
+	Ticket          string    `json:",omitempty"` // Signed ticket, when tickets are turned on
+	TicketExpiresAt time.Time // Use the Token to get a new ticket before this
+
+	RefreshToken     string    `json:",omitempty"` // Trade at /refresh/ for a new Token. Keep it safe
+	RefreshExpiresAt time.Time // The refresh token can't be used after this
+
+	SecondFactorRequired bool      `json:",omitempty"` // Password accepted: send FactorToken and a code to /login/factor/
+	FactorToken          string    `json:",omitempty"`
+	FactorExpiresAt      time.Time // The second factor must be given before this
+
 	FullName  string // FULL user name ("Jane Doe")
 	LoginName string // The ID they use to login with
 	Email     string // Email address
 
+	Roles       []string `json:",omitempty"` // Roles the user has been given
+	Permissions []string `json:",omitempty"` // Every permission, from the roles and given directly
+
 	LoginAt      time.Time // THIS login time
 	LastAuthAt   time.Time // Last login time
 	TimeoutAt    time.Time // Required to authenticate by
@@ -0,0 +1,168 @@
+package tenant
+
+import (
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"sort"
+	"strings"
+)
+
+// SetAccess takes the permissions each role gives from the configuration. Any role or
+// permission name that isn't valid is an error and nothing is changed.
+func SetAccess(c configure.Access) error {
+	roles := make(map[string][]string)
+	for role, permissions := range c.Roles {
+		role = strings.ToLower(strings.TrimSpace(role))
+		if !ValidAccessName(role) {
+			return ErrInvalidAccessName
+		}
+		list, err := accessList(permissions)
+		if err != nil {
+			return err
+		}
+		roles[role] = list
+	}
+	userControl.roles = roles
+	return nil
+}
+
+// ValidAccessName is true when the role or permission name can be stored. Names are made of
+// lower case letters, digits and '.', '_', '-' or ':', e.g. 'users.read' or 'billing:admin'.
+func ValidAccessName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == '-', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// accessList splits a comma separated list of names, checking each one. The list is sorted
+// with duplicates removed. Names that aren't valid (e.g. from a record edited by hand) are left
+// out of the list and ErrInvalidAccessName is returned along with the names that are valid.
+func accessList(names string) ([]string, error) {
+	var list []string
+	var err error
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if !ValidAccessName(name) {
+			err = ErrInvalidAccessName
+			continue
+		}
+		seen[name] = true
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list, err
+}
+
+// RoleList returns the user's roles, sorted
+func (user *User) RoleList() []string {
+	list, _ := accessList(user.Roles)
+	return list
+}
+
+// PermissionList returns the permissions granted to the user directly, sorted. Use
+// AllPermissions to include the ones their roles give.
+func (user *User) PermissionList() []string {
+	list, _ := accessList(user.Permissions)
+	return list
+}
+
+// AllPermissions returns every permission the user holds, directly or through a role, sorted.
+func (user *User) AllPermissions() []string {
+	all := strings.Join(user.PermissionList(), ",")
+	for _, role := range user.RoleList() {
+		all += "," + strings.Join(userControl.roles[role], ",")
+	}
+	list, _ := accessList(all)
+	return list
+}
+
+// HasRole is true when the user has been given the role
+func (user *User) HasRole(role string) bool {
+	return contains(user.RoleList(), strings.ToLower(strings.TrimSpace(role)))
+}
+
+// HasPermission is true when the user holds the permission, directly or through a role
+func (user *User) HasPermission(permission string) bool {
+	return contains(user.AllPermissions(), strings.ToLower(strings.TrimSpace(permission)))
+}
+
+// GrantRole gives the user a role. False is returned if they already had it.
+func (user *User) GrantRole(role string) (bool, error) {
+	return grant(&user.Roles, role)
+}
+
+// RevokeRole takes a role away from the user. False is returned if they didn't have it.
+func (user *User) RevokeRole(role string) (bool, error) {
+	return revoke(&user.Roles, role)
+}
+
+// GrantPermission gives the user a permission directly. False is returned if it was already
+// granted directly; a permission that comes from a role is still added.
+func (user *User) GrantPermission(permission string) (bool, error) {
+	return grant(&user.Permissions, permission)
+}
+
+// RevokePermission takes away a permission granted directly. Permissions that come from a role
+// can only be taken away by revoking the role. False is returned if it wasn't granted directly.
+func (user *User) RevokePermission(permission string) (bool, error) {
+	return revoke(&user.Permissions, permission)
+}
+
+func grant(names *string, name string) (bool, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !ValidAccessName(name) {
+		return false, ErrInvalidAccessName
+	}
+	list, _ := accessList(*names)
+	if contains(list, name) {
+		return false, nil
+	}
+	list, _ = accessList(strings.Join(append(list, name), ","))
+	*names = strings.Join(append(list, unreadable(*names)...), ",")
+	return true, nil
+}
+
+func revoke(names *string, name string) (bool, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !ValidAccessName(name) {
+		return false, ErrInvalidAccessName
+	}
+	list, _ := accessList(*names)
+	for i, have := range list {
+		if have == name {
+			*names = strings.Join(append(append(list[:i], list[i+1:]...), unreadable(*names)...), ",")
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// unreadable returns the names that aren't valid, as they are stored. Changing a list keeps
+// them: an unreadable capability may have been a limit and still has to stop the client.
+func unreadable(names string) []string {
+	var bad []string
+	for _, name := range strings.Split(names, ",") {
+		if lname := strings.ToLower(strings.TrimSpace(name)); lname != "" && !ValidAccessName(lname) {
+			bad = append(bad, name)
+		}
+	}
+	return bad
+}
+
+func contains(list []string, name string) bool {
+	i := sort.SearchStrings(list, name)
+	return i < len(list) && list[i] == name
+}
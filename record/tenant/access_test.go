@@ -0,0 +1,70 @@
+package tenant
+
+import (
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAccess(t *testing.T) {
+	defer SetAccess(configure.Access{})
+
+	Convey("Role names are checked", t, func() {
+		So(ValidAccessName("users.read"), ShouldBeTrue)
+		So(ValidAccessName("billing:admin_2"), ShouldBeTrue)
+		So(ValidAccessName(""), ShouldBeFalse)
+		So(ValidAccessName("a,b"), ShouldBeFalse)
+		So(ValidAccessName("Users"), ShouldBeFalse)
+		So(SetAccess(configure.Access{Roles: map[string]string{"bad role": "x"}}), ShouldEqual, ErrInvalidAccessName)
+		So(SetAccess(configure.Access{Roles: map[string]string{"admin": "x, bad perm"}}), ShouldEqual, ErrInvalidAccessName)
+	})
+	Convey("Users hold permissions directly and through roles", t, func() {
+		So(SetAccess(configure.Access{Roles: map[string]string{
+			"Admin":   "users.read, users.write",
+			"support": "users.read",
+		}}), ShouldBeNil)
+		user := NewUser()
+		So(user.HasPermission("users.read"), ShouldBeFalse)
+
+		ok, err := user.GrantRole("support")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		ok, _ = user.GrantRole("Support")
+		So(ok, ShouldBeFalse)
+		So(user.HasRole("support"), ShouldBeTrue)
+		So(user.HasPermission("users.read"), ShouldBeTrue)
+		So(user.HasPermission("users.write"), ShouldBeFalse)
+
+		ok, err = user.GrantPermission("billing:view")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		user.GrantPermission("audit")
+		So(user.Permissions, ShouldEqual, "audit,billing:view")
+		user.GrantRole("admin")
+		So(user.Roles, ShouldEqual, "admin,support")
+		So(user.AllPermissions(), ShouldResemble, []string{"audit", "billing:view", "users.read", "users.write"})
+
+		_, err = user.GrantPermission("no good")
+		So(err, ShouldEqual, ErrInvalidAccessName)
+
+		Convey("Revoking a role takes its permissions away", func() {
+			ok, err := user.RevokeRole("admin")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(user.HasPermission("users.write"), ShouldBeFalse)
+			So(user.HasPermission("users.read"), ShouldBeTrue)
+			ok, _ = user.RevokeRole("admin")
+			So(ok, ShouldBeFalse)
+		})
+		Convey("Permissions from a role can't be revoked directly", func() {
+			ok, err := user.RevokePermission("users.read")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			So(user.HasPermission("users.read"), ShouldBeTrue)
+			ok, _ = user.RevokePermission("audit")
+			So(ok, ShouldBeTrue)
+			So(user.PermissionList(), ShouldResemble, []string{"billing:view"})
+		})
+	})
+}
@@ -0,0 +1,82 @@
+package tenant
+
+import (
+	"strings"
+)
+
+const (
+	// CAPABILITY_SERVICE is the prefix for a capability that names a service the client may
+	// call, e.g. 'service:update'.
+	CAPABILITY_SERVICE = "service:"
+
+	// CAPABILITY_NO_SERVICE is left when a client's last 'service:' capability is revoked, so
+	// the client can't call any service rather than every one.
+	CAPABILITY_NO_SERVICE = CAPABILITY_SERVICE + "none"
+
+	// CAPABILITY_ADMIN lets a system client call the admin services
+	CAPABILITY_ADMIN = "admin"
+)
+
+// CapabilityList returns the client's capabilities, sorted
+func (user *User) CapabilityList() []string {
+	list, _ := accessList(user.Capabilities)
+	return list
+}
+
+// HasCapability is true when the client has been given the capability
+func (user *User) HasCapability(capability string) bool {
+	return contains(user.CapabilityList(), strings.ToLower(strings.TrimSpace(capability)))
+}
+
+// CanCallService is true when the client may call the service. A client that hasn't been given
+// any 'service:' capabilities may call every service, so existing clients keep working. If any of
+// the stored capabilities can't be read, the client can't call anything: the bad one might have
+// been a 'service:' limit.
+func (user *User) CanCallService(name string) bool {
+	list, err := accessList(user.Capabilities)
+	if err != nil {
+		return false
+	}
+	want := CAPABILITY_SERVICE + strings.ToLower(strings.TrimSpace(name))
+	if want == CAPABILITY_NO_SERVICE {
+		return false
+	}
+	return !serviceLimited(list) || contains(list, want)
+}
+
+// GrantCapability gives the client a capability. False is returned if they already had it.
+// Granting a service replaces the marker left when the last one was revoked.
+func (user *User) GrantCapability(capability string) (bool, error) {
+	ok, err := grant(&user.Capabilities, capability)
+	if ok && strings.HasPrefix(strings.ToLower(strings.TrimSpace(capability)), CAPABILITY_SERVICE) {
+		revoke(&user.Capabilities, CAPABILITY_NO_SERVICE)
+	}
+	return ok, err
+}
+
+// RevokeCapability takes a capability away from the client. False is returned if they didn't have it.
+// Revoking the client's last 'service:' capability leaves CAPABILITY_NO_SERVICE in its place: the
+// client could call every service otherwise.
+func (user *User) RevokeCapability(capability string) (bool, error) {
+	capability = strings.ToLower(strings.TrimSpace(capability))
+	if capability == CAPABILITY_NO_SERVICE {
+		return false, nil
+	}
+	ok, err := revoke(&user.Capabilities, capability)
+	if ok && strings.HasPrefix(capability, CAPABILITY_SERVICE) {
+		if list, _ := accessList(user.Capabilities); !serviceLimited(list) {
+			grant(&user.Capabilities, CAPABILITY_NO_SERVICE)
+		}
+	}
+	return ok, err
+}
+
+// serviceLimited is true when the list holds any 'service:' capabilities
+func serviceLimited(list []string) bool {
+	for _, capability := range list {
+		if strings.HasPrefix(capability, CAPABILITY_SERVICE) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package tenant
+
+import (
+	. "github.com/cgentry/gus/ecode"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestCapability(t *testing.T) {
+	Convey("Clients without service capabilities can call every service", t, func() {
+		client := NewUser()
+		So(client.CanCallService("update"), ShouldBeTrue)
+
+		ok, err := client.GrantCapability("Permit_Email")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(client.HasCapability("permit_email"), ShouldBeTrue)
+		So(client.CanCallService("update"), ShouldBeTrue)
+
+		_, err = client.GrantCapability("no good")
+		So(err, ShouldEqual, ErrInvalidAccessName)
+
+		Convey("Service capabilities limit the calls", func() {
+			client.GrantCapability(CAPABILITY_SERVICE + "login")
+			client.GrantCapability(CAPABILITY_SERVICE + "login.factor")
+			So(client.Capabilities, ShouldEqual, "permit_email,service:login,service:login.factor")
+			So(client.CanCallService("login"), ShouldBeTrue)
+			So(client.CanCallService("login.factor"), ShouldBeTrue)
+			So(client.CanCallService("update"), ShouldBeFalse)
+
+			ok, _ := client.RevokeCapability("service:login")
+			So(ok, ShouldBeTrue)
+			So(client.CanCallService("login"), ShouldBeFalse)
+			client.RevokeCapability("service:login.factor")
+			So(client.Capabilities, ShouldEqual, "permit_email,"+CAPABILITY_NO_SERVICE)
+			So(client.CanCallService("login"), ShouldBeFalse)
+			So(client.CanCallService("none"), ShouldBeFalse)
+
+			ok, _ = client.RevokeCapability(CAPABILITY_NO_SERVICE)
+			So(ok, ShouldBeFalse)
+			So(client.CanCallService("update"), ShouldBeFalse)
+
+			client.GrantCapability(CAPABILITY_SERVICE + "update")
+			So(client.Capabilities, ShouldEqual, "permit_email,service:update")
+			So(client.CanCallService("update"), ShouldBeTrue)
+			So(client.CanCallService("login"), ShouldBeFalse)
+		})
+	})
+	Convey("A capability that can't be read stops every call", t, func() {
+		client := NewUser()
+		client.Capabilities = "admin,service:log in,service:update"
+		So(client.CapabilityList(), ShouldResemble, []string{"admin", "service:update"})
+		So(client.HasCapability(CAPABILITY_ADMIN), ShouldBeTrue)
+		So(client.CanCallService("update"), ShouldBeFalse)
+		So(client.CanCallService("login"), ShouldBeFalse)
+
+		ok, err := client.RevokeCapability("service:update")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(client.Capabilities, ShouldEqual, "admin,service:none,service:log in")
+		So(client.CanCallService("login"), ShouldBeFalse)
+
+		client.GrantCapability("permit_email")
+		So(client.Capabilities, ShouldEqual, "admin,permit_email,service:none,service:log in")
+		So(client.CanCallService("login"), ShouldBeFalse)
+	})
+}
@@ -1,24 +1,13 @@
 package tenant
 
-// This is a 'holding' routine for better password verification logic. Right now it does
-// very little.
+// CheckNewPassword applies the password policy to a new password. The user information
+// (login name, email) is passed so the policy can reject passwords that contain it.
 //
 
 import (
-	. "github.com/cgentry/gus/ecode"
-	"github.com/cgentry/gus/record/configure"
-	"strings"
+	"github.com/cgentry/gus/library/policy"
 )
 
-func CheckNewPassword(newPassword string) error {
-	if len(newPassword) < configure.PASSWORD_MINIMUM_LENGTH {
-		return ErrPasswordTooShort
-	}
-
-	lpwd := strings.ToLower(newPassword)
-
-	if lpwd == "password" {
-		return ErrPasswordTooSimple
-	}
-	return nil
+func CheckNewPassword(newPassword string, userInfo ...string) error {
+	return policy.CheckPassword(newPassword, userInfo...)
 }
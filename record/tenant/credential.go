@@ -0,0 +1,98 @@
+package tenant
+
+import (
+	"encoding/hex"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/webauthn"
+	"math"
+	"time"
+)
+
+// Standard name for the passkey credential store.
+const CREDENTIAL_STORE_NAME = "Credential"
+
+// Credential is a passkey registered by a user. A user may have many. Only the public key is
+// held: the private key never leaves the user's authenticator.
+type Credential struct {
+	Id     string // Credential id, base64url encoded as the browser sends it
+	Guid   string // User's GUID
+	Domain string // User's domain
+	Name   string // Name the user gave the passkey, e.g. "work laptop"
+
+	PublicKey []byte // COSE encoded public key
+	Algorithm int    // COSE algorithm of the key
+	SignCount uint32 // Last signature count seen. Zero if the authenticator doesn't keep one
+	Aaguid    string // Authenticator model, hex encoded. All zeros if not given
+	Format    string // Attestation format given at registration
+
+	CreatedAt  time.Time
+	LastUsedAt time.Time // Last login with the passkey. Zero until then
+}
+
+// NewCredential creates the stored passkey for a registration that has been checked.
+func NewCredential(user *User, name string, cred *webauthn.Credential) *Credential {
+	return &Credential{
+		Id:        webauthn.EncodeBase64(cred.Id),
+		Guid:      user.Guid,
+		Domain:    user.Domain,
+		Name:      name,
+		PublicKey: cred.PublicKey,
+		Algorithm: cred.Algorithm,
+		SignCount: cred.SignCount,
+		Aaguid:    hex.EncodeToString(cred.AAGUID),
+		Format:    cred.Format,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Passkey challenges are random values the browser has the authenticator sign. Only one is
+// kept for a user at a time and each can only be answered once. They prove a response is fresh
+// so, unlike tokens, they are held in the clear.
+
+// NewChallenge creates a new challenge for the user, replacing any that is outstanding.
+func (user *User) NewChallenge() string {
+	now := time.Now()
+	user.Challenge = newToken()
+	user.ChallengeExpiresAt = now.Add(userControl.ChallengeDuration)
+	user.UpdatedAt = now
+	return user.Challenge
+}
+
+// TakeChallenge returns the outstanding challenge and clears it. If there isn't one, or it is
+// too old to answer, ErrPasskeyChallenge is returned.
+func (user *User) TakeChallenge() (string, error) {
+	now := time.Now()
+	challenge, expires := user.Challenge, user.ChallengeExpiresAt
+	user.Challenge = ""
+	user.ChallengeExpiresAt = time.Time{}
+	user.UpdatedAt = now
+	if challenge == "" || !now.Before(expires) {
+		return "", ErrPasskeyChallenge
+	}
+	return challenge, nil
+}
+
+// LoginPasskey logs the user in with a passkey. The outstanding challenge is passed to verify,
+// which checks the response from the authenticator. An error from verify counts as a failed login.
+func (user *User) LoginPasskey(verify func(challenge string) error) error {
+	now := time.Now()
+	user.UpdatedAt = now
+
+	user.clearStaleFailures(now)
+	if locked, wait := user.IsLocked(now); locked {
+		return NewRetryError(ErrUserLocked, int(math.Ceil(wait.Seconds())))
+	}
+	challenge, err := user.TakeChallenge()
+	if err == nil {
+		err = verify(challenge)
+	}
+	if err != nil {
+		user.loginFailed(now)
+		return err
+	}
+	if !user.IsActive {
+		return ErrUserNotActive
+	}
+	user.startSession(now)
+	return nil
+}
@@ -0,0 +1,87 @@
+package tenant
+
+import (
+	"errors"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/webauthn"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestCredential(t *testing.T) {
+	Convey("A passkey is stored for its user", t, func() {
+		tuser := NewTestUser()
+		cred := NewCredential(tuser, "phone", &webauthn.Credential{
+			Id:        []byte{0xfb, 0xff},
+			PublicKey: []byte{0xa0},
+			Algorithm: webauthn.ALG_ES256,
+			SignCount: 3,
+			AAGUID:    make([]byte, 16),
+			Format:    webauthn.FORMAT_NONE,
+		})
+		So(cred.Id, ShouldEqual, "-_8")
+		So(cred.Guid, ShouldEqual, tuser.Guid)
+		So(cred.Domain, ShouldEqual, tuser.Domain)
+		So(cred.Name, ShouldEqual, "phone")
+		So(cred.SignCount, ShouldEqual, 3)
+		So(cred.Aaguid, ShouldEqual, "00000000000000000000000000000000")
+		So(cred.LastUsedAt.IsZero(), ShouldBeTrue)
+	})
+}
+
+func TestChallenge(t *testing.T) {
+	Convey("A challenge can only be answered once", t, func() {
+		tuser := NewTestUser()
+		_, err := tuser.TakeChallenge()
+		So(err, ShouldEqual, ErrPasskeyChallenge)
+
+		challenge := tuser.NewChallenge()
+		So(challenge, ShouldNotBeBlank)
+		So(tuser.NewChallenge(), ShouldNotEqual, challenge)
+
+		challenge = tuser.Challenge
+		got, err := tuser.TakeChallenge()
+		So(err, ShouldBeNil)
+		So(got, ShouldEqual, challenge)
+		_, err = tuser.TakeChallenge()
+		So(err, ShouldEqual, ErrPasskeyChallenge)
+
+		tuser.NewChallenge()
+		tuser.ChallengeExpiresAt = time.Now().Add(-time.Second)
+		_, err = tuser.TakeChallenge()
+		So(err, ShouldEqual, ErrPasskeyChallenge)
+		So(tuser.Challenge, ShouldBeBlank)
+	})
+}
+
+func TestLoginPasskey(t *testing.T) {
+	Convey("A passkey login needs the challenge to be answered", t, func() {
+		tuser := NewTestUser()
+		tuser.Logout()
+		challenge := tuser.NewChallenge()
+
+		var given string
+		So(tuser.LoginPasskey(func(c string) error { given = c; return nil }), ShouldBeNil)
+		So(given, ShouldEqual, challenge)
+		So(tuser.IsLoggedIn, ShouldBeTrue)
+		So(tuser.SessionToken, ShouldNotBeBlank)
+		So(tuser.Token, ShouldEqual, HashToken(tuser.SessionToken))
+
+		Convey("Without a challenge, the answer isn't checked", func() {
+			called := false
+			err := tuser.LoginPasskey(func(string) error { called = true; return nil })
+			So(err, ShouldEqual, ErrPasskeyChallenge)
+			So(called, ShouldBeFalse)
+			So(tuser.FailCount, ShouldEqual, 1)
+		})
+		Convey("A bad answer is a failed login", func() {
+			tuser.NewChallenge()
+			bad := errors.New("bad signature")
+			So(tuser.LoginPasskey(func(string) error { return bad }), ShouldEqual, bad)
+			So(tuser.IsLoggedIn, ShouldBeFalse)
+			So(tuser.FailCount, ShouldEqual, 1)
+			So(tuser.Challenge, ShouldBeBlank)
+		})
+	})
+}
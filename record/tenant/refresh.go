@@ -0,0 +1,90 @@
+package tenant
+
+import (
+	"time"
+)
+
+// Standard name for the refresh token store.
+const REFRESH_STORE_NAME = "Refresh"
+
+// Refresh is a long-lived token given out at login. It can be traded, once, for a new session
+// and a new refresh token, so a user can stay logged in past their maximum session length
+// without giving their password again.
+//
+// Every token that comes from the same login shares a Family. A token that has been traded in
+// is kept (marked as used) until the family ends: if it is ever seen again, someone has a copy
+// of it and the whole family, along with its sessions, is revoked.
+type Refresh struct {
+	Token        string // Hash of the refresh token
+	RefreshToken string `json:"-"` // Clear refresh token. Only set when created and never stored
+	Family       string // Shared by every token rotated from the same login
+
+	Guid     string // User's GUID
+	Domain   string // User's domain
+	ClientId string // GUID of the client that performed the login
+	Device   string // Device name given at login
+
+	CreatedAt time.Time
+	ExpiresAt time.Time // Must be traded in by
+	UsedAt    time.Time // When it was traded in. Zero until then
+}
+
+// NewRefresh creates the first refresh token for a session that has just been created by a login.
+// The session is marked as belonging to the new family.
+func NewRefresh(session *Session) *Refresh {
+	r := newRefresh(NewGuid(), session.Guid, session.Domain, session.ClientId, session.Device)
+	session.Family = r.Family
+	return r
+}
+
+func newRefresh(family, guid, domain, clientId, device string) *Refresh {
+	now := time.Now()
+	token := newToken()
+	return &Refresh{
+		Token:        HashToken(token),
+		RefreshToken: token,
+		Family:       family,
+		Guid:         guid,
+		Domain:       domain,
+		ClientId:     clientId,
+		Device:       device,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(userControl.RefreshTokenDuration),
+	}
+}
+
+// IsUsed returns true once the token has been traded in
+func (r *Refresh) IsUsed() bool {
+	return !r.UsedAt.IsZero()
+}
+
+// IsExpired returns true when the token can no longer be traded in
+func (r *Refresh) IsExpired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+// Rotate marks this token as used and returns a new session along with the refresh token
+// that replaces this one. Both belong to the same family. The used token must be saved
+// so that it is recognised if it is ever presented again.
+func (r *Refresh) Rotate() (*Session, *Refresh) {
+	now := time.Now()
+	r.UsedAt = now
+	timeout, maxSession := userControl.SessionTimes(r.Domain)
+
+	token := newToken()
+	session := &Session{
+		Id:           NewGuid(),
+		Token:        HashToken(token),
+		SessionToken: token,
+		Guid:         r.Guid,
+		Domain:       r.Domain,
+		ClientId:     r.ClientId,
+		Device:       r.Device,
+		Family:       r.Family,
+		CreatedAt:    now,
+		LastAuthAt:   now,
+		TimeoutAt:    now.Add(timeout),
+		MaxSessionAt: now.Add(maxSession),
+	}
+	return session, newRefresh(r.Family, r.Guid, r.Domain, r.ClientId, r.Device)
+}
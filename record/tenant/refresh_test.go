@@ -0,0 +1,36 @@
+package tenant
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestRefresh(t *testing.T) {
+	Convey("Refresh tokens rotate within a family", t, func() {
+		tuser := NewUser()
+		tuser.SetDomain("dom")
+		session := NewSession(tuser, "client", "phone")
+
+		first := NewRefresh(session)
+		So(first.RefreshToken, ShouldNotBeBlank)
+		So(first.Token, ShouldEqual, HashToken(first.RefreshToken))
+		So(session.Family, ShouldEqual, first.Family)
+		So(first.IsUsed(), ShouldBeFalse)
+		So(first.IsExpired(time.Now()), ShouldBeFalse)
+		So(first.IsExpired(first.ExpiresAt), ShouldBeTrue)
+
+		next, second := first.Rotate()
+		So(first.IsUsed(), ShouldBeTrue)
+		So(second.IsUsed(), ShouldBeFalse)
+		So(second.Family, ShouldEqual, first.Family)
+		So(second.Token, ShouldNotEqual, first.Token)
+		So(second.Device, ShouldEqual, "phone")
+
+		So(next.Family, ShouldEqual, first.Family)
+		So(next.Guid, ShouldEqual, tuser.Guid)
+		So(next.Id, ShouldNotEqual, session.Id)
+		So(next.Token, ShouldEqual, HashToken(next.SessionToken))
+		So(next.Authenticate(next.SessionToken), ShouldBeNil)
+	})
+}
@@ -0,0 +1,94 @@
+package tenant
+
+import (
+	"crypto/subtle"
+	. "github.com/cgentry/gus/ecode"
+	"time"
+)
+
+// Standard name for the session store.
+const SESSION_STORE_NAME = "Session"
+
+// Session is one login for a user. A user may have several sessions open at once,
+// one for each device or client they logged in from. Each session has its own token
+// and its own timeouts, so logging in from a second device leaves the first alone.
+type Session struct {
+	Id           string // Public identifier for the session. Safe to show to the user
+	Token        string // Hash of the session token
+	SessionToken string `json:"-"` // Clear session token. Only set when created and never stored
+
+	Guid     string // User's GUID
+	Domain   string // User's domain
+	ClientId string // GUID of the client that performed the login
+	Device   string // Optional device name given at login
+	Family   string // Refresh token family issued with the session. Blank if none
+
+	CreatedAt    time.Time // When the login occurred
+	LastAuthAt   time.Time // Last successful Authorisation
+	TimeoutAt    time.Time // Required to authenticate by
+	MaxSessionAt time.Time // When they MUST logout by
+}
+
+// NewSession creates a session for a user that has just logged in. The token issued by
+// User.Login is moved into the session along with the session timeouts.
+func NewSession(user *User, clientId, device string) *Session {
+	now := time.Now()
+	session := &Session{
+		Id:           NewGuid(),
+		Token:        user.Token,
+		SessionToken: user.SessionToken,
+		Guid:         user.Guid,
+		Domain:       user.Domain,
+		ClientId:     clientId,
+		Device:       device,
+		CreatedAt:    now,
+		LastAuthAt:   now,
+		TimeoutAt:    user.TimeoutAt,
+		MaxSessionAt: user.MaxSessionAt,
+	}
+	if session.Token == "" { // User wasn't logged in through Login
+		session.SessionToken = newToken()
+		session.Token = HashToken(session.SessionToken)
+		timeout, maxSession := userControl.SessionTimes(session.Domain)
+		session.TimeoutAt = now.Add(timeout)
+		session.MaxSessionAt = now.Add(maxSession)
+	}
+	return session
+}
+
+// IsExpired returns true when the session has timed out or has reached its maximum length
+func (session *Session) IsExpired(now time.Time) bool {
+	return !(now.Before(session.MaxSessionAt) && now.Before(session.TimeoutAt))
+}
+
+// Authenticate checks the token against the session and, if it is valid and the session
+// hasn't expired, extends the timeout. The session should be saved after this operation.
+func (session *Session) Authenticate(token string) error {
+	if token == "" || session.Token == "" ||
+		subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(session.Token)) != 1 {
+		return ErrSessionExpired
+	}
+	now := time.Now()
+	if session.IsExpired(now) {
+		return ErrSessionExpired
+	}
+	session.SessionToken = token
+	session.LastAuthAt = now
+	timeout, _ := userControl.SessionTimes(session.Domain)
+	session.TimeoutAt = now.Add(timeout)
+	if session.TimeoutAt.After(session.MaxSessionAt) {
+		session.TimeoutAt = session.MaxSessionAt
+	}
+	return nil
+}
+
+// UseSession copies the session into the user's record so the user's routines (e.g.
+// ChangePassword) work against the session the caller is using.
+func (user *User) UseSession(session *Session) {
+	user.IsLoggedIn = true
+	user.Token = session.Token
+	user.SessionToken = session.SessionToken
+	user.LastAuthAt = session.LastAuthAt
+	user.TimeoutAt = session.TimeoutAt
+	user.MaxSessionAt = session.MaxSessionAt
+}
@@ -0,0 +1,88 @@
+package tenant
+
+import (
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/encryption/drivers/plaintext"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	plaintext.Register()
+	plaintext.SetDefault()
+	pwd := "TestingPassvord"
+
+	Convey("Each login gets its own session", t, func() {
+		tuser := NewUser()
+		tuser.SetDomain("dom")
+		tuser.SetPassword(pwd)
+
+		So(tuser.Login(pwd), ShouldBeNil)
+		first := NewSession(tuser, "client", "phone")
+		So(first.SessionToken, ShouldNotBeBlank)
+		So(first.Token, ShouldEqual, HashToken(first.SessionToken))
+		So(first.Guid, ShouldEqual, tuser.Guid)
+		So(first.Domain, ShouldEqual, "dom")
+		So(first.Device, ShouldEqual, "phone")
+		So(len(first.Id), ShouldEqual, 36)
+
+		So(tuser.Login(pwd), ShouldBeNil)
+		second := NewSession(tuser, "client", "laptop")
+		So(second.Token, ShouldNotEqual, first.Token)
+		So(second.Id, ShouldNotEqual, first.Id)
+
+		So(first.Authenticate(first.SessionToken), ShouldBeNil)
+		So(second.Authenticate(second.SessionToken), ShouldBeNil)
+		So(first.Authenticate(second.SessionToken), ShouldEqual, ErrSessionExpired)
+		So(first.Authenticate(first.Token), ShouldEqual, ErrSessionExpired)
+		So(first.Authenticate(``), ShouldEqual, ErrSessionExpired)
+	})
+
+	Convey("A session without a login gets a new token", t, func() {
+		tuser := NewUser()
+		tuser.Token = ""
+		session := NewSession(tuser, "client", "")
+		So(session.SessionToken, ShouldNotBeBlank)
+		So(session.IsExpired(time.Now()), ShouldBeFalse)
+		So(session.Authenticate(session.SessionToken), ShouldBeNil)
+	})
+
+	Convey("Expired sessions fail", t, func() {
+		tuser := NewUser()
+		tuser.SetPassword(pwd)
+		So(tuser.Login(pwd), ShouldBeNil)
+		session := NewSession(tuser, "client", "")
+		now := time.Now()
+
+		Convey("Timeout", func() {
+			session.TimeoutAt = now.Add(-1 * time.Second)
+			So(session.IsExpired(now), ShouldBeTrue)
+			So(session.Authenticate(session.SessionToken), ShouldEqual, ErrSessionExpired)
+		})
+		Convey("Maximum session length", func() {
+			session.MaxSessionAt = now.Add(-1 * time.Second)
+			So(session.IsExpired(now), ShouldBeTrue)
+			So(session.Authenticate(session.SessionToken), ShouldEqual, ErrSessionExpired)
+		})
+		Convey("Timeout is never past the maximum session", func() {
+			session.MaxSessionAt = now.Add(time.Second)
+			So(session.Authenticate(session.SessionToken), ShouldBeNil)
+			So(session.TimeoutAt, ShouldEqual, session.MaxSessionAt)
+		})
+	})
+
+	Convey("Using a session lets the user change their password", t, func() {
+		tuser := NewUser()
+		tuser.SetPassword(pwd)
+		So(tuser.Login(pwd), ShouldBeNil)
+		session := NewSession(tuser, "client", "")
+		tuser.Logout()
+
+		So(tuser.ChangePassword(pwd, `NewPassword`), ShouldNotBeNil)
+		So(session.Authenticate(session.SessionToken), ShouldBeNil)
+		tuser.UseSession(session)
+		So(tuser.SessionToken, ShouldEqual, session.SessionToken)
+		So(tuser.ChangePassword(pwd, `NewPassword`), ShouldBeNil)
+	})
+}
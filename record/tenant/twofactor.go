@@ -0,0 +1,160 @@
+package tenant
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/totp"
+	"math"
+	"strings"
+	"time"
+)
+
+// RECOVERY_CODES is the number of recovery codes given out when two-factor is turned on
+const RECOVERY_CODES = 10
+
+// RECOVERY_CODE_BYTES is the number of random bytes (80 bits) in each recovery code
+const RECOVERY_CODE_BYTES = 10
+
+// The user's TOTP secret is kept encrypted. These routines are given the clear secret by the
+// caller, which holds the storage field encrypter; the record itself only ever holds the
+// encrypted copy.
+
+// EnrollTotp starts two-factor enrollment with a new (encrypted) secret. Two-factor isn't
+// turned on until a code from the secret has been checked by ConfirmTotp.
+func (user *User) EnrollTotp(encryptedSecret string) error {
+	if user.TotpEnabled {
+		return ErrTwoFactorEnabled
+	}
+	user.TotpSecret = encryptedSecret
+	user.TotpStep = 0
+	user.UpdatedAt = time.Now()
+	return nil
+}
+
+// ConfirmTotp checks the first code from the user's authenticator. When it matches, two-factor
+// is turned on and a new set of recovery codes is returned. These are the only clear copies
+// of the codes: they must be shown to the user now.
+func (user *User) ConfirmTotp(secret, code string) ([]string, error) {
+	if user.TotpEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TotpSecret == "" || secret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	now := time.Now()
+	step, ok := totp.Verify(secret, code, now, user.TotpStep)
+	if !ok {
+		return nil, ErrSecondFactorInvalid
+	}
+	user.TotpStep = step
+	user.TotpEnabled = true
+	user.UpdatedAt = now
+	return user.NewRecoveryCodes(), nil
+}
+
+// LoginSecondFactor finishes a login that was started by Login. The token is the PendingToken
+// and the code is either the current TOTP code or one of the recovery codes. A wrong code
+// counts as a failed login and ends the attempt: the password must be given again.
+func (user *User) LoginSecondFactor(token, code, secret string) error {
+	now := time.Now()
+	user.UpdatedAt = now
+
+	user.clearStaleFailures(now)
+	if locked, wait := user.IsLocked(now); locked {
+		return NewRetryError(ErrUserLocked, int(math.Ceil(wait.Seconds())))
+	}
+	if token == "" || user.FactorToken == "" || !now.Before(user.FactorExpiresAt) ||
+		subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(user.FactorToken)) != 1 {
+		return ErrSecondFactorInvalid
+	}
+	user.clearFactorToken()
+	if !user.checkSecondFactor(secret, code, now) {
+		user.loginFailed(now)
+		return ErrSecondFactorInvalid
+	}
+	user.startSession(now)
+	return nil
+}
+
+// checkSecondFactor will accept either a TOTP code or a recovery code. A recovery code can
+// only be used once.
+func (user *User) checkSecondFactor(secret, code string, now time.Time) bool {
+	if secret != "" {
+		if step, ok := totp.Verify(secret, code, now, user.TotpStep); ok {
+			user.TotpStep = step
+			return true
+		}
+	}
+	return user.useRecoveryCode(code)
+}
+
+func (user *User) clearFactorToken() {
+	user.FactorToken = ""
+	user.PendingToken = ""
+	user.FactorExpiresAt = time.Time{}
+}
+
+// NewRecoveryCodes replaces any recovery codes with a new set. Only the hashes are kept.
+// Each code is 16 characters, shown in groups of four (e.g. abcd-efgh-ijkl-mnop).
+func (user *User) NewRecoveryCodes() []string {
+	codes := make([]string, RECOVERY_CODES)
+	hashes := make([]string, RECOVERY_CODES)
+	for i := range codes {
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(randomBytes(RECOVERY_CODE_BYTES)))
+		codes[i] = raw[:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:]
+		hashes[i] = user.hashRecoveryCode(raw)
+	}
+	user.RecoveryCodes = strings.Join(hashes, ",")
+	user.UpdatedAt = time.Now()
+	return codes
+}
+
+// RecoveryCodesLeft returns the number of recovery codes that haven't been used
+func (user *User) RecoveryCodesLeft() int {
+	if user.RecoveryCodes == "" {
+		return 0
+	}
+	return len(strings.Split(user.RecoveryCodes, ","))
+}
+
+// useRecoveryCode checks the code against the unused recovery codes. A match is removed.
+// Case, spaces and dashes are ignored.
+func (user *User) useRecoveryCode(code string) bool {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if code == "" || user.RecoveryCodes == "" {
+		return false
+	}
+	hash := []byte(user.hashRecoveryCode(code))
+	hashes := strings.Split(user.RecoveryCodes, ",")
+	for i, have := range hashes {
+		if subtle.ConstantTimeCompare(hash, []byte(have)) == 1 {
+			hashes = append(hashes[:i], hashes[i+1:]...)
+			user.RecoveryCodes = strings.Join(hashes, ",")
+			return true
+		}
+	}
+	return false
+}
+
+// hashRecoveryCode returns the value stored for a recovery code. It is keyed with the user's
+// salt so the same code has a different hash for every user.
+func (user *User) hashRecoveryCode(code string) string {
+	mac := hmac.New(sha256.New, []byte(user.Salt))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ResetTwoFactor is used by an administrator to turn two-factor off for a user who has lost
+// their authenticator and recovery codes. The user can enroll again once they login.
+func (user *User) ResetTwoFactor() {
+	user.TotpSecret = ""
+	user.TotpEnabled = false
+	user.TotpStep = 0
+	user.RecoveryCodes = ""
+	user.clearFactorToken()
+	user.UpdatedAt = time.Now()
+}
@@ -0,0 +1,105 @@
+package tenant
+
+import (
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/encryption/drivers/plaintext"
+	"github.com/cgentry/gus/library/totp"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+const twoFactorSecret = "JBSWY3DPEHPK3PXP"
+
+func currentCode() string {
+	code, _ := totp.Code(twoFactorSecret, totp.Step(time.Now()))
+	return code
+}
+
+func TestTwoFactorEnroll(t *testing.T) {
+	Convey("Two-factor is only turned on by a good first code", t, func() {
+		tuser := NewUser()
+		_, err := tuser.ConfirmTotp(twoFactorSecret, currentCode())
+		So(err, ShouldEqual, ErrTwoFactorNotEnrolled)
+
+		So(tuser.EnrollTotp("encrypted"), ShouldBeNil)
+		So(tuser.TotpEnabled, ShouldBeFalse)
+		_, err = tuser.ConfirmTotp(twoFactorSecret, "000000")
+		So(err, ShouldEqual, ErrSecondFactorInvalid)
+
+		codes, err := tuser.ConfirmTotp(twoFactorSecret, currentCode())
+		So(err, ShouldBeNil)
+		So(tuser.TotpEnabled, ShouldBeTrue)
+		So(len(codes), ShouldEqual, RECOVERY_CODES)
+		So(tuser.RecoveryCodesLeft(), ShouldEqual, RECOVERY_CODES)
+		So(tuser.RecoveryCodes, ShouldNotContainSubstring, codes[0])
+		So(len(codes[0]), ShouldEqual, 19)
+		So(strings.Count(codes[0], "-"), ShouldEqual, 3)
+		So(tuser.RecoveryCodes, ShouldNotContainSubstring, HashToken(strings.Replace(codes[0], "-", "", -1)))
+		So(tuser.EnrollTotp("again"), ShouldEqual, ErrTwoFactorEnabled)
+
+		tuser.ResetTwoFactor()
+		So(tuser.TotpEnabled, ShouldBeFalse)
+		So(tuser.TotpSecret, ShouldBeBlank)
+		So(tuser.RecoveryCodesLeft(), ShouldEqual, 0)
+	})
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	plaintext.Register()
+	plaintext.SetDefault()
+	pwd := "TestingPassvord"
+
+	Convey("A password login waits for the second factor", t, func() {
+		tuser := NewUser()
+		tuser.SetDomain("dom")
+		tuser.SetPassword(pwd)
+		tuser.EnrollTotp("encrypted")
+		codes, _ := tuser.ConfirmTotp(twoFactorSecret, currentCode())
+		tuser.TotpStep = 0 // Let the same code be used again below
+
+		So(tuser.Login(pwd), ShouldEqual, ErrSecondFactorRequired)
+		So(tuser.IsLoggedIn, ShouldBeFalse)
+		So(tuser.SessionToken, ShouldBeBlank)
+		So(tuser.PendingToken, ShouldNotBeBlank)
+		So(tuser.FactorToken, ShouldEqual, HashToken(tuser.PendingToken))
+		token := tuser.PendingToken
+
+		Convey("The code finishes the login and can't be used twice", func() {
+			So(tuser.LoginSecondFactor("wrong", currentCode(), twoFactorSecret), ShouldEqual, ErrSecondFactorInvalid)
+			So(tuser.FailCount, ShouldEqual, 0)
+
+			code := currentCode()
+			So(tuser.LoginSecondFactor(token, code, twoFactorSecret), ShouldBeNil)
+			So(tuser.IsLoggedIn, ShouldBeTrue)
+			So(tuser.SessionToken, ShouldNotBeBlank)
+			So(tuser.FactorToken, ShouldBeBlank)
+
+			tuser.Login(pwd)
+			So(tuser.LoginSecondFactor(tuser.PendingToken, code, twoFactorSecret), ShouldEqual, ErrSecondFactorInvalid)
+		})
+		Convey("A wrong code is a failed login and ends the attempt", func() {
+			So(tuser.LoginSecondFactor(token, "000000", twoFactorSecret), ShouldEqual, ErrSecondFactorInvalid)
+			So(tuser.FailCount, ShouldEqual, 1)
+			So(tuser.LoginSecondFactor(token, currentCode(), twoFactorSecret), ShouldEqual, ErrSecondFactorInvalid)
+		})
+		Convey("Recovery codes work once", func() {
+			So(tuser.LoginSecondFactor(token, strings.ToUpper(codes[3]), ""), ShouldBeNil)
+			So(tuser.RecoveryCodesLeft(), ShouldEqual, RECOVERY_CODES-1)
+
+			tuser.Login(pwd)
+			So(tuser.LoginSecondFactor(tuser.PendingToken, codes[3], ""), ShouldEqual, ErrSecondFactorInvalid)
+		})
+		Convey("Recovery codes only work for their own user", func() {
+			other := NewUser()
+			other.RecoveryCodes = tuser.RecoveryCodes
+			So(other.useRecoveryCode(codes[3]), ShouldBeFalse)
+			So(tuser.useRecoveryCode(codes[3]), ShouldBeTrue)
+		})
+		Convey("The token expires", func() {
+			tuser.FactorExpiresAt = time.Now().Add(-time.Second)
+			So(tuser.LoginSecondFactor(token, currentCode(), twoFactorSecret), ShouldEqual, ErrSecondFactorInvalid)
+		})
+	})
+}
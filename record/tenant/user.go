@@ -4,13 +4,16 @@
 package tenant
 
 import (
-	"crypto/md5"
 	"crypto/rand"
-	"errors"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	. "github.com/cgentry/gus/ecode"
 	"github.com/cgentry/gus/library/encryption"
 	"github.com/cgentry/gus/record/configure"
+	"math"
 	"time"
 )
 
@@ -30,6 +33,11 @@ func initialiseControl() *UserControl {
 
 	u.SetMaxDuration("24h")
 	u.SetTimeout("20m")
+	u.SetResetDuration("1h")
+	u.SetRefreshDuration("720h")
+	u.SetFactorDuration("5m")
+	u.SetChallengeDuration("5m")
+	u.SetVerifyDuration("24h")
 	return &u
 }
 
@@ -42,6 +50,19 @@ var userControl = initialiseControl()
 type UserControl struct {
 	MaximumSessionDuration  time.Duration
 	TimeSinceAuthentication time.Duration
+	ResetTokenDuration      time.Duration
+	RefreshTokenDuration    time.Duration // How long a refresh token can be traded for a new session
+	FactorTokenDuration     time.Duration // How long a user has to give their second factor after the password
+	ChallengeDuration       time.Duration // How long a passkey challenge can be answered
+	VerifyTokenDuration     time.Duration // How long a new user has to verify their email address
+
+	domains map[string]sessionLimit // Session times for domains that don't use the defaults
+	roles   map[string][]string     // Permissions given by each role
+
+	MaxFailures   int           // Failed logins before the account is locked (0 = never)
+	FailureWindow time.Duration // How long a failed login is remembered
+	LockoutPeriod time.Duration // First lockout period. Doubles with each failure after a lock ends
+	AutoUnlock    time.Duration // Time after the last failure when the account unlocks (0 = never)
 }
 
 // SetMaxDuration will take a maximimum  time a user can have a session alive
@@ -57,6 +78,98 @@ func (uc *UserControl) SetTimeout(interval string) (err error) {
 	return err
 }
 
+// SetResetDuration will take an interval string used to set how long a lost password token is valid for
+func (uc *UserControl) SetResetDuration(interval string) (err error) {
+	uc.ResetTokenDuration, err = time.ParseDuration(interval)
+	return err
+}
+
+// SetRefreshDuration will take an interval string used to set how long a refresh token is valid for
+func (uc *UserControl) SetRefreshDuration(interval string) (err error) {
+	uc.RefreshTokenDuration, err = time.ParseDuration(interval)
+	return err
+}
+
+// SetFactorDuration will take an interval string used to set how long a user has to give their
+// second factor once their password has been accepted
+func (uc *UserControl) SetFactorDuration(interval string) (err error) {
+	uc.FactorTokenDuration, err = time.ParseDuration(interval)
+	return err
+}
+
+// SetChallengeDuration will take an interval string used to set how long a passkey challenge
+// can be answered
+func (uc *UserControl) SetChallengeDuration(interval string) (err error) {
+	uc.ChallengeDuration, err = time.ParseDuration(interval)
+	return err
+}
+
+// SetVerifyDuration will take an interval string used to set how long an email verification
+// token is valid for
+func (uc *UserControl) SetVerifyDuration(interval string) (err error) {
+	uc.VerifyTokenDuration, err = time.ParseDuration(interval)
+	return err
+}
+
+// sessionLimit holds the session times for a single domain
+type sessionLimit struct {
+	MaximumSessionDuration  time.Duration
+	TimeSinceAuthentication time.Duration
+}
+
+// SetSessions will take the session times from the configuration. The configuration times
+// are all in minutes. Zero values leave the current times alone. Each domain with its own
+// limits gets the defaults for any time it doesn't give.
+func (uc *UserControl) SetSessions(c configure.Session) {
+	if c.MaxSession > 0 {
+		uc.MaximumSessionDuration = time.Duration(c.MaxSession) * time.Minute
+	}
+	if c.Timeout > 0 {
+		uc.TimeSinceAuthentication = time.Duration(c.Timeout) * time.Minute
+	}
+	uc.domains = make(map[string]sessionLimit)
+	for domain, limit := range c.Domains {
+		l := sessionLimit{
+			MaximumSessionDuration:  uc.MaximumSessionDuration,
+			TimeSinceAuthentication: uc.TimeSinceAuthentication,
+		}
+		if limit.MaxSession > 0 {
+			l.MaximumSessionDuration = time.Duration(limit.MaxSession) * time.Minute
+		}
+		if limit.Timeout > 0 {
+			l.TimeSinceAuthentication = time.Duration(limit.Timeout) * time.Minute
+		}
+		uc.domains[domain] = l
+	}
+}
+
+// SessionTimes returns the idle timeout and maximum session length for a domain
+func (uc *UserControl) SessionTimes(domain string) (timeout, maxSession time.Duration) {
+	if l, ok := uc.domains[domain]; ok {
+		return l.TimeSinceAuthentication, l.MaximumSessionDuration
+	}
+	return uc.TimeSinceAuthentication, uc.MaximumSessionDuration
+}
+
+// SetSessions sets the session times used for all logins.
+func SetSessions(c configure.Session) {
+	userControl.SetSessions(c)
+}
+
+// SetLockout will take the lockout policy from the configuration. The configuration
+// times are all in minutes.
+func (uc *UserControl) SetLockout(policy configure.Lockout) {
+	uc.MaxFailures = policy.MaxFailures
+	uc.FailureWindow = time.Duration(policy.Window) * time.Minute
+	uc.LockoutPeriod = time.Duration(policy.Backoff) * time.Minute
+	uc.AutoUnlock = time.Duration(policy.AutoUnlock) * time.Minute
+}
+
+// SetLockout sets the lockout policy used for all user logins.
+func SetLockout(policy configure.Lockout) {
+	userControl.SetLockout(policy)
+}
+
 // UserInterface defines what is required for a user record.
 type UserInterface interface {
 	Login(string) error
@@ -79,7 +192,34 @@ type User struct {
 	Domain    string `name:"Domain" help:"The group that the user belongs to"`
 	LoginName string `name:"Login name" help:"The name the user uses to login with"`
 	Password  string `name:"Encrypted password" help:"This is the user's encrypted password."`
-	Token     string // Generated at login-time
+	Token     string // Hash of the session token generated at login-time
+
+	SessionToken string `json:"-"` // Clear session token. Only set by Login and never stored
+
+	ResetToken     string    // Single-use token for a lost password
+	ResetExpiresAt time.Time // When the reset token can no longer be used
+
+	TotpSecret    string // TOTP secret, encrypted with the storage field encrypter. Blank if not enrolled
+	TotpEnabled   bool   // Set once the first code from the secret has been checked
+	TotpStep      int64  // Time step of the last code used. It, and older codes, can't be used again
+	RecoveryCodes string // Hashes of the unused recovery codes, comma separated
+
+	FactorToken     string    // Hash of the token given out when a login needs the second factor
+	FactorExpiresAt time.Time // When the second factor must be given by
+	PendingToken    string    `json:"-"` // Clear second factor token. Only set by Login and never stored
+
+	LockedOut bool `json:"-"` // Set when this failed login locked the account. Never stored
+
+	Challenge          string    // Passkey challenge waiting for an answer. Single use
+	ChallengeExpiresAt time.Time // When the challenge must be answered by
+
+	VerifyToken     string    // Hash of the token sent to verify the email address
+	VerifyExpiresAt time.Time // When the verification token can no longer be used
+
+	Roles       string // Comma separated roles, e.g. "admin,support"
+	Permissions string // Comma separated permissions granted to the user directly
+
+	Capabilities string // Comma separated capabilities of a client, e.g. "permit_email,service:update"
 
 	Salt string // Magic number used to hash values for user
 
@@ -139,13 +279,37 @@ func (u *User) String() string {
 // CreateSalt will create a magic number for use with other functions,
 // like creating a GUID or a token.
 func CreateSalt(len int) string {
+	return fmt.Sprintf("%x", randomBytes(len))
+}
+
+// randomBytes returns len bytes from the crypto random source.
+func randomBytes(len int) []byte {
 	b := make([]byte, len)
 	_, err := rand.Read(b)
 	if err != nil { // This should never happen
 		panic(err.Error()) // ...and won't be covered in coverage report
 	} // ...if it does - we can't run the system
+	return b
+}
 
-	return fmt.Sprintf("%x", b)
+// NewGuid returns a random (version 4) UUID as defined in RFC 4122,
+// formatted as xxxxxxxx-xxxx-4xxx-yxxx-xxxxxxxxxxxx
+func NewGuid() string {
+	b := randomBytes(16)
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// HashToken returns the value that is stored for a session token. Only the hash
+// is kept in the user's record, so a copy of the user table cannot be used to
+// take over a session. Storage lookups by token must hash the value first.
+func HashToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 /*
@@ -168,7 +332,7 @@ func NewUser() *User {
 	user.SetDomain("")
 	user.GenerateGuid()
 	user.Salt = CreateSalt(32)
-	user.Token = user.CreateToken()
+	user.Token = HashToken(user.CreateToken())
 
 	return user
 }
@@ -183,27 +347,24 @@ func NewTestUser() *User {
 	return user
 }
 
-// Generate a unique GUID for the user record. This GUID will be based upon random numbers
-// and the creation string.
+// Generate a unique GUID for the user record. This is a random (version 4) UUID.
 func (user *User) GenerateGuid() {
 	if user.Guid == "" {
-		guid := md5.New()
-		guid.Write([]byte(user.GetCreatedAtStr())) // Add in the creation string
-		guid.Write([]byte(CreateSalt(60)))         // A more entropy (so it isn't repeatable)
-		out := guid.Sum(nil)
-		user.Guid = fmt.Sprintf("%x-%x-%x-%x-%x", out[0:4], out[4:6], out[6:8], out[8:10], out[10:])
+		user.Guid = NewGuid()
 	}
 }
 
 // CreateToken will generate a short-use token for confirmation with authentication.
-// The token can be used as a ticket until it expires. Any program can gain access
-// to user information with it.
+// The token is 256 random bits, encoded so it is safe to use in a URL. It can be used
+// as a ticket until it expires. Any program can gain access to user information with it,
+// so only the HashToken value should ever be saved.
 func (user *User) CreateToken() string {
-	guid := md5.New()
-	guid.Write([]byte(user.Guid))      // Always based on user's GUID
-	guid.Write([]byte(CreateSalt(20))) // And a bit of random magic
-	out := guid.Sum(nil)
-	return fmt.Sprintf("%x-%x-%x-%x-%x", out[0:4], out[4:6], out[6:8], out[8:10], out[10:])
+	return newToken()
+}
+
+// newToken returns 256 random bits, encoded so they are safe to use in a URL
+func newToken() string {
+	return base64.RawURLEncoding.EncodeToString(randomBytes(32))
 }
 
 // CheckExpirationDates will see if the token is valid or expired. If it
@@ -211,8 +372,12 @@ func (user *User) CreateToken() string {
 func (user *User) CheckExpirationDates() error {
 
 	if user.LastAuthAt.Before(user.MaxSessionAt) && user.LastAuthAt.Before(user.TimeoutAt) {
+		timeout, _ := userControl.SessionTimes(user.Domain)
 		user.LastAuthAt = time.Now()
-		user.TimeoutAt = user.LastAuthAt.Add(userControl.TimeSinceAuthentication)
+		user.TimeoutAt = user.LastAuthAt.Add(timeout)
+		if user.TimeoutAt.After(user.MaxSessionAt) {
+			user.TimeoutAt = user.MaxSessionAt
+		}
 		user.UpdatedAt = user.LastAuthAt
 		return nil
 	}
@@ -225,7 +390,16 @@ func (user *User) CheckExpirationDates() error {
 // The user's record should be saved after this operation
 func (user *User) Authenticate(token string) error {
 	user.UpdatedAt = time.Now()
-	if token != "" && user.IsLoggedIn && token == user.Token {
+	if token != "" && user.Token != "" &&
+		subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(user.Token)) == 1 {
+		return user.checkSession()
+	}
+	return ErrSessionExpired
+}
+
+// checkSession makes sure the user is logged in and the session hasn't expired.
+func (user *User) checkSession() error {
+	if user.IsLoggedIn {
 		if err := user.CheckExpirationDates(); err == nil {
 			user.LastAuthAt = user.UpdatedAt
 			return nil
@@ -234,31 +408,148 @@ func (user *User) Authenticate(token string) error {
 	return ErrSessionExpired
 }
 
+// IsLocked will see if too many logins have failed. If the account is locked, the time
+// left before another login can be tried is returned. A locked account that has no time
+// limit returns zero: it must be unlocked by an administrator.
+func (user *User) IsLocked(now time.Time) (bool, time.Duration) {
+	if userControl.MaxFailures <= 0 || user.FailCount < userControl.MaxFailures {
+		return false, 0
+	}
+	since := now.Sub(user.LastFailedAt)
+	if userControl.AutoUnlock > 0 && since >= userControl.AutoUnlock {
+		return false, 0
+	}
+	if userControl.LockoutPeriod <= 0 {
+		if userControl.AutoUnlock > 0 {
+			return true, userControl.AutoUnlock - since
+		}
+		return true, 0
+	}
+
+	// Every failure past the limit doubles the time the account is locked for. Logins are refused
+	// without checking the password while it is locked, so only failures after the lock has
+	// ended are counted.
+	period := userControl.LockoutPeriod
+	for i := userControl.MaxFailures; i < user.FailCount && period < 24*time.Hour; i++ {
+		period *= 2
+	}
+	if userControl.AutoUnlock > 0 && period > userControl.AutoUnlock {
+		period = userControl.AutoUnlock
+	}
+	if since < period {
+		return true, period - since
+	}
+	return false, 0
+}
+
+// Unlock will clear out any failed logins so the user can login again.
+func (user *User) Unlock() {
+	user.FailCount = 0
+	user.LastFailedAt = time.Time{}
+	user.UpdatedAt = time.Now()
+}
+
+// Delete marks the user as deleted. They are turned off so they can't login; Restore brings
+// the record back but leaves them off until they are enabled.
+func (user *User) Delete() {
+	now := time.Now()
+	user.Deactivate()
+	user.DeletedAt = now
+	user.UpdatedAt = now
+}
+
+// Restore clears the deleted mark. The user must still be enabled before they can login.
+func (user *User) Restore() {
+	user.DeletedAt = time.Time{}
+	user.UpdatedAt = time.Now()
+}
+
+// IsDeleted is true when the user has been deleted and not restored
+func (user *User) IsDeleted() bool {
+	return !user.DeletedAt.IsZero()
+}
+
+// clearStaleFailures forgets failed logins that are outside of the failure window or
+// past the automatic unlock time. It starts every login attempt, so it also clears the
+// lockout flag left by an earlier attempt.
+func (user *User) clearStaleFailures(now time.Time) {
+	user.LockedOut = false
+	if user.FailCount == 0 {
+		return
+	}
+	since := now.Sub(user.LastFailedAt)
+	if userControl.AutoUnlock > 0 && since >= userControl.AutoUnlock {
+		user.FailCount = 0
+	} else if userControl.FailureWindow > 0 && since > userControl.FailureWindow &&
+		user.FailCount < userControl.MaxFailures {
+		user.FailCount = 0
+	}
+}
+
 // Login will authenticate the user and create the tokens required later
+// If the user has two-factor turned on, ErrSecondFactorRequired is returned instead and the
+// record holds the PendingToken to give back to LoginSecondFactor.
 func (user *User) Login(password string) error {
 
 	now := time.Now() // Get time marker all the times
 	user.UpdatedAt = now
 
+	user.clearStaleFailures(now)
+	if locked, wait := user.IsLocked(now); locked {
+		return NewRetryError(ErrUserLocked, int(math.Ceil(wait.Seconds())))
+	}
+
 	if err := user.CheckPassword(password); err != nil {
-		user.LastFailedAt = now // Save failure date/time
-		user.IsLoggedIn = false // Mark as not logged in
-		user.Token = ""         // Clear the token
-		user.FailCount++        // Increment failure count
+		user.loginFailed(now)
 		return err
 	}
+	if !user.IsActive {
+		return ErrUserNotActive
+	}
+
+	// The password is good. If it wasn't encrypted with the current driver and
+	// parameters, re-encrypt it now. The caller saves the record with UserUpdate.
+	if encryption.NeedsRehash(user.Password) {
+		user.Password = encryption.HashPassword(password, user.Salt)
+	}
+
+	// With two-factor turned on, the password only earns a short-lived token that
+	// must be given back with a code (see LoginSecondFactor).
+	if user.TotpEnabled {
+		user.PendingToken = newToken()
+		user.FactorToken = HashToken(user.PendingToken)
+		user.FactorExpiresAt = now.Add(userControl.FactorTokenDuration)
+		return ErrSecondFactorRequired
+	}
+	user.startSession(now)
+	return nil
+}
 
-	user.Token = user.CreateToken() // Give him a ticket
+// loginFailed records a failed login
+func (user *User) loginFailed(now time.Time) {
+	user.LastFailedAt = now // Save failure date/time
+	user.IsLoggedIn = false // Mark as not logged in
+	user.Token = ""         // Clear the token
+	user.SessionToken = ""
+	user.FailCount++ // Increment failure count
 
-	user.MaxSessionAt = now.Add(userControl.MaximumSessionDuration)
-	user.TimeoutAt = now.Add(userControl.TimeSinceAuthentication)
+	// Only the failure that reaches the limit locks the account: later ones just extend it.
+	user.LockedOut = userControl.MaxFailures > 0 && user.FailCount == userControl.MaxFailures
+}
+
+// startSession creates the tokens and times for a successful login
+func (user *User) startSession(now time.Time) {
+	user.SessionToken = user.CreateToken()    // Give him a ticket...
+	user.Token = HashToken(user.SessionToken) // ...but only keep the hash
+
+	timeout, maxSession := userControl.SessionTimes(user.Domain)
+	user.MaxSessionAt = now.Add(maxSession)
+	user.TimeoutAt = now.Add(timeout)
 	user.IsLoggedIn = true
 	user.LastAuthAt = now
 	user.LoginAt = now
 
 	user.FailCount = 0
-
-	return nil
 }
 
 // Logout will mark the record as 'logged out' and the user will be removed from the system
@@ -267,6 +558,7 @@ func (user *User) Logout() error {
 		return ErrUserNotLoggedIn
 	}
 	user.Token = ""
+	user.SessionToken = ""
 	user.IsLoggedIn = false
 	user.LogoutAt = time.Now()
 	user.UpdatedAt = user.LogoutAt
@@ -276,13 +568,13 @@ func (user *User) Logout() error {
 
 // ChangePassword to the new password. The user must be logged in for this
 func (user *User) ChangePassword(oldPassword, newPassword string) error {
-	if user.Authenticate(user.Token) == nil {
-		t := encryption.GetDefaultDriver()
-		if t.EncryptPassword(oldPassword, user.Salt) == user.Password {
-			if err := CheckNewPassword(newPassword); err != nil {
+	user.UpdatedAt = time.Now()
+	if user.checkSession() == nil {
+		if user.CheckPassword(oldPassword) == nil {
+			if err := CheckNewPassword(newPassword, user.LoginName, user.Email); err != nil {
 				return err
 			}
-			user.Password = t.EncryptPassword(newPassword, user.Salt)
+			user.Password = encryption.HashPassword(newPassword, user.Salt)
 			user.UpdatedAt = time.Now()
 			return nil
 		}
@@ -290,31 +582,67 @@ func (user *User) ChangePassword(oldPassword, newPassword string) error {
 	return ErrInvalidPasswordOrUser
 }
 
+// CheckPassword will check the password against the one stored. The stored password
+// records which driver (and parameters) created it, so that driver is used for the check.
 func (user *User) CheckPassword(testPassword string) error {
-	pwd := encryption.GetDefaultDriver().EncryptPassword(testPassword, user.Salt) // Encrypt password
-
-	if pwd != user.Password {
+	if !encryption.ComparePassword(user.Password, testPassword, user.Salt) {
 		return ErrInvalidPasswordOrUser
 	}
 	return nil
 }
 
-// This is used when a user loses their password. They request a password reset
-// based upon their email address. If they are logged in, they will not be able to
-// reset the password ( 'User still logged in'). When they are NOT logged in, a token
-// is generated and set. The client program later calls this with the email address
-// AND the token. When this is confirmed, the password is then set to the value of the
-// token and the user can go ahead and login as normal.
-func (user *User) GenerateLostPassword() (newPassword string, err error) {
+// GenerateLostPassword is used when a user loses their password. They request a password reset
+// based upon their login or email address and a single-use reset token is generated and set,
+// whether or not they are logged in. It is kept separately from the session token and is only
+// valid for a short period; only its hash is kept in the record. The client program later calls
+// ConfirmLostPassword with the token and the new password.
+func (user *User) GenerateLostPassword() (resetToken string) {
+	now := time.Now()
+	resetToken = newToken()
+	user.ResetToken = HashToken(resetToken)
+	user.ResetExpiresAt = now.Add(userControl.ResetTokenDuration)
+	user.UpdatedAt = now
+	return resetToken
+}
 
-	return
+// ConfirmLostPassword checks the reset token and, if it is valid, sets the new password.
+// The token can only be used once and is cleared when it is used or found to be expired.
+func (user *User) ConfirmLostPassword(resetToken, newPassword string) error {
+	now := time.Now()
+	if user.ResetToken == "" ||
+		subtle.ConstantTimeCompare([]byte(HashToken(resetToken)), []byte(user.ResetToken)) != 1 {
+		return ErrInvalidResetToken
+	}
+	if now.After(user.ResetExpiresAt) {
+		user.clearResetToken(now)
+		return ErrInvalidResetToken
+	}
+	if err := user.SetPassword(newPassword); err != nil {
+		return err
+	}
+	user.clearResetToken(now)
+	user.FailCount = 0
+	user.LastFailedAt = time.Time{}
+	return nil
 }
 
-func (user *User) ConfirmLostPassword(lostPwdToken string) (err error) {
-	if lostPwdToken == user.Token {
-		user.Password = encryption.GetDefaultDriver().EncryptPassword(lostPwdToken, user.Salt)
-	} else {
-		err = errors.New(`Invalid password or user id`)
+// ResetPassword is used by an administrator to give the user a new, generated, password. Any
+// outstanding lost password token is cleared. The new password is returned so it can be passed
+// on to the user.
+func (user *User) ResetPassword() (string, error) {
+	newPassword, err := encryption.GeneratePassword()
+	if err != nil {
+		return "", err
+	}
+	if err = user.SetPassword(newPassword); err != nil {
+		return "", err
 	}
-	return
+	user.clearResetToken(time.Now())
+	return newPassword, nil
+}
+
+func (user *User) clearResetToken(now time.Time) {
+	user.ResetToken = ""
+	user.ResetExpiresAt = time.Time{}
+	user.UpdatedAt = now
 }
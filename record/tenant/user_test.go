@@ -1,10 +1,16 @@
 package tenant
 
 import (
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/encryption"
+	"github.com/cgentry/gus/library/encryption/drivers/pbkdf2"
 	"github.com/cgentry/gus/library/encryption/drivers/plaintext"
+	"github.com/cgentry/gus/library/encryption/drivers/sha512"
+	"github.com/cgentry/gus/record/configure"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
 	//"fmt"
+	"strings"
 	"time"
 )
 
@@ -61,6 +67,14 @@ func TestGuid(t *testing.T) {
 		So(tuser.Salt, ShouldNotBeBlank)
 		So(len(tuser.Salt), ShouldEqual, 64)
 	})
+	Convey("Guid is a version 4 UUID", t, func() {
+		guid := NewGuid()
+		So(len(guid), ShouldEqual, 36)
+		So(guid[14:15], ShouldEqual, "4")
+		So(strings.Contains("89ab", guid[19:20]), ShouldBeTrue)
+		So(strings.Count(guid, "-"), ShouldEqual, 4)
+		So(NewGuid(), ShouldNotEqual, guid)
+	})
 }
 
 func TestLogin(t *testing.T) {
@@ -73,12 +87,27 @@ func TestLogin(t *testing.T) {
 		err := tuser.Login(pwd)
 		So(err, ShouldBeNil)
 
-		err = tuser.Authenticate(tuser.Token)
+		err = tuser.Authenticate(tuser.SessionToken)
 		So(err, ShouldEqual, nil)
 
 		err = tuser.Authenticate(``)
 		So(err, ShouldNotEqual, nil)
 	})
+	Convey("Only the hash of the token is kept", t, func() {
+		err := tuser.Login(pwd)
+		So(err, ShouldBeNil)
+		So(len(tuser.SessionToken), ShouldEqual, 43) // 256 bits, URL safe
+		So(strings.ContainsAny(tuser.SessionToken, "+/="), ShouldBeFalse)
+		So(tuser.Token, ShouldEqual, HashToken(tuser.SessionToken))
+		So(tuser.Token, ShouldNotEqual, tuser.SessionToken)
+
+		So(tuser.Authenticate(tuser.Token), ShouldEqual, ErrSessionExpired)
+		So(tuser.Authenticate(tuser.SessionToken), ShouldBeNil)
+
+		tuser.Logout()
+		So(tuser.Token, ShouldBeBlank)
+		So(tuser.SessionToken, ShouldBeBlank)
+	})
 	Convey("Test bad login", t, func() {
 		err := tuser.Login(`this isn't going to work`)
 		So(err, ShouldNotBeNil)
@@ -98,21 +127,21 @@ func TestExpiredLogin(t *testing.T) {
 		err := tuser.Login(pwd)
 		So(err, ShouldBeNil)
 
-		err = tuser.Authenticate(tuser.Token)
+		err = tuser.Authenticate(tuser.SessionToken)
 		So(err, ShouldEqual, nil)
 		Convey("Test Timeout", func() {
 			tuser.TimeoutAt = now.Add(-1 * time.Second)
-			err = tuser.Authenticate(tuser.Token)
+			err = tuser.Authenticate(tuser.SessionToken)
 			So(err, ShouldNotEqual, nil)
 		})
 		Convey("Test Timeout with MAX session length", func() {
 			tuser.MaxSessionAt = now.Add(-1 * time.Second)
-			err = tuser.Authenticate(tuser.Token)
+			err = tuser.Authenticate(tuser.SessionToken)
 			So(err, ShouldNotEqual, nil)
 		})
 		Convey("Test Timeout when TimeoutAt passed", func() {
 			tuser.SetTimeoutAt(now.Add(-1 * time.Second))
-			err = tuser.Authenticate(tuser.Token)
+			err = tuser.Authenticate(tuser.SessionToken)
 			So(err, ShouldNotEqual, nil)
 		})
 
@@ -151,7 +180,7 @@ func TestChangePassword(t *testing.T) {
 		})
 		Convey("Test Change with MAX time passed", func() {
 			tuser.MaxSessionAt = now.Add(-1 * time.Second)
-			err = tuser.Authenticate(tuser.Token)
+			err = tuser.Authenticate(tuser.SessionToken)
 			So(err, ShouldNotEqual, nil)
 			err = tuser.ChangePassword(pwd, `NewPassword`)
 			So(err, ShouldNotEqual, nil)
@@ -159,3 +188,272 @@ func TestChangePassword(t *testing.T) {
 
 	})
 }
+
+func TestLockout(t *testing.T) {
+	plaintext.Register()
+	plaintext.SetDefault()
+	pwd := "TestingPassvord"
+	saveControl := *userControl
+	defer func() { *userControl = saveControl }()
+	SetLockout(configure.Lockout{MaxFailures: 3, Window: 15, Backoff: 1, AutoUnlock: 60})
+
+	Convey("Lock after too many failures", t, func() {
+		tuser := NewUser()
+		tuser.SetDomain("dom")
+		tuser.SetPassword(pwd)
+		for i := 0; i < 3; i++ {
+			So(tuser.LockedOut, ShouldBeFalse)
+			So(tuser.Login(`bad password`), ShouldEqual, ErrInvalidPasswordOrUser)
+		}
+		So(tuser.LockedOut, ShouldBeTrue)
+		err := tuser.Login(pwd)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, ErrUserLocked.Error())
+		rerr, ok := err.(RetryErrorCoder)
+		So(ok, ShouldBeTrue)
+		So(rerr.RetryAfter(), ShouldBeGreaterThan, 0)
+		So(rerr.RetryAfter(), ShouldBeLessThanOrEqualTo, 60)
+		So(tuser.FailCount, ShouldEqual, 3)
+
+		Convey("Login once the lockout period has passed", func() {
+			tuser.LastFailedAt = time.Now().Add(-61 * time.Second)
+			So(tuser.Login(pwd), ShouldBeNil)
+			So(tuser.FailCount, ShouldEqual, 0)
+		})
+		Convey("Failures while locked are not counted", func() {
+			failedAt := tuser.LastFailedAt
+			So(tuser.Login(`bad password`).Error(), ShouldEqual, ErrUserLocked.Error())
+			So(tuser.FailCount, ShouldEqual, 3)
+			So(tuser.LastFailedAt, ShouldResemble, failedAt)
+		})
+		Convey("Each failure after the lock ends doubles the period", func() {
+			tuser.LastFailedAt = time.Now().Add(-61 * time.Second)
+			So(tuser.Login(`bad password`), ShouldEqual, ErrInvalidPasswordOrUser)
+			So(tuser.LockedOut, ShouldBeFalse)
+			tuser.LastFailedAt = time.Now().Add(-61 * time.Second)
+			locked, wait := tuser.IsLocked(time.Now())
+			So(locked, ShouldBeTrue)
+			So(wait, ShouldBeGreaterThan, 58*time.Second)
+		})
+		Convey("Unlock clears the failures", func() {
+			tuser.Unlock()
+			So(tuser.Login(pwd), ShouldBeNil)
+		})
+		Convey("Auto unlock", func() {
+			tuser.LastFailedAt = time.Now().Add(-61 * time.Minute)
+			So(tuser.Login(pwd), ShouldBeNil)
+		})
+	})
+	Convey("Failures outside the window are forgotten", t, func() {
+		tuser := NewUser()
+		tuser.SetPassword(pwd)
+		tuser.Login(`bad password`)
+		tuser.Login(`bad password`)
+		tuser.LastFailedAt = time.Now().Add(-16 * time.Minute)
+		So(tuser.Login(`bad password`), ShouldEqual, ErrInvalidPasswordOrUser)
+		So(tuser.FailCount, ShouldEqual, 1)
+	})
+	Convey("Lockout turned off", t, func() {
+		SetLockout(configure.Lockout{})
+		tuser := NewUser()
+		tuser.SetPassword(pwd)
+		for i := 0; i < 10; i++ {
+			tuser.Login(`bad password`)
+			So(tuser.LockedOut, ShouldBeFalse)
+		}
+		So(tuser.Login(pwd), ShouldBeNil)
+	})
+}
+
+func TestSessionTimes(t *testing.T) {
+	plaintext.Register()
+	plaintext.SetDefault()
+	pwd := "TestingPassvord"
+	saveControl := *userControl
+	defer func() { *userControl = saveControl }()
+	SetSessions(configure.Session{Timeout: 30, MaxSession: 600, Domains: map[string]configure.SessionLimit{
+		"admin":  {Timeout: 15},
+		"public": {Timeout: 120, MaxSession: 1440},
+	}})
+
+	login := func(domain string) *User {
+		tuser := NewUser()
+		tuser.SetDomain(domain)
+		tuser.SetPassword(pwd)
+		So(tuser.Login(pwd), ShouldBeNil)
+		return tuser
+	}
+	Convey("Each domain uses its own session times", t, func() {
+		tuser := login("other")
+		So(tuser.TimeoutAt.Sub(tuser.LoginAt), ShouldEqual, 30*time.Minute)
+		So(tuser.MaxSessionAt.Sub(tuser.LoginAt), ShouldEqual, 600*time.Minute)
+
+		tuser = login("admin")
+		So(tuser.TimeoutAt.Sub(tuser.LoginAt), ShouldEqual, 15*time.Minute)
+		So(tuser.MaxSessionAt.Sub(tuser.LoginAt), ShouldEqual, 600*time.Minute)
+
+		tuser = login("public")
+		So(tuser.TimeoutAt.Sub(tuser.LoginAt), ShouldEqual, 120*time.Minute)
+		So(tuser.MaxSessionAt.Sub(tuser.LoginAt), ShouldEqual, 1440*time.Minute)
+
+		session := NewSession(tuser, "client", "")
+		So(session.TimeoutAt, ShouldEqual, tuser.TimeoutAt)
+	})
+	Convey("Authentication extends by the domain's timeout, up to the maximum", t, func() {
+		tuser := login("admin")
+		So(tuser.CheckExpirationDates(), ShouldBeNil)
+		So(tuser.TimeoutAt.Sub(tuser.LastAuthAt), ShouldEqual, 15*time.Minute)
+
+		tuser.MaxSessionAt = tuser.LastAuthAt.Add(5 * time.Minute)
+		So(tuser.CheckExpirationDates(), ShouldBeNil)
+		So(tuser.TimeoutAt, ShouldEqual, tuser.MaxSessionAt)
+	})
+}
+
+func TestLostPassword(t *testing.T) {
+	plaintext.Register()
+	plaintext.SetDefault()
+	pwd := "TestingPassvord"
+
+	Convey("Generate a reset token", t, func() {
+		tuser := NewUser()
+		tuser.SetDomain("dom")
+		tuser.SetPassword(pwd)
+		token := tuser.GenerateLostPassword()
+		So(token, ShouldNotBeBlank)
+		So(tuser.ResetToken, ShouldEqual, HashToken(token))
+		So(tuser.ResetExpiresAt.After(time.Now()), ShouldBeTrue)
+		So(token, ShouldNotEqual, tuser.Token)
+		So(tuser.ResetToken, ShouldNotContainSubstring, token)
+
+		Convey("Bad token is rejected", func() {
+			So(tuser.ConfirmLostPassword(`bad token`, `NewPassword`), ShouldEqual, ErrInvalidResetToken)
+			So(tuser.ResetToken, ShouldEqual, HashToken(token))
+		})
+		Convey("Good token sets the password once", func() {
+			So(tuser.ConfirmLostPassword(token, `NewPassword`), ShouldBeNil)
+			So(tuser.ResetToken, ShouldBeBlank)
+			So(tuser.Login(`NewPassword`), ShouldBeNil)
+			tuser.Logout()
+			So(tuser.ConfirmLostPassword(token, `OtherPassword`), ShouldEqual, ErrInvalidResetToken)
+		})
+		Convey("Expired token is cleared", func() {
+			tuser.ResetExpiresAt = time.Now().Add(-1 * time.Second)
+			So(tuser.ConfirmLostPassword(token, `NewPassword`), ShouldEqual, ErrInvalidResetToken)
+			So(tuser.ResetToken, ShouldBeBlank)
+		})
+		Convey("Short password keeps the token", func() {
+			So(tuser.ConfirmLostPassword(token, `x`), ShouldNotBeNil)
+			So(tuser.ResetToken, ShouldEqual, HashToken(token))
+		})
+	})
+	Convey("Administrator reset", t, func() {
+		tuser := NewUser()
+		tuser.SetPassword(pwd)
+		tuser.GenerateLostPassword()
+		newPassword, err := tuser.ResetPassword()
+		So(err, ShouldBeNil)
+		So(len(newPassword), ShouldBeGreaterThan, 20)
+		So(tuser.ResetToken, ShouldBeBlank)
+		So(tuser.Login(pwd), ShouldEqual, ErrInvalidPasswordOrUser)
+		So(tuser.Login(newPassword), ShouldBeNil)
+	})
+	Convey("Logged in users can reset", t, func() {
+		tuser := NewUser()
+		tuser.SetPassword(pwd)
+		So(tuser.Login(pwd), ShouldBeNil)
+		token := tuser.GenerateLostPassword()
+		So(tuser.ConfirmLostPassword(token, `NewPassword`), ShouldBeNil)
+	})
+}
+
+func TestRehashOnLogin(t *testing.T) {
+	plaintext.Register()
+	sha512.Register()
+	defer plaintext.SetDefault()
+	pwd := "TestingPassvord"
+
+	Convey("Password moves to the new default driver", t, func() {
+		plaintext.SetDefault()
+		tuser := NewUser()
+		tuser.SetPassword(pwd)
+		So(tuser.Password, ShouldStartWith, "$plaintext$$")
+
+		sha512.SetDefault()
+		So(tuser.Login(pwd), ShouldBeNil)
+		So(tuser.Password, ShouldStartWith, "$"+sha512.DriverName+"$4$")
+		So(tuser.Logout(), ShouldBeNil)
+		So(tuser.Login(pwd), ShouldBeNil)
+
+		Convey("Raising the cost rehashes again", func() {
+			encryption.SetOptions(sha512.DriverName, `{"Cost": 6}`)
+			defer encryption.SetOptions(sha512.DriverName, "")
+			So(tuser.Login(pwd), ShouldBeNil)
+			So(tuser.Password, ShouldStartWith, "$"+sha512.DriverName+"$6$")
+		})
+		Convey("A bad password does not rehash", func() {
+			plaintext.SetDefault()
+			before := tuser.Password
+			So(tuser.Login(`bad password`), ShouldEqual, ErrInvalidPasswordOrUser)
+			So(tuser.Password, ShouldEqual, before)
+		})
+	})
+	Convey("Unversioned passwords are checked with the default driver", t, func() {
+		plaintext.SetDefault()
+		tuser := NewUser()
+		tuser.Password = encryption.GetDefaultDriver().EncryptPassword(pwd, tuser.Salt)
+		So(tuser.Login(pwd), ShouldBeNil)
+		So(tuser.Password, ShouldStartWith, "$plaintext$$")
+	})
+}
+
+func TestLegacyMigration(t *testing.T) {
+	sha512.Register()
+	pbkdf2.Register()
+	plaintext.Register()
+	defer plaintext.SetDefault()
+	defer encryption.SetLegacy("")
+	encryption.SetOptions(pbkdf2.DriverName, `{"Cost": 1000}`)
+	defer encryption.SetOptions(pbkdf2.DriverName, "")
+	pwd := "TestingPassvord"
+
+	Convey("Legacy sha512 passwords are moved to pbkdf2", t, func() {
+		pbkdf2.SetDefault()
+		encryption.SetLegacy(sha512.DriverName)
+		tuser := NewUser()
+		tuser.Password = sha512.New().EncryptPassword(pwd, tuser.Salt)
+
+		So(tuser.Login(`bad password`), ShouldEqual, ErrInvalidPasswordOrUser)
+		So(tuser.Login(pwd), ShouldBeNil)
+		So(tuser.Password, ShouldStartWith, "$"+pbkdf2.DriverName+"$1000$")
+		So(tuser.Logout(), ShouldBeNil)
+		So(tuser.Login(pwd), ShouldBeNil)
+	})
+	Convey("Versioned sha512 passwords are moved to pbkdf2", t, func() {
+		sha512.SetDefault()
+		encryption.SetLegacy("")
+		tuser := NewUser()
+		tuser.SetPassword(pwd)
+		So(tuser.Password, ShouldStartWith, "$"+sha512.DriverName+"$")
+
+		pbkdf2.SetDefault()
+		So(tuser.Login(pwd), ShouldBeNil)
+		So(tuser.Password, ShouldStartWith, "$"+pbkdf2.DriverName+"$1000$")
+	})
+}
+
+func TestDeleteRestore(t *testing.T) {
+	Convey("Deleted users are turned off and stay off when restored", t, func() {
+		user := NewTestUser()
+		user.Activate()
+		So(user.IsDeleted(), ShouldBeFalse)
+
+		user.Delete()
+		So(user.IsDeleted(), ShouldBeTrue)
+		So(user.IsActive, ShouldBeFalse)
+
+		user.Restore()
+		So(user.IsDeleted(), ShouldBeFalse)
+		So(user.IsActive, ShouldBeFalse)
+	})
+}
@@ -48,3 +48,23 @@ func (user *User) GetLoginAtStr() string {
 func (user *User) GetLogoutAtStr() string {
 	return user.LogoutAt.Format(configure.USER_TIME_STR)
 }
+
+func (user *User) GetResetExpiresAtStr() string {
+	return user.ResetExpiresAt.Format(configure.USER_TIME_STR)
+}
+
+func (user *User) GetTotpStepStr() string {
+	return strconv.FormatInt(user.TotpStep, 10)
+}
+
+func (user *User) GetFactorExpiresAtStr() string {
+	return user.FactorExpiresAt.Format(configure.USER_TIME_STR)
+}
+
+func (user *User) GetChallengeExpiresAtStr() string {
+	return user.ChallengeExpiresAt.Format(configure.USER_TIME_STR)
+}
+
+func (user *User) GetVerifyExpiresAtStr() string {
+	return user.VerifyExpiresAt.Format(configure.USER_TIME_STR)
+}
@@ -56,6 +56,81 @@ func (user *User) SetToken(val string) error {
 	return nil
 }
 
+func (user *User) SetResetToken(val string) error {
+	user.ResetToken = val
+	return nil
+}
+
+func (user *User) SetResetExpiresAt(t time.Time) error {
+	user.ResetExpiresAt = t
+	return nil
+}
+
+func (user *User) SetTotpSecret(val string) error {
+	user.TotpSecret = val
+	return nil
+}
+
+func (user *User) SetTotpEnabled(val bool) error {
+	user.TotpEnabled = val
+	return nil
+}
+
+func (user *User) SetTotpStep(step int64) error {
+	user.TotpStep = step
+	return nil
+}
+
+func (user *User) SetRecoveryCodes(val string) error {
+	user.RecoveryCodes = val
+	return nil
+}
+
+func (user *User) SetFactorToken(val string) error {
+	user.FactorToken = val
+	return nil
+}
+
+func (user *User) SetFactorExpiresAt(t time.Time) error {
+	user.FactorExpiresAt = t
+	return nil
+}
+
+func (user *User) SetChallenge(val string) error {
+	user.Challenge = val
+	return nil
+}
+
+func (user *User) SetChallengeExpiresAt(t time.Time) error {
+	user.ChallengeExpiresAt = t
+	return nil
+}
+
+func (user *User) SetVerifyToken(val string) error {
+	user.VerifyToken = val
+	return nil
+}
+
+func (user *User) SetVerifyExpiresAt(t time.Time) error {
+	user.VerifyExpiresAt = t
+	return nil
+}
+
+func (user *User) SetRoles(val string) error {
+	user.Roles = val
+	return nil
+}
+
+func (user *User) SetPermissions(val string) error {
+	user.Permissions = val
+	return nil
+}
+
+func (user *User) SetCapabilities(val string) error {
+	user.Capabilities = val
+	return nil
+}
+
 func (user *User) SetLoginAt(t time.Time) error {
 	user.LoginAt = t
 	return nil
@@ -80,10 +155,10 @@ func (user *User) SetPassword(newPassword string) error {
 	if newPassword == "" {
 		return ecode.ErrMissingPassword
 	}
-	if len(newPassword) < 6 {
-		return ecode.ErrPasswordTooShort
+	if err := CheckNewPassword(newPassword, user.LoginName, user.Email); err != nil {
+		return err
 	}
-	user.Password = encryption.GetDefaultDriver().EncryptPassword(newPassword, user.Salt)
+	user.Password = encryption.HashPassword(newPassword, user.Salt)
 	return nil
 }
 
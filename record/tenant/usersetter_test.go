@@ -1,6 +1,7 @@
 package tenant
 
 import (
+	"github.com/cgentry/gus/ecode"
 	"github.com/cgentry/gus/record/configure"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
@@ -64,16 +65,18 @@ func TestSetPasswrd(t *testing.T) {
 
 		Convey("Check for simple password set", func() {
 			err := user.SetPassword("12345678")
+			So(err, ShouldEqual, ecode.ErrPasswordTooSimple)
+			err = user.SetPassword("90817263")
 			So(err, ShouldBeNil)
 			err = user.SetPassword("12")
 			So(err, ShouldNotBeNil)
 		})
 
 		Convey("Check values are saved ", func() {
-			err := user.SetPassword("123456")
+			err := user.SetPassword("918273")
 			So(err, ShouldBeNil)
 
-			So(user.CheckPassword("123456"), ShouldEqual, nil)
+			So(user.CheckPassword("918273"), ShouldEqual, nil)
 		})
 	})
 }
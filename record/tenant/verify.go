@@ -0,0 +1,72 @@
+package tenant
+
+import (
+	"crypto/subtle"
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/record/configure"
+	"time"
+)
+
+// SetVerify sets how long the email verification tokens last. The configuration time is in
+// minutes; zero leaves the current time alone.
+func SetVerify(c configure.Verify) {
+	if c.Duration > 0 {
+		userControl.VerifyTokenDuration = time.Duration(c.Duration) * time.Minute
+	}
+}
+
+// NewVerifyToken marks the user as not yet activated and gives them a new verification token,
+// replacing any that is outstanding. The clear token is returned to be sent to the user's email
+// address; only the hash is kept in the record.
+func (user *User) NewVerifyToken() string {
+	now := time.Now()
+	token := newToken()
+	user.IsActive = false
+	user.VerifyToken = HashToken(token)
+	user.VerifyExpiresAt = now.Add(userControl.VerifyTokenDuration)
+	user.UpdatedAt = now
+	return token
+}
+
+// ConfirmVerify checks the token sent to the user and, if it is valid, activates the user.
+// The token can only be used once. An expired token is left in place: it can't be used, but
+// it marks the user as waiting for verification so a new message can be sent.
+func (user *User) ConfirmVerify(token string) error {
+	now := time.Now()
+	if user.VerifyToken == "" ||
+		subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(user.VerifyToken)) != 1 {
+		return ErrInvalidVerifyToken
+	}
+	if now.After(user.VerifyExpiresAt) {
+		return ErrInvalidVerifyToken
+	}
+	user.IsActive = true
+	user.clearVerifyToken(now)
+	return nil
+}
+
+// IsVerifyPending is true when the user hasn't yet verified their email address. A user that
+// was turned off by an administrator is not pending: they can't turn themselves back on.
+func (user *User) IsVerifyPending() bool {
+	return !user.IsActive && user.VerifyToken != ""
+}
+
+// Activate turns the user on without a verification token, as when an administrator enables
+// them. Any outstanding token can no longer be used.
+func (user *User) Activate() {
+	user.IsActive = true
+	user.clearVerifyToken(time.Now())
+}
+
+// Deactivate turns the user off. Any outstanding verification token is cleared so the user
+// can't turn themselves back on.
+func (user *User) Deactivate() {
+	user.IsActive = false
+	user.clearVerifyToken(time.Now())
+}
+
+func (user *User) clearVerifyToken(now time.Time) {
+	user.VerifyToken = ""
+	user.VerifyExpiresAt = time.Time{}
+	user.UpdatedAt = now
+}
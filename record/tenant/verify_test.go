@@ -0,0 +1,70 @@
+package tenant
+
+import (
+	. "github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/encryption/drivers/plaintext"
+	"github.com/cgentry/gus/record/configure"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	plaintext.Register()
+	plaintext.SetDefault()
+	pwd := "TestingPassvord"
+
+	Convey("A new verification token stops the user logging in", t, func() {
+		tuser := NewUser()
+		tuser.SetDomain("dom")
+		tuser.SetPassword(pwd)
+		token := tuser.NewVerifyToken()
+		So(token, ShouldNotBeBlank)
+		So(tuser.IsActive, ShouldBeFalse)
+		So(tuser.VerifyToken, ShouldEqual, HashToken(token))
+		So(tuser.VerifyExpiresAt.After(time.Now()), ShouldBeTrue)
+
+		So(tuser.Login(`bad password`), ShouldEqual, ErrInvalidPasswordOrUser)
+		So(tuser.Login(pwd), ShouldEqual, ErrUserNotActive)
+		So(tuser.IsLoggedIn, ShouldBeFalse)
+
+		Convey("Bad token is rejected", func() {
+			So(tuser.ConfirmVerify(`bad token`), ShouldEqual, ErrInvalidVerifyToken)
+			So(tuser.ConfirmVerify(``), ShouldEqual, ErrInvalidVerifyToken)
+			So(tuser.IsActive, ShouldBeFalse)
+			So(tuser.VerifyToken, ShouldEqual, HashToken(token))
+		})
+		Convey("Good token activates the user once", func() {
+			So(tuser.ConfirmVerify(token), ShouldBeNil)
+			So(tuser.IsActive, ShouldBeTrue)
+			So(tuser.VerifyToken, ShouldBeBlank)
+			So(tuser.Login(pwd), ShouldBeNil)
+			So(tuser.ConfirmVerify(token), ShouldEqual, ErrInvalidVerifyToken)
+		})
+		Convey("Expired token is rejected but still pending", func() {
+			tuser.VerifyExpiresAt = time.Now().Add(-1 * time.Second)
+			So(tuser.ConfirmVerify(token), ShouldEqual, ErrInvalidVerifyToken)
+			So(tuser.IsActive, ShouldBeFalse)
+			So(tuser.IsVerifyPending(), ShouldBeTrue)
+		})
+		Convey("Activating the user clears the token", func() {
+			So(tuser.IsVerifyPending(), ShouldBeTrue)
+			tuser.Activate()
+			So(tuser.IsActive, ShouldBeTrue)
+			So(tuser.VerifyToken, ShouldBeBlank)
+			So(tuser.IsVerifyPending(), ShouldBeFalse)
+		})
+		Convey("A user turned off can't verify", func() {
+			tuser.Deactivate()
+			So(tuser.IsVerifyPending(), ShouldBeFalse)
+			So(tuser.ConfirmVerify(token), ShouldEqual, ErrInvalidVerifyToken)
+		})
+	})
+	Convey("The token lifetime comes from the configuration", t, func() {
+		defer userControl.SetVerifyDuration("24h")
+		SetVerify(configure.Verify{})
+		So(userControl.VerifyTokenDuration, ShouldEqual, 24*time.Hour)
+		SetVerify(configure.Verify{Duration: 30})
+		So(userControl.VerifyTokenDuration, ShouldEqual, 30*time.Minute)
+	})
+}
@@ -97,6 +97,11 @@ func runConfig(cmd *cli.Command, args []string) {
 		if strings.Contains(c.Encrypt.Options, ConfigSetupAutosalt) {
 			c.Encrypt.Options = strings.Replace(c.Encrypt.Options, ConfigSetupAutosalt, tenant.CreateSalt(200), -1)
 		}
+		for name, options := range c.Encrypt.Drivers {
+			if strings.Contains(options, ConfigSetupAutosalt) {
+				c.Encrypt.Drivers[name] = strings.Replace(options, ConfigSetupAutosalt, tenant.CreateSalt(200), -1)
+			}
+		}
 		fmt.Println("\nValues are:")
 		cli.PrintStructValue(os.Stdout, &c.Encrypt)
 		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
@@ -107,6 +112,72 @@ func runConfig(cmd *cli.Command, args []string) {
 		cli.PrintStructValue(os.Stdout, &c.User)
 		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
 	}
+	for promptForValues = true; promptForValues; {
+		cli.PromptForStructFields(&c.Lockout, templateCmdHelpConfigLockout)
+		fmt.Println("\nValues are:")
+		cli.PrintStructValue(os.Stdout, &c.Lockout)
+		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
+	}
+	for promptForValues = true; promptForValues; {
+		cli.PromptForStructFields(&c.Session, templateCmdHelpConfigSession)
+		fmt.Println("\nValues are:")
+		cli.PrintStructValue(os.Stdout, &c.Session)
+		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
+	}
+	for promptForValues = true; promptForValues; {
+		cli.PromptForStructFields(&c.Password, templateCmdHelpConfigPassword)
+		fmt.Println("\nValues are:")
+		cli.PrintStructValue(os.Stdout, &c.Password)
+		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
+	}
+	for promptForValues = true; promptForValues; {
+		cli.PromptForStructFields(&c.Ticket, templateCmdHelpConfigTicket)
+		fmt.Println("\nValues are:")
+		cli.PrintStructValue(os.Stdout, &c.Ticket)
+		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
+	}
+	for promptForValues = true; promptForValues; {
+		cli.PromptForStructFields(&c.Keys, templateCmdHelpConfigKeys)
+		fmt.Println("\nValues are:")
+		cli.PrintStructValue(os.Stdout, &c.Keys)
+		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
+	}
+	for promptForValues = true; promptForValues; {
+		cli.PromptForStructFields(&c.TwoFactor, templateCmdHelpConfigTwoFactor)
+		fmt.Println("\nValues are:")
+		cli.PrintStructValue(os.Stdout, &c.TwoFactor)
+		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
+	}
+	for promptForValues = true; promptForValues; {
+		cli.PromptForStructFields(&c.Passkey, templateCmdHelpConfigPasskey)
+		fmt.Println("\nValues are:")
+		cli.PrintStructValue(os.Stdout, &c.Passkey)
+		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
+	}
+	for promptForValues = true; promptForValues; {
+		cli.PromptForStructFields(&c.Notify, templateCmdHelpConfigNotify)
+		fmt.Println("\nValues are:")
+		cli.PrintStructValue(os.Stdout, &c.Notify)
+		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
+	}
+	for promptForValues = true; promptForValues; {
+		cli.PromptForStructFields(&c.Verify, templateCmdHelpConfigVerify)
+		fmt.Println("\nValues are:")
+		cli.PrintStructValue(os.Stdout, &c.Verify)
+		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
+	}
+	for promptForValues = true; promptForValues; {
+		cli.PromptForStructFields(&c.Webhook, templateCmdHelpConfigWebhook)
+		fmt.Println("\nValues are:")
+		cli.PrintStructValue(os.Stdout, &c.Webhook)
+		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
+	}
+	for promptForValues = true; promptForValues; {
+		cli.PromptForStructFields(&c.Delete, templateCmdHelpConfigDelete)
+		fmt.Println("\nValues are:")
+		cli.PrintStructValue(os.Stdout, &c.Delete)
+		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
+	}
 	if c.Service.ClientStore {
 		for promptForValues = true; promptForValues; {
 			cli.PromptForStructFields(&c.Client, templateCmdHelpConfigClient)
@@ -182,6 +253,66 @@ func runConfigList() {
 	cli.PrintStructValue(os.Stdout, &c.Encrypt)
 	fmt.Println("\n")
 
+	cli.Box(os.Stdout, "Login Lockout Configuration")
+	cli.PrintStructValue(os.Stdout, &c.Lockout)
+	fmt.Print("\n\n")
+
+	cli.Box(os.Stdout, "Session Configuration")
+	cli.PrintStructValue(os.Stdout, &c.Session)
+	for domain, limit := range c.Session.Domains {
+		fmt.Printf("    Domain '%s': idle timeout %d, maximum session %d\n", domain, limit.Timeout, limit.MaxSession)
+	}
+	fmt.Print("\n\n")
+
+	cli.Box(os.Stdout, "Password Policy Configuration")
+	cli.PrintStructValue(os.Stdout, &c.Password)
+	fmt.Print("\n\n")
+
+	cli.Box(os.Stdout, "Session Ticket Configuration")
+	cli.PrintStructValue(os.Stdout, &c.Ticket)
+	fmt.Print("\n\n")
+
+	cli.Box(os.Stdout, "Signing Key Configuration")
+	cli.PrintStructValue(os.Stdout, &c.Keys)
+	fmt.Print("\n\n")
+
+	cli.Box(os.Stdout, "Two-Factor Configuration")
+	cli.PrintStructValue(os.Stdout, &c.TwoFactor)
+	fmt.Print("\n\n")
+
+	cli.Box(os.Stdout, "Passkey Configuration")
+	cli.PrintStructValue(os.Stdout, &c.Passkey)
+	fmt.Print("\n\n")
+
+	cli.Box(os.Stdout, "Notify Configuration")
+	cli.PrintStructValue(os.Stdout, &c.Notify)
+	fmt.Print("\n\n")
+
+	cli.Box(os.Stdout, "Email Verification Configuration")
+	cli.PrintStructValue(os.Stdout, &c.Verify)
+	fmt.Print("\n\n")
+
+	cli.Box(os.Stdout, "Webhook Configuration")
+	cli.PrintStructValue(os.Stdout, &c.Webhook)
+	for name, hook := range c.Webhook.Hooks {
+		events := hook.Events
+		if events == "" {
+			events = "all"
+		}
+		fmt.Printf("    Hook '%s': %s (events: %s)\n", name, hook.Url, events)
+	}
+	fmt.Print("\n\n")
+
+	cli.Box(os.Stdout, "Delete Configuration")
+	cli.PrintStructValue(os.Stdout, &c.Delete)
+	fmt.Print("\n\n")
+
+	cli.Box(os.Stdout, "Access Configuration")
+	for role, permissions := range c.Access.Roles {
+		fmt.Printf("    Role '%s': %s\n", role, permissions)
+	}
+	fmt.Print("\n\n")
+
 	cli.Box(os.Stdout, "User Storage Configuration")
 	cli.PrintStructValue(os.Stdout, &c.User)
 	fmt.Println("\n")
@@ -233,10 +364,208 @@ const templateCmdHelpConfigCrypt = `
 =================================
 What encryption technology to use.
         This sets the configuration for the encryption driver to use. The
-        standard selection is bcrypt. The options are usually JSON
+        standard selection is bcrypt; argon2id and scrypt are memory
+        hard alternatives. Use 'gus help encrypt' for the list of
+        drivers and their options. The options are usually JSON
         encoded and would include additional data for use with randomising
         the password. This would be encoded as:
-        { "salt" : "data to include, usually random" }{{ range . }}
+        { "salt" : "data to include, usually random" }
+        Each driver's options are kept under "Drivers" in the
+        configuration file. Passwords are checked by the driver that
+        saved them, so leave a driver's entry there when you change
+        the encryption driver or its users can't login.
+        The legacy driver is used for passwords saved before the driver
+        was recorded with each password (e.g. sha512 when moving to pbkdf2).
+        Give it the options it had then, such as its salt, or none of
+        those passwords will match.{{ range . }}
+    {{ .Name   }}:
+        {{ .Help}}{{ end }}
+
+`
+
+const templateCmdHelpConfigLockout = `
+=================================
+    Login Lockout Policy
+=================================
+How failed logins lock an account.
+        After a number of failed logins the account will be locked for
+        a period of time. Logins are refused while it is locked, and each
+        failure after the lock ends doubles the period.
+        All times are given in minutes. Set the maximum failed logins to
+        zero to turn lockout off.{{ range . }}
+    {{ .Name   }}:
+        {{ .Help}}{{ end }}
+
+`
+
+const templateCmdHelpConfigPassword = `
+=================================
+    Password Policy
+=================================
+The rules for new passwords.
+        These are checked whenever a password is set: when a user
+        registers, changes or resets their password, or is added here.
+        Each rule that fails gives the client its own error message.
+        The strength score is from 0 (anything) to 4 (very hard to
+        guess); common words, the user's details, repeats and keyboard
+        runs count for very little.{{ range . }}
+    {{ .Name   }}:
+        {{ .Help}}{{ end }}
+
+`
+
+const templateCmdHelpConfigSession = `
+=================================
+    Session Times
+=================================
+How long a login lasts. All times are in minutes.
+        A session ends when it hasn't been used for the idle timeout or
+        when it reaches the maximum session length, whichever is first.
+        Domains can have their own times (e.g. a short timeout for an
+        "admin" domain). These are set in the "Domains" section of the
+        configuration file; a zero there uses the value given here.{{ range . }}
+    {{ .Name   }}:
+        {{ .Help}}{{ end }}
+
+`
+
+const templateCmdHelpConfigTicket = `
+=================================
+    Session Tickets
+=================================
+Signed tickets returned at login.
+        A ticket carries the user's GUID, domain, login time and expiry
+        and is signed by gus. Other services can check a ticket without
+        calling gus, so it takes load off the user store. A ticket can't
+        be revoked: keep the lifetime short. Clients use their session
+        token to get a new ticket from /ticket/ and a logout stops any
+        more from being issued. EdDSA lets services check tickets with
+        only the public key; HS256 needs every service to share the key.{{ range . }}
+    {{ .Name   }}:
+        {{ .Help}}{{ end }}
+
+`
+
+const templateCmdHelpConfigKeys = `
+=================================
+    Signing Keys
+=================================
+The key store used to sign responses.
+        Each response is signed with the current key and the key's id is
+        put in the header. The public keys are published at /keys/ so
+        clients can check a response without sharing a secret. Keys are
+        kept encrypted in the file and are managed with 'gus keys'.
+        After a rotation the old key is still published until it is
+        retired. EdDSA tickets without a key of their own use the
+        current key when it is an EdDSA key.{{ range . }}
+    {{ .Name   }}:
+        {{ .Help}}{{ end }}
+
+`
+
+const templateCmdHelpConfigTwoFactor = `
+=================================
+    Two-Factor Logins
+=================================
+TOTP codes from an authenticator app, as a second login step.
+        Users turn two-factor on with /2fa/enroll/ and /2fa/confirm/.
+        After that, their password only returns a short-lived token
+        that must be sent to /login/factor/ with a code. Each user also
+        gets single-use recovery codes. The TOTP secrets are stored
+        encrypted with the field encryption key; without a key, users
+        can't turn two-factor on. Losing the key locks out everyone
+        using two-factor until 'gus user reset2fa' is run for them.{{ range . }}
+    {{ .Name   }}:
+        {{ .Help}}{{ end }}
+
+`
+
+const templateCmdHelpConfigPasskey = `
+=================================
+    Passkeys
+=================================
+WebAuthn passkeys, as a login that needs no password.
+        A logged in user gets a challenge from /passkey/new/ and sends
+        the browser's answer to /passkey/add/. To login, a challenge
+        comes from /passkey/start/ and the answer goes to
+        /passkey/login/. The site domain must match the domain the
+        login pages are served from (or be a parent of it); if it
+        changes, every passkey has to be registered again. Only the
+        "none" and "packed" attestation formats are accepted.{{ range . }}
+    {{ .Name   }}:
+        {{ .Help}}{{ end }}
+
+`
+
+const templateCmdHelpConfigNotify = `
+=================================
+    Notify Driver
+=================================
+How messages, such as the email verification link, reach users.
+        The 'file' driver writes the messages to a file or outbox
+        directory instead of sending them; the 'smtp' driver sends
+        them by email and the 'webhook' driver posts them to another
+        system. Use 'gus notify' to list the drivers and the options
+        each one takes. Leave the driver blank to send no messages.
+
+        Messages are sent when a user registers, changes their
+        password or email address (the old address is told), is
+        locked out or asks for a lost password token. Each message
+        can be replaced by a template file named for its event, such
+        as 'reset.txt', in the template directory. A template in a
+        sub-directory named for a domain is only used for that
+        domain. A template starts with a 'Subject:' line and a blank
+        line; the rest is the body. Values such as {{"{{"}}.Name{{"}}"}},
+        {{"{{"}}.Login{{"}}"}} and {{"{{"}}.Link{{"}}"}} are filled in.{{ range . }}
+    {{ .Name   }}:
+        {{ .Help}}{{ end }}
+
+`
+
+const templateCmdHelpConfigVerify = `
+=================================
+    Email Verification
+=================================
+New users must verify their email address before they can login.
+        When this is on, /register/ creates the user turned off and
+        sends them a link holding a single-use token. The page the
+        link opens sends the token to /verify/ to turn the user on.
+        A user whose token has expired can ask /verify/resend/ for
+        another. A notify driver must be set up to send the links.{{ range . }}
+    {{ .Name   }}:
+        {{ .Help}}{{ end }}
+
+`
+
+const templateCmdHelpConfigWebhook = `
+=================================
+    Webhooks
+=================================
+Events sent to other services when users register, change their email
+        address, are disabled or log out. Each event is POSTed inside a
+        gus package signed with the hook's secret. Events are queued
+        first; a failed delivery is tried again, waiting twice as long
+        each time, and then moved to the dead-letter list. Use
+        'gus webhook' to see the queue and retry deliveries.
+
+        The hooks themselves are only set in the configuration file:
+            "Hooks": { "billing": { "Url": "https://billing.example.com/gus",
+                                    "Secret": "...", "Events": "user.register" } }
+        Events is comma separated; blank sends every event.{{ range . }}
+    {{ .Name   }}:
+        {{ .Help}}{{ end }}
+
+`
+
+const templateCmdHelpConfigDelete = `
+=================================
+    Deleted Users
+=================================
+Deleting a user only marks them as deleted. They can't login or be
+        found, and their login name and email address can be used
+        again. 'gus user restore' brings them back until they are
+        removed for good by 'gus user purge', which only removes users
+        deleted longer ago than the retention period.{{ range . }}
     {{ .Name   }}:
         {{ .Help}}{{ end }}
 
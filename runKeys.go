@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cgentry/gus/cli"
+	"github.com/cgentry/gus/library/keystore"
+)
+
+var cmdKeys = &cli.Command{
+	Name:      "keys",
+	UsageLine: "gus keys [rotate|list|retire] [-c configfile] [-alg algorithm] [keyid]",
+	Short:     "Manage the keys used to sign responses.",
+	Long: `
+This has three subcommands:
+    rotate      Create a new current key. The old current key is kept as a
+                previous key and is still published at /keys/
+    list        Show all of the keys and their status
+    retire      Stop publishing a previous key. Give the key id to retire.
+                The current key can't be retired.
+The options are:
+    alg         Algorithm for a new key: EdDSA (default) or ES256
+
+The key store file and passphrase come from the configuration. If the
+passphrase is blank, it is read from ` + keystore.PASSPHRASE_ENV + `.
+A running service must be restarted to use a new key.
+`,
+}
+
+var cmdKeysAlgorithm string
+
+func init() {
+	cmdKeys.Run = runKeys
+	addCommonCommandFlags(cmdKeys)
+	cmdKeys.Flag.StringVar(&cmdKeysAlgorithm, "alg", keystore.ALG_EDDSA, "")
+}
+
+func runKeys(cmd *cli.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "%s\n", cmd.UsageLine)
+		return
+	}
+	subCommand := args[0]
+	cmd.Flag.Parse(args[1:])
+	args = cmd.Flag.Args()
+
+	switch subCommand {
+	case "rotate":
+		runKeysRotate(cmd, args)
+	case "list":
+		runKeysList(cmd, args)
+	case "retire":
+		runKeysRetire(cmd, args)
+	default:
+		runtimeFail("Invalid keys command", errors.New(subCommand))
+	}
+}
+
+// openKeyStore opens the key store named in the configuration file
+func openKeyStore() *keystore.KeyStore {
+	c, err := GetConfigFile()
+	if err != nil {
+		runtimeFail("Opening configuration file", err)
+	}
+	if c.Keys.File == "" {
+		runtimeFail("Opening key store", errors.New("No key store file is set. Use 'gus config' to set one"))
+	}
+	keys, err := keystore.Open(c.Keys.File, keystore.Passphrase(c.Keys.Passphrase))
+	if err != nil {
+		runtimeFail("Opening key store", err)
+	}
+	return keys
+}
+
+func runKeysRotate(cmd *cli.Command, args []string) {
+	keys := openKeyStore()
+	key, err := keys.Rotate(cmdKeysAlgorithm)
+	if err != nil {
+		runtimeFail("Creating key", err)
+	}
+	if err = keys.Save(); err != nil {
+		runtimeFail("Saving key store", err)
+	}
+	fmt.Fprintf(os.Stdout, "New %s key %s is now current.\n", key.Algorithm, key.KeyId())
+}
+
+func runKeysList(cmd *cli.Command, args []string) {
+	keys := openKeyStore()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY ID\tALGORITHM\tSTATUS\tCREATED\tROTATED\tRETIRED")
+	for _, key := range keys.List() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.KeyId(), key.Algorithm, key.Status,
+			keysTime(key.CreatedAt), keysTime(key.RotatedAt), keysTime(key.RetiredAt))
+	}
+	w.Flush()
+}
+
+func runKeysRetire(cmd *cli.Command, args []string) {
+	if len(args) != 1 {
+		runtimeFail("Retiring key", errors.New("Give the id of the key to retire"))
+	}
+	keys := openKeyStore()
+	if err := keys.Retire(args[0]); err != nil {
+		runtimeFail("Retiring key", err)
+	}
+	if err := keys.Save(); err != nil {
+		runtimeFail("Saving key store", err)
+	}
+	fmt.Fprintf(os.Stdout, "Key %s retired.\n", args[0])
+}
+
+func keysTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -1,8 +1,21 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"strings"
+
 	"github.com/cgentry/gus/cli"
+	"github.com/cgentry/gus/ecode"
 	"github.com/cgentry/gus/library/encryption"
+	"github.com/cgentry/gus/library/keystore"
+	"github.com/cgentry/gus/library/notify"
+	"github.com/cgentry/gus/library/policy"
+	"github.com/cgentry/gus/library/storage"
+	"github.com/cgentry/gus/library/ticket"
+	"github.com/cgentry/gus/library/webauthn"
+	"github.com/cgentry/gus/library/webhook"
+	"github.com/cgentry/gus/record"
+	"github.com/cgentry/gus/record/tenant"
 	"github.com/cgentry/gus/service/web"
 )
 
@@ -33,7 +46,53 @@ func runService(cmd *cli.Command, args []string) {
 	if err != nil {
 		runtimeFail("Opening configuration file", err)
 	}
-	encryption.GetDriver(c.Encrypt.Name).Setup(c.Encrypt.Options)
+	encryption.Set(c.Encrypt)
+	if err = policy.SetPassword(c.Password); err != nil {
+		runtimeFail("Setting password policy", err)
+	}
+	if err = ticket.Set(c.Ticket); err != nil {
+		runtimeFail("Setting ticket signing", err)
+	}
+	if c.Keys.File != "" {
+		keys, err := keystore.Open(c.Keys.File, keystore.Passphrase(c.Keys.Passphrase))
+		if err != nil {
+			runtimeFail("Opening key store", err)
+		}
+		key := keys.Current()
+		if key == nil {
+			runtimeFail("Opening key store", ecode.ErrNoCurrentKey)
+		}
+		keystore.Set(keys)
+		record.SetKeySigner(key)
+
+		// EdDSA tickets without a key of their own are signed with the current key
+		if private, ok := key.PrivateKey().(ed25519.PrivateKey); ok &&
+			c.Ticket.Key == "" && strings.EqualFold(c.Ticket.Algorithm, ticket.ALG_EDDSA) {
+			ticket.UseKey(key.KeyId(), private)
+		}
+	}
+	if key := storage.FieldKey(c.TwoFactor.Key); key != "" {
+		storage.SetEncrypter(storage.NewFieldEncrypter(key))
+	}
+	webauthn.Set(c.Passkey)
+	if err = notify.Set(c.Notify); err != nil {
+		runtimeFail("Setting notify driver", err)
+	}
+	if c.Verify.Required && notify.Get() == nil {
+		runtimeFail("Setting email verification", ecode.ErrNotifyOff)
+	}
+	if err = webhook.Set(c.Webhook); err != nil {
+		runtimeFail("Setting webhooks", err)
+	}
+	if hooks := webhook.Get(); hooks != nil {
+		go hooks.Run(make(chan struct{})) // Runs as long as the service does
+	}
+	if err = tenant.SetAccess(c.Access); err != nil {
+		runtimeFail("Setting roles", err)
+	}
+	tenant.SetVerify(c.Verify)
+	tenant.SetLockout(c.Lockout)
+	tenant.SetSessions(c.Session)
 	router := web.New(c)
 	router.Register(web.RouteMap).Serve()
 
@@ -6,34 +6,90 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/cgentry/gus/cli"
+	"github.com/cgentry/gus/ecode"
 	"github.com/cgentry/gus/library/encryption"
+	"github.com/cgentry/gus/library/policy"
 	"github.com/cgentry/gus/library/storage"
+	"github.com/cgentry/gus/library/webhook"
 	"github.com/cgentry/gus/record/configure"
 	"github.com/cgentry/gus/record/mappers"
+	"github.com/cgentry/gus/record/response"
 	"github.com/cgentry/gus/record/tenant"
+	"github.com/cgentry/gus/service"
+	"github.com/cgentry/gus/service/web"
 )
 
 // DefaultCmdUserLevel defines what type of default command should be run
 const (
-	DefaultCmdUserLevel = "user"
+	DefaultCmdUserLevel    = "user"
+	DefaultDeleteRetention = 30 // Days a deleted user is kept when the configuration doesn't say
 )
 
 var cmdUser = &cli.Command{
 	Name:      "user",
-	UsageLine: "gus user [add|enable|show|disable] [-c configfile] [-priv level] [-email mail] [-login name] ",
+	UsageLine: "gus user [add|enable|show|disable|unlock|password|reset2fa|recovery|grant|revoke|delete|restore|purge|list] [-c configfile] [-priv level] [-email mail] [-login name] [-role name] [-perm name] [-cap name]",
 	Short:     "Manipulate users' information in the store system.",
 	Long: `
-This has three subcommands:
+This has fourteen subcommands:
     add         add a new user to the database
     enable      Enable the user account
     disable     Disable the user account, but don't delete it
     show        Display the record that matches the search criteria
+    unlock      Clear failed logins so a locked account can login again
+    password    Give the user a new, generated, password and display it
+    reset2fa    Turn two-factor off for a user that has lost their
+                authenticator and recovery codes. They can enroll again.
+    recovery    Give a user with two-factor a new set of recovery codes and
+                display them. Any unused codes stop working.
+    grant       Give the user the role named by -role and/or the permission
+                named by -perm. Roles must be set in the configuration.
+                A client (-priv client) can be given the capability named
+                by -cap.
+    revoke      Take away the role named by -role, the permission named by
+                -perm or the capability named by -cap. A permission that
+                comes from a role can only be taken away by revoking the role.
+    delete      Delete the user. They are turned off, logged out and can't
+                be found. Their login name and email address are free to
+                be used again.
+    restore     Bring back a deleted user. They stay turned off until they
+                are enabled. This fails if their login name or email address
+                has been taken since.
+    purge       Remove, for good, every user that was deleted longer ago
+                than the retention period in the configuration. No criteria
+                are needed; -priv selects the user or client store.
+    list        List the users that match the filters below, a page at a
+                time. No criteria are needed.
 The criteria are:
     priv        Select either a normal "user" (default) or "client" systems
     email       Search for records matching the email address.
     login       Search for records matching the user/client login name
+
+The filters for list are all optional:
+    group       Only users in the domain
+    email       Email addresses that start with the value
+    name        Full or login names that start with the value
+    active      "yes" or "no": only users that are (or aren't) enabled
+    loggedin    "yes" or "no": only users that are (or aren't) logged in
+    from, to    Created on or after 'from' and before 'to'. Use 2006-01-02
+                or a full RFC3339 time.
+    sort        created (default), name, login or email. -desc reverses it.
+    limit       Users on each page. The default is 50.
+    cursor      Start from where the last page ended. The command prints
+                the cursor to use when there are more users.
+    json        Print the page as JSON rather than as a table
+
+Client capabilities are either the fields the client may change through
+the update service:
+    permit_all, permit_login, permit_name, permit_email, permit_password
+or a service the client may call, e.g. "service:login". A client that has
+no service capabilities may call every service. Revoking the last one leaves
+"service:none", so the client can't call any service until it is granted one.
+A system client with the "admin" capability may call the admin services.
 `,
 }
 
@@ -48,7 +104,8 @@ allows you to bootstrap users into the system. The levels can be:
 	client		Clients are allowed to remotely authenticate.
 
 To enable the record, you must add -enable or the record will be added
-but not enabled.
+but not enabled. If you leave the password empty, you will be offered a
+generated password.
 `,
 }
 
@@ -65,6 +122,14 @@ should look like:
 
 var cmdUserCli *tenant.UserCli
 
+// Role, permission and capability for grant and revoke
+var cmdUserRole, cmdUserPerm, cmdUserCap string
+
+// Filters, order and output for list
+var cmdUserName, cmdUserActive, cmdUserLoggedIn, cmdUserFrom, cmdUserTo, cmdUserSort, cmdUserCursor string
+var cmdUserDesc, cmdUserJSON bool
+var cmdUserLimit int
+
 func init() {
 	cmdUserCli = tenant.NewUserCli()
 
@@ -75,6 +140,19 @@ func init() {
 	cmdUser.Flag.StringVar(&cmdUserCli.LoginName, "login", "", "")
 	cmdUser.Flag.StringVar(&cmdUserCli.Email, "email", "", "")
 	cmdUser.Flag.StringVar(&cmdUserCli.Domain, "group", "", "")
+	cmdUser.Flag.StringVar(&cmdUserRole, "role", "", "")
+	cmdUser.Flag.StringVar(&cmdUserPerm, "perm", "", "")
+	cmdUser.Flag.StringVar(&cmdUserCap, "cap", "", "")
+	cmdUser.Flag.StringVar(&cmdUserName, "name", "", "")
+	cmdUser.Flag.StringVar(&cmdUserActive, "active", "", "")
+	cmdUser.Flag.StringVar(&cmdUserLoggedIn, "loggedin", "", "")
+	cmdUser.Flag.StringVar(&cmdUserFrom, "from", "", "")
+	cmdUser.Flag.StringVar(&cmdUserTo, "to", "", "")
+	cmdUser.Flag.StringVar(&cmdUserSort, "sort", "", "")
+	cmdUser.Flag.BoolVar(&cmdUserDesc, "desc", false, "")
+	cmdUser.Flag.IntVar(&cmdUserLimit, "limit", 0, "")
+	cmdUser.Flag.StringVar(&cmdUserCursor, "cursor", "", "")
+	cmdUser.Flag.BoolVar(&cmdUserJSON, "json", false, "")
 
 	cmdUserAdd.Run = runUserAdd
 	addCommonCommandFlags(cmdUserAdd)
@@ -92,7 +170,7 @@ func runUser(cmd *cli.Command, args []string) {
 	cmd.Flag.Parse(args[1:])
 	args = cmd.Flag.Args()
 
-	if subCommand != "add" && subCommand != "load" {
+	if subCommand != "add" && subCommand != "load" && subCommand != "purge" && subCommand != "list" {
 		if cmdUserCli.Domain == "" {
 			err = errors.New("Domain is required for " + subCommand)
 		} else if cmdUserCli.Email == "" && cmdUserCli.LoginName == "" {
@@ -112,6 +190,26 @@ func runUser(cmd *cli.Command, args []string) {
 		runUserEnable(cmd, args)
 	case subCommand == "disable":
 		runUserDisable(cmd, args)
+	case subCommand == "unlock":
+		runUserUnlock(cmd, args)
+	case subCommand == "password":
+		runUserPassword(cmd, args)
+	case subCommand == "reset2fa":
+		runUserResetTwoFactor(cmd, args)
+	case subCommand == "recovery":
+		runUserRecovery(cmd, args)
+	case subCommand == "grant":
+		runUserAccess(cmd, args, true)
+	case subCommand == "revoke":
+		runUserAccess(cmd, args, false)
+	case subCommand == "delete":
+		runUserDelete(cmd, args)
+	case subCommand == "restore":
+		runUserRestore(cmd, args)
+	case subCommand == "purge":
+		runUserPurge(cmd, args)
+	case subCommand == "list":
+		runUserList(cmd, args)
 	case subCommand == "load":
 		runUserLoad(cmd, args)
 	default:
@@ -129,11 +227,21 @@ func runUserAdd(cmd *cli.Command, args []string) {
 	if err != nil {
 		runtimeFail("Opening configuration file", err)
 	}
-	encryption.GetDriver(c.Encrypt.Name).Setup(c.Encrypt.Options)
+	encryption.Set(c.Encrypt)
+	if err = policy.SetPassword(c.Password); err != nil {
+		runtimeFail("Setting password policy", err)
+	}
 
 	// We've got the config file. Now we need to prompt for the user information
 	for promptForValues = true; promptForValues; {
 		cli.PromptForStructFields(cmdUserCli, templateCmdUseradd)
+		if cmdUserCli.Password == "" && cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Generate a password", true) {
+			generator := encryption.NewPasswordGenerator()
+			if cmdUserCli.Password, err = generator.Generate(); err != nil {
+				runtimeFail("Generating password", err)
+			}
+			fmt.Fprintf(os.Stdout, "Generated password (%.0f bits of entropy)\n", generator.Entropy())
+		}
 		fmt.Println("\nValues are:")
 		cli.PrintStructValue(os.Stdout, cmdUserCli)
 		promptForValues = cli.PromptYesNoDefault(os.Stdout, os.Stdin, "Re-enter values", false)
@@ -152,6 +260,7 @@ func runUserAdd(cmd *cli.Command, args []string) {
 	if err != nil {
 		runtimeFail("Opening database", err)
 	}
+	defer store.Close()
 
 	if err := store.UserInsert(urec); err != nil {
 		runtimeFail("Writing user record", err)
@@ -174,6 +283,369 @@ func runUserDisable(cmd *cli.Command, args []string) {
 	return
 }
 
+// Unlock a user (of any flavour) that has been locked out by failed logins.
+func runUserUnlock(cmd *cli.Command, args []string) {
+	var configStore configure.Store
+
+	c, err := GetConfigFile()
+	if err != nil {
+		runtimeFail("Opening configuration file", err)
+	}
+	if c.Service.ClientStore && cmdUserCli.Level == "client" {
+		configStore = c.Client
+	} else {
+		configStore = c.User
+	}
+	store, err := storage.Open(configStore.Name, configStore.Dsn, configStore.Options)
+	defer store.Close()
+	if err != nil {
+		runtimeFail("Opening database", err)
+	}
+	userRecord := getUserRecordByCli(store, cmdUserCli)
+	if userRecord.FailCount == 0 {
+		fmt.Fprintf(os.Stdout, "User is not locked.\n")
+		return
+	}
+	userRecord.Unlock()
+	if err := store.UserUpdate(userRecord); err != nil {
+		runtimeFail("Saving user record", err)
+	}
+	fmt.Fprintf(os.Stdout, "User unlocked.\n")
+}
+
+// Give a user (of any flavour) a new, generated, password. This is used when a user
+// can't use the lost password service.
+func runUserPassword(cmd *cli.Command, args []string) {
+	var configStore configure.Store
+
+	c, err := GetConfigFile()
+	if err != nil {
+		runtimeFail("Opening configuration file", err)
+	}
+	encryption.Set(c.Encrypt)
+	if err = policy.SetPassword(c.Password); err != nil {
+		runtimeFail("Setting password policy", err)
+	}
+
+	if c.Service.ClientStore && cmdUserCli.Level == "client" {
+		configStore = c.Client
+	} else {
+		configStore = c.User
+	}
+	store, err := storage.Open(configStore.Name, configStore.Dsn, configStore.Options)
+	defer store.Close()
+	if err != nil {
+		runtimeFail("Opening database", err)
+	}
+	userRecord := getUserRecordByCli(store, cmdUserCli)
+	newPassword, err := userRecord.ResetPassword()
+	if err != nil {
+		runtimeFail("Generating password", err)
+	}
+	if err := store.UserUpdate(userRecord); err != nil {
+		runtimeFail("Saving user record", err)
+	}
+	fmt.Fprintf(os.Stdout, "New password for %s: %s\n", userRecord.FullName, newPassword)
+}
+
+// Turn two-factor off for a user (of any flavour). The secret, recovery codes and any
+// login waiting for a code are all cleared.
+func runUserResetTwoFactor(cmd *cli.Command, args []string) {
+	store, userRecord := openUserRecordByCli()
+	defer store.Close()
+	if !userRecord.TotpEnabled && userRecord.TotpSecret == "" {
+		fmt.Fprintf(os.Stdout, "User does not have two-factor turned on.\n")
+		return
+	}
+	userRecord.ResetTwoFactor()
+	if err := store.UserUpdate(userRecord); err != nil {
+		runtimeFail("Saving user record", err)
+	}
+	fmt.Fprintf(os.Stdout, "Two-factor turned off for %s.\n", userRecord.FullName)
+}
+
+// Give a user with two-factor turned on a new set of recovery codes.
+func runUserRecovery(cmd *cli.Command, args []string) {
+	store, userRecord := openUserRecordByCli()
+	defer store.Close()
+	if !userRecord.TotpEnabled {
+		runtimeFail("Creating recovery codes", errors.New("User does not have two-factor turned on"))
+	}
+	codes := userRecord.NewRecoveryCodes()
+	if err := store.UserUpdate(userRecord); err != nil {
+		runtimeFail("Saving user record", err)
+	}
+	fmt.Fprintf(os.Stdout, "New recovery codes for %s:\n", userRecord.FullName)
+	for _, code := range codes {
+		fmt.Fprintf(os.Stdout, "    %s\n", code)
+	}
+}
+
+// Give a user a role, permission or capability, or take one away. Roles have to be in the
+// configuration and capabilities have to be known before they can be granted, so a mistyped
+// name isn't saved.
+func runUserAccess(cmd *cli.Command, args []string, grant bool) {
+	if cmdUserRole == "" && cmdUserPerm == "" && cmdUserCap == "" {
+		runtimeFail("Missing parameters", errors.New("-role, -perm or -cap is required"))
+	}
+	if grant && cmdUserCap != "" && !knownCapability(cmdUserCap) {
+		runtimeFail("Granting capability", errors.New("Capability "+cmdUserCap+" is not known"))
+	}
+	if grant && cmdUserRole != "" {
+		c, err := GetConfigFile()
+		if err != nil {
+			runtimeFail("Opening configuration file", err)
+		}
+		found := false
+		for role := range c.Access.Roles {
+			found = found || strings.EqualFold(strings.TrimSpace(role), strings.TrimSpace(cmdUserRole))
+		}
+		if !found {
+			runtimeFail("Granting role", errors.New("Role "+cmdUserRole+" is not in the configuration"))
+		}
+	}
+	store, userRecord := openUserRecordByCli()
+	defer store.Close()
+
+	var changed bool
+	var err error
+	if cmdUserRole != "" {
+		if grant {
+			changed, err = userRecord.GrantRole(cmdUserRole)
+		} else {
+			changed, err = userRecord.RevokeRole(cmdUserRole)
+		}
+		if err != nil {
+			runtimeFail("Changing role", err)
+		}
+	}
+	if cmdUserPerm != "" {
+		var permChanged bool
+		if grant {
+			permChanged, err = userRecord.GrantPermission(cmdUserPerm)
+		} else {
+			permChanged, err = userRecord.RevokePermission(cmdUserPerm)
+		}
+		if err != nil {
+			runtimeFail("Changing permission", err)
+		}
+		changed = changed || permChanged
+	}
+	if cmdUserCap != "" {
+		var capChanged bool
+		if grant {
+			capChanged, err = userRecord.GrantCapability(cmdUserCap)
+		} else {
+			capChanged, err = userRecord.RevokeCapability(cmdUserCap)
+		}
+		if err != nil {
+			runtimeFail("Changing capability", err)
+		}
+		changed = changed || capChanged
+	}
+	if !changed {
+		fmt.Fprintf(os.Stdout, "No change.\n")
+		return
+	}
+	if err = store.UserUpdate(userRecord); err != nil {
+		runtimeFail("Saving user record", err)
+	}
+	fmt.Fprintf(os.Stdout, "Roles for %s: %s\n", userRecord.FullName, userRecord.Roles)
+	fmt.Fprintf(os.Stdout, "Permissions for %s: %s\n", userRecord.FullName, userRecord.Permissions)
+	if userRecord.Capabilities != "" {
+		fmt.Fprintf(os.Stdout, "Capabilities for %s: %s\n", userRecord.FullName, userRecord.Capabilities)
+	}
+}
+
+// knownCapability is true for the update permits and for the name of a service that is routed
+func knownCapability(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case service.PERMIT_ALL, service.PERMIT_LOGIN, service.PERMIT_NAME, service.PERMIT_EMAIL, service.PERMIT_PASSWORD,
+		tenant.CAPABILITY_ADMIN:
+		return true
+	}
+	for _, route := range web.RouteMap {
+		if route.Server != nil && name == tenant.CAPABILITY_SERVICE+route.Server().Name {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete a user (of any flavour). They are logged out everywhere and turned off. They can be
+// restored until they are purged.
+func runUserDelete(cmd *cli.Command, args []string) {
+	c, err := GetConfigFile()
+	if err != nil {
+		runtimeFail("Opening configuration file", err)
+	}
+	store, userRecord := openUserRecordByCli()
+	defer store.Close()
+
+	wasActive := userRecord.IsActive
+	userRecord.Logout()
+	if err = store.UserDelete(userRecord); err != nil {
+		runtimeFail("Deleting user record", err)
+	}
+	if err = store.SessionDeleteAll(userRecord.Guid); err != nil && err != ecode.ErrNoSupport {
+		runtimeFail("Removing sessions", err)
+	}
+	if err = store.RefreshDeleteAll(userRecord.Guid); err != nil && err != ecode.ErrNoSupport {
+		runtimeFail("Removing refresh tokens", err)
+	}
+	if wasActive {
+		fireCliWebhook(c.Webhook, webhook.EVENT_DISABLE, userRecord)
+	}
+	fmt.Fprintf(os.Stdout, "User %s deleted.\n", userRecord.FullName)
+}
+
+// Bring back a deleted user (of any flavour). They have to be enabled before they can login.
+func runUserRestore(cmd *cli.Command, args []string) {
+	var userRecord *tenant.User
+	var err error
+
+	store := openStoreByCli()
+	defer store.Close()
+	if cmdUserCli.Email != "" {
+		userRecord, err = store.FetchDeletedUser(cmdUserCli.Domain, storage.FieldEmail, cmdUserCli.Email)
+	} else {
+		userRecord, err = store.FetchDeletedUser(cmdUserCli.Domain, storage.FieldLogin, cmdUserCli.LoginName)
+	}
+	if err != nil {
+		runtimeFail("Finding deleted user", err)
+	}
+	if err = store.UserRestore(userRecord); err != nil {
+		runtimeFail("Restoring user record", err)
+	}
+	fmt.Fprintf(os.Stdout, "User %s restored. Use 'gus user enable' to turn them on.\n", userRecord.FullName)
+}
+
+// Remove the users that were deleted longer ago than the retention period. They can't be
+// restored afterwards.
+func runUserPurge(cmd *cli.Command, args []string) {
+	c, err := GetConfigFile()
+	if err != nil {
+		runtimeFail("Opening configuration file", err)
+	}
+	retention := c.Delete.Retention
+	if retention <= 0 {
+		retention = DefaultDeleteRetention
+	}
+	store := openStoreByCli()
+	defer store.Close()
+
+	count, err := store.UserPurge(time.Now().AddDate(0, 0, -retention))
+	if err != nil {
+		runtimeFail("Purging deleted users", err)
+	}
+	fmt.Fprintf(os.Stdout, "%d users deleted more than %d days ago were purged.\n", count, retention)
+}
+
+// List the users (of either flavour) that match the filters, a page at a time. The table is
+// for people to read; -json prints the same fields the admin list service returns.
+func runUserList(cmd *cli.Command, args []string) {
+	var err error
+
+	search := storage.Search{
+		Domain:      cmdUserCli.Domain,
+		NamePrefix:  cmdUserName,
+		EmailPrefix: cmdUserCli.Email,
+		Descending:  cmdUserDesc,
+		Limit:       cmdUserLimit,
+		Cursor:      cmdUserCursor,
+	}
+	if search.Sort, err = storage.SearchSort(cmdUserSort); err != nil {
+		runtimeFail("-sort must be created, name, login or email", err)
+	}
+	if search.Active, err = storage.SearchFlag(cmdUserActive); err != nil {
+		runtimeFail("-active must be yes or no", err)
+	}
+	if search.LoggedIn, err = storage.SearchFlag(cmdUserLoggedIn); err != nil {
+		runtimeFail("-loggedin must be yes or no", err)
+	}
+	if search.CreatedFrom, err = parseListDate(cmdUserFrom); err != nil {
+		runtimeFail("Reading -from", err)
+	}
+	if search.CreatedTo, err = parseListDate(cmdUserTo); err != nil {
+		runtimeFail("Reading -to", err)
+	}
+
+	store := openStoreByCli()
+	defer store.Close()
+	page, err := store.UserSearch(search)
+	if err != nil {
+		runtimeFail("Listing users", err)
+	}
+
+	if cmdUserJSON {
+		rtn := response.NewAdminList()
+		for _, user := range page.Users {
+			rtn.Users = append(rtn.Users, mappers.AdminFromUser(response.NewAdminUser(), user))
+		}
+		rtn.Next = page.Next
+		buff, err := json.MarshalIndent(rtn, "", "  ")
+		if err != nil {
+			runtimeFail("Encoding users", err)
+		}
+		fmt.Fprintf(os.Stdout, "%s\n", buff)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "GUID\tDOMAIN\tLOGIN\tEMAIL\tNAME\tENABLED\tLOGGED IN\tCREATED")
+	for _, user := range page.Users {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%t\t%s\n",
+			user.Guid, user.Domain, user.LoginName, user.Email, user.FullName,
+			user.IsActive, user.IsLoggedIn, user.CreatedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stdout, "%d users listed.\n", len(page.Users))
+	if page.Next != "" {
+		fmt.Fprintf(os.Stdout, "There are more. Add -cursor %s to see the next page.\n", page.Next)
+	}
+}
+
+// parseListDate reads a date (2006-01-02, in local time) or a full RFC3339 time. Blank is the
+// zero time, which doesn't filter.
+func parseListDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if when, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return when, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// openUserRecordByCli opens the store for the user's level and finds the record that matches
+// the command line criteria.
+func openUserRecordByCli() (storage.Storer, *tenant.User) {
+	store := openStoreByCli()
+	return store, getUserRecordByCli(store, cmdUserCli)
+}
+
+// openStoreByCli opens the store for the level given on the command line
+func openStoreByCli() storage.Storer {
+	var configStore configure.Store
+
+	c, err := GetConfigFile()
+	if err != nil {
+		runtimeFail("Opening configuration file", err)
+	}
+	if c.Service.ClientStore && cmdUserCli.Level == "client" {
+		configStore = c.Client
+	} else {
+		configStore = c.User
+	}
+	store, err := storage.Open(configStore.Name, configStore.Dsn, configStore.Options)
+	if err != nil {
+		runtimeFail("Opening database", err)
+	}
+	return store
+}
+
 // Find and display a user's record. Templates are used to nicely format the data.
 func runUserShow(cmd *cli.Command, args []string) {
 	var configStore configure.Store
@@ -284,12 +756,28 @@ func setUserEnableFlag(newFlag bool) {
 	}
 	userRecord := getUserRecordByCli(store, cmdUserCli)
 	if userRecord.IsActive != newFlag {
-		userRecord.IsActive = newFlag
+		if newFlag {
+			userRecord.Activate()
+		} else {
+			userRecord.Deactivate()
+			userRecord.Logout()
+		}
 		err := store.UserUpdate(userRecord)
 		if err != nil {
 			runtimeFail("Saving user record", err)
 		}
+		if !newFlag {
+			if err = store.SessionDeleteAll(userRecord.Guid); err != nil && err != ecode.ErrNoSupport {
+				runtimeFail("Removing sessions", err)
+			}
+			if err = store.RefreshDeleteAll(userRecord.Guid); err != nil && err != ecode.ErrNoSupport {
+				runtimeFail("Removing refresh tokens", err)
+			}
+		}
 		fmt.Fprintf(os.Stdout, "Record saved for user\n")
+		if !newFlag {
+			fireCliWebhook(c.Webhook, webhook.EVENT_DISABLE, userRecord)
+		}
 	} else {
 		fmt.Fprintf(os.Stdout, "No change required for user.")
 	}
@@ -332,11 +820,16 @@ Email:           {{ .Email     }}
 Is Enabled:      {{ .IsActive  }}
 Is Logged In:    {{ .IsLoggedIn}}
 
+Roles:           {{ .Roles }}
+Permissions:     {{ .Permissions }}
+Capabilities:    {{ .Capabilities }}
+
 Last Login:      {{ .LoginAt }}
 Last Auth:       {{ .LastAuthAt }}
 Last Logout:     {{ .LogoutAt }}
 
 Error tries:     {{ .FailCount }}
+Last Failure:    {{ .LastFailedAt }}
 
 Created At:      {{ .CreatedAt }}
 Updated At:      {{ .UpdatedAt }}
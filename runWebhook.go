@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cgentry/gus/cli"
+	"github.com/cgentry/gus/library/webhook"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/tenant"
+)
+
+var cmdWebhook = &cli.Command{
+	Name:      "webhook",
+	UsageLine: "gus webhook [list|retry|test] [-c configfile] [id|hook]",
+	Short:     "Manage the events sent to other services.",
+	Long: `
+This has three subcommands:
+    list        Show the hooks, then the events waiting to be delivered and
+                those on the dead-letter list
+    retry       Send the events on the dead-letter list again. Give a
+                delivery id to retry just that one. Events waiting for
+                their next try are sent too.
+    test        Send a test event to a hook, straight away. Give the name
+                of the hook.
+
+The hooks and the queue file come from the configuration. Each event is
+POSTed to the hook's address inside a gus package signed with the hook's
+secret. A failed delivery is tried again, waiting twice as long each time,
+until it is moved to the dead-letter list.
+`,
+}
+
+func init() {
+	cmdWebhook.Run = runWebhook
+	addCommonCommandFlags(cmdWebhook)
+}
+
+func runWebhook(cmd *cli.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "%s\n", cmd.UsageLine)
+		return
+	}
+	subCommand := args[0]
+	cmd.Flag.Parse(args[1:])
+	args = cmd.Flag.Args()
+
+	switch subCommand {
+	case "list":
+		runWebhookList(cmd, args)
+	case "retry":
+		runWebhookRetry(cmd, args)
+	case "test":
+		runWebhookTest(cmd, args)
+	default:
+		runtimeFail("Invalid webhook command", errors.New(subCommand))
+	}
+}
+
+// openWebhooks sets up the hooks named in the configuration file
+func openWebhooks() *webhook.Webhooks {
+	c, err := GetConfigFile()
+	if err != nil {
+		runtimeFail("Opening configuration file", err)
+	}
+	hooks, err := webhook.New(c.Webhook)
+	if err != nil {
+		runtimeFail("Setting webhooks", err)
+	}
+	if hooks == nil {
+		runtimeFail("Setting webhooks", errors.New("No hooks are set in the configuration file"))
+	}
+	return hooks
+}
+
+func runWebhookList(cmd *cli.Command, args []string) {
+	hooks := openWebhooks()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOOK\tURL\tEVENTS")
+	for _, hook := range hooks.Hooks() {
+		events := strings.Join(hook.Events(), ", ")
+		if events == "" {
+			events = "all"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", hook.Name, hook.Url, events)
+	}
+	w.Flush()
+	fmt.Println()
+
+	list, err := hooks.Queue().List()
+	if err != nil {
+		runtimeFail("Reading webhook queue", err)
+	}
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DELIVERY ID\tHOOK\tEVENT\tUSER\tTRIES\tSTATUS\tLAST ERROR")
+	for _, d := range list {
+		status := "next " + d.NextAt.Format(time.RFC3339)
+		if d.IsDead() {
+			status = "dead " + d.DeadAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", d.Id, d.Hook, d.Event.Type, d.Event.Guid,
+			d.Attempts, status, d.LastError)
+	}
+	w.Flush()
+}
+
+func runWebhookRetry(cmd *cli.Command, args []string) {
+	if len(args) > 1 {
+		runtimeFail("Retrying webhooks", errors.New("Give one delivery id, or none to retry them all"))
+	}
+	id := ""
+	if len(args) == 1 {
+		id = args[0]
+	}
+	hooks := openWebhooks()
+	count, err := hooks.Queue().Retry(id, time.Now())
+	if err != nil {
+		runtimeFail("Retrying webhooks", err)
+	}
+	sent, failed, err := hooks.Deliver(time.Now())
+	if err != nil {
+		runtimeFail("Delivering webhooks", err)
+	}
+	fmt.Fprintf(os.Stdout, "%d retried: %d sent, %d failed.\n", count, sent, failed)
+}
+
+func runWebhookTest(cmd *cli.Command, args []string) {
+	if len(args) != 1 {
+		runtimeFail("Testing webhook", errors.New("Give the name of the hook to test"))
+	}
+	if err := openWebhooks().Test(args[0]); err != nil {
+		runtimeFail("Testing webhook", err)
+	}
+	fmt.Fprintf(os.Stdout, "Test event sent to %s.\n", args[0])
+}
+
+// fireCliWebhook sends an event for a change made from the command line. The event is queued,
+// so if it can't be sent now the running service will retry it.
+func fireCliWebhook(c configure.Webhook, eventType string, user *tenant.User) {
+	hooks, err := webhook.New(c)
+	if err != nil || hooks == nil {
+		return
+	}
+	err = hooks.Fire(eventType, webhook.Event{
+		Domain: user.Domain,
+		Guid:   user.Guid,
+		Login:  user.LoginName,
+		Email:  user.Email,
+	})
+	if err == nil {
+		hooks.Deliver(time.Now())
+	}
+}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/notify"
+	"github.com/cgentry/gus/library/storage"
+	"github.com/cgentry/gus/library/webhook"
+	"github.com/cgentry/gus/record"
+	"github.com/cgentry/gus/record/mappers"
+	"github.com/cgentry/gus/record/request"
+	"github.com/cgentry/gus/record/response"
+	"github.com/cgentry/gus/record/tenant"
+)
+
+// The admin services let a system client manage users. The client must have the 'admin'
+// capability (see tenant.CAPABILITY_ADMIN). Each call names the user it works on and, except
+// for logout, returns the user's record as it is after the change. Deleted users can only be
+// restored.
+
+// NewServiceAdminShow is the entry point for an admin client to fetch a user's record
+func NewServiceAdminShow() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "admin.show",
+		Run:         adminShow,
+		RequestBody: &request.Admin{},
+	}
+	return r.Reset()
+}
+
+// NewServiceAdminEnable is the entry point for an admin client to turn a user on
+func NewServiceAdminEnable() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "admin.enable",
+		Run:         adminEnable,
+		RequestBody: &request.Admin{},
+	}
+	return r.Reset()
+}
+
+// NewServiceAdminDisable is the entry point for an admin client to turn a user off
+func NewServiceAdminDisable() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "admin.disable",
+		Run:         adminDisable,
+		RequestBody: &request.Admin{},
+	}
+	return r.Reset()
+}
+
+// NewServiceAdminLogout is the entry point for an admin client to end all of a user's sessions
+func NewServiceAdminLogout() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "admin.logout",
+		Run:         adminLogout,
+		RequestBody: &request.Admin{},
+	}
+	return r.Reset()
+}
+
+// NewServiceAdminPassword is the entry point for an admin client to give a user a new password
+func NewServiceAdminPassword() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "admin.password",
+		Run:         adminPassword,
+		RequestBody: &request.Admin{},
+	}
+	return r.Reset()
+}
+
+// NewServiceAdminDomain is the entry point for an admin client to move a user to another domain
+func NewServiceAdminDomain() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "admin.domain",
+		Run:         adminDomain,
+		RequestBody: &request.AdminDomain{},
+	}
+	return r.Reset()
+}
+
+// NewServiceAdminDelete is the entry point for an admin client to delete a user
+func NewServiceAdminDelete() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "admin.delete",
+		Run:         adminDelete,
+		RequestBody: &request.Admin{},
+	}
+	return r.Reset()
+}
+
+// NewServiceAdminRestore is the entry point for an admin client to bring back a deleted user
+func NewServiceAdminRestore() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "admin.restore",
+		Run:         adminRestore,
+		RequestBody: &request.Admin{},
+	}
+	return r.Reset()
+}
+
+// NewServiceAdminList is the entry point for an admin client to page through the users
+func NewServiceAdminList() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "admin.list",
+		Run:         adminList,
+		RequestBody: &request.AdminList{},
+	}
+	return r.Reset()
+}
+
+// adminShow returns the user's record
+func adminShow(s *ServiceProcess) (record.Packer, error) {
+	user, err := adminUser(s)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+	return adminReturn(s, user)
+}
+
+// adminEnable turns the user on. A deleted user must be restored first.
+func adminEnable(s *ServiceProcess) (record.Packer, error) {
+	user, err := adminUser(s)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	if user.IsDeleted() {
+		return s.PackageErr(ecode.ErrUserDeleted)
+	}
+	if !user.IsActive {
+		user.Activate()
+		if err = s.UserStore.UserUpdate(user); err != nil {
+			return s.PackageErr(err)
+		}
+	}
+	return adminReturn(s, user)
+}
+
+// adminDisable turns the user off and ends every session and refresh token they have
+func adminDisable(s *ServiceProcess) (record.Packer, error) {
+	user, err := adminUser(s)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	if user.IsActive {
+		user.Deactivate()
+		if err = endUserSessions(s, user); err != nil {
+			return s.PackageErr(err)
+		}
+		fireWebhook(webhook.EVENT_DISABLE, newEvent(user))
+	}
+	return adminReturn(s, user)
+}
+
+// adminLogout ends every session the user has open and revokes their refresh tokens
+func adminLogout(s *ServiceProcess) (record.Packer, error) {
+	user, err := adminUser(s)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	if err = endUserSessions(s, user); err != nil {
+		return s.PackageErr(err)
+	}
+	if err = s.ResponsePackage.SetBodyMarshal(response.NewAck(`logout`)); err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// adminPassword gives the user a new, generated, password and logs them out everywhere. The
+// password is returned to the client, which is responsible for getting it to the user.
+func adminPassword(s *ServiceProcess) (record.Packer, error) {
+	user, err := adminUser(s)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	newPassword, err := user.ResetPassword()
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	if err = endUserSessions(s, user); err != nil {
+		return s.PackageErr(err)
+	}
+	notifyUser(notify.EVENT_PASSWORD, newData(user))
+
+	rtn := response.NewAdminPassword()
+	rtn.Guid = user.Guid
+	rtn.Password = newPassword
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// adminDomain moves the user to another domain. The login name and email address must not be
+// in use there. Sessions belong to a domain, so the user is logged out everywhere.
+func adminDomain(s *ServiceProcess) (record.Packer, error) {
+	move, _ := s.RequestBody.(*request.AdminDomain)
+
+	user, err := adminUser(s)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	if move.NewDomain == user.Domain {
+		return adminReturn(s, user)
+	}
+	if user.LoginName != "" {
+		if err = adminCheckFree(s, s.UserStore.FetchUserByLogin, move.NewDomain, user.LoginName, ecode.ErrDuplicateLogin); err != nil {
+			return s.PackageErr(err)
+		}
+	}
+	if user.Email != "" {
+		if err = adminCheckFree(s, s.UserStore.FetchUserByEmail, move.NewDomain, user.Email, ecode.ErrDuplicateEmail); err != nil {
+			return s.PackageErr(err)
+		}
+	}
+	user.SetDomain(move.NewDomain)
+	if err = endUserSessions(s, user); err != nil {
+		return s.PackageErr(err)
+	}
+	return adminReturn(s, user)
+}
+
+// adminDelete marks the user as deleted, turns them off and logs them out everywhere. They can
+// be restored until they are purged.
+func adminDelete(s *ServiceProcess) (record.Packer, error) {
+	user, err := adminUser(s)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	wasActive := user.IsActive
+	if err = s.UserStore.UserDelete(user); err != nil {
+		return s.PackageErr(err)
+	}
+	if err = endUserSessions(s, user); err != nil {
+		return s.PackageErr(err)
+	}
+	if wasActive {
+		fireWebhook(webhook.EVENT_DISABLE, newEvent(user))
+	}
+	return adminReturn(s, user)
+}
+
+// adminRestore brings back a deleted user. They stay turned off until they are enabled.
+func adminRestore(s *ServiceProcess) (record.Packer, error) {
+	user, err := adminDeletedUser(s)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	if err = s.UserStore.UserRestore(user); err != nil {
+		return s.PackageErr(err)
+	}
+	return adminReturn(s, user)
+}
+
+// adminList returns a page of the users that match the request's filters. Deleted users are
+// not included.
+func adminList(s *ServiceProcess) (record.Packer, error) {
+	var err error
+	list, _ := s.RequestBody.(*request.AdminList)
+
+	if err = adminClient(s); err != nil {
+		return s.PackageErr(err)
+	}
+	search := storage.Search{
+		Domain:      list.Domain,
+		CreatedFrom: list.CreatedFrom,
+		CreatedTo:   list.CreatedTo,
+		NamePrefix:  list.NamePrefix,
+		EmailPrefix: list.EmailPrefix,
+		Descending:  list.Descending,
+		Limit:       list.Limit,
+		Cursor:      list.Cursor,
+	}
+	if search.Sort, err = storage.SearchSort(list.Sort); err != nil {
+		return s.PackageErr(err)
+	}
+	if search.Active, err = storage.SearchFlag(list.Active); err != nil {
+		return s.PackageErr(err)
+	}
+	if search.LoggedIn, err = storage.SearchFlag(list.LoggedIn); err != nil {
+		return s.PackageErr(err)
+	}
+	page, err := s.UserStore.UserSearch(search)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+
+	rtn := response.NewAdminList()
+	for _, user := range page.Users {
+		rtn.Users = append(rtn.Users, mappers.AdminFromUser(response.NewAdminUser(), user))
+	}
+	rtn.Next = page.Next
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// adminUser checks the client may use the admin services and then finds the user named in the
+// request. Deleted users aren't found. The caller must Release the store when the user is found.
+func adminUser(s *ServiceProcess) (*tenant.User, error) {
+	return adminFind(s, s.UserStore.UserFetch)
+}
+
+// adminDeletedUser works like adminUser but only finds users that have been deleted
+func adminDeletedUser(s *ServiceProcess) (*tenant.User, error) {
+	return adminFind(s, s.UserStore.FetchDeletedUser)
+}
+
+// adminFind checks the client and looks up the user named in the request with 'fetch'
+func adminFind(s *ServiceProcess, fetch func(domain, key, value string) (*tenant.User, error)) (*tenant.User, error) {
+	if err := adminClient(s); err != nil {
+		return nil, err
+	}
+	var target *request.Admin
+	switch body := s.RequestBody.(type) {
+	case *request.Admin:
+		target = body
+	case *request.AdminDomain:
+		target = &body.Admin
+	default:
+		return nil, ecode.ErrBadBody
+	}
+	switch {
+	case target.Guid != "":
+		return fetch(storage.MatchAnyDomain, storage.FieldGUID, target.Guid)
+	case target.Login != "":
+		return fetch(target.Domain, storage.FieldLogin, target.Login)
+	}
+	return fetch(target.Domain, storage.FieldEmail, target.Email)
+}
+
+// adminClient returns ErrNotAdminClient unless the caller is a system client with the admin
+// capability
+func adminClient(s *ServiceProcess) error {
+	if !s.Client.IsSystem || !s.Client.HasCapability(tenant.CAPABILITY_ADMIN) {
+		return ecode.ErrNotAdminClient
+	}
+	return nil
+}
+
+// adminCheckFree makes sure no other user in the domain has the value. 'inUse' is returned
+// when there is one.
+func adminCheckFree(s *ServiceProcess, fetch func(domain, value string) (*tenant.User, error), domain, value string, inUse error) error {
+	_, err := fetch(domain, value)
+	if err == nil {
+		s.UserStore.Release()
+		return inUse
+	}
+	if err != ecode.ErrUserNotFound {
+		return err
+	}
+	return nil
+}
+
+// adminReturn packages the user's record for the admin client
+func adminReturn(s *ServiceProcess, user *tenant.User) (record.Packer, error) {
+	err := s.ResponsePackage.SetBodyMarshal(mappers.AdminFromUser(response.NewAdminUser(), user))
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
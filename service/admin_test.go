@@ -0,0 +1,236 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/encryption/drivers/plaintext"
+	"github.com/cgentry/gus/library/storage"
+	"github.com/cgentry/gus/library/storage/drivers/mock"
+	"github.com/cgentry/gus/record/request"
+	"github.com/cgentry/gus/record/response"
+	"github.com/cgentry/gus/record/tenant"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// adminCaller is a system client with the admin capability
+func adminCaller() *tenant.User {
+	client := generateCaller()
+	client.IsSystem = true
+	client.GrantCapability(tenant.CAPABILITY_ADMIN)
+	return client
+}
+
+// adminRun runs an admin service against the user with the guid
+func adminRun(store storage.Storer, srv *ServiceProcess, client *tenant.User, guid string) (string, error) {
+	srv.UserStore = store
+	srv.Client = client
+	switch body := srv.RequestBody.(type) {
+	case *request.Admin:
+		body.Guid = guid
+	case *request.AdminDomain:
+		body.Guid = guid
+	}
+	pack, err := srv.Run(srv)
+	if gerr, ok := err.(ecode.ErrorCoder); ok && gerr.Code() == 200 {
+		err = nil
+	}
+	return pack.GetBody(), err
+}
+
+// adminRunUser runs an admin service and returns the user's record
+func adminRunUser(store storage.Storer, srv *ServiceProcess, guid string) (response.AdminUser, error) {
+	rtn := response.AdminUser{}
+	body, err := adminRun(store, srv, adminCaller(), guid)
+	if err != nil {
+		return rtn, err
+	}
+	err = json.Unmarshal([]byte(body), &rtn)
+	return rtn, err
+}
+
+func TestServiceAdmin(t *testing.T) {
+	mock.Register()
+	plaintext.Register()
+	plaintext.SetDefault()
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	user := tenant.NewUser()
+	user.SetDomain(`Test`)
+	user.SetLoginName(`*Admin`)
+	user.SetEmail(`admin@example.com`)
+	user.SetPassword(`12345678abcdefg`)
+	store.UserInsert(user)
+
+	other := tenant.NewUser()
+	other.SetDomain(`Other`)
+	other.SetLoginName(`*Admin`)
+	other.SetPassword(`12345678abcdefg`)
+	store.UserInsert(other)
+
+	Convey("Only system clients with the admin capability can use the admin services", t, func() {
+		_, err := adminRun(store, NewServiceAdminShow(), generateCaller(), user.Guid)
+		So(err, ShouldEqual, ecode.ErrNotAdminClient)
+
+		client := generateCaller()
+		client.GrantCapability(tenant.CAPABILITY_ADMIN)
+		_, err = adminRun(store, NewServiceAdminShow(), client, user.Guid)
+		So(err, ShouldEqual, ecode.ErrNotAdminClient)
+
+		rtn, err := adminRunUser(store, NewServiceAdminShow(), user.Guid)
+		So(err, ShouldBeNil)
+		So(rtn.LoginName, ShouldEqual, `*Admin`)
+		So(rtn.Domain, ShouldEqual, `Test`)
+
+		_, err = adminRunUser(store, NewServiceAdminShow(), "no-such-user")
+		So(err, ShouldEqual, ecode.ErrUserNotFound)
+	})
+
+	Convey("Users can be disabled, enabled and logged out", t, func() {
+		userRtn, err := sessionLoginAs(store, "*Admin")
+		So(err, ShouldBeNil)
+
+		rtn, err := adminRunUser(store, NewServiceAdminDisable(), user.Guid)
+		So(err, ShouldBeNil)
+		So(rtn.IsActive, ShouldBeFalse)
+		So(rtn.IsLoggedIn, ShouldBeFalse)
+		sessions, _ := store.SessionList(user.Guid)
+		So(sessions, ShouldBeEmpty)
+		_, err = sessionRun(store, NewServiceAuthenticate(), userRtn.Token)
+		So(err, ShouldEqual, ecode.ErrUserNotLoggedIn)
+
+		rtn, err = adminRunUser(store, NewServiceAdminEnable(), user.Guid)
+		So(err, ShouldBeNil)
+		So(rtn.IsActive, ShouldBeTrue)
+
+		userRtn, err = sessionLoginAs(store, "*Admin")
+		So(err, ShouldBeNil)
+		_, err = adminRun(store, NewServiceAdminLogout(), adminCaller(), user.Guid)
+		So(err, ShouldBeNil)
+		_, err = sessionRun(store, NewServiceAuthenticate(), userRtn.Token)
+		So(err, ShouldNotBeNil)
+		rtn, err = adminRunUser(store, NewServiceAdminShow(), user.Guid)
+		So(err, ShouldBeNil)
+		So(rtn.IsLoggedIn, ShouldBeFalse)
+	})
+
+	Convey("A new password is returned and the old one stops working", t, func() {
+		body, err := adminRun(store, NewServiceAdminPassword(), adminCaller(), user.Guid)
+		So(err, ShouldBeNil)
+		rtn := response.AdminPassword{}
+		So(json.Unmarshal([]byte(body), &rtn), ShouldBeNil)
+		So(rtn.Guid, ShouldEqual, user.Guid)
+		So(rtn.Password, ShouldNotBeBlank)
+
+		_, err = sessionLoginAs(store, "*Admin")
+		So(err, ShouldNotBeNil)
+		found, _ := store.FetchUserByGUID(user.Guid)
+		store.Release()
+		So(found.CheckPassword(rtn.Password), ShouldBeNil)
+		found.SetPassword(`12345678abcdefg`)
+		store.UserUpdate(found)
+	})
+
+	Convey("Users can only move to a domain where their login is free", t, func() {
+		srv := NewServiceAdminDomain()
+		srv.RequestBody.(*request.AdminDomain).NewDomain = `Other`
+		_, err := adminRunUser(store, srv, user.Guid)
+		So(err, ShouldEqual, ecode.ErrDuplicateLogin)
+
+		srv = NewServiceAdminDomain()
+		srv.RequestBody.(*request.AdminDomain).NewDomain = `Moved`
+		rtn, err := adminRunUser(store, srv, user.Guid)
+		So(err, ShouldBeNil)
+		So(rtn.Domain, ShouldEqual, `Moved`)
+
+		srv = NewServiceAdminDomain()
+		srv.RequestBody.(*request.AdminDomain).NewDomain = `Test`
+		_, err = adminRunUser(store, srv, user.Guid)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Deleted users can't be found until restored and enabled", t, func() {
+		rtn, err := adminRunUser(store, NewServiceAdminDelete(), user.Guid)
+		So(err, ShouldBeNil)
+		So(rtn.DeletedAt.IsZero(), ShouldBeFalse)
+		So(rtn.IsActive, ShouldBeFalse)
+
+		_, err = adminRunUser(store, NewServiceAdminEnable(), user.Guid)
+		So(err, ShouldEqual, ecode.ErrUserNotFound)
+		_, err = adminRunUser(store, NewServiceAdminDelete(), user.Guid)
+		So(err, ShouldEqual, ecode.ErrUserNotFound)
+
+		rtn, err = adminRunUser(store, NewServiceAdminRestore(), user.Guid)
+		So(err, ShouldBeNil)
+		So(rtn.DeletedAt.IsZero(), ShouldBeTrue)
+		So(rtn.IsActive, ShouldBeFalse)
+		_, err = adminRunUser(store, NewServiceAdminRestore(), user.Guid)
+		So(err, ShouldEqual, ecode.ErrUserNotFound)
+
+		rtn, err = adminRunUser(store, NewServiceAdminEnable(), user.Guid)
+		So(err, ShouldBeNil)
+		So(rtn.IsActive, ShouldBeTrue)
+	})
+
+	Convey("Deleted users can't be restored once their login is taken", t, func() {
+		_, err := adminRunUser(store, NewServiceAdminDelete(), user.Guid)
+		So(err, ShouldBeNil)
+
+		taken := tenant.NewUser()
+		taken.SetDomain(`Test`)
+		taken.SetLoginName(`*Admin`)
+		So(store.UserInsert(taken), ShouldBeNil)
+		_, err = adminRunUser(store, NewServiceAdminRestore(), user.Guid)
+		So(err, ShouldEqual, ecode.ErrDuplicateLogin)
+
+		So(store.UserDelete(taken), ShouldBeNil)
+		_, err = adminRunUser(store, NewServiceAdminRestore(), user.Guid)
+		So(err, ShouldBeNil)
+		_, err = adminRunUser(store, NewServiceAdminEnable(), user.Guid)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Admin clients can page through the users", t, func() {
+		_, err := adminRun(store, NewServiceAdminList(), generateCaller(), "")
+		So(err, ShouldEqual, ecode.ErrNotAdminClient)
+
+		srv := NewServiceAdminList()
+		srv.RequestBody.(*request.AdminList).Domain = `Test`
+		body, err := adminRun(store, srv, adminCaller(), "")
+		So(err, ShouldBeNil)
+		rtn := response.AdminList{}
+		So(json.Unmarshal([]byte(body), &rtn), ShouldBeNil)
+		So(len(rtn.Users), ShouldEqual, 1)
+		So(rtn.Users[0].Guid, ShouldEqual, user.Guid)
+		So(rtn.Next, ShouldBeBlank)
+
+		srv = NewServiceAdminList()
+		srv.RequestBody.(*request.AdminList).Sort = `login`
+		srv.RequestBody.(*request.AdminList).Limit = 1
+		body, err = adminRun(store, srv, adminCaller(), "")
+		So(err, ShouldBeNil)
+		first := response.AdminList{}
+		So(json.Unmarshal([]byte(body), &first), ShouldBeNil)
+		So(len(first.Users), ShouldEqual, 1)
+		So(first.Next, ShouldNotBeBlank)
+
+		srv = NewServiceAdminList()
+		srv.RequestBody.(*request.AdminList).Sort = `login`
+		srv.RequestBody.(*request.AdminList).Limit = 1
+		srv.RequestBody.(*request.AdminList).Cursor = first.Next
+		body, err = adminRun(store, srv, adminCaller(), "")
+		So(err, ShouldBeNil)
+		second := response.AdminList{}
+		So(json.Unmarshal([]byte(body), &second), ShouldBeNil)
+		So(len(second.Users), ShouldEqual, 1)
+		So(second.Users[0].Guid, ShouldNotEqual, first.Users[0].Guid)
+		So(second.Next, ShouldBeBlank)
+
+		srv = NewServiceAdminList()
+		srv.RequestBody.(*request.AdminList).Sort = `password`
+		_, err = adminRun(store, srv, adminCaller(), "")
+		So(err, ShouldEqual, ecode.ErrInvalidSearch)
+	})
+}
@@ -14,11 +14,18 @@ import (
 	"github.com/cgentry/gus/record/request"
 	"github.com/cgentry/gus/record/response"
 	"github.com/cgentry/gus/record/tenant"
+	"github.com/cgentry/gus/library/notify"
 	"github.com/cgentry/gus/library/storage"
+	"github.com/cgentry/gus/library/ticket"
+	"github.com/cgentry/gus/library/totp"
+	"github.com/cgentry/gus/library/webauthn"
+	"github.com/cgentry/gus/library/webhook"
 	"net/http"
+	"strings"
+	"time"
 )
 
-// Permissions for updating
+// Permissions for updating. These are given to a client as capabilities; see tenant.GrantCapability
 const (
 	SERVICE_EMPTY_BODY = ""
 
@@ -42,6 +49,10 @@ type ServiceProcessor interface {
 // All of the service control requirements are stored in this structure. This points to the
 // runtime function that will receive this information.
 type ServiceProcess struct {
+	// Name of the service. Clients limited by 'service:' capabilities can only call the
+	// services they name.
+	Name string
+
 	// Points to the function that will process the request. It will be passed this structure.
 	Run func(*ServiceProcess) (record.Packer, error)
 
@@ -73,6 +84,7 @@ type ServiceProcess struct {
 
 func NewServiceRegister() *ServiceProcess {
 	r := &ServiceProcess{
+		Name:        "register",
 		Run:         register,
 		RequestBody: &request.Register{},
 		SetFlag:     false,
@@ -83,24 +95,137 @@ func NewServiceRegister() *ServiceProcess {
 // The Structure that gives us the entry point for user Login
 func NewServiceLogin() *ServiceProcess {
 	r := &ServiceProcess{
+		Name:        "login",
 		Run:         login,
 		RequestBody: &request.Login{},
 	}
 	return r.Reset()
 }
 
+// NewServiceLoginFactor is the entry point to finish a login with the second factor
+func NewServiceLoginFactor() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "login.factor",
+		Run:         loginFactor,
+		RequestBody: &request.SecondFactor{},
+	}
+	return r.Reset()
+}
+
+// NewServiceTotpEnroll is the entry point for a logged in user to start two-factor enrollment
+func NewServiceTotpEnroll() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "2fa.enroll",
+		Run:         totpEnroll,
+		RequestBody: &request.Authenticate{},
+	}
+	return r.Reset()
+}
+
+// NewServiceTotpConfirm is the entry point to turn two-factor on with the first code
+func NewServiceTotpConfirm() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "2fa.confirm",
+		Run:         totpConfirm,
+		RequestBody: &request.TotpConfirm{},
+	}
+	return r.Reset()
+}
+
+// NewServicePasskeyNew is the entry point for a logged in user to get a challenge for a new passkey
+func NewServicePasskeyNew() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "passkey.new",
+		Run:         passkeyNew,
+		RequestBody: &request.Authenticate{},
+	}
+	return r.Reset()
+}
+
+// NewServicePasskeyAdd is the entry point to register a new passkey
+func NewServicePasskeyAdd() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "passkey.add",
+		Run:         passkeyAdd,
+		RequestBody: &request.PasskeyAdd{},
+	}
+	return r.Reset()
+}
+
+// NewServicePasskeyStart is the entry point to get a challenge for a passkey login
+func NewServicePasskeyStart() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "passkey.start",
+		Run:         passkeyStart,
+		RequestBody: &request.PasskeyStart{},
+	}
+	return r.Reset()
+}
+
+// NewServicePasskeyLogin is the entry point to login with a passkey
+func NewServicePasskeyLogin() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "passkey.login",
+		Run:         passkeyLogin,
+		RequestBody: &request.PasskeyLogin{},
+	}
+	return r.Reset()
+}
+
 // The Structure that gives us the entry point for user Logout
 func NewServiceLogout() *ServiceProcess {
 	r := &ServiceProcess{
+		Name:        "logout",
 		Run:         logout,
 		RequestBody: &request.Logout{},
 	}
 	return r.Reset()
 }
 
+// The Structure that gives us the entry point to logout all of a user's sessions
+func NewServiceLogoutAll() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "logout.all",
+		Run:         logoutAll,
+		RequestBody: &request.Logout{},
+	}
+	return r.Reset()
+}
+
+// The Structure that gives us the entry point to list a user's sessions
+func NewServiceSessions() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "sessions",
+		Run:         sessions,
+		RequestBody: &request.Authenticate{},
+	}
+	return r.Reset()
+}
+
+// The Structure that gives us the entry point to get a new signed ticket for a session
+func NewServiceTicket() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "ticket",
+		Run:         newTicket,
+		RequestBody: &request.Authenticate{},
+	}
+	return r.Reset()
+}
+
+// The Structure that gives us the entry point to trade a refresh token for a new session
+func NewServiceRefresh() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "refresh",
+		Run:         refreshSession,
+		RequestBody: &request.Refresh{},
+	}
+	return r.Reset()
+}
+
 // The Structure that gives us the entry point for user record updates
 func NewServiceUpdate() *ServiceProcess {
 	r := &ServiceProcess{
+		Name:        "update",
 		Run:         update,
 		RequestBody: &request.Update{},
 	}
@@ -110,6 +235,7 @@ func NewServiceUpdate() *ServiceProcess {
 // The Structure that gives us the entry point for user record updates
 func NewServiceAuthenticate() *ServiceProcess {
 	r := &ServiceProcess{
+		Name:        "authenticate",
 		Run:         authenticate,
 		RequestBody: &request.Authenticate{},
 	}
@@ -117,9 +243,30 @@ func NewServiceAuthenticate() *ServiceProcess {
 
 }
 
+// NewServiceIntrospect is the entry point for a system client checking a token without using it
+func NewServiceIntrospect() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "introspect",
+		Run:         introspect,
+		RequestBody: &request.Authenticate{},
+	}
+	return r.Reset()
+}
+
+// NewServiceAuthorize is the entry point for a client checking a user holds a permission
+func NewServiceAuthorize() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "authorize",
+		Run:         authorize,
+		RequestBody: &request.Authorize{},
+	}
+	return r.Reset()
+}
+
 // NewServiceTest is the entry point for a client checking a connection
 func NewServiceTest() *ServiceProcess {
 	r := &ServiceProcess{
+		Name:        "test",
 		Run:         servicetest,
 		RequestBody: &request.Test{},
 	}
@@ -127,11 +274,53 @@ func NewServiceTest() *ServiceProcess {
 
 }
 
+// NewServiceResetRequest is the entry point for a user that has lost their password
+func NewServiceResetRequest() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "reset",
+		Run:         resetRequest,
+		RequestBody: &request.ResetRequest{},
+	}
+	return r.Reset()
+}
+
+// NewServiceResetConfirm is the entry point to set a new password from a lost password token
+func NewServiceResetConfirm() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "reset.confirm",
+		Run:         resetConfirm,
+		RequestBody: &request.ResetConfirm{},
+	}
+	return r.Reset()
+}
+
+// NewServiceVerify is the entry point to activate a new user with the token from their verification message
+func NewServiceVerify() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "verify",
+		Run:         verifyUser,
+		RequestBody: &request.Verify{},
+	}
+	return r.Reset()
+}
+
+// NewServiceVerifyResend is the entry point for a new user that needs another verification message
+func NewServiceVerifyResend() *ServiceProcess {
+	r := &ServiceProcess{
+		Name:        "verify.resend",
+		Run:         verifyResend,
+		RequestBody: &request.VerifyResend{},
+	}
+	return r.Reset()
+}
+
 // Setup the service structure for common values required.  This will take the request package and
 // unpack it into the header and service-specific body.
 func (s *ServiceProcess) SetupService(c *configure.Configure, requestPackage string) (record.Packer, error) {
 	var err error
 
+	s.Config = c
+
 	// Unpack the incoming request, saving the body and header in our structure.
 	// ensure the package has all of the required elements.
 	pack := record.NewPackage()
@@ -178,11 +367,17 @@ func (s *ServiceProcess) SetupService(c *configure.Configure, requestPackage str
 		return s.PackageErr(err)
 	}
 	s.ResponsePackage.SetSecret([]byte(s.Client.Salt))
+	pack.SetSecret([]byte(s.Client.Salt))
 
 	// Confirm that the signature is good. We wait here so we can use the client record.
 	if !record.GoodSignature(pack) {
 		return s.PackageErr(ecode.ErrInvalidChecksum)
 	}
+	// The client's capabilities say which services it may call and what they may change
+	if !s.Client.CanCallService(s.Name) {
+		return s.PackageErr(ecode.ErrServiceNotPermitted)
+	}
+	s.clientOptions()
 	// Unpack the body. The body is defined as an interface, so we can do a check here.
 	if err = json.Unmarshal([]byte(pack.GetBody()), s.RequestBody); err != nil {
 		return s.PackageErr(ecode.ErrBadBody)
@@ -241,9 +436,26 @@ func register(s *ServiceProcess) (record.Packer, error) {
 		return s.PackageErr(err)
 	}
 
+	// When verification is required, the user can't login until they follow the link
+	// they are sent.
+	token := ""
+	if verifyConfig(s).Required {
+		if notify.Get() == nil {
+			return s.PackageErr(ecode.ErrNotifyOff)
+		}
+		token = newUser.NewVerifyToken()
+	}
+
 	if err = s.UserStore.UserInsert(newUser); err != nil {
 		return s.PackageErr(err)
 	}
+	if token != "" {
+		if err = sendVerify(s, newUser, token); err != nil {
+			return s.PackageErr(err)
+		}
+	}
+	notifyUser(notify.EVENT_REGISTER, newData(newUser))
+	fireWebhook(webhook.EVENT_REGISTER, newEvent(newUser))
 
 	if err = s.ResponsePackage.SetBodyMarshal(mappers.ResponseFromUser(response.NewUserReturn(), newUser)); err != nil {
 		return s.PackageErr(err)
@@ -265,144 +477,1081 @@ func login(s *ServiceProcess) (record.Packer, error) {
 	if err != nil {
 		return s.PackageErr(err)
 	}
-	// Process the login request. This checks the password that was passed
+	// Process the login request. This checks the password that was passed. If the
+	// account is locked, the error will carry how long the caller should wait.
 	if err = user.Login(login.Password); err != nil {
-		s.UserStore.UserUpdate(user) // Try and save the error counters
+		if err == ecode.ErrSecondFactorRequired {
+			return secondFactorRequired(s, user)
+		}
+		loginFailed(s, user)
 		return s.PackageErr(err)
 	}
+	return newLogin(s, user, login.Device)
+}
 
-	if err = s.UserStore.UserUpdate(user); err != nil {
+// secondFactorRequired answers a password login for a user with two-factor turned on. There is
+// no session yet: the caller gets a short-lived token to send to /login/factor/ with a code.
+func secondFactorRequired(s *ServiceProcess, user *tenant.User) (record.Packer, error) {
+	if err := s.UserStore.UserUpdate(user); err != nil {
 		return s.PackageErr(err)
 	}
-	if err = s.ResponsePackage.SetBodyMarshal(mappers.ResponseFromUser(response.NewUserReturn(), user)); err != nil {
+	if err := s.ResponsePackage.SetBodyMarshal(mappers.SecondFactorFromUser(response.NewUserReturn(), user)); err != nil {
 		return s.PackageErr(err)
 	}
 	return s.PackageOk()
 }
 
-// ServiceLogout will logout the user that is currently logged in. Only the token is required for this operation.
-// If the user is not logged in then an error will be returned. If a user isn't found, a 'NotLoggedIn'
-// is returned instead. This is a more precise message for a logout condition
-func logout(s *ServiceProcess) (record.Packer, error) {
-	var err error
-
-	logout, _ := s.RequestBody.(*request.Logout)
+// loginFactor finishes a two-factor login. The token from the password login is checked
+// along with the authenticator (or recovery) code. A wrong code ends the attempt.
+func loginFactor(s *ServiceProcess) (record.Packer, error) {
+	req := s.RequestBody.(*request.SecondFactor)
 
-	// Find the user - we have to use the TOKEN name for this
-	user, err := s.UserStore.UserFetch(s.Client.Domain, storage.FieldToken, logout.Token)
+	defer s.UserStore.Release()
+	user, err := s.UserStore.FetchUserByLogin(s.Client.Domain, req.Login)
 	if err != nil {
-		if err == ecode.ErrUserNotFound {
-			return s.PackageErr(ecode.ErrUserNotLoggedIn)
-		}
 		return s.PackageErr(err)
 	}
-	defer s.UserStore.Release()
+	secret := ""
+	if encrypter := storage.GetEncrypter(); encrypter != nil {
+		secret = encrypter.Decrypt(user.TotpSecret)
+	}
+	if err = user.LoginSecondFactor(req.Token, req.Code, secret); err != nil {
+		loginFailed(s, user)
+		return s.PackageErr(err)
+	}
+	return newLogin(s, user, req.Device)
+}
+
+// newLogin creates the session for a user that has just logged in and returns it to the caller.
+func newLogin(s *ServiceProcess, user *tenant.User, device string) (record.Packer, error) {
+	var err error
 
-	if err = user.Logout(); err != nil {
+	// Each login gets its own session so other devices stay logged in.
+	// A refresh token is issued with it when the store can keep them.
+	session := tenant.NewSession(user, s.Client.Guid, device)
+	refresh := tenant.NewRefresh(session)
+	if err = s.UserStore.RefreshInsert(refresh); err != nil {
+		if err != ecode.ErrNoSupport {
+			return s.PackageErr(err)
+		}
+		refresh = nil
+		session.Family = ""
+	}
+	if err = s.UserStore.SessionInsert(session); err != nil {
 		return s.PackageErr(err)
 	}
 
 	if err = s.UserStore.UserUpdate(user); err != nil {
 		return s.PackageErr(err)
 	}
-	err = s.ResponsePackage.SetBodyMarshal(response.NewAck(`logout`))
-	if err != nil {
+	rtn := mappers.ResponseFromSession(mappers.ResponseFromUser(response.NewUserReturn(), user), session)
+	if refresh != nil {
+		mappers.ResponseFromRefresh(rtn, refresh)
+	}
+	if signer := ticket.Get(); signer != nil {
+		rtn.Ticket, rtn.TicketExpiresAt, err = signer.Issue(session.Guid, session.Domain, session.Id, session.CreatedAt)
+		if err != nil {
+			return s.PackageErr(err)
+		}
+	}
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
 		return s.PackageErr(err)
 	}
 	return s.PackageOk()
 }
 
-// Authenticate will check to see if the user is logged in and then mark the record as updated. This should
-// only be called about once a minute by the client so they
-func authenticate(s *ServiceProcess) (record.Packer, error) {
-	var err error
-
+// totpEnroll gives a logged in user a new TOTP secret. Two-factor isn't turned on until the
+// first code is sent to /2fa/confirm/. The secret is only stored encrypted.
+func totpEnroll(s *ServiceProcess) (record.Packer, error) {
 	auth, _ := s.RequestBody.(*request.Authenticate)
 
-	// Find the user - we have to use the TOKEN name for this
-	user, err := s.UserStore.UserFetch(s.Client.Domain, storage.FieldToken, auth.Token)
+	encrypter := storage.GetEncrypter()
+	if encrypter == nil {
+		return s.PackageErr(ecode.ErrTwoFactorOff)
+	}
+	user, err := sessionUser(s, auth.Token)
 	if err != nil {
-		if err == ecode.ErrUserNotFound {
-			return s.PackageErr(ecode.ErrUserNotLoggedIn)
-		}
 		return s.PackageErr(err)
 	}
 	defer s.UserStore.Release()
 
-	if err = user.Authenticate(auth.Token); err != nil {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	if err = user.EnrollTotp(encrypter.Encrypt(secret)); err != nil {
 		return s.PackageErr(err)
 	}
-
 	if err = s.UserStore.UserUpdate(user); err != nil {
 		return s.PackageErr(err)
 	}
-	s.ResponsePackage.SetBodyMarshal(response.NewAck(`logout`))
+
+	issuer := ""
+	if s.Config != nil {
+		issuer = s.Config.TwoFactor.Issuer
+	}
+	rtn := response.NewTotpEnroll()
+	rtn.Secret = secret
+	rtn.Uri = totp.URI(issuer, user.LoginName, secret)
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
+		return s.PackageErr(err)
+	}
 	return s.PackageOk()
 }
 
-// Update is the catch-all for updating the record. The fields that can be updated through THIS call
-// are: LoginName, FullName, Email and Password. This limited set allows most front-end applications to
-// alter key fields that the user will want to affect. It is only accessible by the users' token, so they
-// must be logged in currently.
-//
-// If a field is blank, the field will not be updated. This allows the front-end to control what is being altered.
-//
-// If a front-end wants to create multiple interfaces (change password only, for example) it can include options
-// in the call which will stop updates from occurring.
-func update(s *ServiceProcess) (record.Packer, error) {
-	var err error
-	var eSetter mappers.ErrSetter
-	var updatedFields []string
+// totpConfirm checks the first code from the user's authenticator and turns two-factor on.
+// The recovery codes are returned; this is the only time they can be seen.
+func totpConfirm(s *ServiceProcess) (record.Packer, error) {
+	req, _ := s.RequestBody.(*request.TotpConfirm)
 
-	update := s.RequestBody.(*request.Update)
+	encrypter := storage.GetEncrypter()
+	if encrypter == nil {
+		return s.PackageErr(ecode.ErrTwoFactorOff)
+	}
+	user, err := sessionUser(s, req.Token)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
 
-	if s.Options == nil || len(s.Options) == 0 {
-		return s.PackageCodeMsg(http.StatusInternalServerError, "No updates in options")
+	rtn := response.NewRecoveryCodes()
+	if rtn.Codes, err = user.ConfirmTotp(encrypter.Decrypt(user.TotpSecret), req.Code); err != nil {
+		return s.PackageErr(err)
+	}
+	if err = s.UserStore.UserUpdate(user); err != nil {
+		return s.PackageErr(err)
+	}
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
+		return s.PackageErr(err)
 	}
+	return s.PackageOk()
+}
+
+// passkeyNew gives a logged in user a challenge, and the options the browser needs, to create
+// a new passkey. The answer is sent to /passkey/add/.
+func passkeyNew(s *ServiceProcess) (record.Packer, error) {
+	auth, _ := s.RequestBody.(*request.Authenticate)
 
-	// Find the user via Token
-	user, err := s.UserStore.UserFetch(s.Client.Domain, storage.FieldToken, update.Token)
+	rp := webauthn.Get()
+	if rp == nil {
+		return s.PackageErr(ecode.ErrPasskeysOff)
+	}
+	user, err := sessionUser(s, auth.Token)
 	if err != nil {
 		return s.PackageErr(err)
 	}
 	defer s.UserStore.Release()
 
-	if update.Login != "" && (s.boolOption(PERMIT_ALL) || s.boolOption(PERMIT_LOGIN)) {
-		eSetter.Set(user.SetLoginName, update.Login)
-		updatedFields = append(updatedFields, "Login")
+	list, err := s.UserStore.CredentialList(user.Guid)
+	if err != nil {
+		return s.PackageErr(err)
 	}
-	if update.Name != "" && (s.boolOption(PERMIT_ALL) || s.boolOption(PERMIT_NAME)) {
-		eSetter.Set(user.SetName, update.Name)
-		updatedFields = append(updatedFields, "Name")
+	rtn := response.NewPasskeyCreate()
+	rtn.Challenge = user.NewChallenge()
+	if err = s.UserStore.UserUpdate(user); err != nil {
+		return s.PackageErr(err)
 	}
-	if update.Email != "" && (s.boolOption(PERMIT_ALL) || s.boolOption(PERMIT_EMAIL)) {
-		eSetter.Set(user.SetEmail, update.Email)
-		updatedFields = append(updatedFields, "Email")
+	rtn.RPId = rp.Id
+	rtn.RPName = rp.Name
+	rtn.UserId = webauthn.EncodeBase64([]byte(user.Guid))
+	rtn.UserName = user.LoginName
+	rtn.DisplayName = user.FullName
+	rtn.Algorithms = webauthn.Algorithms
+	rtn.Exclude = make([]string, 0, len(list))
+	for _, cred := range list {
+		rtn.Exclude = append(rtn.Exclude, cred.Id)
 	}
-	if eSetter.Err != nil {
-		return s.PackageErr(eSetter.Err)
+	rtn.UserVerification = userVerification(rp)
+	rtn.ExpiresAt = user.ChallengeExpiresAt
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
+		return s.PackageErr(err)
 	}
-	if update.OldPassword != "" && update.NewPassword != "" && (s.boolOption(PERMIT_ALL) || s.boolOption(PERMIT_PASSWORD)) {
-		if err = user.ChangePassword(update.OldPassword, update.NewPassword); err != nil {
-			return s.PackageErr(err)
-		}
-		updatedFields = append(updatedFields, "Password")
+	return s.PackageOk()
+}
+
+// passkeyAdd checks the browser's answer to the challenge from passkeyNew and saves the new
+// passkey. The challenge is used up whether or not the answer is good.
+func passkeyAdd(s *ServiceProcess) (record.Packer, error) {
+	req, _ := s.RequestBody.(*request.PasskeyAdd)
+
+	rp := webauthn.Get()
+	if rp == nil {
+		return s.PackageErr(ecode.ErrPasskeysOff)
 	}
-	if len(updatedFields) == 0 {
-		return s.PackageCodeMsg(http.StatusBadRequest, "No fields included for update")
+	user, err := sessionUser(s, req.Token)
+	if err != nil {
+		return s.PackageErr(err)
 	}
-	if err = s.UserStore.UserUpdate(user); err != nil {
+	defer s.UserStore.Release()
+
+	challenge, err := user.TakeChallenge()
+	if saveErr := s.UserStore.UserUpdate(user); err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	clientData, err := webauthn.DecodeBase64(req.ClientDataJSON)
+	if err != nil {
+		return s.PackageErr(ecode.ErrPasskeyResponse)
+	}
+	attestation, err := webauthn.DecodeBase64(req.AttestationObject)
+	if err != nil {
+		return s.PackageErr(ecode.ErrPasskeyResponse)
+	}
+	cred, err := rp.VerifyRegistration(challenge, clientData, attestation)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	stored := tenant.NewCredential(user, req.Name, cred)
+	if err = s.UserStore.CredentialInsert(stored); err != nil {
 		return s.PackageErr(err)
 	}
 
-	if err = s.ResponsePackage.SetBodyMarshal(mappers.ResponseFromUser(response.NewUserReturn(), user)); err != nil {
+	rtn := response.NewPasskey()
+	rtn.Id = stored.Id
+	rtn.Name = stored.Name
+	rtn.CreatedAt = stored.CreatedAt
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
 		return s.PackageErr(err)
 	}
 	return s.PackageOk()
+}
+
+// passkeyStart gives a challenge, and the user's passkeys, for a passkey login. The answer is
+// sent to /passkey/login/.
+func passkeyStart(s *ServiceProcess) (record.Packer, error) {
+	req, _ := s.RequestBody.(*request.PasskeyStart)
+
+	rp := webauthn.Get()
+	if rp == nil {
+		return s.PackageErr(ecode.ErrPasskeysOff)
+	}
+	defer s.UserStore.Release()
+	user, err := s.UserStore.FetchUserByLogin(s.Client.Domain, req.Login)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	list, err := s.UserStore.CredentialList(user.Guid)
+	if err == nil && len(list) == 0 {
+		err = ecode.ErrPasskeyNotFound
+	}
+	if err != nil {
+		return s.PackageErr(err)
+	}
 
+	rtn := response.NewPasskeyGet()
+	rtn.Challenge = user.NewChallenge()
+	if err = s.UserStore.UserUpdate(user); err != nil {
+		return s.PackageErr(err)
+	}
+	rtn.RPId = rp.Id
+	for _, cred := range list {
+		rtn.Allow = append(rtn.Allow, cred.Id)
+	}
+	rtn.UserVerification = userVerification(rp)
+	rtn.ExpiresAt = user.ChallengeExpiresAt
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
+		return s.PackageErr(err)
+	}
 	return s.PackageOk()
 }
 
+// passkeyLogin checks the browser's answer to the challenge from passkeyStart and logs the
+// user in. A bad answer counts as a failed login.
+func passkeyLogin(s *ServiceProcess) (record.Packer, error) {
+	req, _ := s.RequestBody.(*request.PasskeyLogin)
+
+	rp := webauthn.Get()
+	if rp == nil {
+		return s.PackageErr(ecode.ErrPasskeysOff)
+	}
+	defer s.UserStore.Release()
+	user, err := s.UserStore.FetchUserByLogin(s.Client.Domain, req.Login)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	id, err := webauthn.DecodeBase64(req.CredentialId)
+	if err != nil {
+		return s.PackageErr(ecode.ErrPasskeyResponse)
+	}
+	cred, err := s.UserStore.CredentialFetch(webauthn.EncodeBase64(id))
+	if err == nil && cred.Guid != user.Guid {
+		err = ecode.ErrPasskeyNotFound
+	}
+	if err != nil {
+		return s.PackageErr(err)
+	}
+
+	err = user.LoginPasskey(func(challenge string) error {
+		clientData, err1 := webauthn.DecodeBase64(req.ClientDataJSON)
+		authData, err2 := webauthn.DecodeBase64(req.AuthenticatorData)
+		signature, err3 := webauthn.DecodeBase64(req.Signature)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return ecode.ErrPasskeyResponse
+		}
+		count, err := rp.VerifyAssertion(challenge, cred.PublicKey, cred.SignCount, clientData, authData, signature)
+		if err == nil {
+			cred.SignCount = count
+			cred.LastUsedAt = time.Now()
+		}
+		return err
+	})
+	if err != nil {
+		loginFailed(s, user)
+		return s.PackageErr(err)
+	}
+	if err = s.UserStore.CredentialUpdate(cred); err != nil {
+		return s.PackageErr(err)
+	}
+	return newLogin(s, user, req.Device)
+}
+
+// userVerification is how the browser is asked to verify the user
+func userVerification(rp *webauthn.RelyingParty) string {
+	if rp.UserVerification {
+		return "required"
+	}
+	return "preferred"
+}
+
+// sessionUser authenticates the session token and returns the user that owns the session
+func sessionUser(s *ServiceProcess, token string) (*tenant.User, error) {
+	session, err := authenticateSession(s, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.UserStore.FetchUserByGUID(session.Guid)
+}
+
+// refreshSession trades a refresh token for a new session and a new refresh token. The old
+// refresh token and the session it came with can't be used again. If a refresh token is
+// presented a second time, it has been copied: every session and refresh token from the
+// same login is removed and the user must login again.
+func refreshSession(s *ServiceProcess) (record.Packer, error) {
+	var err error
+
+	req, _ := s.RequestBody.(*request.Refresh)
+
+	old, err := s.UserStore.RefreshFetch(req.RefreshToken)
+	if err == ecode.ErrRefreshNotFound || (err == nil && old.Domain != s.Client.Domain) {
+		return s.PackageErr(ecode.ErrRefreshInvalid)
+	}
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	if old.IsUsed() {
+		revokeFamily(s, old)
+		return s.PackageErr(ecode.ErrRefreshReused)
+	}
+	if old.IsExpired(time.Now()) {
+		revokeFamily(s, old)
+		return s.PackageErr(ecode.ErrRefreshInvalid)
+	}
+	user, err := s.UserStore.FetchUserByGUID(old.Guid)
+	if err == nil && !user.IsActive {
+		err = ecode.ErrUserNotActive
+	}
+	if err != nil {
+		revokeFamily(s, old)
+		if err == ecode.ErrUserNotFound {
+			err = ecode.ErrRefreshInvalid
+		}
+		return s.PackageErr(err)
+	}
+
+	session, next := old.Rotate()
+	if err = s.UserStore.RefreshUpdate(old); err != nil {
+		if err == ecode.ErrRefreshReused { // Another request traded it in first
+			revokeFamily(s, old)
+		}
+		return s.PackageErr(err)
+	}
+	if err = deleteFamilySessions(s, old); err != nil {
+		return s.PackageErr(err)
+	}
+	if err = s.UserStore.RefreshInsert(next); err != nil {
+		return s.PackageErr(err)
+	}
+	if err = s.UserStore.SessionInsert(session); err != nil {
+		return s.PackageErr(err)
+	}
+
+	rtn := mappers.RefreshFromSession(response.NewRefresh(), session, next)
+	if signer := ticket.Get(); signer != nil {
+		rtn.Ticket, rtn.TicketExpiresAt, err = signer.Issue(session.Guid, session.Domain, session.Id, session.CreatedAt)
+		if err != nil {
+			return s.PackageErr(err)
+		}
+	}
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// revokeFamily ends a login: the refresh tokens and sessions that came from it are removed.
+// If the user has no sessions left, they are logged out.
+func revokeFamily(s *ServiceProcess, refresh *tenant.Refresh) error {
+	if err := deleteFamilySessions(s, refresh); err != nil {
+		return err
+	}
+	if err := s.UserStore.RefreshDeleteFamily(refresh.Family); err != nil {
+		return err
+	}
+	remaining, err := s.UserStore.SessionList(refresh.Guid)
+	if err == nil && len(remaining) == 0 {
+		err = logoutUser(s, refresh.Guid)
+	}
+	return err
+}
+
+// deleteFamilySessions removes the sessions that were issued with the refresh token's family
+func deleteFamilySessions(s *ServiceProcess, refresh *tenant.Refresh) error {
+	list, err := s.UserStore.SessionList(refresh.Guid)
+	if err != nil {
+		return err
+	}
+	for _, session := range list {
+		if session.Family == refresh.Family {
+			if err = s.UserStore.SessionDelete(session); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newTicket will issue a new signed ticket for a session. The session token is used, so
+// a session that has been logged out can't get any more tickets.
+func newTicket(s *ServiceProcess) (record.Packer, error) {
+	var err error
+
+	auth, _ := s.RequestBody.(*request.Authenticate)
+
+	signer := ticket.Get()
+	if signer == nil {
+		return s.PackageErr(ecode.ErrTicketsOff)
+	}
+	session, err := authenticateSession(s, auth.Token)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	rtn := response.NewTicket()
+	rtn.Ticket, rtn.ExpiresAt, err = signer.Issue(session.Guid, session.Domain, session.Id, session.CreatedAt)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// fetchSession finds the session for a token and makes sure it belongs to the client's domain.
+// If a session isn't found, a 'NotLoggedIn' is returned.
+func fetchSession(s *ServiceProcess, token string) (*tenant.Session, error) {
+	session, err := s.UserStore.SessionFetch(token)
+	if err == ecode.ErrSessionNotFound || (err == nil && session.Domain != s.Client.Domain) {
+		return nil, ecode.ErrUserNotLoggedIn
+	}
+	return session, err
+}
+
+// authenticateSession finds the session for the token and checks it hasn't expired and that
+// its user is still active. Expired sessions are removed from the store. When the user has been
+// disabled or deleted, all of their sessions and refresh tokens are removed.
+func authenticateSession(s *ServiceProcess, token string) (*tenant.Session, error) {
+	session, err := fetchSession(s, token)
+	if err != nil {
+		return nil, err
+	}
+	if err = session.Authenticate(token); err != nil {
+		s.UserStore.SessionDelete(session)
+		return nil, err
+	}
+	user, err := s.UserStore.FetchUserByGUID(session.Guid)
+	if err == nil && !user.IsActive {
+		err = ecode.ErrUserNotActive
+	}
+	if err == ecode.ErrUserNotActive || err == ecode.ErrUserNotFound {
+		endSessions(s, session.Guid)
+		if err == ecode.ErrUserNotFound {
+			err = ecode.ErrUserNotLoggedIn
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = s.UserStore.SessionUpdate(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ServiceLogout will logout the user that is currently logged in. Only the token is required for this operation.
+// If the user is not logged in then an error will be returned. If a user isn't found, a 'NotLoggedIn'
+// is returned instead. This is a more precise message for a logout condition
+func logout(s *ServiceProcess) (record.Packer, error) {
+	var err error
+
+	logout, _ := s.RequestBody.(*request.Logout)
+
+	// Find the session - we have to use the TOKEN for this
+	session, err := fetchSession(s, logout.Token)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	if err = s.UserStore.SessionDelete(session); err != nil {
+		return s.PackageErr(err)
+	}
+	if session.Family != "" {
+		if err = s.UserStore.RefreshDeleteFamily(session.Family); err != nil {
+			return s.PackageErr(err)
+		}
+	}
+
+	// The user is only logged out when their last session is gone
+	remaining, err := s.UserStore.SessionList(session.Guid)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	if len(remaining) == 0 {
+		if err = logoutUser(s, session.Guid); err != nil {
+			return s.PackageErr(err)
+		}
+	}
+	err = s.ResponsePackage.SetBodyMarshal(response.NewAck(`logout`))
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// logoutAll will remove every session the user has open, logging them out on every device.
+// Any of the user's session tokens can be used.
+func logoutAll(s *ServiceProcess) (record.Packer, error) {
+	var err error
+
+	logout, _ := s.RequestBody.(*request.Logout)
+
+	session, err := fetchSession(s, logout.Token)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	if err = endSessions(s, session.Guid); err != nil {
+		return s.PackageErr(err)
+	}
+	if err = logoutUser(s, session.Guid); err != nil {
+		return s.PackageErr(err)
+	}
+	err = s.ResponsePackage.SetBodyMarshal(response.NewAck(`logout`))
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// endSessions removes every session and refresh token the user has
+func endSessions(s *ServiceProcess, guid string) error {
+	if err := s.UserStore.SessionDeleteAll(guid); err != nil {
+		return err
+	}
+	err := s.UserStore.RefreshDeleteAll(guid)
+	if err == ecode.ErrNoSupport {
+		err = nil
+	}
+	return err
+}
+
+// endUserSessions removes all of the user's sessions and refresh tokens and saves the record,
+// marked as logged out, along with any other changes made to it.
+func endUserSessions(s *ServiceProcess, user *tenant.User) error {
+	if err := endSessions(s, user.Guid); err != nil {
+		return err
+	}
+	loggedOut := user.Logout() == nil
+	if err := s.UserStore.UserUpdate(user); err != nil {
+		return err
+	}
+	if loggedOut {
+		fireWebhook(webhook.EVENT_LOGOUT, newEvent(user))
+	}
+	return nil
+}
+
+// logoutUser marks the user's record as logged out once they have no sessions left
+func logoutUser(s *ServiceProcess, guid string) error {
+	user, err := s.UserStore.FetchUserByGUID(guid)
+	if err != nil {
+		return err
+	}
+	if !user.IsLoggedIn {
+		return nil
+	}
+	user.Logout()
+	if err = s.UserStore.UserUpdate(user); err != nil {
+		return err
+	}
+	fireWebhook(webhook.EVENT_LOGOUT, newEvent(user))
+	return nil
+}
+
+// sessions will return a list of all the sessions the user has open. The session making the
+// request must be valid and is flagged in the list.
+func sessions(s *ServiceProcess) (record.Packer, error) {
+	auth, _ := s.RequestBody.(*request.Authenticate)
+
+	current, err := authenticateSession(s, auth.Token)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	list, err := s.UserStore.SessionList(current.Guid)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	now := time.Now()
+	open := []*tenant.Session{}
+	for _, session := range list {
+		if session.IsExpired(now) {
+			s.UserStore.SessionDelete(session) // Clean up as we go
+			continue
+		}
+		open = append(open, session)
+	}
+
+	rtn := mappers.SessionListFromSessions(response.NewSessionList(), open, current)
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// Authenticate will check to see if the user is logged in and then mark the record as updated. This should
+// only be called about once a minute by the client so they
+func authenticate(s *ServiceProcess) (record.Packer, error) {
+	var err error
+
+	auth, _ := s.RequestBody.(*request.Authenticate)
+
+	// Find the session - we have to use the TOKEN for this
+	if _, err = authenticateSession(s, auth.Token); err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	s.ResponsePackage.SetBodyMarshal(response.NewAck(`logout`))
+	return s.PackageOk()
+}
+
+// introspect reports on a session token for a downstream service. Unlike authenticate, nothing
+// is changed: the session's timeout isn't extended and expired sessions are left for the owner
+// to find. Only system clients can use it. A token that isn't valid is not an error; the
+// response simply says it isn't active.
+func introspect(s *ServiceProcess) (record.Packer, error) {
+	auth, _ := s.RequestBody.(*request.Authenticate)
+
+	if !s.Client.IsSystem {
+		return s.PackageErr(ecode.ErrNotSystemClient)
+	}
+	rtn := response.NewIntrospect()
+
+	session, err := fetchSession(s, auth.Token)
+	if err != nil && err != ecode.ErrUserNotLoggedIn {
+		return s.PackageErr(err)
+	}
+	if err == nil {
+		defer s.UserStore.Release()
+		now := time.Now()
+		if !session.IsExpired(now) {
+			user, err := s.UserStore.FetchUserByGUID(session.Guid)
+			if err != nil && err != ecode.ErrUserNotFound {
+				return s.PackageErr(err)
+			}
+			if err == nil && user.IsActive {
+				mappers.IntrospectFromSession(rtn, session, user, now)
+			}
+		}
+	}
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// authorize tells a client whether the owner of a token holds a permission. The domain defaults
+// to the client's own; only system clients can ask about another domain. As with introspect,
+// the session isn't extended, and a token that isn't valid isn't an error: the permission just
+// isn't granted.
+func authorize(s *ServiceProcess) (record.Packer, error) {
+	auth, _ := s.RequestBody.(*request.Authorize)
+
+	domain := auth.Domain
+	if domain == "" {
+		domain = s.Client.Domain
+	}
+	if domain != s.Client.Domain && !s.Client.IsSystem {
+		return s.PackageErr(ecode.ErrNotSystemClient)
+	}
+	rtn := response.NewAuthorize()
+	rtn.Permission = strings.ToLower(strings.TrimSpace(auth.Permission))
+	rtn.Domain = domain
+
+	session, err := s.UserStore.SessionFetch(auth.Token)
+	if err != nil && err != ecode.ErrSessionNotFound {
+		return s.PackageErr(err)
+	}
+	if err == nil {
+		defer s.UserStore.Release()
+		if session.Domain == domain && !session.IsExpired(time.Now()) {
+			user, err := s.UserStore.FetchUserByGUID(session.Guid)
+			if err != nil && err != ecode.ErrUserNotFound {
+				return s.PackageErr(err)
+			}
+			if err == nil && user.IsActive {
+				rtn.Guid = user.Guid
+				rtn.Granted = user.HasPermission(rtn.Permission)
+			}
+		}
+	}
+	if err = s.ResponsePackage.SetBodyMarshal(rtn); err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// Update is the catch-all for updating the record. The fields that can be updated through THIS call
+// are: LoginName, FullName, Email and Password. This limited set allows most front-end applications to
+// alter key fields that the user will want to affect. It is only accessible by the users' token, so they
+// must be logged in currently.
+//
+// If a field is blank, the field will not be updated. This allows the front-end to control what is being altered.
+//
+// What can be changed is set by the calling client's PERMIT_* capabilities. If a front-end wants to create
+// multiple interfaces (change password only, for example) each one can use a client with fewer capabilities.
+func update(s *ServiceProcess) (record.Packer, error) {
+	var err error
+	var eSetter mappers.ErrSetter
+	var updatedFields []string
+
+	update := s.RequestBody.(*request.Update)
+
+	if s.Options == nil || len(s.Options) == 0 {
+		return s.PackageErr(ecode.ErrNoUpdateCapability)
+	}
+
+	// Find the user via the session's Token
+	session, err := authenticateSession(s, update.Token)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	user, err := s.UserStore.FetchUserByGUID(session.Guid)
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+	user.UseSession(session)
+	oldEmail := user.Email
+	passwordChanged := false
+
+	if update.Login != "" && (s.boolOption(PERMIT_ALL) || s.boolOption(PERMIT_LOGIN)) {
+		eSetter.Set(user.SetLoginName, update.Login)
+		updatedFields = append(updatedFields, "Login")
+	}
+	if update.Name != "" && (s.boolOption(PERMIT_ALL) || s.boolOption(PERMIT_NAME)) {
+		eSetter.Set(user.SetName, update.Name)
+		updatedFields = append(updatedFields, "Name")
+	}
+	if update.Email != "" && (s.boolOption(PERMIT_ALL) || s.boolOption(PERMIT_EMAIL)) {
+		eSetter.Set(user.SetEmail, update.Email)
+		updatedFields = append(updatedFields, "Email")
+	}
+	if eSetter.Err != nil {
+		return s.PackageErr(eSetter.Err)
+	}
+	if update.OldPassword != "" && update.NewPassword != "" && (s.boolOption(PERMIT_ALL) || s.boolOption(PERMIT_PASSWORD)) {
+		if err = user.ChangePassword(update.OldPassword, update.NewPassword); err != nil {
+			return s.PackageErr(err)
+		}
+		updatedFields = append(updatedFields, "Password")
+		passwordChanged = true
+	}
+	if len(updatedFields) == 0 {
+		return s.PackageCodeMsg(http.StatusBadRequest, "No fields included for update")
+	}
+	if err = s.UserStore.UserUpdate(user); err != nil {
+		return s.PackageErr(err)
+	}
+	if user.Email != oldEmail {
+		data := newData(user)
+		data.Email = oldEmail // Tell the old address, in case the change wasn't made by the user
+		data.NewEmail = user.Email
+		notifyUser(notify.EVENT_EMAIL, data)
+
+		event := newEvent(user)
+		event.OldEmail = oldEmail
+		fireWebhook(webhook.EVENT_EMAIL, event)
+	}
+	if passwordChanged {
+		notifyUser(notify.EVENT_PASSWORD, newData(user))
+	}
+
+	if err = s.ResponsePackage.SetBodyMarshal(mappers.ResponseFromUser(response.NewUserReturn(), user)); err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+
+	return s.PackageOk()
+}
+
+// resetRequest will generate a single-use token for a user that has lost their password. The user
+// is found by login or, if that isn't given, by email. Only a system client will be sent the token
+// back; everyone else gets an acknowledgement so the request can't be used to probe for users.
+func resetRequest(s *ServiceProcess) (record.Packer, error) {
+	var user *tenant.User
+	var err error
+
+	reset := s.RequestBody.(*request.ResetRequest)
+
+	if reset.Login != "" {
+		user, err = s.UserStore.FetchUserByLogin(s.Client.Domain, reset.Login)
+	} else {
+		user, err = s.UserStore.FetchUserByEmail(s.Client.Domain, reset.Email)
+	}
+	if err != nil {
+		if err == ecode.ErrUserNotFound && !s.Client.IsSystem {
+			s.ResponsePackage.SetBodyMarshal(response.NewAck(`reset`))
+			return s.PackageOk()
+		}
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	token := user.GenerateLostPassword()
+	if err = s.UserStore.UserUpdate(user); err != nil {
+		return s.PackageErr(err)
+	}
+	data := newData(user)
+	data.Token = token
+	data.ExpiresAt = user.ResetExpiresAt
+	if s.Config != nil && s.Config.Notify.ResetLink != "" {
+		data.Link = s.Config.Notify.ResetLink + token
+	}
+	notifyUser(notify.EVENT_RESET, data)
+
+	if s.Client.IsSystem {
+		rtn := response.NewReset()
+		rtn.Login = user.LoginName
+		rtn.Token = token
+		rtn.Expires = user.ResetExpiresAt
+		err = s.ResponsePackage.SetBodyMarshal(rtn)
+	} else {
+		err = s.ResponsePackage.SetBodyMarshal(response.NewAck(`reset`))
+	}
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// resetConfirm will take the lost password token and the new password. If the token is valid, the
+// password is changed and the token can no longer be used. Every session and refresh token the
+// user has is ended, so any taken along with the old password stop working.
+func resetConfirm(s *ServiceProcess) (record.Packer, error) {
+	var err error
+
+	confirm := s.RequestBody.(*request.ResetConfirm)
+
+	user, err := s.UserStore.FetchUserByResetToken(s.Client.Domain, confirm.Token)
+	if err != nil {
+		if err == ecode.ErrUserNotFound {
+			return s.PackageErr(ecode.ErrInvalidResetToken)
+		}
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	err = user.ConfirmLostPassword(confirm.Token, confirm.NewPassword)
+	if err == ecode.ErrInvalidResetToken {
+		s.UserStore.UserUpdate(user) // Save the cleared token
+	}
+	if err != nil {
+		return s.PackageErr(err)
+	}
+	if err = endUserSessions(s, user); err != nil {
+		return s.PackageErr(err)
+	}
+	notifyUser(notify.EVENT_PASSWORD, newData(user))
+	if err = s.ResponsePackage.SetBodyMarshal(response.NewAck(`reset`)); err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// verifyUser takes the token from the verification message and, if it is valid, activates the user.
+func verifyUser(s *ServiceProcess) (record.Packer, error) {
+	req := s.RequestBody.(*request.Verify)
+
+	user, err := s.UserStore.FetchUserByVerifyToken(s.Client.Domain, req.Token)
+	if err != nil {
+		if err == ecode.ErrUserNotFound {
+			return s.PackageErr(ecode.ErrInvalidVerifyToken)
+		}
+		return s.PackageErr(err)
+	}
+	defer s.UserStore.Release()
+
+	if err = user.ConfirmVerify(req.Token); err != nil {
+		return s.PackageErr(err)
+	}
+	if err = s.UserStore.UserUpdate(user); err != nil {
+		return s.PackageErr(err)
+	}
+	if err = s.ResponsePackage.SetBodyMarshal(response.NewAck(`verify`)); err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// verifyResend sends a new verification message to a user that hasn't been activated. The old
+// token can no longer be used. Only system clients are told if the user wasn't found or doesn't
+// need verifying.
+func verifyResend(s *ServiceProcess) (record.Packer, error) {
+	var user *tenant.User
+	var err error
+
+	if notify.Get() == nil {
+		return s.PackageErr(ecode.ErrNotifyOff)
+	}
+	resend := s.RequestBody.(*request.VerifyResend)
+
+	if resend.Login != "" {
+		user, err = s.UserStore.FetchUserByLogin(s.Client.Domain, resend.Login)
+	} else {
+		user, err = s.UserStore.FetchUserByEmail(s.Client.Domain, resend.Email)
+	}
+	if err == nil {
+		defer s.UserStore.Release()
+		if !user.IsVerifyPending() {
+			err = ecode.ErrUserActive
+		}
+	}
+	if err != nil {
+		if (err == ecode.ErrUserNotFound || err == ecode.ErrUserActive) && !s.Client.IsSystem {
+			s.ResponsePackage.SetBodyMarshal(response.NewAck(`verify`))
+			return s.PackageOk()
+		}
+		return s.PackageErr(err)
+	}
+
+	token := user.NewVerifyToken()
+	if err = s.UserStore.UserUpdate(user); err != nil {
+		return s.PackageErr(err)
+	}
+	if err = sendVerify(s, user, token); err != nil {
+		return s.PackageErr(err)
+	}
+	if err = s.ResponsePackage.SetBodyMarshal(response.NewAck(`verify`)); err != nil {
+		return s.PackageErr(err)
+	}
+	return s.PackageOk()
+}
+
+// verifyConfig returns the email verification settings. Verification is off if there is no configuration.
+func verifyConfig(s *ServiceProcess) configure.Verify {
+	if s.Config == nil {
+		return configure.Verify{}
+	}
+	return s.Config.Verify
+}
+
+// sendVerify sends the verification message, with its link, to the user's email address.
+func sendVerify(s *ServiceProcess, user *tenant.User, token string) error {
+	notifier := notify.Get()
+	if notifier == nil {
+		return ecode.ErrNotifyOff
+	}
+	data := newData(user)
+	data.Token = token
+	data.Link = verifyConfig(s).Link + token
+	data.ExpiresAt = user.VerifyExpiresAt
+	if err := notifier.Send(notify.EVENT_VERIFY, data); err != nil {
+		return ecode.ErrNotifyFailed
+	}
+	return nil
+}
+
+// loginFailed saves the failure counters after a bad login. If this failure locked the account,
+// the user is told.
+func loginFailed(s *ServiceProcess, user *tenant.User) {
+	s.UserStore.UserUpdate(user) // Try and save the error counters
+	if user.LockedOut {
+		data := newData(user)
+		if locked, wait := user.IsLocked(data.Time); locked && wait > 0 {
+			data.ExpiresAt = data.Time.Add(wait)
+		}
+		notifyUser(notify.EVENT_LOCKOUT, data)
+	}
+}
+
+// newData fills in the message values that come from the user record
+func newData(user *tenant.User) *notify.Data {
+	return &notify.Data{
+		Guid:   user.Guid,
+		Name:   user.FullName,
+		Login:  user.LoginName,
+		Email:  user.Email,
+		Domain: user.Domain,
+		Time:   time.Now(),
+	}
+}
+
+// newEvent fills in the webhook event values that come from the user record
+func newEvent(user *tenant.User) webhook.Event {
+	return webhook.Event{
+		Domain: user.Domain,
+		Guid:   user.Guid,
+		Login:  user.LoginName,
+		Email:  user.Email,
+	}
+}
+
+// fireWebhook queues the event for the services that want it. Like messages, events don't stop
+// the request if they can't be queued.
+func fireWebhook(eventType string, event webhook.Event) {
+	if hooks := webhook.Get(); hooks != nil {
+		hooks.Fire(eventType, event)
+	}
+}
+
+// notifyUser tells the user about something that has happened to their account. Messages are
+// a courtesy: if they are turned off, or can't be sent, the request still succeeds.
+func notifyUser(event string, data *notify.Data) {
+	if notifier := notify.Get(); notifier != nil {
+		notifier.Send(event, data)
+	}
+}
+
+// clientOptions copies the client's capabilities, other than the services it may call, into the
+// options so routines like update know what the client is allowed to do.
+func (s *ServiceProcess) clientOptions() {
+	for _, capability := range s.Client.CapabilityList() {
+		if !strings.HasPrefix(capability, tenant.CAPABILITY_SERVICE) {
+			s.Options[capability] = ""
+		}
+	}
+}
+
 func (s *ServiceProcess) boolOption(key string) bool {
 	_, ok := s.Options[key]
 	return ok
@@ -432,7 +1581,7 @@ func (s *ServiceProcess) PackageErr(err error) (record.Packer, error) {
 	var gerror ecode.ErrorCoder
 	var ok bool
 
-	if gerror, ok = err.(*ecode.GeneralError); !ok {
+	if gerror, ok = err.(ecode.ErrorCoder); !ok {
 		gerror = ecode.NewGeneralFromError(err, http.StatusInternalServerError)
 	}
 
@@ -0,0 +1,1022 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/encryption/drivers/plaintext"
+	"github.com/cgentry/gus/library/notify"
+	"github.com/cgentry/gus/library/notify/drivers/file"
+	"github.com/cgentry/gus/library/storage"
+	"github.com/cgentry/gus/library/storage/drivers/mock"
+	"github.com/cgentry/gus/library/ticket"
+	"github.com/cgentry/gus/library/totp"
+	"github.com/cgentry/gus/library/webauthn"
+	"github.com/cgentry/gus/library/webauthn/webauthntest"
+	"github.com/cgentry/gus/library/webhook"
+	"github.com/cgentry/gus/record/configure"
+	"github.com/cgentry/gus/record/request"
+	"github.com/cgentry/gus/record/response"
+	"github.com/cgentry/gus/record/tenant"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sessionLogin logs the user in and returns the token for the new session
+func sessionLogin(store storage.Storer, device string) (string, error) {
+	userRtn, err := sessionLoginReturn(store, device)
+	return userRtn.Token, err
+}
+
+// sessionLoginReturn logs the user in and returns the full login response
+func sessionLoginReturn(store storage.Storer, device string) (response.UserReturn, error) {
+	sl := NewServiceLogin()
+	sl.UserStore = store
+	sl.Client = generateCaller()
+
+	reqLogin := request.NewLogin()
+	reqLogin.Login = "*Session"
+	reqLogin.Password = "12345678abcdefg"
+	reqLogin.Device = device
+	sl.RequestBody = reqLogin
+
+	userRtn := response.UserReturn{}
+	pack, err := sl.Run(sl)
+	if gerr, ok := err.(ecode.ErrorCoder); ok && gerr.Code() != 200 {
+		return userRtn, err
+	}
+	err = json.Unmarshal([]byte(pack.GetBody()), &userRtn)
+	return userRtn, err
+}
+
+// sessionRun runs a service that only needs a token
+func sessionRun(store storage.Storer, srv *ServiceProcess, token string) (string, error) {
+	srv.UserStore = store
+	srv.Client = generateCaller()
+	switch body := srv.RequestBody.(type) {
+	case *request.Logout:
+		body.Token = token
+	case *request.Authenticate:
+		body.Token = token
+	}
+	pack, err := srv.Run(srv)
+	if gerr, ok := err.(ecode.ErrorCoder); ok && gerr.Code() == 200 {
+		err = nil
+	}
+	return pack.GetBody(), err
+}
+
+func TestServiceSessions(t *testing.T) {
+	mock.Register()
+	plaintext.Register()
+	plaintext.SetDefault()
+
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	user := tenant.NewUser()
+	user.SetDomain(`Test`)
+	user.SetLoginName(`*Session`)
+	user.SetPassword(`12345678abcdefg`)
+	store.UserInsert(user)
+
+	Convey("Each login has its own session", t, func() {
+		phone, err := sessionLogin(store, "phone")
+		So(err, ShouldBeNil)
+		laptop, err := sessionLogin(store, "laptop")
+		So(err, ShouldBeNil)
+		So(phone, ShouldNotEqual, laptop)
+
+		_, err = sessionRun(store, NewServiceAuthenticate(), phone)
+		So(err, ShouldBeNil)
+		_, err = sessionRun(store, NewServiceAuthenticate(), laptop)
+		So(err, ShouldBeNil)
+
+		body, err := sessionRun(store, NewServiceSessions(), phone)
+		So(err, ShouldBeNil)
+		So(body, ShouldNotContainSubstring, phone)
+		list := response.SessionList{}
+		So(json.Unmarshal([]byte(body), &list), ShouldBeNil)
+		So(len(list.Sessions), ShouldEqual, 2)
+		for _, session := range list.Sessions {
+			So(session.Current, ShouldEqual, session.Device == "phone")
+		}
+
+		Convey("Logout only ends one session", func() {
+			_, err = sessionRun(store, NewServiceLogout(), phone)
+			So(err, ShouldBeNil)
+			_, err = sessionRun(store, NewServiceAuthenticate(), phone)
+			So(err, ShouldEqual, ecode.ErrUserNotLoggedIn)
+			_, err = sessionRun(store, NewServiceAuthenticate(), laptop)
+			So(err, ShouldBeNil)
+
+			rec, _ := store.FetchUserByGUID(user.Guid)
+			So(rec.IsLoggedIn, ShouldBeTrue)
+
+			_, err = sessionRun(store, NewServiceLogout(), laptop)
+			So(err, ShouldBeNil)
+			rec, _ = store.FetchUserByGUID(user.Guid)
+			So(rec.IsLoggedIn, ShouldBeFalse)
+		})
+
+		Convey("Logout everywhere ends all sessions", func() {
+			_, err = sessionRun(store, NewServiceLogoutAll(), laptop)
+			So(err, ShouldBeNil)
+			_, err = sessionRun(store, NewServiceAuthenticate(), phone)
+			So(err, ShouldEqual, ecode.ErrUserNotLoggedIn)
+			_, err = sessionRun(store, NewServiceAuthenticate(), laptop)
+			So(err, ShouldEqual, ecode.ErrUserNotLoggedIn)
+
+			rec, _ := store.FetchUserByGUID(user.Guid)
+			So(rec.IsLoggedIn, ShouldBeFalse)
+		})
+
+		Convey("A disabled user's sessions stop working", func() {
+			rec, _ := store.FetchUserByGUID(user.Guid)
+			rec.Deactivate()
+			So(store.UserUpdate(rec), ShouldBeNil)
+			defer func() {
+				rec.Activate()
+				store.UserUpdate(rec)
+			}()
+
+			_, err = sessionRun(store, NewServiceAuthenticate(), phone)
+			So(err, ShouldEqual, ecode.ErrUserNotActive)
+			list, _ := store.SessionList(user.Guid)
+			So(list, ShouldBeEmpty)
+			_, err = sessionRun(store, NewServiceSessions(), laptop)
+			So(err, ShouldEqual, ecode.ErrUserNotLoggedIn)
+		})
+	})
+}
+
+func TestServiceTicket(t *testing.T) {
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	user := tenant.NewUser()
+	user.SetDomain(`Test`)
+	user.SetLoginName(`*Session`)
+	user.SetPassword(`12345678abcdefg`)
+	store.UserInsert(user)
+
+	Convey("No tickets unless they are turned on", t, func() {
+		ticket.Set(configure.Ticket{})
+		userRtn, err := sessionLoginReturn(store, "")
+		So(err, ShouldBeNil)
+		So(userRtn.Ticket, ShouldBeBlank)
+
+		_, err = sessionRun(store, NewServiceTicket(), userRtn.Token)
+		So(err, ShouldEqual, ecode.ErrTicketsOff)
+	})
+
+	Convey("Login returns a signed ticket", t, func() {
+		So(ticket.Set(configure.Ticket{Algorithm: ticket.ALG_EDDSA, Issuer: "gus"}), ShouldBeNil)
+		defer ticket.Set(configure.Ticket{})
+
+		userRtn, err := sessionLoginReturn(store, "")
+		So(err, ShouldBeNil)
+		So(userRtn.Ticket, ShouldNotBeBlank)
+
+		verify, _ := ticket.NewVerifier(ticket.Get().PublicKey())
+		claims, err := verify.Verify(userRtn.Ticket)
+		So(err, ShouldBeNil)
+		So(claims.Subject, ShouldEqual, user.Guid)
+		So(claims.Domain, ShouldEqual, `Test`)
+		So(claims.ExpiresAt, ShouldEqual, userRtn.TicketExpiresAt.Unix())
+
+		body, err := sessionRun(store, NewServiceTicket(), userRtn.Token)
+		So(err, ShouldBeNil)
+		rtn := response.Ticket{}
+		So(json.Unmarshal([]byte(body), &rtn), ShouldBeNil)
+		claims2, err := verify.Verify(rtn.Ticket)
+		So(err, ShouldBeNil)
+		So(claims2.SessionId, ShouldEqual, claims.SessionId)
+
+		_, err = sessionRun(store, NewServiceLogout(), userRtn.Token)
+		So(err, ShouldBeNil)
+		_, err = sessionRun(store, NewServiceTicket(), userRtn.Token)
+		So(err, ShouldEqual, ecode.ErrUserNotLoggedIn)
+	})
+}
+
+// sessionIntrospect runs introspection for the token as a system client
+func sessionIntrospect(store storage.Storer, token string) (response.Introspect, error) {
+	srv := NewServiceIntrospect()
+	srv.UserStore = store
+	srv.Client = generateCaller()
+	srv.Client.IsSystem = true
+	srv.RequestBody.(*request.Authenticate).Token = token
+
+	rtn := response.Introspect{}
+	pack, err := srv.Run(srv)
+	if gerr, ok := err.(ecode.ErrorCoder); ok && gerr.Code() != 200 {
+		return rtn, err
+	}
+	err = json.Unmarshal([]byte(pack.GetBody()), &rtn)
+	return rtn, err
+}
+
+func TestServiceIntrospect(t *testing.T) {
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	user := tenant.NewUser()
+	user.SetDomain(`Test`)
+	user.SetLoginName(`*Session`)
+	user.SetPassword(`12345678abcdefg`)
+	store.UserInsert(user)
+
+	Convey("Only system clients can introspect", t, func() {
+		token, err := sessionLogin(store, "")
+		So(err, ShouldBeNil)
+		_, err = sessionRun(store, NewServiceIntrospect(), token)
+		So(err, ShouldEqual, ecode.ErrNotSystemClient)
+	})
+
+	Convey("Introspection reports on the token without using it", t, func() {
+		token, err := sessionLogin(store, "phone")
+		So(err, ShouldBeNil)
+		before, _ := store.SessionFetch(token)
+		lastAuth := before.LastAuthAt
+
+		rtn, err := sessionIntrospect(store, token)
+		So(err, ShouldBeNil)
+		So(rtn.Active, ShouldBeTrue)
+		So(rtn.Guid, ShouldEqual, user.Guid)
+		So(rtn.Domain, ShouldEqual, `Test`)
+		So(rtn.LoginName, ShouldEqual, `*Session`)
+		So(rtn.ExpiresIn, ShouldBeGreaterThan, 0)
+		So(rtn.MaxExpiresIn, ShouldBeGreaterThanOrEqualTo, rtn.ExpiresIn)
+
+		after, _ := store.SessionFetch(token)
+		So(after.LastAuthAt.Equal(lastAuth), ShouldBeTrue)
+
+		_, err = sessionRun(store, NewServiceLogout(), token)
+		So(err, ShouldBeNil)
+		rtn, err = sessionIntrospect(store, token)
+		So(err, ShouldBeNil)
+		So(rtn.Active, ShouldBeFalse)
+		So(rtn.Guid, ShouldBeBlank)
+
+		rtn, err = sessionIntrospect(store, "not-a-token")
+		So(err, ShouldBeNil)
+		So(rtn.Active, ShouldBeFalse)
+	})
+}
+
+// sessionAuthorize asks whether the token's owner holds the permission
+func sessionAuthorize(store storage.Storer, token, permission, domain string, system bool) (response.Authorize, error) {
+	srv := NewServiceAuthorize()
+	srv.UserStore = store
+	srv.Client = generateCaller()
+	srv.Client.IsSystem = system
+	body := srv.RequestBody.(*request.Authorize)
+	body.Token = token
+	body.Permission = permission
+	body.Domain = domain
+
+	rtn := response.Authorize{}
+	pack, err := srv.Run(srv)
+	if gerr, ok := err.(ecode.ErrorCoder); ok && gerr.Code() != 200 {
+		return rtn, err
+	}
+	err = json.Unmarshal([]byte(pack.GetBody()), &rtn)
+	return rtn, err
+}
+
+func TestServiceAuthorize(t *testing.T) {
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	user := tenant.NewUser()
+	user.SetDomain(`Test`)
+	user.SetLoginName(`*Session`)
+	user.SetPassword(`12345678abcdefg`)
+	user.GrantRole("editor")
+	user.GrantPermission("billing.read")
+	store.UserInsert(user)
+
+	tenant.SetAccess(configure.Access{Roles: map[string]string{"editor": "pages.read, pages.write"}})
+	defer tenant.SetAccess(configure.Access{})
+
+	Convey("Permissions come from roles and are granted directly", t, func() {
+		token, err := sessionLogin(store, "")
+		So(err, ShouldBeNil)
+
+		rtn, err := sessionAuthorize(store, token, "Pages.Write", "", false)
+		So(err, ShouldBeNil)
+		So(rtn.Granted, ShouldBeTrue)
+		So(rtn.Permission, ShouldEqual, "pages.write")
+		So(rtn.Domain, ShouldEqual, `Test`)
+		So(rtn.Guid, ShouldEqual, user.Guid)
+
+		rtn, err = sessionAuthorize(store, token, "billing.read", "", false)
+		So(err, ShouldBeNil)
+		So(rtn.Granted, ShouldBeTrue)
+
+		rtn, err = sessionAuthorize(store, token, "billing.write", "", false)
+		So(err, ShouldBeNil)
+		So(rtn.Granted, ShouldBeFalse)
+		So(rtn.Guid, ShouldEqual, user.Guid)
+
+		// Only system clients can ask about another domain
+		_, err = sessionAuthorize(store, token, "pages.read", "Other", false)
+		So(err, ShouldEqual, ecode.ErrNotSystemClient)
+		rtn, err = sessionAuthorize(store, token, "pages.read", "Other", true)
+		So(err, ShouldBeNil)
+		So(rtn.Granted, ShouldBeFalse)
+		So(rtn.Guid, ShouldBeBlank)
+
+		rtn, err = sessionAuthorize(store, "not-a-token", "pages.read", "", false)
+		So(err, ShouldBeNil)
+		So(rtn.Granted, ShouldBeFalse)
+	})
+}
+
+func TestServiceCapabilities(t *testing.T) {
+	mock.Register()
+	plaintext.Register()
+	plaintext.SetDefault()
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	user := tenant.NewUser()
+	user.SetDomain(`Test`)
+	user.SetLoginName(`*Capable`)
+	user.SetName(`Capable User`)
+	user.SetPassword(`12345678abcdefg`)
+	store.UserInsert(user)
+
+	// update runs the update service for a client with the capabilities
+	update := func(token string, capabilities ...string) (*ServiceProcess, error) {
+		client := generateCaller()
+		for _, capability := range capabilities {
+			client.GrantCapability(capability)
+		}
+		srv := NewServiceUpdate()
+		srv.UserStore = store
+		srv.Client = client
+		srv.clientOptions()
+		body := srv.RequestBody.(*request.Update)
+		body.Token = token
+		body.Name = "Capable Renamed"
+		body.Email = "capable@example.com"
+		_, err := srv.Run(srv)
+		if gerr, ok := err.(ecode.ErrorCoder); ok && gerr.Code() == 200 {
+			err = nil
+		}
+		return srv, err
+	}
+
+	Convey("The client's capabilities decide what can be updated", t, func() {
+		userRtn, err := sessionLoginAs(store, "*Capable")
+		So(err, ShouldBeNil)
+
+		_, err = update(userRtn.Token)
+		So(err, ShouldEqual, ecode.ErrNoUpdateCapability)
+
+		srv, err := update(userRtn.Token, PERMIT_NAME, tenant.CAPABILITY_SERVICE+"update")
+		So(err, ShouldBeNil)
+		So(srv.Options, ShouldResemble, map[string]string{PERMIT_NAME: ""})
+		So(srv.Client.CanCallService(srv.Name), ShouldBeTrue)
+		So(srv.Client.CanCallService(NewServiceLogin().Name), ShouldBeFalse)
+
+		found, err := store.FetchUserByGUID(user.Guid)
+		So(err, ShouldBeNil)
+		store.Release()
+		So(found.FullName, ShouldEqual, "Capable Renamed")
+		So(found.Email, ShouldNotEqual, "capable@example.com")
+	})
+}
+
+// sessionRefresh trades in a refresh token
+func sessionRefresh(store storage.Storer, token string) (response.Refresh, error) {
+	srv := NewServiceRefresh()
+	srv.UserStore = store
+	srv.Client = generateCaller()
+	srv.RequestBody.(*request.Refresh).RefreshToken = token
+
+	rtn := response.Refresh{}
+	pack, err := srv.Run(srv)
+	if gerr, ok := err.(ecode.ErrorCoder); ok && gerr.Code() != 200 {
+		return rtn, err
+	}
+	err = json.Unmarshal([]byte(pack.GetBody()), &rtn)
+	return rtn, err
+}
+
+func TestServiceRefresh(t *testing.T) {
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	user := tenant.NewUser()
+	user.SetDomain(`Test`)
+	user.SetLoginName(`*Session`)
+	user.SetPassword(`12345678abcdefg`)
+	store.UserInsert(user)
+
+	Convey("Refresh tokens rotate", t, func() {
+		login, err := sessionLoginReturn(store, "phone")
+		So(err, ShouldBeNil)
+		So(login.RefreshToken, ShouldNotBeBlank)
+		So(login.RefreshExpiresAt.After(login.MaxSessionAt), ShouldBeTrue)
+
+		rtn, err := sessionRefresh(store, login.RefreshToken)
+		So(err, ShouldBeNil)
+		So(rtn.Token, ShouldNotBeBlank)
+		So(rtn.Token, ShouldNotEqual, login.Token)
+		So(rtn.RefreshToken, ShouldNotEqual, login.RefreshToken)
+
+		// The old session is replaced by the new one
+		_, err = sessionRun(store, NewServiceAuthenticate(), login.Token)
+		So(err, ShouldEqual, ecode.ErrUserNotLoggedIn)
+		_, err = sessionRun(store, NewServiceAuthenticate(), rtn.Token)
+		So(err, ShouldBeNil)
+
+		Convey("Reusing a refresh token ends the login", func() {
+			other, err := sessionLoginReturn(store, "laptop")
+			So(err, ShouldBeNil)
+
+			_, err = sessionRefresh(store, login.RefreshToken)
+			So(err, ShouldEqual, ecode.ErrRefreshReused)
+
+			_, err = sessionRun(store, NewServiceAuthenticate(), rtn.Token)
+			So(err, ShouldEqual, ecode.ErrUserNotLoggedIn)
+			_, err = sessionRefresh(store, rtn.RefreshToken)
+			So(err, ShouldEqual, ecode.ErrRefreshInvalid)
+
+			// Other logins are left alone
+			_, err = sessionRun(store, NewServiceAuthenticate(), other.Token)
+			So(err, ShouldBeNil)
+			_, err = sessionRefresh(store, other.RefreshToken)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Logout removes the refresh token", func() {
+			_, err = sessionRun(store, NewServiceLogout(), rtn.Token)
+			So(err, ShouldBeNil)
+			_, err = sessionRefresh(store, rtn.RefreshToken)
+			So(err, ShouldEqual, ecode.ErrRefreshInvalid)
+		})
+	})
+
+	Convey("Unknown refresh tokens are rejected", t, func() {
+		_, err := sessionRefresh(store, "not-a-token")
+		So(err, ShouldEqual, ecode.ErrRefreshInvalid)
+	})
+}
+
+// sessionLoginAs logs in with the login name and returns the full login response
+func sessionLoginAs(store storage.Storer, login string) (response.UserReturn, error) {
+	sl := NewServiceLogin()
+	sl.UserStore = store
+	sl.Client = generateCaller()
+	reqLogin := request.NewLogin()
+	reqLogin.Login = login
+	reqLogin.Password = "12345678abcdefg"
+	sl.RequestBody = reqLogin
+
+	userRtn := response.UserReturn{}
+	pack, err := sl.Run(sl)
+	if gerr, ok := err.(ecode.ErrorCoder); ok && gerr.Code() != 200 {
+		return userRtn, err
+	}
+	err = json.Unmarshal([]byte(pack.GetBody()), &userRtn)
+	return userRtn, err
+}
+
+// sessionFactor sends the second factor for a login that is waiting for one
+func sessionFactor(store storage.Storer, login, token, code string) (response.UserReturn, error) {
+	srv := NewServiceLoginFactor()
+	srv.UserStore = store
+	srv.Client = generateCaller()
+	req := srv.RequestBody.(*request.SecondFactor)
+	req.Login, req.Token, req.Code = login, token, code
+
+	userRtn := response.UserReturn{}
+	pack, err := srv.Run(srv)
+	if gerr, ok := err.(ecode.ErrorCoder); ok && gerr.Code() != 200 {
+		return userRtn, err
+	}
+	err = json.Unmarshal([]byte(pack.GetBody()), &userRtn)
+	return userRtn, err
+}
+
+func TestServiceTwoFactor(t *testing.T) {
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	user := tenant.NewUser()
+	user.SetDomain(`Test`)
+	user.SetLoginName(`*TwoFactor`)
+	user.SetPassword(`12345678abcdefg`)
+	store.UserInsert(user)
+
+	Convey("Two-factor can't be used without a field encryption key", t, func() {
+		storage.SetEncrypter(nil)
+		login, err := sessionLoginAs(store, "*TwoFactor")
+		So(err, ShouldBeNil)
+		_, err = sessionRun(store, NewServiceTotpEnroll(), login.Token)
+		So(err, ShouldEqual, ecode.ErrTwoFactorOff)
+	})
+
+	Convey("Enrolled users need a code to login", t, func() {
+		encrypter := storage.NewFieldEncrypter("test key")
+		storage.SetEncrypter(encrypter)
+		defer storage.SetEncrypter(nil)
+
+		login, err := sessionLoginAs(store, "*TwoFactor")
+		So(err, ShouldBeNil)
+		body, err := sessionRun(store, NewServiceTotpEnroll(), login.Token)
+		So(err, ShouldBeNil)
+		enroll := response.TotpEnroll{}
+		So(json.Unmarshal([]byte(body), &enroll), ShouldBeNil)
+		So(enroll.Uri, ShouldStartWith, "otpauth://totp/")
+
+		rec, _ := store.FetchUserByGUID(user.Guid)
+		So(rec.TotpSecret, ShouldNotEqual, enroll.Secret)
+		So(encrypter.Decrypt(rec.TotpSecret), ShouldEqual, enroll.Secret)
+
+		confirm := NewServiceTotpConfirm()
+		req := confirm.RequestBody.(*request.TotpConfirm)
+		req.Token = login.Token
+		req.Code, _ = totp.Code(enroll.Secret, totp.Step(time.Now()))
+		body, err = sessionRun(store, confirm, "")
+		So(err, ShouldBeNil)
+		codes := response.RecoveryCodes{}
+		So(json.Unmarshal([]byte(body), &codes), ShouldBeNil)
+		So(len(codes.Codes), ShouldEqual, tenant.RECOVERY_CODES)
+
+		first, err := sessionLoginAs(store, "*TwoFactor")
+		So(err, ShouldBeNil)
+		So(first.SecondFactorRequired, ShouldBeTrue)
+		So(first.Token, ShouldBeBlank)
+		So(first.Guid, ShouldBeBlank)
+		So(first.FactorToken, ShouldNotBeBlank)
+
+		_, err = sessionFactor(store, "*TwoFactor", first.FactorToken, "000000")
+		So(err, ShouldEqual, ecode.ErrSecondFactorInvalid)
+
+		first, _ = sessionLoginAs(store, "*TwoFactor")
+		done, err := sessionFactor(store, "*TwoFactor", first.FactorToken, codes.Codes[0])
+		So(err, ShouldBeNil)
+		So(done.Token, ShouldNotBeBlank)
+		So(done.Guid, ShouldEqual, user.Guid)
+		_, err = sessionRun(store, NewServiceAuthenticate(), done.Token)
+		So(err, ShouldBeNil)
+	})
+}
+
+// sessionPasskeyStart asks for a passkey login challenge
+func sessionPasskeyStart(store storage.Storer, login string) (response.PasskeyGet, error) {
+	srv := NewServicePasskeyStart()
+	srv.RequestBody.(*request.PasskeyStart).Login = login
+	rtn := response.PasskeyGet{}
+	body, err := sessionRun(store, srv, "")
+	if err == nil {
+		err = json.Unmarshal([]byte(body), &rtn)
+	}
+	return rtn, err
+}
+
+// sessionPasskeyLogin answers a passkey login challenge with the software passkey
+func sessionPasskeyLogin(store storage.Storer, login string, key *webauthntest.Authenticator, challenge string) (response.UserReturn, error) {
+	srv := NewServicePasskeyLogin()
+	req := srv.RequestBody.(*request.PasskeyLogin)
+	clientData, authData, sig := key.Assert(challenge)
+	req.Login = login
+	req.CredentialId = key.CredentialId()
+	req.ClientDataJSON = webauthn.EncodeBase64(clientData)
+	req.AuthenticatorData = webauthn.EncodeBase64(authData)
+	req.Signature = webauthn.EncodeBase64(sig)
+
+	userRtn := response.UserReturn{}
+	body, err := sessionRun(store, srv, "")
+	if err == nil {
+		err = json.Unmarshal([]byte(body), &userRtn)
+	}
+	return userRtn, err
+}
+
+func TestServicePasskey(t *testing.T) {
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	user := tenant.NewUser()
+	user.SetDomain(`Test`)
+	user.SetLoginName(`*Passkey`)
+	user.SetPassword(`12345678abcdefg`)
+	store.UserInsert(user)
+
+	Convey("Passkeys can't be used without a site", t, func() {
+		webauthn.Set(configure.Passkey{})
+		login, err := sessionLoginAs(store, "*Passkey")
+		So(err, ShouldBeNil)
+		_, err = sessionRun(store, NewServicePasskeyNew(), login.Token)
+		So(err, ShouldEqual, ecode.ErrPasskeysOff)
+		_, err = sessionPasskeyStart(store, "*Passkey")
+		So(err, ShouldEqual, ecode.ErrPasskeysOff)
+	})
+
+	Convey("A registered passkey can be used to login", t, func() {
+		webauthn.Set(configure.Passkey{RPId: "example.com"})
+		defer webauthn.Set(configure.Passkey{})
+		key := webauthntest.New("example.com", "https://example.com")
+
+		_, err := sessionPasskeyStart(store, "*Passkey")
+		So(err, ShouldEqual, ecode.ErrPasskeyNotFound)
+
+		login, err := sessionLoginAs(store, "*Passkey")
+		So(err, ShouldBeNil)
+		body, err := sessionRun(store, NewServicePasskeyNew(), login.Token)
+		So(err, ShouldBeNil)
+		create := response.PasskeyCreate{}
+		So(json.Unmarshal([]byte(body), &create), ShouldBeNil)
+		So(create.RPId, ShouldEqual, "example.com")
+		So(create.UserName, ShouldEqual, "*Passkey")
+		So(create.Algorithms, ShouldResemble, webauthn.Algorithms)
+		So(len(create.Exclude), ShouldEqual, 0)
+
+		add := func() (string, error) {
+			srv := NewServicePasskeyAdd()
+			req := srv.RequestBody.(*request.PasskeyAdd)
+			clientData, attestation := key.Register(create.Challenge)
+			req.Token = login.Token
+			req.Name = "phone"
+			req.ClientDataJSON = webauthn.EncodeBase64(clientData)
+			req.AttestationObject = webauthn.EncodeBase64(attestation)
+			return sessionRun(store, srv, "")
+		}
+		body, err = add()
+		So(err, ShouldBeNil)
+		passkey := response.Passkey{}
+		So(json.Unmarshal([]byte(body), &passkey), ShouldBeNil)
+		So(passkey.Id, ShouldEqual, key.CredentialId())
+		So(passkey.Name, ShouldEqual, "phone")
+		_, err = add()
+		So(err, ShouldEqual, ecode.ErrPasskeyChallenge)
+
+		get, err := sessionPasskeyStart(store, "*Passkey")
+		So(err, ShouldBeNil)
+		So(get.Allow, ShouldResemble, []string{key.CredentialId()})
+		done, err := sessionPasskeyLogin(store, "*Passkey", key, get.Challenge)
+		So(err, ShouldBeNil)
+		So(done.Guid, ShouldEqual, user.Guid)
+		So(done.Token, ShouldNotBeBlank)
+		_, err = sessionRun(store, NewServiceAuthenticate(), done.Token)
+		So(err, ShouldBeNil)
+
+		// Each challenge can only be answered once
+		_, err = sessionPasskeyLogin(store, "*Passkey", key, get.Challenge)
+		So(err, ShouldEqual, ecode.ErrPasskeyChallenge)
+
+		// A copied passkey is refused
+		get, _ = sessionPasskeyStart(store, "*Passkey")
+		key.Count = 0
+		_, err = sessionPasskeyLogin(store, "*Passkey", key, get.Challenge)
+		So(err, ShouldEqual, ecode.ErrPasskeyCloned)
+		rec, _ := store.FetchUserByGUID(user.Guid)
+		So(rec.FailCount, ShouldEqual, 2)
+	})
+}
+
+// sessionVerifyToken returns the token from the last verification message written to the file
+func sessionVerifyToken(fname string) string {
+	b, _ := ioutil.ReadFile(fname)
+	text := string(b)
+	at := strings.LastIndex(text, "token=")
+	if at < 0 {
+		return ""
+	}
+	text = text[at+len("token="):]
+	return text[:strings.Index(text, "\n")]
+}
+
+func TestServiceVerify(t *testing.T) {
+	mock.Register()
+	plaintext.Register()
+	plaintext.SetDefault()
+	file.Register()
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	fname := os.TempDir() + "/gus_service_verify_test.log"
+	os.Remove(fname)
+	defer os.Remove(fname)
+	defer notify.Set(configure.Notify{})
+
+	config := configure.New()
+	config.Verify.Required = true
+	config.Verify.Link = "https://example.com/verify?token="
+	register := func(login string) error {
+		srv := NewServiceRegister()
+		srv.Config = config
+		reg := srv.RequestBody.(*request.Register)
+		reg.Login, reg.Name, reg.Email, reg.Password = login, "Verify Me", login+"@example.com", "12345678abcdefg"
+		_, err := sessionRun(store, srv, "")
+		return err
+	}
+
+	Convey("Verification needs a notifier", t, func() {
+		So(notify.Set(configure.Notify{}), ShouldBeNil)
+		So(register("*NoNotify"), ShouldEqual, ecode.ErrNotifyOff)
+		_, err := sessionRun(store, NewServiceVerifyResend(), "")
+		So(err, ShouldEqual, ecode.ErrNotifyOff)
+	})
+
+	Convey("New users must verify before they login", t, func() {
+		So(notify.Set(configure.Notify{Name: file.DriverName, Options: `{"File": "` + fname + `"}`, From: "accounts@example.com"}), ShouldBeNil)
+		So(register("*Verify"), ShouldBeNil)
+		_, err := sessionLoginAs(store, "*Verify")
+		So(err, ShouldEqual, ecode.ErrUserNotActive)
+
+		first := sessionVerifyToken(fname)
+		So(first, ShouldNotBeBlank)
+
+		resend := NewServiceVerifyResend()
+		resend.Config = config
+		resend.RequestBody.(*request.VerifyResend).Login = "*Verify"
+		_, err = sessionRun(store, resend, "")
+		So(err, ShouldBeNil)
+		token := sessionVerifyToken(fname)
+		So(token, ShouldNotEqual, first)
+
+		verify := NewServiceVerify()
+		verify.RequestBody.(*request.Verify).Token = first
+		_, err = sessionRun(store, verify, "")
+		So(err, ShouldEqual, ecode.ErrInvalidVerifyToken)
+		verify.RequestBody.(*request.Verify).Token = token
+		_, err = sessionRun(store, verify, "")
+		So(err, ShouldBeNil)
+		_, err = sessionRun(store, verify, "")
+		So(err, ShouldEqual, ecode.ErrInvalidVerifyToken)
+
+		_, err = sessionLoginAs(store, "*Verify")
+		So(err, ShouldBeNil)
+
+		// Active users don't get another message. Only system clients are told why.
+		_, err = sessionRun(store, resend, "")
+		So(err, ShouldBeNil)
+		So(sessionVerifyToken(fname), ShouldEqual, token)
+		resend.Client = generateCaller()
+		resend.Client.IsSystem = true
+		_, err = resend.Run(resend)
+		So(err, ShouldEqual, ecode.ErrUserActive)
+	})
+}
+
+// sessionEvents returns the events written to the notify file, in order
+func sessionEvents(fname string) []string {
+	var events []string
+	b, _ := ioutil.ReadFile(fname)
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "Event: ") {
+			events = append(events, strings.TrimPrefix(line, "Event: "))
+		}
+	}
+	return events
+}
+
+func TestServiceNotify(t *testing.T) {
+	mock.Register()
+	plaintext.Register()
+	plaintext.SetDefault()
+	file.Register()
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	fname := os.TempDir() + "/gus_service_notify_test.log"
+	os.Remove(fname)
+	defer os.Remove(fname)
+	defer notify.Set(configure.Notify{})
+	defer tenant.SetLockout(configure.Lockout{})
+
+	config := configure.New()
+	config.Notify.Name = file.DriverName
+	config.Notify.Options = `{"File": "` + fname + `"}`
+	config.Notify.ResetLink = "https://example.com/reset?token="
+	if err = notify.Set(config.Notify); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Users are told about changes to their account", t, func() {
+		os.Remove(fname)
+		srv := NewServiceRegister()
+		srv.Config = config
+		reg := srv.RequestBody.(*request.Register)
+		reg.Login, reg.Name, reg.Email, reg.Password = "*Notify", "Notify Me", "notify@example.com", "12345678abcdefg"
+		_, err := sessionRun(store, srv, "")
+		So(err, ShouldBeNil)
+		So(sessionEvents(fname), ShouldResemble, []string{notify.EVENT_REGISTER})
+
+		userRtn, err := sessionLoginAs(store, "*Notify")
+		So(err, ShouldBeNil)
+		upd := NewServiceUpdate()
+		upd.Options = map[string]string{PERMIT_ALL: ""}
+		body := upd.RequestBody.(*request.Update)
+		body.Token = userRtn.Token
+		body.Email = "changed@example.com"
+		body.OldPassword, body.NewPassword = "12345678abcdefg", "Notify-Changed-9x7q"
+		_, err = sessionRun(store, upd, "")
+		So(err, ShouldBeNil)
+		So(sessionEvents(fname), ShouldResemble, []string{notify.EVENT_REGISTER, notify.EVENT_EMAIL, notify.EVENT_PASSWORD})
+		b, _ := ioutil.ReadFile(fname)
+		So(string(b), ShouldContainSubstring, "To: notify@example.com\n")
+		So(string(b), ShouldContainSubstring, "changed to changed@example.com")
+
+		_, err = sessionRun(store, NewServiceLogout(), userRtn.Token)
+		So(err, ShouldBeNil)
+		reset := NewServiceResetRequest()
+		reset.Config = config
+		reset.RequestBody.(*request.ResetRequest).Login = "*Notify"
+		_, err = sessionRun(store, reset, "")
+		So(err, ShouldBeNil)
+		So(sessionEvents(fname)[3], ShouldEqual, notify.EVENT_RESET)
+		b, _ = ioutil.ReadFile(fname)
+		So(string(b), ShouldContainSubstring, "To: changed@example.com\n")
+		So(string(b), ShouldContainSubstring, "https://example.com/reset?token=")
+
+		// Only the failure that locks the account sends a message
+		tenant.SetLockout(configure.Lockout{MaxFailures: 2, Window: 15, Backoff: 1})
+		for i := 0; i < 3; i++ {
+			login := NewServiceLogin()
+			login.RequestBody.(*request.Login).Login = "*Notify"
+			login.RequestBody.(*request.Login).Password = "bad password"
+			_, err = sessionRun(store, login, "")
+			So(err, ShouldNotBeNil)
+		}
+		events := sessionEvents(fname)
+		So(len(events), ShouldEqual, 5)
+		So(events[4], ShouldEqual, notify.EVENT_LOCKOUT)
+		b, _ = ioutil.ReadFile(fname)
+		So(string(b), ShouldContainSubstring, "You can try again after")
+	})
+}
+
+func TestServiceWebhook(t *testing.T) {
+	mock.Register()
+	plaintext.Register()
+	plaintext.SetDefault()
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	var mu sync.Mutex
+	var events []*webhook.Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if e, err := webhook.Open(body, []byte("hook secret")); err == nil {
+			mu.Lock()
+			events = append(events, e)
+			mu.Unlock()
+		}
+	}))
+	defer server.Close()
+	defer webhook.Set(configure.Webhook{})
+
+	err = webhook.Set(configure.Webhook{Hooks: map[string]configure.WebhookHook{
+		"test": {Url: server.URL, Secret: "hook secret"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliver := func() []string {
+		webhook.Get().Deliver(time.Now())
+		mu.Lock()
+		defer mu.Unlock()
+		var types []string
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		return types
+	}
+
+	Convey("Other services are told about user changes", t, func() {
+		srv := NewServiceRegister()
+		reg := srv.RequestBody.(*request.Register)
+		reg.Login, reg.Name, reg.Email, reg.Password = "*Webhook", "Hook Me", "hook@example.com", "12345678abcdefg"
+		_, err := sessionRun(store, srv, "")
+		So(err, ShouldBeNil)
+		So(deliver(), ShouldResemble, []string{webhook.EVENT_REGISTER})
+		So(events[0].Login, ShouldEqual, "*Webhook")
+		So(events[0].Guid, ShouldNotBeBlank)
+
+		userRtn, err := sessionLoginAs(store, "*Webhook")
+		So(err, ShouldBeNil)
+		upd := NewServiceUpdate()
+		upd.Options = map[string]string{PERMIT_EMAIL: ""}
+		upd.RequestBody.(*request.Update).Token = userRtn.Token
+		upd.RequestBody.(*request.Update).Email = "moved@example.com"
+		_, err = sessionRun(store, upd, "")
+		So(err, ShouldBeNil)
+		So(deliver(), ShouldResemble, []string{webhook.EVENT_REGISTER, webhook.EVENT_EMAIL})
+		So(events[1].Email, ShouldEqual, "moved@example.com")
+		So(events[1].OldEmail, ShouldEqual, "hook@example.com")
+
+		_, err = sessionRun(store, NewServiceLogout(), userRtn.Token)
+		So(err, ShouldBeNil)
+		So(deliver(), ShouldResemble, []string{webhook.EVENT_REGISTER, webhook.EVENT_EMAIL, webhook.EVENT_LOGOUT})
+	})
+}
+
+// sessionReset asks for a lost password reset. Only a system client is given the token.
+func sessionReset(store storage.Storer, login string, system bool) (string, error) {
+	srv := NewServiceResetRequest()
+	srv.UserStore = store
+	srv.Client = generateCaller()
+	srv.Client.IsSystem = system
+	srv.RequestBody.(*request.ResetRequest).Login = login
+
+	rtn := response.Reset{}
+	pack, err := srv.Run(srv)
+	if gerr, ok := err.(ecode.ErrorCoder); ok && gerr.Code() != 200 {
+		return "", err
+	}
+	err = json.Unmarshal([]byte(pack.GetBody()), &rtn)
+	return rtn.Token, err
+}
+
+// sessionResetConfirm sets a new password with the reset token
+func sessionResetConfirm(store storage.Storer, token, password string) error {
+	srv := NewServiceResetConfirm()
+	body := srv.RequestBody.(*request.ResetConfirm)
+	body.Token = token
+	body.NewPassword = password
+	_, err := sessionRun(store, srv, "")
+	return err
+}
+
+func TestServiceReset(t *testing.T) {
+	mock.Register()
+	plaintext.Register()
+	plaintext.SetDefault()
+
+	store, err := storage.Open(mock.DriverName, "", "")
+	if err != nil {
+		t.Errorf("Error opening store: %s", err.Error())
+	}
+	user := tenant.NewUser()
+	user.SetDomain(`Test`)
+	user.SetLoginName(`*Reset`)
+	user.SetPassword(`12345678abcdefg`)
+	store.UserInsert(user)
+
+	Convey("Logged in users can reset and the reset ends their sessions", t, func() {
+		userRtn, err := sessionLoginAs(store, "*Reset")
+		So(err, ShouldBeNil)
+
+		token, err := sessionReset(store, "*Reset", false)
+		So(err, ShouldBeNil)
+		So(token, ShouldBeBlank)
+		token, err = sessionReset(store, "*Nobody", false)
+		So(err, ShouldBeNil)
+		So(token, ShouldBeBlank)
+
+		token, err = sessionReset(store, "*Reset", true)
+		So(err, ShouldBeNil)
+		So(sessionResetConfirm(store, token, "Reset-Password-3x7u"), ShouldBeNil)
+		_, err = sessionRun(store, NewServiceAuthenticate(), userRtn.Token)
+		So(err, ShouldEqual, ecode.ErrUserNotLoggedIn)
+		list, _ := store.SessionList(user.Guid)
+		So(list, ShouldBeEmpty)
+
+		rec, _ := store.FetchUserByGUID(user.Guid)
+		So(rec.IsLoggedIn, ShouldBeFalse)
+		rec.SetPassword(`12345678abcdefg`)
+		store.UserUpdate(rec)
+	})
+
+	Convey("Only the hash of the reset token is stored", t, func() {
+		token, err := sessionReset(store, "*Reset", true)
+		So(err, ShouldBeNil)
+		So(token, ShouldNotBeBlank)
+		rec, _ := store.FetchUserByGUID(user.Guid)
+		So(rec.ResetToken, ShouldEqual, tenant.HashToken(token))
+
+		So(sessionResetConfirm(store, rec.ResetToken, "Reset-Password-4z8w"), ShouldEqual, ecode.ErrInvalidResetToken)
+		So(sessionResetConfirm(store, "", "Reset-Password-4z8w"), ShouldEqual, ecode.ErrInvalidResetToken)
+		So(sessionResetConfirm(store, token, "Reset-Password-4z8w"), ShouldBeNil)
+		So(sessionResetConfirm(store, token, "Reset-Password-5y9v"), ShouldEqual, ecode.ErrInvalidResetToken)
+
+		rec, _ = store.FetchUserByGUID(user.Guid)
+		So(rec.CheckPassword("Reset-Password-4z8w"), ShouldBeNil)
+		So(rec.ResetToken, ShouldBeBlank)
+	})
+}
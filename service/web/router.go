@@ -9,6 +9,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/cgentry/gus/ecode"
+	"github.com/cgentry/gus/library/keystore"
+	"github.com/cgentry/gus/library/ticket"
 	"github.com/cgentry/gus/record"
 	"github.com/cgentry/gus/record/configure"
 	"github.com/cgentry/gus/service"
@@ -23,14 +25,41 @@ import (
 const (
 	SRV_REGISTER = "/register/"
 	SRV_LOGIN    = "/login/"
+	SRV_FACTOR   = "/login/factor/" // Second step of a two-factor login
 	SRV_LOGOUT   = "/logout/"
+	SRV_LOGOUTS  = "/logout/all/" // Logout of every session
+	SRV_SESSIONS = "/sessions/"
+	SRV_TICKET   = "/ticket/"
+	SRV_REFRESH  = "/refresh/"
+	SRV_KEYS     = "/keys/" // Public signing keys (JWKS)
 	SRV_AUTH     = "/authenticate/"
+	SRV_INSPECT  = "/introspect/" // Read-only token check for system clients
+	SRV_ALLOW    = "/authorize/"  // Does a token's owner hold a permission
 	SRV_ENABLE   = "/enable/"
 	SRV_DISABLE  = "/disable/"
 	SRV_PING     = "/ping/"
 	SRV_UPDATE   = "/update/"
 	SRV_HOME     = "/"
 	SRV_TEST     = "/test/"
+	SRV_RESET    = "/reset/"
+	SRV_CONFIRM  = "/reset/confirm/"
+	SRV_2FA_ADD  = "/2fa/enroll/"
+	SRV_2FA_CONF = "/2fa/confirm/"
+	SRV_PK_NEW   = "/passkey/new/" // Challenge for registering a passkey
+	SRV_PK_ADD   = "/passkey/add/"
+	SRV_PK_START = "/passkey/start/" // Challenge for a passkey login
+	SRV_PK_LOGIN = "/passkey/login/"
+	SRV_VERIFY   = "/verify/"
+	SRV_RESEND   = "/verify/resend/" // Send another verification message
+	SRV_ADM_SHOW = "/admin/show/" // Admin services for system clients with the admin capability
+	SRV_ADM_ON   = "/admin/enable/"
+	SRV_ADM_OFF  = "/admin/disable/"
+	SRV_ADM_OUT  = "/admin/logout/"
+	SRV_ADM_PWD  = "/admin/password/"
+	SRV_ADM_DOM  = "/admin/domain/"
+	SRV_ADM_DEL  = "/admin/delete/"
+	SRV_ADM_BACK = "/admin/restore/"
+	SRV_ADM_LIST = "/admin/list/"
 
 	GUS_VERSION = "0.1"
 )
@@ -51,13 +80,40 @@ type RouteTable map[string]RouteService
 var RouteMap = RouteTable{
 	SRV_REGISTER: {Handler: httpCallService, Server: service.NewServiceRegister},
 	SRV_LOGIN:    {Handler: httpCallService, Server: service.NewServiceLogin},
+	SRV_FACTOR:   {Handler: httpCallService, Server: service.NewServiceLoginFactor},
 	SRV_LOGOUT:   {Handler: httpCallService, Server: service.NewServiceLogout},
+	SRV_LOGOUTS:  {Handler: httpCallService, Server: service.NewServiceLogoutAll},
+	SRV_SESSIONS: {Handler: httpCallService, Server: service.NewServiceSessions},
+	SRV_TICKET:   {Handler: httpCallService, Server: service.NewServiceTicket},
+	SRV_REFRESH:  {Handler: httpCallService, Server: service.NewServiceRefresh},
 	SRV_AUTH:     {Handler: httpCallService, Server: service.NewServiceAuthenticate},
+	SRV_INSPECT:  {Handler: httpCallService, Server: service.NewServiceIntrospect},
+	SRV_ALLOW:    {Handler: httpCallService, Server: service.NewServiceAuthorize},
 	SRV_UPDATE:   {Handler: httpCallService, Server: service.NewServiceUpdate},
 	SRV_TEST:     {Handler: httpCallService, Server: service.NewServiceTest},
+	SRV_RESET:    {Handler: httpCallService, Server: service.NewServiceResetRequest},
+	SRV_CONFIRM:  {Handler: httpCallService, Server: service.NewServiceResetConfirm},
+	SRV_2FA_ADD:  {Handler: httpCallService, Server: service.NewServiceTotpEnroll},
+	SRV_2FA_CONF: {Handler: httpCallService, Server: service.NewServiceTotpConfirm},
+	SRV_PK_NEW:   {Handler: httpCallService, Server: service.NewServicePasskeyNew},
+	SRV_PK_ADD:   {Handler: httpCallService, Server: service.NewServicePasskeyAdd},
+	SRV_PK_START: {Handler: httpCallService, Server: service.NewServicePasskeyStart},
+	SRV_PK_LOGIN: {Handler: httpCallService, Server: service.NewServicePasskeyLogin},
+	SRV_VERIFY:   {Handler: httpCallService, Server: service.NewServiceVerify},
+	SRV_RESEND:   {Handler: httpCallService, Server: service.NewServiceVerifyResend},
+	SRV_ADM_SHOW: {Handler: httpCallService, Server: service.NewServiceAdminShow},
+	SRV_ADM_ON:   {Handler: httpCallService, Server: service.NewServiceAdminEnable},
+	SRV_ADM_OFF:  {Handler: httpCallService, Server: service.NewServiceAdminDisable},
+	SRV_ADM_OUT:  {Handler: httpCallService, Server: service.NewServiceAdminLogout},
+	SRV_ADM_PWD:  {Handler: httpCallService, Server: service.NewServiceAdminPassword},
+	SRV_ADM_DOM:  {Handler: httpCallService, Server: service.NewServiceAdminDomain},
+	SRV_ADM_DEL:  {Handler: httpCallService, Server: service.NewServiceAdminDelete},
+	SRV_ADM_BACK: {Handler: httpCallService, Server: service.NewServiceAdminRestore},
+	SRV_ADM_LIST: {Handler: httpCallService, Server: service.NewServiceAdminList},
 	//SRV_ENABLE:   {Handler: httpCallService , Server: service.NewServiceEnable } ,
 	//SRV_DISABLE:  {Handler: httpCallService , Server: service.NewServiceDisable },
 	SRV_PING: {Handler: httpPing, Server: nil},
+	SRV_KEYS: {Handler: httpKeys, Server: nil},
 	SRV_HOME: {Handler: httpHome, Server: nil},
 }
 
@@ -108,6 +164,31 @@ func httpPing(c *configure.Configure, rhandle RouteService, name string, w http.
 	return
 }
 
+// httpKeys returns the public keys as a JSON Web Key Set. These are the keys in the key store
+// that have not been retired, plus the key used for EdDSA tickets. It is a plain JWKS document,
+// not a package, so standard JWT libraries can read it.
+func httpKeys(c *configure.Configure, rhandle RouteService, name string, w http.ResponseWriter, r *http.Request) {
+	set := &keystore.JWKSet{Keys: []keystore.JWK{}}
+	if keys := keystore.Get(); keys != nil {
+		set = keys.JWKS()
+	}
+	if signer := ticket.Get(); signer != nil && signer.Algorithm() == ticket.ALG_EDDSA {
+		if jwk, ok := keystore.NewJWK(signer.KeyId(), signer.PublicKey()); ok {
+			set.Add(jwk)
+		}
+	}
+	body, err := json.Marshal(set)
+	if err != nil {
+		httpErrorWrite(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "max-age=300") // Keys change rarely; a rotation is seen within minutes
+	w.Header().Set("Server", "gus/"+GUS_VERSION)
+	w.Write(body)
+	return
+}
+
 // httpHome is one of the route routines that will simply return an error if the pattern doesn't match antyhing
 func httpHome(c *configure.Configure, rhandle RouteService, name string, w http.ResponseWriter, r *http.Request) {
 	httpErrorWrite(w, 404, "Invalid page request '"+r.URL.Path+"'")
@@ -163,7 +244,10 @@ func httpResponseWrite(w http.ResponseWriter, responsePackage record.Packer, err
 		err = ecode.ErrStatusOk
 	}
 	w.Header().Set("Message", err.Error())
-	errInternal, ok := err.(*ecode.GeneralError)
+	if errRetry, ok := err.(ecode.RetryErrorCoder); ok && errRetry.RetryAfter() > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(errRetry.RetryAfter()))
+	}
+	errInternal, ok := err.(ecode.ErrorCoder)
 	if ok {
 		w.WriteHeader(errInternal.Code())
 	}